@@ -0,0 +1,186 @@
+// fake-mcp-server 用于联调和 CI 的最小 MCP Server：通过 stdin/stdout 按行收发 JSON-RPC，
+// 实现 initialize、tools/list、tools/call，不依赖 Python 环境和 Java 商城。
+//
+// 工具行为固定，便于覆盖 MCPClient 与 ToolExecutor 的各种路径：
+//   - search_product: 立即返回 JSON 商品列表（成功）
+//   - create_order:   返回"✅ 订单创建成功"文本，包含固定订单号
+//   - query_order:    按 FAKE_MCP_SLOW_DELAY（默认 1m）延迟后才返回，用于验证超时
+//   - cancel_order:   返回 JSON-RPC 错误
+//   - 其他工具:       返回"方法不存在"错误
+//
+// FAKE_MCP_SILENT_METHODS（逗号分隔，如 tools/list）中的方法只接收不响应，用于模拟不回复的服务端。
+//
+// 用法: go build -o fake-mcp-server ./cmd/fake-mcp-server，然后设置 MCP_SERVER_COMMAND=./fake-mcp-server
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// request JSON-RPC 请求或通知（通知没有 ID）
+type request struct {
+	ID     *int            `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcError JSON-RPC 错误
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC 标准错误码
+const (
+	codeMethodNotFound = -32601
+	codeInternalError  = -32603
+)
+
+// fakeOrderNumber create_order 返回的固定订单号
+const fakeOrderNumber = "ORD-FAKE-0001"
+
+// tools tools/list 返回的工具定义
+var tools = []map[string]interface{}{
+	{"name": "search_product", "description": "搜索商品（立即返回）", "inputSchema": schema("keyword")},
+	{"name": "create_order", "description": "创建订单（返回固定订单号）", "inputSchema": schema("productName", "quantity", "customerName", "customerPhone", "shippingAddress")},
+	{"name": "query_order", "description": "查询订单（延迟返回，用于验证超时）", "inputSchema": schema("orderNumber")},
+	{"name": "cancel_order", "description": "取消订单（总是返回错误）", "inputSchema": schema("orderNumber")},
+}
+
+// out 串行写 stdout，慢工具在单独的 goroutine 中响应
+var out = struct {
+	sync.Mutex
+	w *bufio.Writer
+}{w: bufio.NewWriter(os.Stdout)}
+
+func main() {
+	// 日志写 stderr，由 MCPClient 转发到服务日志
+	log.SetOutput(os.Stderr)
+	log.SetFlags(0)
+
+	slowDelay := time.Minute
+	if value := os.Getenv("FAKE_MCP_SLOW_DELAY"); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("FAKE_MCP_SLOW_DELAY 格式错误: %v", err)
+		}
+		slowDelay = delay
+	}
+
+	silent := make(map[string]bool)
+	for _, method := range strings.Split(os.Getenv("FAKE_MCP_SILENT_METHODS"), ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			silent[method] = true
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			log.Printf("无法解析请求: %v", err)
+			continue
+		}
+		if req.ID == nil {
+			// 通知（如 notifications/initialized）无需响应
+			continue
+		}
+		if silent[req.Method] {
+			log.Printf("按 FAKE_MCP_SILENT_METHODS 不响应: %s (ID: %d)", req.Method, *req.ID)
+			continue
+		}
+		handle(*req.ID, req.Method, req.Params, slowDelay)
+	}
+}
+
+// handle 处理一个请求并写回响应
+func handle(id int, method string, params json.RawMessage, slowDelay time.Duration) {
+	switch method {
+	case "initialize":
+		respond(id, map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "fake-mcp-server", "version": "1.0.0"},
+		}, nil)
+	case "tools/list":
+		respond(id, map[string]interface{}{"tools": tools}, nil)
+	case "tools/call":
+		var call struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &call); err != nil {
+			respond(id, nil, &rpcError{Code: codeInternalError, Message: "参数格式错误: " + err.Error()})
+			return
+		}
+		callTool(id, call.Name, call.Arguments, slowDelay)
+	default:
+		respond(id, nil, &rpcError{Code: codeMethodNotFound, Message: "Method not found: " + method})
+	}
+}
+
+// callTool 按工具名返回固定的结果
+func callTool(id int, name string, args map[string]interface{}, slowDelay time.Duration) {
+	switch name {
+	case "search_product":
+		products, _ := json.Marshal([]map[string]interface{}{
+			{"id": 1, "name": fmt.Sprintf("%v", args["keyword"]), "price": 99.9, "stock": 10, "category": "测试"},
+		})
+		respond(id, textResult(string(products)), nil)
+	case "create_order":
+		respond(id, textResult(fmt.Sprintf("✅ 订单创建成功！\n\n订单号：%s\n商品：%v\n数量：%v", fakeOrderNumber, args["productName"], args["quantity"])), nil)
+	case "query_order":
+		go func() {
+			time.Sleep(slowDelay)
+			respond(id, textResult(fmt.Sprintf("订单号：%v\n状态：PENDING", args["orderNumber"])), nil)
+		}()
+	case "cancel_order":
+		respond(id, nil, &rpcError{Code: codeInternalError, Message: "取消订单失败：模拟的服务端错误"})
+	default:
+		respond(id, nil, &rpcError{Code: codeMethodNotFound, Message: "Unknown tool: " + name})
+	}
+}
+
+// textResult tools/call 的文本结果
+func textResult(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+	}
+}
+
+// schema 所有参数均为必填字符串的简化 inputSchema
+func schema(required ...string) map[string]interface{} {
+	properties := make(map[string]interface{}, len(required))
+	for _, name := range required {
+		properties[name] = map[string]string{"type": "string"}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// respond 写一条 JSON-RPC 响应
+func respond(id int, result interface{}, rpcErr *rpcError) {
+	message := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		message["error"] = rpcErr
+	} else {
+		message["result"] = result
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("序列化响应失败: %v", err)
+		return
+	}
+
+	out.Lock()
+	defer out.Unlock()
+	out.w.Write(append(data, '\n'))
+	out.w.Flush()
+}
@@ -2,7 +2,12 @@ package config
 
 import (
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config 应用配置
@@ -12,10 +17,253 @@ type Config struct {
 	ChromaPort      string
 	JavaShopURL     string
 	Port            string
+
+	// HTTP 连接池配置（DashScope 与 Chroma 客户端共享）
+	// MaxIdleConnsPerHost 应不小于并发请求数，否则高并发时空闲连接会被关闭并重新握手
+	HTTPMaxIdleConns        int
+	HTTPMaxIdleConnsPerHost int
+	HTTPMaxConnsPerHost     int // 0 表示不限制
+	HTTPIdleConnTimeout     time.Duration
+	HTTPTimeout             time.Duration
+
+	// MCP 工具调用策略覆盖（按工具名称配置，未配置的使用默认值）
+	ToolTimeouts map[string]time.Duration
+	ToolRetries  map[string]int
+
+	// 只读工具（查询订单、搜索商品等）结果的短时缓存
+	ToolCacheEnabled bool
+	ToolCacheTTL     time.Duration
+
+	// 就绪检查要求 MCP Server 必须声明的工具，以及工具列表的缓存时间
+	MCPRequiredTools map[string]bool
+	MCPToolsCacheTTL time.Duration
+
+	// 嵌入模型最大输入 token 数（超出时截断重试）
+	EmbeddingMaxTokens int
+
+	// 批量嵌入失败后的重试次数与间隔；EmbeddingSkipFailed 开启时拆分失败批次，仅跳过出错的文档
+	EmbeddingRetries    int
+	EmbeddingRetryDelay time.Duration
+	EmbeddingSkipFailed bool
+
+	// 导入知识库时同时进行的批量嵌入请求数上限
+	EmbeddingConcurrency int
+
+	// 嵌入请求的超时时间（与聊天请求使用的 HTTPTimeout 相互独立），0 表示沿用 HTTPTimeout
+	EmbeddingTimeout time.Duration
+
+	// POST /embed 单次请求最多的文本数
+	EmbedMaxTexts int
+
+	// 多查询检索时并发查询 Chroma 的上限
+	RAGQueryConcurrency int
+
+	// 发送给 LLM 的上下文 token 预算（超出时丢弃最早的历史轮次）
+	ContextTokenBudget int
+
+	// "仅咨询"模式：禁用创建/取消订单，引导用户前往网站操作
+	AdvisoryOnly bool
+
+	// 工具安全模式（故障期间的总开关）：ToolsReadOnly 拦截创建/取消订单，ToolsDisabled 拦截所有工具
+	ToolsReadOnly bool
+	ToolsDisabled bool
+
+	// 每个用户在时间窗口内最多可通过对话创建/取消订单的次数（按工具分别计数，0 表示不限制）
+	ToolRateLimit  int
+	ToolRateWindow time.Duration
+
+	// 欢迎语：开启后空消息的初始化请求返回 GreetingMessage（不调用 LLM），关闭时空消息仍返回 400
+	GreetingEnabled bool
+	GreetingMessage string
+
+	// FAQ 快速通道：常见问题命中高置信度知识库文档时直接返回，不调用 LLM
+	// FAQMinRelevance 为最低相关度（0~1，与距离度量无关），未配置时按 FAQDistanceThreshold（原始距离）换算
+	FAQFastPath          bool
+	FAQDistanceThreshold float64
+	FAQMinRelevance      float64
+
+	// 合并完全相同的并发 LLM 请求（singleflight）
+	LLMCoalesceRequests bool
+
+	// 启用的工具列表（为空表示全部启用）
+	EnabledTools map[string]bool
+
+	// 管理接口（如 /tools）的 API Key，未配置时管理接口拒绝访问
+	AdminAPIKey string
+
+	// 在回复中标注知识库引用并附上参考资料列表；CitationsShowRelevance 开启时参考资料标注相关度
+	CitationsEnabled       bool
+	CitationsShowRelevance bool
+
+	// 回复依据判断：相关度不低于 GroundingMinRelevance 的文档中，回复有不少于 GroundingMinOverlap 比例的字词
+	// 出现在文档里时，回复标记为 grounded
+	GroundingMinRelevance float64
+	GroundingMinOverlap   float64
+
+	// 知识库检索结果的 LLM 重排序（会额外增加一次 LLM 调用）
+	RAGRerank           bool
+	RAGRerankCandidates int
+	RAGRerankModel      string
+
+	// LLM 生成参数：决定/提取阶段使用低温度，总结工具结果阶段使用较高温度
+	DecideTemperature    float64
+	DecideTopP           float64
+	SummarizeTemperature float64
+	SummarizeTopP        float64
+
+	// LLM 停止序列：生成内容遇到任一序列时停止（如 </func_call>，工具调用后不再继续输出；默认不设置）
+	LLMStopSequences []string
+
+	// 按模型覆盖 DashScope 请求的 input 格式（model=messages|prompt|array），未配置的模型使用内置能力表
+	LLMModelInputShapes map[string]string
+
+	// 回复长度控制：超出 ReplyMaxLength 字时在句末截断（0 表示不限制），ConciseReplies 要求模型简洁回答
+	ReplyMaxLength int
+	ConciseReplies bool
+
+	// 知识库集合不存在时自动创建，ChromaHNSWSpace 为向量距离度量（cosine/l2/ip）
+	ChromaAutoCreate bool
+	ChromaHNSWSpace  string
+
+	// 解读检索距离所用的度量（cosine/l2/ip），默认与 ChromaHNSWSpace 相同；连接已有集合且度量不同时单独配置
+	ChromaDistanceMetric string
+
+	// Chroma 默认 tenant/database；MerchantScopes 为 商户凭证→tenant/database 映射，
+	// 请求携带已配置的商户凭证（X-Merchant-Key）时检索和导入该商户自己的知识库
+	ChromaTenant   string
+	ChromaDatabase string
+	MerchantScopes map[string]ChromaScope
+
+	// 默认知识库集合；ChromaRequestCollections 为聊天请求可通过 collection 字段切换的集合白名单（如 A/B 测试新旧 FAQ）
+	ChromaCollection         string
+	ChromaRequestCollections map[string]bool
+
+	// Chroma 临时错误（连接被拒绝、502/503/504）的重试次数与首次重试间隔（之后指数退避并随机抖动，单次最长 1s）
+	ChromaRetries    int
+	ChromaRetryDelay time.Duration
+
+	// 导入知识库时写入 Chroma 的 metadata 字段白名单（为空表示全部保留）
+	ChromaMetadataFields map[string]bool
+
+	// DashScope 服务地址（生成与嵌入接口均基于此地址，可指向代理/网关），未配置时按地域选择默认地址
+	DashScopeRegion      string
+	DashScopeBaseURL     string
+	DashScopeValidateKey bool // 启动时用一次低成本的嵌入调用校验 API Key 与地域是否匹配（默认开启）
+
+	// 按意图路由模型（ModelRoutes 为 意图→模型 映射，未配置的意图使用默认模型 qwen-max）
+	ModelRouting bool
+	ModelRoutes  map[string]string
+
+	// 服务端会话存储：超过 SessionTTL 未活跃的会话过期，每个会话最多保留 SessionMaxMessages 条消息
+	SessionTTL         time.Duration
+	SessionMaxMessages int
+
+	// 订单创建回调：通过聊天创建订单后 POST 到 OrderWebhookURL，使用 OrderWebhookSecret 进行 HMAC-SHA256 签名
+	OrderWebhookURL    string
+	OrderWebhookSecret string
+
+	// 用户资料接口（地址中的 {userId} 替换为请求的 userId）：下单缺少客户信息时用默认收货信息补全，提交前请用户确认
+	ProfileURL string
+
+	// 慢请求阈值（毫秒）：超过时输出各阶段耗时明细，否则只输出一行摘要（0 表示不输出明细）
+	SlowRequestMS int
+
+	// 移除知识库文档中类似指令的语句（防止提示注入，默认关闭），检索内容始终以不可信参考资料的形式注入
+	RAGStripInstructions bool
+
+	// 注入上下文时单个知识库文档正文的最大字符数，超出部分截断并以省略号结尾（默认 0，不限制）
+	RAGMaxDocChars int
+
+	// 演示模式：create_order 缺少客户信息时使用以下默认值补全（仅用于演示环境，默认关闭）
+	DemoMode            bool
+	DemoCustomerName    string
+	DemoCustomerPhone   string
+	DemoShippingAddress string
+
+	// 服务端接受的最大历史轮数（只保留最近的轮次，防止客户端传入过多历史）
+	MaxHistoryTurns int
+
+	// 单次请求允许的最大工具调用轮数（包括工具调用格式有误时的修正重试）
+	MaxToolIterations int
+
+	// 知识库后台导入：文档按 KnowledgeChunkSize 字切分（相邻片段重叠 KnowledgeChunkOverlap 字），
+	// 已结束的任务保留 KnowledgeJobTTL 供查询
+	KnowledgeChunkSize    int
+	KnowledgeChunkOverlap int
+	KnowledgeJobTTL       time.Duration
+
+	// 示例对话文件（JSON，可选）：插入在系统提示词之后，用于调优下单等场景的提取效果
+	FewShotExamplesFile string
+
+	// 面向用户的固定提示语：MessageLocale 为使用的语言（zh-CN、en-US），MessagesFile（JSON，可选）按消息 ID 覆盖内置文本
+	MessageLocale string
+	MessagesFile  string
+
+	// 会话偏好的默认值（可通过 POST /session/:id/prefs 按会话覆盖）：详略程度 concise/detailed（为空时按 ConciseReplies），
+	// 语气 formal/casual（为空表示不限定）；默认语言为 MessageLocale
+	PrefsDefaultVerbosity string
+	PrefsDefaultTone      string
+
+	// 助手人设（白标）：名字、说话风格和所属品牌，写入系统提示词（工具调用规范不变），启动时校验
+	AssistantName  string
+	AssistantTone  string
+	AssistantBrand string
+
+	// 下单确认：开启后 create_order 参数齐全时总是先把订单预览发给用户确认（否则只在使用了默认资料时确认）；
+	// 预览模板文件（JSON，可选）按工具名覆盖内置的预览模板
+	OrderConfirmation        bool
+	ToolPreviewTemplatesFile string
+
+	// 知识库检索的元数据过滤规则：查询包含关键词时只检索对应元数据的文档（为空表示不过滤）
+	KnowledgeFilterRules map[string]MetadataFilter
+
+	// 请求体大小上限（字节），超过时返回 413（0 表示不限制）
+	MaxBodyBytes int64
+
+	// 推荐追问问题（请求开启 suggestions 时生成）：使用的模型、最多条数与超时时间
+	SuggestionsModel   string
+	SuggestionsMax     int
+	SuggestionsTimeout time.Duration
+
+	// 下单参数不全时用一次独立的 LLM 调用从对话中提取订单字段（未开启或失败时使用正则提取）
+	OrderExtractionLLM     bool
+	OrderExtractionModel   string
+	OrderExtractionTimeout time.Duration
+
+	// 知识库检索失败时提示模型"暂时无法查询政策详情"（区别于没有相关文档）
+	RAGUnavailableNote bool
+
+	// 发送给 LLM 前将手机号、地址等敏感信息替换为占位符（请求内可逆），PIIMaskTypes 为启用的类型
+	PIIMasking   bool
+	PIIMaskTypes map[string]bool
+}
+
+// ChromaScope Chroma 的 tenant 与 database
+type ChromaScope struct {
+	Tenant   string
+	Database string
+}
+
+// MetadataFilter 元数据过滤条件（字段 = 值）
+type MetadataFilter struct {
+	Field string
+	Value string
+}
+
+// dashScopeRegionURLs 各地域的 DashScope 默认地址
+var dashScopeRegionURLs = map[string]string{
+	"cn":   "https://dashscope.aliyuncs.com",
+	"intl": "https://dashscope-intl.aliyuncs.com",
 }
 
 // LoadConfig 加载配置
 func LoadConfig() *Config {
+	dashScopeRegion := strings.ToLower(getEnv("DASHSCOPE_REGION", "cn"))
+	if _, ok := dashScopeRegionURLs[dashScopeRegion]; !ok {
+		log.Printf("⚠️  不支持的 DASHSCOPE_REGION: %s（可选 cn/intl），使用 cn", dashScopeRegion)
+		dashScopeRegion = "cn"
+	}
+
 	apiKey := os.Getenv("DASHSCOPE_API_KEY")
 	if apiKey == "" {
 		log.Fatal("错误: 必须设置 DASHSCOPE_API_KEY 环境变量")
@@ -27,15 +275,220 @@ func LoadConfig() *Config {
 		ChromaPort:      getEnv("CHROMA_PORT", "8000"),
 		JavaShopURL:     getEnv("JAVA_SHOP_URL", "http://localhost:8080"),
 		Port:            getEnv("PORT", "8081"),
+
+		HTTPMaxIdleConns:        getEnvInt("HTTP_MAX_IDLE_CONNS", 100),
+		HTTPMaxIdleConnsPerHost: getEnvInt("HTTP_MAX_IDLE_CONNS_PER_HOST", 20),
+		HTTPMaxConnsPerHost:     getEnvInt("HTTP_MAX_CONNS_PER_HOST", 0),
+		HTTPIdleConnTimeout:     getEnvDuration("HTTP_IDLE_CONN_TIMEOUT", 90*time.Second),
+		HTTPTimeout:             getEnvDuration("HTTP_TIMEOUT", 60*time.Second),
+
+		ToolTimeouts: parseDurationMap(os.Getenv("MCP_TOOL_TIMEOUTS")),
+		ToolRetries:  parseIntMap(os.Getenv("MCP_TOOL_RETRIES")),
+
+		ToolCacheEnabled: getEnvBool("TOOL_CACHE_ENABLED", false),
+		ToolCacheTTL:     getEnvDuration("TOOL_CACHE_TTL", 30*time.Second),
+
+		MCPRequiredTools: parseSet(getEnv("MCP_REQUIRED_TOOLS", "search_product,create_order,query_order,cancel_order")),
+		MCPToolsCacheTTL: getEnvDuration("MCP_TOOLS_CACHE_TTL", 10*time.Second),
+
+		EmbeddingMaxTokens: getEnvInt("EMBEDDING_MAX_TOKENS", 2048),
+
+		EmbeddingRetries:    getEnvInt("EMBEDDING_RETRIES", 2),
+		EmbeddingRetryDelay: getEnvDuration("EMBEDDING_RETRY_DELAY", time.Second),
+		EmbeddingSkipFailed: getEnvBool("EMBEDDING_SKIP_FAILED", true),
+
+		EmbeddingConcurrency: getEnvInt("EMBEDDING_CONCURRENCY", 2),
+
+		EmbeddingTimeout: time.Duration(getEnvInt("EMBEDDING_TIMEOUT_SECONDS", 30)) * time.Second,
+
+		EmbedMaxTexts: getEnvInt("EMBED_MAX_TEXTS", 100),
+
+		RAGQueryConcurrency: getEnvInt("RAG_QUERY_CONCURRENCY", 4),
+
+		ContextTokenBudget: getEnvInt("CONTEXT_TOKEN_BUDGET", 6000),
+
+		AdvisoryOnly: getEnvBool("ADVISORY_ONLY", false),
+
+		ToolsReadOnly: getEnvBool("TOOLS_READONLY", false),
+		ToolsDisabled: getEnvBool("TOOLS_DISABLED", false),
+
+		ToolRateLimit:  getEnvInt("TOOL_RATE_LIMIT", 10),
+		ToolRateWindow: getEnvDuration("TOOL_RATE_WINDOW", time.Hour),
+
+		GreetingEnabled: getEnvBool("GREETING_ENABLED", false),
+		GreetingMessage: getEnv("GREETING_MESSAGE", "您好，欢迎光临！我是智能客服，可以为您解答商品问题、查询或下单，请问有什么可以帮您？"),
+
+		FAQFastPath:          getEnvBool("FAQ_FAST_PATH", false),
+		FAQDistanceThreshold: getEnvFloat("FAQ_DISTANCE_THRESHOLD", 0.3),
+		FAQMinRelevance:      getEnvFloat("FAQ_MIN_RELEVANCE", 0),
+
+		GroundingMinRelevance: getEnvFloat("GROUNDING_MIN_RELEVANCE", 0.6),
+		GroundingMinOverlap:   getEnvFloat("GROUNDING_MIN_OVERLAP", 0.3),
+
+		LLMCoalesceRequests: getEnvBool("LLM_COALESCE_REQUESTS", false),
+
+		EnabledTools: parseSet(os.Getenv("ENABLED_TOOLS")),
+		AdminAPIKey:  os.Getenv("ADMIN_API_KEY"),
+
+		CitationsEnabled:       getEnvBool("CITATIONS_ENABLED", false),
+		CitationsShowRelevance: getEnvBool("CITATIONS_SHOW_RELEVANCE", false),
+
+		RAGRerank:           getEnvBool("RAG_RERANK", false),
+		RAGRerankCandidates: getEnvInt("RAG_RERANK_CANDIDATES", 10),
+		RAGRerankModel:      getEnv("RAG_RERANK_MODEL", "qwen-turbo"),
+
+		DecideTemperature:    getEnvFloat("LLM_DECIDE_TEMPERATURE", 0.1),
+		DecideTopP:           getEnvFloat("LLM_DECIDE_TOP_P", 0.8),
+		SummarizeTemperature: getEnvFloat("LLM_SUMMARIZE_TEMPERATURE", 0.7),
+		SummarizeTopP:        getEnvFloat("LLM_SUMMARIZE_TOP_P", 0.9),
+
+		LLMStopSequences: parseStopSequences(os.Getenv("LLM_STOP_SEQUENCES")),
+
+		LLMModelInputShapes: parseKeyValues(os.Getenv("LLM_MODEL_INPUT_SHAPES")),
+
+		ReplyMaxLength: getEnvInt("REPLY_MAX_LENGTH", 0),
+		ConciseReplies: getEnvBool("CONCISE_REPLIES", false),
+
+		ChromaAutoCreate: getEnvBool("CHROMA_AUTO_CREATE", true),
+		ChromaHNSWSpace:  getEnv("CHROMA_HNSW_SPACE", "cosine"),
+
+		ChromaDistanceMetric: getEnv("CHROMA_DISTANCE_METRIC", getEnv("CHROMA_HNSW_SPACE", "cosine")),
+
+		ChromaTenant:   getEnv("CHROMA_TENANT", "default_tenant"),
+		ChromaDatabase: getEnv("CHROMA_DATABASE", "default_database"),
+		MerchantScopes: parseMerchantScopes(os.Getenv("MERCHANT_DATABASES")),
+
+		ChromaCollection:         getEnv("CHROMA_COLLECTION", "shop_knowledge"),
+		ChromaRequestCollections: parseSet(os.Getenv("CHROMA_REQUEST_COLLECTIONS")),
+
+		ChromaRetries:    getEnvInt("CHROMA_RETRIES", 2),
+		ChromaRetryDelay: getEnvDuration("CHROMA_RETRY_DELAY", 200*time.Millisecond),
+
+		ChromaMetadataFields: parseSet(os.Getenv("CHROMA_METADATA_FIELDS")),
+
+		DashScopeRegion:      dashScopeRegion,
+		DashScopeBaseURL:     getEnv("DASHSCOPE_BASE_URL", dashScopeRegionURLs[dashScopeRegion]),
+		DashScopeValidateKey: getEnvBool("DASHSCOPE_VALIDATE_KEY", true),
+
+		ModelRouting: getEnvBool("MODEL_ROUTING", false),
+		ModelRoutes:  parseKeyValues(getEnv("MODEL_ROUTES", "faq=qwen-turbo,general=qwen-turbo")),
+
+		SessionTTL:         getEnvDuration("SESSION_TTL", 30*time.Minute),
+		SessionMaxMessages: getEnvInt("SESSION_MAX_MESSAGES", 40),
+
+		OrderWebhookURL:    os.Getenv("ORDER_WEBHOOK_URL"),
+		OrderWebhookSecret: os.Getenv("ORDER_WEBHOOK_SECRET"),
+
+		ProfileURL: os.Getenv("PROFILE_URL"),
+
+		SlowRequestMS: getEnvInt("SLOW_REQUEST_MS", 3000),
+
+		RAGStripInstructions: getEnvBool("RAG_STRIP_INSTRUCTIONS", false),
+
+		RAGMaxDocChars: getEnvInt("RAG_MAX_DOC_CHARS", 0),
+
+		DemoMode:            getEnvBool("DEMO_MODE", false),
+		DemoCustomerName:    getEnv("DEMO_CUSTOMER_NAME", "演示用户"),
+		DemoCustomerPhone:   getEnv("DEMO_CUSTOMER_PHONE", "13800000000"),
+		DemoShippingAddress: getEnv("DEMO_SHIPPING_ADDRESS", "演示地址（测试数据，请勿发货）"),
+
+		MaxHistoryTurns: getEnvInt("MAX_HISTORY_TURNS", 5),
+
+		MaxToolIterations: getEnvInt("MAX_TOOL_ITERATIONS", 5),
+
+		KnowledgeChunkSize:    getEnvInt("KNOWLEDGE_CHUNK_SIZE", 500),
+		KnowledgeChunkOverlap: getEnvInt("KNOWLEDGE_CHUNK_OVERLAP", 50),
+		KnowledgeJobTTL:       getEnvDuration("KNOWLEDGE_JOB_TTL", time.Hour),
+
+		FewShotExamplesFile: os.Getenv("FEW_SHOT_EXAMPLES_FILE"),
+
+		MessageLocale: getEnv("MESSAGE_LOCALE", "zh-CN"),
+		MessagesFile:  os.Getenv("MESSAGES_FILE"),
+
+		PrefsDefaultVerbosity: strings.ToLower(os.Getenv("PREFS_DEFAULT_VERBOSITY")),
+		PrefsDefaultTone:      strings.ToLower(os.Getenv("PREFS_DEFAULT_TONE")),
+
+		AssistantName:  strings.TrimSpace(os.Getenv("ASSISTANT_NAME")),
+		AssistantTone:  strings.TrimSpace(os.Getenv("ASSISTANT_TONE")),
+		AssistantBrand: strings.TrimSpace(os.Getenv("ASSISTANT_BRAND")),
+
+		OrderConfirmation:        getEnvBool("ORDER_CONFIRMATION", false),
+		ToolPreviewTemplatesFile: os.Getenv("TOOL_PREVIEW_TEMPLATES_FILE"),
+
+		KnowledgeFilterRules: parseFilterRules(os.Getenv("KNOWLEDGE_FILTER_RULES")),
+
+		MaxBodyBytes: int64(getEnvInt("MAX_BODY_BYTES", 1<<20)),
+
+		SuggestionsModel:   getEnv("SUGGESTIONS_MODEL", "qwen-turbo"),
+		SuggestionsMax:     getEnvInt("SUGGESTIONS_MAX", 3),
+		SuggestionsTimeout: getEnvDuration("SUGGESTIONS_TIMEOUT", 3*time.Second),
+
+		OrderExtractionLLM:     getEnvBool("ORDER_EXTRACTION_LLM", false),
+		OrderExtractionModel:   getEnv("ORDER_EXTRACTION_MODEL", "qwen-turbo"),
+		OrderExtractionTimeout: getEnvDuration("ORDER_EXTRACTION_TIMEOUT", 5*time.Second),
+
+		RAGUnavailableNote: getEnvBool("RAG_UNAVAILABLE_NOTE", false),
+
+		PIIMasking:   getEnvBool("PII_MASKING", false),
+		PIIMaskTypes: parseSet(getEnv("PII_MASK_TYPES", "phone,address,email")),
 	}
 
 	log.Printf("✅ 配置加载完成")
-	log.Printf("   - Chroma: %s:%s", cfg.ChromaHost, cfg.ChromaPort)
+	log.Printf("   - Chroma: %s:%s (%s/%s)", cfg.ChromaHost, cfg.ChromaPort, cfg.ChromaTenant, cfg.ChromaDatabase)
+	if len(cfg.MerchantScopes) > 0 {
+		log.Printf("   - 商户知识库: %d 个", len(cfg.MerchantScopes))
+	}
+	log.Printf("   - DashScope: %s (地域: %s)", cfg.DashScopeBaseURL, cfg.DashScopeRegion)
 	log.Printf("   - Java Shop: %s", cfg.JavaShopURL)
+	if cfg.AdvisoryOnly {
+		log.Printf("   - 仅咨询模式: 已启用（禁用创建/取消订单）")
+	}
+	if cfg.ToolsDisabled {
+		log.Printf("   - 🚧 工具安全模式: 已拦截所有工具")
+	} else if cfg.ToolsReadOnly {
+		log.Printf("   - 🚧 工具安全模式: 只读（拦截创建/取消订单）")
+	}
+	if cfg.DemoMode {
+		log.Printf("   - ⚠️  演示模式: 已启用（下单缺少客户信息时填充演示数据，请勿用于生产环境）")
+	}
+	if cfg.ModelRouting {
+		log.Printf("   - 模型路由: 已启用 %v", cfg.ModelRoutes)
+	}
+	if len(cfg.KnowledgeFilterRules) > 0 {
+		log.Printf("   - 知识库过滤规则: %d 条", len(cfg.KnowledgeFilterRules))
+	}
+	log.Printf("   - HTTP 连接池: MaxIdleConns=%d, MaxIdleConnsPerHost=%d, MaxConnsPerHost=%d, IdleConnTimeout=%s, Timeout=%s",
+		cfg.HTTPMaxIdleConns, cfg.HTTPMaxIdleConnsPerHost, cfg.HTTPMaxConnsPerHost, cfg.HTTPIdleConnTimeout, cfg.HTTPTimeout)
+	if cfg.EmbeddingTimeout > 0 {
+		log.Printf("   - 嵌入请求超时: %s", cfg.EmbeddingTimeout)
+	}
 
 	return cfg
 }
 
+// NewHTTPClient 创建带连接池的 HTTP 客户端，供各个下游客户端共享
+func (c *Config) NewHTTPClient() *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          c.HTTPMaxIdleConns,
+		MaxIdleConnsPerHost:   c.HTTPMaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.HTTPMaxConnsPerHost,
+		IdleConnTimeout:       c.HTTPIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   c.HTTPTimeout,
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -43,3 +496,153 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️  环境变量 %s 不是有效的整数: %s, 使用默认值 %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return intValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️  环境变量 %s 不是有效的时长: %s, 使用默认值 %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+// parseKeyValues 解析 "key1=value1,key2=value2" 格式的配置
+func parseKeyValues(value string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+// parseDurationMap 解析 "tool=5s,tool2=30s" 格式的时长配置
+func parseDurationMap(value string) map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for key, raw := range parseKeyValues(value) {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Printf("⚠️  无效的时长配置 %s=%s, 已忽略", key, raw)
+			continue
+		}
+		result[key] = duration
+	}
+	return result
+}
+
+// parseFilterRules 解析 "关键词=字段:值,关键词2=字段:值" 格式的元数据过滤规则
+func parseFilterRules(value string) map[string]MetadataFilter {
+	result := make(map[string]MetadataFilter)
+	for keyword, raw := range parseKeyValues(value) {
+		parts := strings.SplitN(raw, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			log.Printf("⚠️  无效的过滤规则 %s=%s（应为 关键词=字段:值）, 已忽略", keyword, raw)
+			continue
+		}
+		result[keyword] = MetadataFilter{Field: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])}
+	}
+	return result
+}
+
+// parseMerchantScopes 解析 "商户凭证=tenant/database,商户凭证2=database" 格式的商户知识库配置，
+// 省略 tenant 时使用默认 tenant
+func parseMerchantScopes(value string) map[string]ChromaScope {
+	result := make(map[string]ChromaScope)
+	for key, raw := range parseKeyValues(value) {
+		scope := ChromaScope{Database: raw}
+		if parts := strings.SplitN(raw, "/", 2); len(parts) == 2 {
+			scope = ChromaScope{Tenant: strings.TrimSpace(parts[0]), Database: strings.TrimSpace(parts[1])}
+		}
+		if scope.Database == "" {
+			log.Printf("⚠️  无效的商户知识库配置 %q（应为 凭证=tenant/database 或 凭证=database）, 已忽略", raw)
+			continue
+		}
+		result[key] = scope
+	}
+	return result
+}
+
+// parseIntMap 解析 "tool=2,tool2=0" 格式的整数配置
+func parseIntMap(value string) map[string]int {
+	result := make(map[string]int)
+	for key, raw := range parseKeyValues(value) {
+		intValue, err := strconv.Atoi(raw)
+		if err != nil {
+			log.Printf("⚠️  无效的整数配置 %s=%s, 已忽略", key, raw)
+			continue
+		}
+		result[key] = intValue
+	}
+	return result
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️  环境变量 %s 不是有效的布尔值: %s, 使用默认值 %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return boolValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("⚠️  环境变量 %s 不是有效的数字: %s, 使用默认值 %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return floatValue
+}
+
+// parseStopSequences 解析逗号分隔的停止序列（保持顺序，忽略空项），off 表示不设置
+func parseStopSequences(value string) []string {
+	if strings.EqualFold(strings.TrimSpace(value), "off") {
+		return nil
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseSet 解析逗号分隔的列表为集合
+func parseSet(value string) map[string]bool {
+	result := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result[item] = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParseMerchantScopes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[string]ChromaScope
+	}{
+		{"未配置", "", map[string]ChromaScope{}},
+		{
+			name:  "tenant/database",
+			value: "key-a=shop_a/knowledge",
+			want:  map[string]ChromaScope{"key-a": {Tenant: "shop_a", Database: "knowledge"}},
+		},
+		{
+			name:  "省略 tenant",
+			value: "key-b=shop_b_db",
+			want:  map[string]ChromaScope{"key-b": {Database: "shop_b_db"}},
+		},
+		{
+			name:  "多个商户并去除空白",
+			value: " key-a = shop_a / knowledge , key-b=shop_b_db",
+			want: map[string]ChromaScope{
+				"key-a": {Tenant: "shop_a", Database: "knowledge"},
+				"key-b": {Database: "shop_b_db"},
+			},
+		},
+		{
+			name:  "忽略没有 database 的配置",
+			value: "key-a=shop_a/,key-b=,key-c=db_c",
+			want:  map[string]ChromaScope{"key-c": {Database: "db_c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMerchantScopes(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMerchantScopes(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// BenchmarkNewHTTPClient 并发请求同一个下游时，对比不限制和限制 MaxConnsPerHost 建立的连接数（conns）和耗时：
+// 不限制时连接数随并发增长，限制后超出的请求排队复用已有连接
+func BenchmarkNewHTTPClient(b *testing.B) {
+	for _, maxConns := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("MaxConnsPerHost=%d", maxConns), func(b *testing.B) {
+			var newConns atomic.Int64
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond) // 模拟下游处理耗时
+				io.WriteString(w, "ok")
+			}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					newConns.Add(1)
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			cfg := &Config{
+				HTTPMaxIdleConns:        100,
+				HTTPMaxIdleConnsPerHost: 2,
+				HTTPMaxConnsPerHost:     maxConns,
+				HTTPIdleConnTimeout:     90 * time.Second,
+				HTTPTimeout:             10 * time.Second,
+			}
+			client := cfg.NewHTTPClient()
+			defer client.CloseIdleConnections()
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					resp, err := client.Get(server.URL)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			})
+			b.ReportMetric(float64(newConns.Load()), "conns")
+		})
+	}
+}
+
+func TestDashScopeValidateKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"默认开启", "", true},
+		{"显式关闭", "false", false},
+		{"显式开启", "true", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DASHSCOPE_API_KEY", "test-key")
+			t.Setenv("DASHSCOPE_VALIDATE_KEY", tt.value)
+			if got := LoadConfig().DashScopeValidateKey; got != tt.want {
+				t.Errorf("DashScopeValidateKey = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
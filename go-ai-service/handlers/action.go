@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-ai-service/mcp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 回复中的 action 字段：本次请求实际完成的订单操作，前端据此更新本地状态，无需解析回复文字
+const (
+	ActionNone           = "none"
+	ActionOrderCreated   = "order_created"
+	ActionOrderCancelled = "order_cancelled"
+	ActionOrderQueried   = "order_queried"
+)
+
+// actionContextKey gin.Context 中保存本次请求完成的操作的键
+const actionContextKey = "actionTaken"
+
+// toolActions 工具执行成功后对应的操作
+var toolActions = map[string]string{
+	"create_order":   ActionOrderCreated,
+	"cancel_order":   ActionOrderCancelled,
+	"query_order":    ActionOrderQueried,
+	"list_orders":    ActionOrderQueried,
+	"track_shipment": ActionOrderQueried,
+}
+
+// actionTaken 本次请求完成的操作及涉及的订单号
+type actionTaken struct {
+	Action      string
+	OrderNumber string
+}
+
+// recordAction 根据工具执行结果记录本次请求完成的操作，writeReply 时写入回复。
+// 执行失败、被安全模式拦截或模拟执行的调用不算完成操作；创建/取消订单以 MCP Server 的成功标记 ✅ 为准
+func recordAction(c *gin.Context, toolName, arguments, result string) {
+	action, ok := toolActions[toolName]
+	if !ok || strings.HasPrefix(result, "❌") || strings.HasPrefix(result, mcp.DryRunResultPrefix) || mcp.IsBlockedReply(result) {
+		return
+	}
+	if mutatingTools[toolName] && !strings.HasPrefix(result, "✅") {
+		return
+	}
+	c.Set(actionContextKey, actionTaken{Action: action, OrderNumber: actionOrderNumber(toolName, arguments, result)})
+}
+
+// actionOrderNumber 操作涉及的订单号：新订单从创建结果中提取，其余取工具参数中的订单号
+func actionOrderNumber(toolName, arguments, result string) string {
+	if toolName == "create_order" {
+		if matches := createdOrderNumberRegex.FindStringSubmatch(result); len(matches) > 1 {
+			return matches[1]
+		}
+		return ""
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return ""
+	}
+	orderNumber, _ := args["orderNumber"].(string)
+	return strings.TrimSpace(orderNumber)
+}
+
+// actionFromContext 获取本次请求完成的操作（没有完成任何订单操作时为 none）
+func actionFromContext(c *gin.Context) actionTaken {
+	if value, ok := c.Get(actionContextKey); ok {
+		if action, ok := value.(actionTaken); ok {
+			return action
+		}
+	}
+	return actionTaken{Action: ActionNone}
+}
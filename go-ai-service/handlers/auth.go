@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAPIKey 校验请求携带的 API Key（Authorization: Bearer <key> 或 X-API-Key: <key>）
+// 未配置 API Key 时拒绝所有请求
+func RequireAPIKey(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !apiKeyValid(c, apiKey) {
+			respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "未授权的请求")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// apiKeyValid 判断请求是否携带了正确的 API Key，未配置 API Key 时始终返回 false
+func apiKeyValid(c *gin.Context, apiKey string) bool {
+	provided := c.GetHeader("X-API-Key")
+	if provided == "" {
+		provided = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	return apiKey != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) == 1
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LimitBodySize 限制请求体大小，超过 maxBytes 时返回 413（maxBytes <= 0 表示不限制）
+func LimitBodySize(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		// 声明了 Content-Length 的请求直接拒绝，无需读取请求体
+		if c.Request.ContentLength > maxBytes {
+			respondBodyTooLarge(c, maxBytes)
+			c.Abort()
+			return
+		}
+
+		// 分块传输等未声明长度的请求，在读取超限时由绑定逻辑返回 413
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// respondBindError 处理 JSON 绑定错误：请求体超限返回 413，格式/类型错误返回 400，
+// 其他错误（如必填校验）返回 false 交给调用方继续完整校验
+func respondBindError(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondBodyTooLarge(c, maxBytesErr.Limit)
+		return true
+	}
+
+	if details := bindErrorDetails(err); details != nil {
+		respondValidationError(c, details)
+		return true
+	}
+	return false
+}
+
+// respondBodyTooLarge 返回请求体过大的错误
+func respondBodyTooLarge(c *gin.Context, maxBytes int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge,
+		fmt.Sprintf("请求体过大，最大 %d 字节", maxBytes))
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-ai-service/tracing"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 取消订单流程阶段
+const (
+	cancelStageConfirm = "confirm" // 等待用户确认取消唯一的候选订单
+	cancelStageChoose  = "choose"  // 等待用户从多个候选订单中选择
+)
+
+// maxCancelCandidates 列出供用户选择的最大订单数
+const maxCancelCandidates = 5
+
+// cancelFlow 会话中进行中的"无订单号取消订单"流程
+type cancelFlow struct {
+	Stage      string
+	UserID     string         // 发起流程的用户，会话被其他用户使用时不能继续流程
+	Reason     string         // 用户说明的取消原因
+	Candidates []orderSummary // 可取消的候选订单（按下单时间倒序）
+}
+
+// orderSummary list_orders 结果中的一个订单
+type orderSummary struct {
+	OrderNumber string
+	Product     string
+	Quantity    int
+	Status      string
+	CreatedAt   string
+}
+
+// cancellableStatuses 允许取消的订单状态（与 Java 商城保持一致）
+var cancellableStatuses = map[string]bool{
+	"PENDING":   true,
+	"CONFIRMED": true,
+}
+
+var (
+	// cancelIntentRegex 取消订单的意图
+	cancelIntentRegex = regexp.MustCompile(`取消.{0,6}(订单|单子|的单)|退单|撤单|不想要了`)
+	// confirmReplyRegex 确认取消
+	confirmReplyRegex = regexp.MustCompile(`^(确认|确定|是的?|对|好的?|可以|嗯|取消吧|确认取消|yes|ok)[。!！.]*$`)
+	// declineReplyRegex 放弃取消
+	declineReplyRegex = regexp.MustCompile(`^(不用了?|不要|算了|不取消|否|不是|先不|no)[。!！.]*$`)
+	// choiceIndexRegex 按序号选择订单，如"2"、"第2个"、"第二个"
+	choiceIndexRegex = regexp.MustCompile(`^第?\s*([1-9一二三四五])\s*(个|单|号)?[。!！.]*$`)
+
+	orderLineRegex     = regexp.MustCompile(`订单号[：:][ \t]*(\S+)`)
+	productLineRegex   = regexp.MustCompile(`商品[：:][ \t]*(.*)`)
+	quantityLineRegex  = regexp.MustCompile(`数量[：:][ \t]*(\d+)`)
+	statusLineRegex    = regexp.MustCompile(`状态[：:][ \t]*(\S+)`)
+	createdAtLineRegex = regexp.MustCompile(`下单时间[：:][ \t]*(\S+)`)
+)
+
+// chineseDigits 中文序号
+var chineseDigits = map[string]int{"一": 1, "二": 2, "三": 3, "四": 4, "五": 5}
+
+// handleCancelFlow 处理没有订单号的取消请求：按登录用户资料中的手机号查出最近可取消的订单，经用户确认后再取消。
+// 返回 false 表示本条消息不属于该流程，继续正常处理
+func (h *ChatHandler) handleCancelFlow(c *gin.Context, req *ChatRequest, span *tracing.Span, timings *requestTimings) bool {
+	if req.SessionID == "" || !h.isToolAllowed("cancel_order") || !h.isToolAllowed("list_orders") {
+		return false
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if flow := h.sessions.CancelFlow(req.SessionID); flow != nil {
+		if flow.UserID != req.UserID {
+			log.Printf("⚠️  会话 %s 的取消流程属于其他用户，不继续流程", req.SessionID)
+		} else if reply, orderNumber, ok := h.continueCancelFlow(req, flow, message); ok {
+			if orderNumber != "" {
+				h.cancelOrder(c, req, span, timings, orderNumber, flow.Reason)
+			} else {
+				h.writeReply(c, ChatResponse{Reply: reply, SessionID: req.SessionID})
+			}
+			return true
+		}
+		// 用户转而谈论其他话题，结束流程
+		h.sessions.SetCancelFlow(req.SessionID, nil)
+	}
+
+	if !cancelIntentRegex.MatchString(message) || orderNumberRegex.MatchString(message) {
+		return false
+	}
+
+	log.Printf("🗂️  取消订单但未提供订单号，查找当前用户最近的订单")
+	reply := h.messages.Text(msgOrderCancelNeedsID)
+	if phone, ok := h.accountPhone(req.UserID); ok {
+		flow := &cancelFlow{UserID: req.UserID, Reason: extractCancelReason(message)}
+		reply = h.lookupCancellableOrders(c, req, flow, phone)
+	}
+	h.writeReply(c, ChatResponse{Reply: reply, SessionID: req.SessionID})
+	return true
+}
+
+// accountPhone 登录用户资料中绑定的手机号。只按账号绑定的手机号查询订单，不使用消息中提供的手机号，
+// 避免凭他人的手机号查看或取消他人的订单；未配置资料查询、没有 userId 或资料中没有手机号时返回 false
+func (h *ChatHandler) accountPhone(userID string) (string, bool) {
+	if h.profiles == nil || userID == "" {
+		return "", false
+	}
+	profile, found, err := h.profiles.Profile(userID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return "", false
+	}
+	if !found || strings.TrimSpace(profile.CustomerPhone) == "" {
+		return "", false
+	}
+	return normalizePhone(profile.CustomerPhone), true
+}
+
+// continueCancelFlow 根据流程阶段处理用户的回复：返回直接回复的内容，或用户确认/选择后要取消的订单号
+func (h *ChatHandler) continueCancelFlow(req *ChatRequest, flow *cancelFlow, message string) (string, string, bool) {
+	switch flow.Stage {
+	case cancelStageConfirm:
+		switch {
+		case confirmReplyRegex.MatchString(message):
+			h.sessions.SetCancelFlow(req.SessionID, nil)
+			return "", flow.Candidates[0].OrderNumber, true
+		case declineReplyRegex.MatchString(message):
+			h.sessions.SetCancelFlow(req.SessionID, nil)
+			return h.messages.Text(msgCancelKept), "", true
+		}
+		return "", "", false
+
+	case cancelStageChoose:
+		if declineReplyRegex.MatchString(message) {
+			h.sessions.SetCancelFlow(req.SessionID, nil)
+			return h.messages.Text(msgCancelKeptAll), "", true
+		}
+		if order, ok := chooseOrder(flow.Candidates, message); ok {
+			h.sessions.SetCancelFlow(req.SessionID, nil)
+			return "", order.OrderNumber, true
+		}
+		return "", "", false
+	}
+
+	return "", "", false
+}
+
+// lookupCancellableOrders 查询客户的订单并根据可取消订单数量推进流程
+func (h *ChatHandler) lookupCancellableOrders(c *gin.Context, req *ChatRequest, flow *cancelFlow, phone string) string {
+	sessionID := req.SessionID
+	args, _ := json.Marshal(map[string]interface{}{
+		"customerPhone": phone,
+		"status":        []string{"PENDING", "CONFIRMED"},
+		"pageSize":      maxCancelCandidates,
+	})
+	result, err := h.executeTool(c, req, nil, "list_orders", string(args), nil)
+	if err != nil {
+		log.Printf("❌ 查询订单列表失败: %v", err)
+		h.sessions.SetCancelFlow(sessionID, nil)
+		return h.messages.Text(msgCancelLookupFailed)
+	}
+
+	var candidates []orderSummary
+	for _, order := range parseOrderList(result) {
+		if cancellableStatuses[order.Status] {
+			candidates = append(candidates, order)
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		h.sessions.SetCancelFlow(sessionID, nil)
+		return h.messages.Text(msgCancelNoCandidates)
+
+	case len(candidates) == 1:
+		flow.Stage = cancelStageConfirm
+		flow.Candidates = candidates
+		h.sessions.SetCancelFlow(sessionID, flow)
+		return h.messages.Text(msgCancelConfirmOne, "order", candidates[0].describe(h.messages))
+
+	default:
+		if len(candidates) > maxCancelCandidates {
+			candidates = candidates[:maxCancelCandidates]
+		}
+		flow.Stage = cancelStageChoose
+		flow.Candidates = candidates
+		h.sessions.SetCancelFlow(sessionID, flow)
+
+		var list strings.Builder
+		for i, order := range candidates {
+			list.WriteString(fmt.Sprintf("%d. %s\n", i+1, order.describe(h.messages)))
+		}
+		return h.messages.Text(msgCancelChooseMany, "orders", list.String())
+	}
+}
+
+// cancelOrder 用户确认后调用 cancel_order 取消订单，与模型发起的工具调用一样返回工具结果、错误和耗时
+func (h *ChatHandler) cancelOrder(c *gin.Context, req *ChatRequest, span *tracing.Span, timings *requestTimings, orderNumber, reason string) {
+	cancelArgs := map[string]string{"orderNumber": orderNumber}
+	if reason != "" {
+		cancelArgs["reason"] = reason
+	}
+	args, _ := json.Marshal(cancelArgs)
+
+	toolCall := ToolCallInfo{ToolName: "cancel_order", Arguments: string(args)}
+	debugFromContext(c).setToolCall(toolCall)
+	h.runToolCall(c, req, span, timings, toolCall, "", "", nil)
+}
+
+// describe 订单的简短描述，按 messages 的语言输出
+func (o orderSummary) describe(messages *MessageCatalog) string {
+	parts := []string{o.OrderNumber}
+	if o.Product != "" {
+		parts = append(parts, o.Product)
+	}
+	if o.CreatedAt != "" {
+		parts = append(parts, messages.Text(msgCancelOrderPlacedAt, "time", o.CreatedAt))
+	}
+	return strings.Join(parts, messages.Text(msgCancelOrderSep))
+}
+
+// parseOrderList 解析 list_orders 返回的订单列表文本
+func parseOrderList(result string) []orderSummary {
+	var orders []orderSummary
+	for _, block := range strings.Split(result, "---") {
+		matched := orderLineRegex.FindStringSubmatch(block)
+		if len(matched) < 2 {
+			continue
+		}
+		order := orderSummary{OrderNumber: matched[1]}
+		if m := productLineRegex.FindStringSubmatch(block); len(m) > 1 {
+			order.Product = strings.TrimSpace(m[1])
+		}
+		if m := quantityLineRegex.FindStringSubmatch(block); len(m) > 1 {
+			order.Quantity, _ = strconv.Atoi(m[1])
+		}
+		if m := statusLineRegex.FindStringSubmatch(block); len(m) > 1 {
+			order.Status = m[1]
+		}
+		if m := createdAtLineRegex.FindStringSubmatch(block); len(m) > 1 {
+			order.CreatedAt = m[1]
+		}
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// chooseOrder 根据用户回复的序号或订单号选择候选订单
+func chooseOrder(candidates []orderSummary, message string) (orderSummary, bool) {
+	if matched := orderNumberRegex.FindStringSubmatch(message); len(matched) > 1 {
+		for _, order := range candidates {
+			if normalizeOrderNumber(order.OrderNumber) == normalizeOrderNumber(matched[0]) {
+				return order, true
+			}
+		}
+		return orderSummary{}, false
+	}
+
+	if matched := choiceIndexRegex.FindStringSubmatch(message); len(matched) > 1 {
+		index, err := strconv.Atoi(matched[1])
+		if err != nil {
+			index = chineseDigits[matched[1]]
+		}
+		if index >= 1 && index <= len(candidates) {
+			return candidates[index-1], true
+		}
+	}
+	return orderSummary{}, false
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"go-ai-service/mcp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticProfiles 固定的用户资料
+type staticProfiles map[string]CustomerProfile
+
+func (p staticProfiles) Profile(userID string) (CustomerProfile, bool, error) {
+	profile, ok := p[userID]
+	return profile, ok, nil
+}
+
+// shopOrders fake Java 商城中的订单：ORD-1 属于 13800138000，ORD-2 属于 13900139000
+var shopOrders = []mcp.ShopOrder{
+	{OrderNumber: "ORD-1", CustomerPhone: "13800138000", Quantity: 1, Status: "PENDING", CreatedAt: "2024-01-02T10:00:00"},
+	{OrderNumber: "ORD-2", CustomerPhone: "13900139000", Quantity: 1, Status: "PENDING", CreatedAt: "2024-01-03T10:00:00"},
+}
+
+// useFakeShop 让处理器的工具执行器降级调用返回 shopOrders 的 Java 商城
+func useFakeShop(t *testing.T, h *ChatHandler) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/orders" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(shopOrders)
+	}))
+	t.Cleanup(server.Close)
+	h.toolExecutor = mcp.NewToolExecutor(server.URL, nil)
+}
+
+func TestCancelFlowLooksUpAccountOrdersOnly(t *testing.T) {
+	tests := []struct {
+		name      string
+		profiles  ProfileProvider
+		userID    string
+		message   string
+		wantOrder string // 回复中应列出的订单，为空表示不查询订单
+	}{
+		{
+			name:    "未配置用户资料时要求订单号",
+			userID:  "u1",
+			message: "帮我取消订单，手机号 13900139000",
+		},
+		{
+			name:     "没有 userId 时要求订单号",
+			profiles: staticProfiles{"u1": {CustomerPhone: "13800138000"}},
+			message:  "帮我取消订单，手机号 13900139000",
+		},
+		{
+			name:      "只查询账号绑定手机号的订单",
+			profiles:  staticProfiles{"u1": {CustomerPhone: "138-0013-8000"}},
+			userID:    "u1",
+			message:   "帮我取消订单，手机号 13900139000",
+			wantOrder: "ORD-1",
+		},
+		{
+			name:     "资料中没有手机号时要求订单号",
+			profiles: staticProfiles{"u1": {CustomerName: "张三"}},
+			userID:   "u1",
+			message:  "帮我取消订单",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+			h.SetProfileProvider(tt.profiles)
+			useFakeShop(t, h)
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": tt.message, "userId": tt.userID, "sessionId": "s1"}))
+			if strings.Contains(resp.Reply, "ORD-2") {
+				t.Fatalf("回复泄露了其他手机号的订单: %s", resp.Reply)
+			}
+			if tt.wantOrder == "" {
+				if !strings.Contains(resp.Reply, "订单号") || strings.Contains(resp.Reply, "ORD-") {
+					t.Errorf("Reply = %q, want 要求提供订单号", resp.Reply)
+				}
+				return
+			}
+			if !strings.Contains(resp.Reply, tt.wantOrder) {
+				t.Errorf("Reply = %q, want 包含 %s", resp.Reply, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestCancelFlowCannotBeContinuedByAnotherUser(t *testing.T) {
+	fake := newFakeLLM(t, "您好，请问有什么可以帮您？")
+	h := newTestHandler(t, testConfig(t), fake)
+	h.SetProfileProvider(staticProfiles{"u1": {CustomerPhone: "13800138000"}})
+	useFakeShop(t, h)
+
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "帮我取消订单", "userId": "u1", "sessionId": "s1"}))
+	if !strings.Contains(resp.Reply, "ORD-1") || h.sessions.CancelFlow("s1") == nil {
+		t.Fatalf("u1 应进入确认阶段: %q", resp.Reply)
+	}
+
+	// 其他用户使用同一个会话 ID 回复"确认"，不能取消 u1 的订单
+	resp = decodeChat(t, postChat(t, h, map[string]interface{}{"message": "确认", "userId": "u2", "sessionId": "s1"}))
+	if resp.Action == ActionOrderCancelled || strings.Contains(resp.Reply, "ORD-1") {
+		t.Errorf("其他用户继续了取消流程: %+v", resp)
+	}
+	if fake.requestCount() != 1 {
+		t.Errorf("LLM 请求数 = %d, want 1（不属于流程的消息按普通消息处理）", fake.requestCount())
+	}
+	if h.sessions.CancelFlow("s1") != nil {
+		t.Error("取消流程应被结束")
+	}
+}
+
+func TestCancelFlowRespectsToolRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		exhausted bool // 确认前已用完取消订单的次数
+		wantReply string
+		wantTool  bool
+		wantCode  string
+	}{
+		{"未超过频率限制时调用 cancel_order", false, "订单处理失败", true, ErrCodeToolError}, // 测试中没有 MCP Server，调用失败说明工具被执行
+		{"超过频率限制时不调用 cancel_order", true, toolRateLimitedReply, false, ErrCodeRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+			h.SetProfileProvider(staticProfiles{"u1": {CustomerPhone: "13800138000"}})
+			h.toolLimiter = NewToolRateLimiter(1, time.Minute)
+			useFakeShop(t, h)
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "帮我取消订单", "userId": "u1", "sessionId": "s1"}))
+			if !strings.Contains(resp.Reply, "ORD-1") {
+				t.Fatalf("应进入确认阶段: %q", resp.Reply)
+			}
+			if tt.exhausted {
+				h.toolLimiter.Allow("user:u1|cancel_order")
+			}
+
+			resp = decodeChat(t, postChat(t, h, map[string]interface{}{"message": "确认", "userId": "u1", "sessionId": "s1"}))
+			if !strings.Contains(resp.Reply, tt.wantReply) {
+				t.Errorf("Reply = %q, want 包含 %q", resp.Reply, tt.wantReply)
+			}
+			if resp.ToolCalled != tt.wantTool || (tt.wantTool && resp.ToolName != "cancel_order") {
+				t.Errorf("ToolCalled = %v, ToolName = %q, want %v cancel_order", resp.ToolCalled, resp.ToolName, tt.wantTool)
+			}
+			if resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Errorf("Error = %+v, want code %s", resp.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestExecuteToolRateLimit(t *testing.T) {
+	h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+	h.toolLimiter = NewToolRateLimiter(1, time.Minute)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/chat", nil)
+
+	tests := []struct {
+		name        string
+		req         ChatRequest
+		tool        string
+		wantLimited bool
+	}{
+		{"首次取消", ChatRequest{UserID: "u1"}, "cancel_order", false},
+		{"超过限制", ChatRequest{UserID: "u1"}, "cancel_order", true},
+		{"其他用户不受影响", ChatRequest{UserID: "u2"}, "cancel_order", false},
+		{"其他修改类工具单独计数", ChatRequest{UserID: "u1"}, "create_order", false},
+		{"只读工具不限制", ChatRequest{UserID: "u1"}, "query_order", false},
+		{"模拟执行不限制", ChatRequest{UserID: "u1", DryRun: true}, "cancel_order", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := h.executeTool(c, &tt.req, nil, tt.tool, `{"orderNumber":"ORD-1"}`, nil)
+			if limited := errors.Is(err, errToolRateLimited); limited != tt.wantLimited {
+				t.Errorf("executeTool error = %v, want 限流 %v", err, tt.wantLimited)
+			}
+		})
+	}
+}
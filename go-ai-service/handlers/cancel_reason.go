@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// explicitReasonRegex 用户明确说明的原因，如"因为质量问题"、"原因是买错了"
+var explicitReasonRegex = regexp.MustCompile(`(?:因为|原因[是为:：]?|理由[是为:：]?)\s*([^，。,.!！?？\n]+)`)
+
+// cancelReasonKeywords 常见的取消原因
+var cancelReasonKeywords = []string{
+	"质量问题", "不想要了", "不要了", "买错了", "拍错了", "下错单", "重复下单",
+	"地址填错", "地址写错", "信息填错", "发货太慢", "太慢了", "价格太高", "太贵了", "买贵了", "找到更便宜",
+}
+
+// extractCancelReason 从用户消息中提取取消订单的原因，未找到时返回空字符串
+func extractCancelReason(message string) string {
+	if matched := explicitReasonRegex.FindStringSubmatch(message); len(matched) > 1 {
+		if reason := strings.TrimSpace(matched[1]); reason != "" {
+			return reason
+		}
+	}
+	for _, keyword := range cancelReasonKeywords {
+		if strings.Contains(message, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// withCancelReason 模型未给出取消原因时，尝试从用户消息中提取并补充到 cancel_order 参数中
+func withCancelReason(arguments, message string) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+
+	if reason, _ := args["reason"].(string); strings.TrimSpace(reason) != "" {
+		return arguments
+	}
+	delete(args, "reason")
+
+	if reason := extractCancelReason(message); reason != "" {
+		args["reason"] = reason
+		log.Printf("📝 提取到取消原因: %s", reason)
+	}
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
+	return string(argsJSON)
+}
@@ -1,16 +1,18 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
+	"go-ai-service/config"
 	"go-ai-service/llm"
 	"go-ai-service/mcp"
 	"go-ai-service/rag"
+	"go-ai-service/tracing"
 	"log"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,14 +22,32 @@ type ChatHandler struct {
 	llmClient    *llm.DashScopeClient
 	ragClient    *rag.ChromaClient
 	toolExecutor *mcp.ToolExecutor
+	cfg          *config.Config
+	sessions     *SessionStore
+	toolLimiter  *ToolRateLimiter // 修改类工具的调用频率限制（为空表示不限制）
+	orderWebhook *OrderWebhook    // 订单创建回调（为空表示未启用）
+	profiles     ProfileProvider  // 用户默认收货信息查询（为空表示未启用）
+	messages     *MessageCatalog  // 面向用户的固定提示语
+	defaultPrefs Preferences      // 会话未设置偏好时使用的默认偏好
+	personaNote  string           // 系统提示词中的助手人设说明（为空表示未配置，见 SetPersona）
+
+	fewShotExamples  []FewShotExample              // 插入在系统提示词之后的示例对话（为空表示未配置）
+	previewTemplates map[string]*template.Template // 需要确认的工具调用的预览模板（按工具名）
 }
 
 // NewChatHandler 创建新的聊天处理器
-func NewChatHandler(llmClient *llm.DashScopeClient, ragClient *rag.ChromaClient, toolExecutor *mcp.ToolExecutor) *ChatHandler {
+func NewChatHandler(llmClient *llm.DashScopeClient, ragClient *rag.ChromaClient, toolExecutor *mcp.ToolExecutor, cfg *config.Config) *ChatHandler {
 	return &ChatHandler{
 		llmClient:    llmClient,
 		ragClient:    ragClient,
 		toolExecutor: toolExecutor,
+		cfg:          cfg,
+		sessions:     NewSessionStore(cfg.SessionTTL, cfg.SessionMaxMessages),
+		toolLimiter:  NewToolRateLimiter(cfg.ToolRateLimit, cfg.ToolRateWindow),
+		messages:     NewMessageCatalog(cfg.MessageLocale),
+		defaultPrefs: defaultPreferences(cfg),
+
+		previewTemplates: builtinToolPreviewTemplates(),
 	}
 }
 
@@ -43,120 +63,188 @@ type ChatRequest struct {
 	UserID    string           `json:"userId"`
 	SessionID string           `json:"sessionId"`
 	History   []HistoryMessage `json:"history"` // 前端传递的历史消息
+	Images    []string         `json:"images"`  // 可选的图片（URL、data URI 或 base64，多模态）
+	Debug     bool             `json:"debug"`   // 返回调试信息（需要 API Key）
+	DryRun    bool             `json:"dryRun"`  // 模拟执行下单/取消订单，不实际修改订单（需要 API Key）
+	Stream    bool             `json:"stream"`  // 以 SSE 流式返回：delta（回复增量）、progress（工具进度），最后是 done（完整响应）或 error
+
+	Collection string `json:"collection"` // 本次检索使用的知识库集合（须在 CHROMA_REQUEST_COLLECTIONS 中，为空时使用默认集合）
+
+	Suggestions      bool `json:"suggestions"`      // 返回推荐的追问问题（额外一次 LLM 调用）
+	IncludeKnowledge bool `json:"includeKnowledge"` // 返回本次检索到的知识库资料（与回复中的引用标记无关）
 }
 
 // ChatResponse 聊天响应
 type ChatResponse struct {
-	Reply     string `json:"reply"`
-	SessionID string `json:"sessionId"`
+	Reply        string            `json:"reply"`
+	SessionID    string            `json:"sessionId"`
+	FinishReason string            `json:"finishReason,omitempty"` // LLM 结束原因
+	ToolCalled   bool              `json:"toolCalled,omitempty"`   // 是否执行了工具调用
+	ToolName     string            `json:"toolName,omitempty"`     // 调用的工具名称
+	ToolResults  []ToolResult      `json:"toolResults,omitempty"`  // 结构化的工具执行结果
+	Order        *OrderResult      `json:"order,omitempty"`        // 结构化的订单信息（query_order 返回可识别的订单时）
+	Error        *APIError         `json:"error,omitempty"`        // 工具执行失败等非致命错误
+	Suggestions  []string          `json:"suggestions,omitempty"`  // 推荐的追问问题（请求开启 suggestions 时）
+	Knowledge    []KnowledgeSource `json:"knowledge,omitempty"`    // 检索到的知识库资料（请求开启 includeKnowledge 时）
+	Debug        *DebugInfo        `json:"debug,omitempty"`        // 调试信息（仅授权的 debug 请求）
+	Diagnostics  *Diagnostics      `json:"diagnostics,omitempty"`  // 各阶段耗时（仅授权的 debug 请求）
+	DryRun       bool              `json:"dryRun,omitempty"`       // 本次请求为模拟执行
+	Action       string            `json:"action"`                 // 本次请求完成的订单操作：order_created、order_cancelled、order_queried 或 none
+	OrderNumber  string            `json:"orderNumber,omitempty"`  // action 涉及的订单号
+	Grounded     bool              `json:"grounded"`               // 回复基于高相关度的知识库资料（前端可展示"依据政策文档"标记）
+	GroundedOn   []string          `json:"groundedOn,omitempty"`   // 作为依据的知识库文档 ID
 }
 
 // HandleChat 处理聊天请求
 func (h *ChatHandler) HandleChat(c *gin.Context) {
 	var req ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求"})
+		// 请求体超限、JSON 格式或字段类型错误直接返回；其余（如必填校验）交给下面的完整校验列出所有问题
+		if respondBindError(c, err) {
+			return
+		}
+	}
+	greeting := h.cfg.GreetingEnabled && strings.TrimSpace(req.Message) == "" && len(req.Images) == 0
+	if problems := validateChatRequest(&req, greeting); len(problems) > 0 {
+		respondValidationError(c, problems)
+		return
+	}
+
+	// 模拟执行必须授权：未授权时拒绝请求，而不是忽略参数后真实执行
+	if req.DryRun && !apiKeyValid(c, h.cfg.AdminAPIKey) {
+		respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "dryRun 需要 API Key")
+		return
+	}
+
+	startReplyStream(c, req.Stream)
+
+	// 空消息的初始化请求：直接返回配置的欢迎语，不调用 LLM，也不记入会话
+	if greeting {
+		log.Printf("👋 初始化请求，返回欢迎语 [%s]", req.SessionID)
+		sendChatResponse(c, ChatResponse{Reply: h.cfg.GreetingMessage, SessionID: req.SessionID, Action: ActionNone})
+		return
+	}
+
+	images, err := normalizeImages(req.Images)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	req.Images = images
+
+	// 携带商户凭证时检索该商户自己的知识库
+	knowledgeClient, ok := resolveKnowledgeClient(c, h.ragClient, h.cfg.MerchantScopes)
+	if !ok {
+		return
+	}
+	// 请求指定了知识库集合（如 A/B 测试）时改用该集合检索
+	if knowledgeClient, ok = resolveCollection(c, knowledgeClient, req.Collection, h.cfg.ChromaRequestCollections); !ok {
 		return
 	}
 
 	log.Printf("💬 收到消息 [%s]: %s", req.UserID, req.Message)
+	c.Set(chatRequestContextKey, &req)
+
+	timings := newRequestTimings()
+	defer h.logRequestTimings(&req, timings)
+	c.Set(timingsContextKey, timings)
+
+	// 追踪：沿用上游 traceparent，各阶段记录为子 span
+	span := tracing.StartRoot("chat", c.GetHeader("traceparent"))
+	defer span.End()
+	span.SetAttribute("session.id", req.SessionID)
+	span.SetAttribute("user.id", req.UserID)
+	c.Set(traceSpanContextKey, span)
+
+	debugInfo := h.startDebug(c, req.Debug)
+	masker := h.startPIIMasking(c)
+
+	// 没有订单号的取消请求：先查询订单并确认，再取消
+	if h.handleCancelFlow(c, &req, span, timings) {
+		return
+	}
+
+	// 补全下单信息流程：用户在回答缺失的下单信息时直接合并，补全后执行下单
+	if h.handleOrderFlow(c, &req, span, timings, masker) {
+		return
+	}
 
 	// 1. RAG 检索 - 从知识库中搜索相关信息
-	knowledgeDocs, err := h.ragClient.SearchKnowledge(req.Message, 3)
-	if err != nil {
-		log.Printf("⚠️  RAG 检索失败: %v", err)
-		// 即使检索失败也继续处理
+	stopRAG := timings.measure(&timings.rag)
+	ragSpan := span.Child("rag.search", tracing.KindInternal)
+	knowledgeDocs, ragErr := h.searchKnowledge(knowledgeClient, req.Message)
+	ragSpan.SetAttribute("rag.documents", len(knowledgeDocs))
+	ragSpan.RecordError(ragErr)
+	ragSpan.End()
+	stopRAG()
+	debugInfo.setDocuments(knowledgeDocs)
+	h.setKnowledgeSources(c, &req, knowledgeDocs)
+	setGroundingDocuments(c, knowledgeDocs)
+
+	// 高置信度的常见问题直接返回知识库内容，不调用 LLM
+	if reply, ok := h.faqFastPathReply(req.Message, knowledgeDocs); ok {
+		h.writeReply(c, ChatResponse{
+			Reply:        reply,
+			SessionID:    req.SessionID,
+			FinishReason: "faq",
+		})
+		return
 	}
 
 	// 2. 构建消息历史
 	messages := []llm.Message{
 		{
-			Role: "system",
-			Content: `你是一个智能客服助手,负责帮助用户完成订单操作和解答问题。
-
-你的能力:
-1. 搜索商品 (search_product) - 当用户询问商品信息、价格、库存时
-2. 创建订单 (create_order) - 当用户提供商品名称、数量、姓名、电话、地址时
-3. 查询订单 (query_order) - 当用户询问订单状态时
-4. 取消订单 (cancel_order) - 当用户要求取消订单时
-5. 回答售后问题
-
-⚠️ 工具调用格式规范:
-当需要调用工具时,必须使用以下 XML 格式输出,参数名称必须精确匹配:
-
-搜索商品示例:
-<func_call>
-<tool_name>search_product</tool_name>
-<arguments>
-<keyword>山地自行车</keyword>
-</arguments>
-</func_call>
-
-创建订单示例:
-<func_call>
-<tool_name>create_order</tool_name>
-<arguments>
-<productName>山地自行车</productName>
-<quantity>2</quantity>
-<customerName>张三</customerName>
-<customerPhone>13800138000</customerPhone>
-<shippingAddress>北京市朝阳区建国路1号</shippingAddress>
-</arguments>
-</func_call>
-
-查询订单示例:
-<func_call>
-<tool_name>query_order</tool_name>
-<arguments>
-<orderNumber>ORD-1234567890</orderNumber>
-</arguments>
-</func_call>
-
-取消订单示例:
-<func_call>
-<tool_name>cancel_order</tool_name>
-<arguments>
-<orderNumber>ORD-1234567890</orderNumber>
-</arguments>
-</func_call>
-
-重要:
-- 必须严格按照上述 XML 格式输出
-- 在 <func_call> 标签前后可以添加说明文字
-- 如果信息不完整,先询问用户,不要调用工具`,
+			Role:    "system",
+			Content: h.systemPrompt(h.sessionPreferences(req.SessionID)),
 		},
 	}
 
+	// 示例对话（可选）
+	if fewShot := h.fewShotMessages(); len(fewShot) > 0 {
+		messages = append(messages, fewShot...)
+		log.Printf("🧪 添加示例对话,共 %d 组", len(h.fewShotExamples))
+	}
+
 	// 如果有知识库检索结果,添加到上下文
 	if len(knowledgeDocs) > 0 {
+		contextDocs := knowledgeDocs
+		if h.cfg.RAGStripInstructions {
+			contextDocs = rag.SanitizeDocuments(knowledgeDocs)
+		}
+		contextContent := rag.FormatContext(contextDocs, h.cfg.RAGMaxDocChars)
+		if h.cfg.CitationsEnabled {
+			contextContent = rag.FormatContextWithCitations(contextDocs, h.cfg.RAGMaxDocChars)
+		}
 		contextMsg := llm.Message{
 			Role:    "system",
-			Content: rag.FormatContext(knowledgeDocs),
+			Content: contextContent,
 		}
 		messages = append(messages, contextMsg)
 		log.Printf("📚 添加知识库上下文,共 %d 个文档", len(knowledgeDocs))
+	} else if ragErr != nil && h.cfg.RAGUnavailableNote {
+		// 检索失败（而非没有相关文档）时告知模型，避免凭空编造政策细节
+		messages = append(messages, llm.Message{
+			Role:    "system",
+			Content: knowledgeUnavailableNote,
+		})
+		log.Printf("📚 知识库不可用，已提示模型谨慎回答")
 	}
 
-	// 添加历史消息（前端传来的，已经限制在5轮以内）
+	// 添加历史消息（前端传来的，服务端再按 MAX_HISTORY_TURNS 限制轮数）
 	if len(req.History) > 0 {
 		log.Printf("📜 添加历史消息,共 %d 条", len(req.History))
-		for i, histMsg := range req.History {
-			// 跳过当前消息（前端会在 history 末尾包含当前消息）
-			if histMsg.Content == req.Message && histMsg.Role == "user" {
-				log.Printf("   跳过当前消息")
-				continue
-			}
-			
+		history := sanitizeHistory(req.History, req.Message)
+		if limited, droppedTurns := limitHistoryTurns(history, h.cfg.MaxHistoryTurns); droppedTurns > 0 {
+			log.Printf("✂️  历史消息超过 %d 轮，丢弃最早的 %d 轮", h.cfg.MaxHistoryTurns, droppedTurns)
+			history = limited
+		}
+		for i, histMsg := range history {
 			// 安全地截断内容用于日志
-			content := histMsg.Content
-			if len(content) > 50 {
-				content = content[:50] + "..."
-			}
-			log.Printf("   [%d] %s: %s", i+1, histMsg.Role, content)
+			log.Printf("   [%d] %s: %s", i+1, histMsg.Role, truncateForLog(histMsg.Content, 50))
 			
 			messages = append(messages, llm.Message{
 				Role:    histMsg.Role,
-				Content: histMsg.Content,
+				Content: masker.Mask(histMsg.Content),
 			})
 		}
 	} else {
@@ -164,177 +252,415 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 	}
 
 	// 添加当前用户消息
+	if len(req.Images) > 0 {
+		log.Printf("🖼️  当前消息包含 %d 张图片", len(req.Images))
+	}
 	messages = append(messages, llm.Message{
 		Role:    "user",
-		Content: req.Message,
+		Content: masker.Mask(req.Message),
+		Images:  req.Images,
 	})
 
-	// 3. 调用 LLM（不再传递 tools 参数，使用 XML 格式）
-	response, err := h.llmClient.Chat(messages, nil)
+	// 发送给 LLM 的手机号、地址等已替换为占位符，提示模型在工具参数中原样使用
+	if count := masker.Count(); count > 0 {
+		messages[0].Content += "\n\n" + piiPlaceholderNote
+		log.Printf("🔒 已脱敏 %d 处敏感信息", count)
+	}
+
+	// 裁剪历史消息，避免超出模型上下文窗口
+	if trimmed, droppedTurns := trimToTokenBudget(messages, h.cfg.ContextTokenBudget); droppedTurns > 0 {
+		log.Printf("✂️  超出上下文 token 预算 (%d)，丢弃最早的 %d 轮历史", h.cfg.ContextTokenBudget, droppedTurns)
+		messages = trimmed
+	}
+
+	// 3. 调用 LLM（不再传递 tools 参数，使用 XML 格式），按意图路由模型
+	model := h.routeModel(req.Message, req.History)
+	stopLLM := timings.measure(&timings.llm)
+	llmSpan := span.Child("llm.chat", tracing.KindClient)
+	llmSpan.SetAttribute("llm.model", model)
+	response, err := h.chatLLM(c, model, h.decideParams(), messages)
+	llmSpan.RecordError(err)
+	llmSpan.End()
+	stopLLM()
+	// 客户端已断开：不再执行工具、不记录会话，也不写响应
+	if clientDisconnected(c) {
+		return
+	}
 	if err != nil {
 		log.Printf("❌ LLM 调用失败: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理失败,请稍后再试"})
+		respondLLMError(c, err)
 		return
 	}
 
-	// 提取响应文本
-	responseText := response.Output.Text
+	// 提取响应文本（推理模型的思考过程单独记录，不进入回复）
+	responseText := h.llmClient.GetTextResponse(response)
+	debugInfo.addReasoning(h.llmClient.GetReasoningContent(response))
+	finishReason := h.llmClient.GetFinishReason(response)
 	log.Printf("🤖 LLM 原始响应: %s", responseText)
 
-	// 4. 检查是否包含工具调用（XML 格式）
-	if toolCall, found := h.parseToolCallFromXML(responseText); found {
-		log.Printf("🔧 检测到工具调用: %s", toolCall.ToolName)
-		
-		// 执行工具
-		result, err := h.toolExecutor.Execute(toolCall.ToolName, toolCall.Arguments)
-		if err != nil {
-			log.Printf("❌ 工具执行失败: %v", err)
-			c.JSON(http.StatusOK, ChatResponse{
-				Reply:     fmt.Sprintf("抱歉，订单处理失败: %v", err),
-				SessionID: req.SessionID,
+	// 4. 检查是否包含工具调用（优先 XML 格式，其次 JSON 代码块格式）
+	toolCall, found := h.parseToolCall(masker.Unmask(responseText))
+	if found && !isKnownTool(toolCall.ToolName) {
+		log.Printf("⚠️  未知的工具名称: %s", toolCall.ToolName)
+		found = false
+	}
+
+	// 包含 <func_call> 但解析失败（格式错误或被截断）时，提示模型修正并重试一次
+	if !found && (strings.Contains(responseText, "<func_call>") || isTruncatedToolCall(responseText, finishReason)) {
+		stopRepair := timings.measure(&timings.llm)
+		repairSpan := span.Child("llm.repair_tool_call", tracing.KindClient)
+		repairSpan.SetAttribute("tool.truncated", isTruncatedToolCall(responseText, finishReason))
+		responseText, finishReason, toolCall, found = h.repairToolCall(model, messages, responseText, finishReason, masker)
+		repairSpan.SetAttribute("tool.found", found)
+		repairSpan.End()
+		stopRepair()
+	}
+
+	// 占位符还原为真实值，之后的回复内容只在本地使用
+	responseText = masker.Unmask(responseText)
+
+	// 取消订单时补充用户消息中的取消原因
+	if found && toolCall.ToolName == "cancel_order" {
+		toolCall.Arguments = withCancelReason(toolCall.Arguments, req.Message)
+	}
+
+	// 模型没有填全下单参数时先合并会话中已收集的参数，再从整段对话中补全，然后用登录用户的默认资料补全客户信息，
+	// 演示模式下最后补全仍缺失的客户信息
+	var demoFilled, profileFilled []string
+	if found && toolCall.ToolName == "create_order" {
+		var carried []string
+		toolCall.Arguments, carried = h.resumeOrderFlow(&req, toolCall.Arguments)
+		toolCall.Arguments = h.fillOrderArguments(span, &req, toolCall.Arguments, masker)
+		toolCall.Arguments, profileFilled = h.applyProfileDefaults(&req, toolCall.Arguments)
+		profileFilled = append(carried, profileFilled...)
+		toolCall.Arguments, demoFilled = h.applyDemoDefaults(toolCall.Arguments)
+	}
+
+	if found {
+		debugInfo.setToolCall(toolCall)
+	}
+
+	// 拦截未启用的工具调用（"仅咨询"模式下引导用户前往网站）
+	if found && !h.isToolAllowed(toolCall.ToolName) {
+		log.Printf("🚫 工具未启用，拒绝执行: %s", toolCall.ToolName)
+		reply := toolDisabledReply
+		if h.cfg.AdvisoryOnly && mutatingTools[toolCall.ToolName] {
+			reply = advisoryRedirectReply
+		}
+		h.writeReply(c, ChatResponse{
+			Reply:        reply,
+			SessionID:    req.SessionID,
+			FinishReason: finishReason,
+		})
+		return
+	}
+
+	// 缺少必需参数时不调用工具，先询问用户
+	if found {
+		if missing := mcp.MissingRequiredArgs(toolCall.ToolName, toolCall.Arguments); len(missing) > 0 {
+			log.Printf("⚠️  工具 %s 缺少必需参数: %v", toolCall.ToolName, missing)
+			if toolCall.ToolName == "create_order" {
+				h.startOrderFlow(&req, toolCall.Arguments, profileFilled)
+			}
+			h.writeReply(c, ChatResponse{
+				Reply:        h.missingArgsReply(responseText, missing),
+				SessionID:    req.SessionID,
+				FinishReason: finishReason,
 			})
 			return
 		}
+	}
 
-		log.Printf("✅ 工具执行成功: %s", result)
+	// 使用了用户默认资料或开启了下单确认的订单先请用户确认，确认后再提交
+	if found && toolCall.ToolName == "create_order" && (len(profileFilled) > 0 || h.cfg.OrderConfirmation) {
+		if reply, ok := h.startOrderConfirmation(&req, toolCall.Arguments, profileFilled); ok {
+			h.writeReply(c, ChatResponse{
+				Reply:        reply,
+				SessionID:    req.SessionID,
+				FinishReason: finishReason,
+			})
+			return
+		}
+	}
 
-		// 构建最终回复（包含工具执行结果）
-		finalReply := h.buildFinalReply(responseText, result)
-		
-		c.JSON(http.StatusOK, ChatResponse{
-			Reply:     finalReply,
-			SessionID: req.SessionID,
-		})
+	if found {
+		h.runToolCall(c, &req, span, timings, toolCall, responseText, finishReason, demoFilled)
 		return
 	}
 
 	// 5. 没有工具调用，直接返回 LLM 响应
 	log.Printf("✅ 普通回复（无工具调用）")
 
-	c.JSON(http.StatusOK, ChatResponse{
-		Reply:     responseText,
-		SessionID: req.SessionID,
+	// 模型返回空白内容时使用默认回复（不附加参考资料）
+	if strings.TrimSpace(responseText) == "" {
+		log.Printf("⚠️  LLM 返回空白内容")
+		responseText = emptyReply(false)
+	} else if h.cfg.CitationsEnabled {
+		// 追加引用的参考资料
+		responseText = rag.AppendCitations(responseText, knowledgeDocs, h.cfg.CitationsShowRelevance)
+	}
+
+	h.writeReply(c, ChatResponse{
+		Reply:        responseText,
+		SessionID:    req.SessionID,
+		FinishReason: finishReason,
 	})
 }
 
-// chatWithToolCalling 支持工具调用的聊天
-func (h *ChatHandler) chatWithToolCalling(messages []llm.Message, tools []llm.Tool) (string, error) {
-	maxIterations := 5 // 最多允许 5 轮工具调用
-	currentMessages := messages
+// runToolCall 执行工具调用并返回最终回复（包含格式化后的工具执行结果），
+// 创建/取消订单超过频率限制时不执行，引导用户前往网站操作
+func (h *ChatHandler) runToolCall(c *gin.Context, req *ChatRequest, span *tracing.Span, timings *requestTimings, toolCall ToolCallInfo, responseText, finishReason string, demoFilled []string) {
+	log.Printf("🔧 检测到工具调用: %s", toolCall.ToolName)
+
+	// 执行工具（长耗时工具会上报进度）
+	stopTool := timings.measure(&timings.tool)
+	result, err := h.executeTool(c, req, span, toolCall.ToolName, toolCall.Arguments, toolProgress(c, toolCall.ToolName))
+	stopTool()
+	if errors.Is(err, errToolRateLimited) {
+		h.writeReply(c, ChatResponse{
+			Reply:        toolRateLimitedReply,
+			SessionID:    req.SessionID,
+			FinishReason: finishReason,
+			Error:        &APIError{Code: ErrCodeRateLimited, Message: "工具调用超过频率限制: " + toolCall.ToolName},
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ 工具执行失败: %v", err)
+		h.writeReply(c, ChatResponse{
+			Reply:        h.messages.Text(msgToolFailed, "error", err.Error()),
+			SessionID:    req.SessionID,
+			FinishReason: finishReason,
+			ToolCalled:   true,
+			ToolName:     toolCall.ToolName,
+			Error:        &APIError{Code: ErrCodeToolError, Message: err.Error()},
+		})
+		return
+	}
 
-	for i := 0; i < maxIterations; i++ {
-		// 调用 LLM
-		response, err := h.llmClient.Chat(currentMessages, tools)
-		if err != nil {
-			return "", err
-		}
+	log.Printf("✅ 工具执行成功: %s", result)
+	debugFromContext(c).addRawToolResult(result)
+	recordAction(c, toolCall.ToolName, toolCall.Arguments, result)
 
-		// 检查是否需要调用工具
-		if h.llmClient.ShouldCallTool(response) {
-			toolCalls := h.llmClient.GetToolCalls(response)
-			log.Printf("🔧 LLM 请求调用 %d 个工具", len(toolCalls))
+	if toolCall.ToolName == "create_order" && !req.DryRun {
+		h.notifyOrderCreated(req, toolCall.Arguments, result)
+	}
 
-			// 添加 assistant 消息
-			assistantMsg := llm.Message{
-				Role:    "assistant",
-				Content: "",
-			}
-			currentMessages = append(currentMessages, assistantMsg)
-
-			// 执行所有工具调用
-			for _, toolCall := range toolCalls {
-				log.Printf("   - 工具: %s", toolCall.Function.Name)
-
-				// 执行工具
-				result, err := h.toolExecutor.Execute(toolCall.Function.Name, toolCall.Function.Arguments)
-				if err != nil {
-					result = fmt.Sprintf("工具执行失败: %v", err)
-					log.Printf("❌ 工具执行失败: %v", err)
-				}
-
-				// 添加工具结果到消息历史
-				toolResultMsg := llm.Message{
-					Role:    "tool",
-					Content: result,
-				}
-
-				// 如果工具结果是 JSON,尝试美化
-				if json.Valid([]byte(result)) {
-					var prettyJSON map[string]interface{}
-					if err := json.Unmarshal([]byte(result), &prettyJSON); err == nil {
-						prettyBytes, _ := json.MarshalIndent(prettyJSON, "", "  ")
-						toolResultMsg.Content = string(prettyBytes)
-					}
-				}
-
-				currentMessages = append(currentMessages, toolResultMsg)
-			}
+	// 构建最终回复（包含格式化后的工具执行结果）
+	formattedResult, toolResult := formatToolResult(toolCall.ToolName, result)
+	finalReply := h.buildFinalReply(responseText, formattedResult)
+	if len(demoFilled) > 0 {
+		finalReply += h.demoDefaultsNote(demoFilled)
+	}
+
+	order, _ := toolResult.Data.(*OrderResult)
+	h.writeReply(c, ChatResponse{
+		Reply:        finalReply,
+		SessionID:    req.SessionID,
+		FinishReason: finishReason,
+		ToolCalled:   true,
+		ToolName:     toolCall.ToolName,
+		ToolResults:  []ToolResult{toolResult},
+		Order:        order,
+	})
+}
+
+// executorFor 返回处理该请求的工具执行器，dryRun 请求使用模拟执行的执行器
+func (h *ChatHandler) executorFor(req *ChatRequest) *mcp.ToolExecutor {
+	if req.DryRun {
+		return h.toolExecutor.DryRun()
+	}
+	return h.toolExecutor
+}
 
-			// 继续下一轮对话
-			continue
+// progressLogger 返回记录工具执行进度的回调
+func progressLogger(toolName string) mcp.ProgressFunc {
+	return func(progress mcp.MCPProgress) {
+		if percent := progress.Percent(); percent >= 0 {
+			log.Printf("⏳ [%s] 正在处理…(%d%%) %s", toolName, percent, progress.Message)
+		} else {
+			log.Printf("⏳ [%s] 正在处理… %s", toolName, progress.Message)
 		}
+	}
+}
 
-		// 没有工具调用,返回最终回复
-		return h.llmClient.GetTextResponse(response), nil
+// decideParams 决定/提取阶段（是否调用工具、提取参数）的生成参数：低随机性
+func (h *ChatHandler) decideParams() llm.GenerationParams {
+	return llm.GenerationParams{
+		Name:        "decide",
+		Temperature: h.cfg.DecideTemperature,
+		TopP:        h.cfg.DecideTopP,
 	}
+}
 
-	return "抱歉,处理您的请求时遇到了问题,请稍后再试。", nil
+// summarizeParams 总结工具结果阶段的生成参数：较高随机性，回复更自然
+func (h *ChatHandler) summarizeParams() llm.GenerationParams {
+	return llm.GenerationParams{
+		Name:        "summarize",
+		Temperature: h.cfg.SummarizeTemperature,
+		TopP:        h.cfg.SummarizeTopP,
+	}
 }
 
-// handleOrderIntent 处理订单相关的用户意图
-func (h *ChatHandler) handleOrderIntent(message string) (string, bool) {
-	// 简单的关键词匹配识别订单操作意图
-	
-	// 1. 检查是否是创建订单意图
-	if strings.Contains(message, "下单") || strings.Contains(message, "购买") || strings.Contains(message, "买") {
-		// 尝试从消息中提取订单信息
-		orderInfo := h.extractOrderInfo(message)
-		if orderInfo != nil {
-			// 调用 create_order 工具
-			args, _ := json.Marshal(orderInfo)
-			result, err := h.toolExecutor.Execute("create_order", string(args))
-			if err != nil {
-				return fmt.Sprintf("订单创建失败：%v。请访问网站直接下单。", err), true
-			}
-			return result, true
+// knowledgeTopK 最终加入上下文的知识库文档数
+const knowledgeTopK = 3
+
+// searchKnowledge 检索知识库；启用重排序时先召回更多候选再由 LLM 重排序
+// 返回的 error 仅表示检索失败（知识库不可用），没有相关文档时返回空列表和 nil
+func (h *ChatHandler) searchKnowledge(client *rag.ChromaClient, query string) ([]rag.Document, error) {
+	where := inferKnowledgeFilter(query, h.cfg.KnowledgeFilterRules)
+
+	if !h.cfg.RAGRerank {
+		knowledgeDocs, err := h.filteredSearch(client, query, knowledgeTopK, where)
+		if err != nil {
+			log.Printf("⚠️  RAG 检索失败: %v", err)
+			// 即使检索失败也继续处理
+			return nil, err
 		}
-		return "我理解您想要下单，但订单信息不完整。请提供：商品ID、数量、姓名、电话、地址。或者您可以访问网站直接下单。", true
+		return knowledgeDocs, nil
 	}
-	
-	// 2. 检查是否是查询订单意图
-	if strings.Contains(message, "查询订单") || strings.Contains(message, "订单状态") {
-		// 提取订单号
-		orderNumber := h.extractOrderNumber(message)
-		if orderNumber != "" {
-			args, _ := json.Marshal(map[string]string{"orderNumber": orderNumber})
-			result, err := h.toolExecutor.Execute("query_order", string(args))
-			if err != nil {
-				return fmt.Sprintf("订单查询失败：%v", err), true
-			}
-			return result, true
+
+	candidates, err := h.filteredSearch(client, query, h.cfg.RAGRerankCandidates, where)
+	if err != nil {
+		log.Printf("⚠️  RAG 检索失败: %v", err)
+		return nil, err
+	}
+
+	reranked, err := client.RerankDocuments(query, candidates, knowledgeTopK)
+	if err != nil {
+		log.Printf("⚠️  重排序失败，使用向量距离排序: %v", err)
+		if len(candidates) > knowledgeTopK {
+			candidates = candidates[:knowledgeTopK]
 		}
-		return "请提供订单号，格式如：ORD-1729512345", true
+		return candidates, nil
 	}
-	
-	// 3. 检查是否是取消订单意图
-	if strings.Contains(message, "取消订单") || strings.Contains(message, "退单") {
-		orderNumber := h.extractOrderNumber(message)
-		if orderNumber != "" {
-			args, _ := json.Marshal(map[string]string{"orderNumber": orderNumber})
-			result, err := h.toolExecutor.Execute("cancel_order", string(args))
-			if err != nil {
-				return fmt.Sprintf("订单取消失败：%v", err), true
+
+	return reranked, nil
+}
+
+// toolCallRepairPrompt 工具调用格式有误时的修正提示
+const toolCallRepairPrompt = "你的工具调用格式有误，请严格按照格式重新输出"
+
+// truncatedToolCallPrompt 工具调用被截断时要求模型只输出完整的工具调用
+const truncatedToolCallPrompt = "你的工具调用在输出中途被截断了（缺少 </func_call>），请只输出完整的 <func_call>...</func_call>，不要添加其他说明文字"
+
+// truncatedToolCallNotice 被截断的工具调用重试后仍无法解析时，请用户重新发送
+const truncatedToolCallNotice = "抱歉，刚才的操作没有处理完整，请再发送一次您的请求。"
+
+// repairToolCall 工具调用格式有误时用同一个模型（model 为路由选择的模型）重新提示并重试解析，
+// 连同首次调用最多调用 LLM maxToolIterations 轮，仍无法解析时返回上限提示并记录每一轮的输出；
+// masker 用于在解析前还原脱敏占位符
+func (h *ChatHandler) repairToolCall(model string, messages []llm.Message, responseText, finishReason string, masker *piiMasker) (string, string, ToolCallInfo, bool) {
+	maxIterations := h.maxToolIterations()
+	truncated := isTruncatedToolCall(responseText, finishReason)
+	trace := []toolTraceEntry{{Iteration: 1, Response: responseText, Problem: toolCallProblem(truncated)}}
+	repairMessages := append([]llm.Message{}, messages...)
+
+	for attempt := 2; attempt <= maxIterations; attempt++ {
+		prompt := toolCallRepairPrompt
+		if truncated {
+			log.Printf("✂️  工具调用被截断（finish_reason=%s，第 %d 次尝试）: %s", finishReason, attempt-1, responseText)
+			prompt = truncatedToolCallPrompt
+		} else {
+			log.Printf("🔁 工具调用格式有误（第 %d 次尝试）: %s", attempt-1, responseText)
+		}
+		repairMessages = append(repairMessages,
+			llm.Message{Role: "assistant", Content: responseText},
+			llm.Message{Role: "user", Content: prompt},
+		)
+
+		response, err := h.llmClient.ChatWithOptions(model, h.decideParams(), repairMessages, nil)
+		if err != nil {
+			log.Printf("❌ 修正工具调用时 LLM 调用失败: %v", err)
+			if truncated {
+				return discardTruncatedToolCall(responseText), finishReason, ToolCallInfo{}, false
 			}
-			return result, true
+			return discardBrokenToolCall(responseText), finishReason, ToolCallInfo{}, false
 		}
-		return "请提供要取消的订单号，格式如：ORD-1729512345", true
+
+		responseText = h.llmClient.GetTextResponse(response)
+		finishReason = h.llmClient.GetFinishReason(response)
+		log.Printf("🔁 修正后的响应（第 %d 次尝试）: %s", attempt, responseText)
+
+		toolCall, found := h.parseToolCall(masker.Unmask(responseText))
+		if found && isKnownTool(toolCall.ToolName) {
+			log.Printf("✅ 工具调用修正成功: %s", toolCall.ToolName)
+			return responseText, finishReason, toolCall, true
+		}
+		if !strings.Contains(responseText, "<func_call>") && !isTruncatedToolCall(responseText, finishReason) {
+			// 模型放弃调用工具，直接回复用户
+			log.Printf("⚠️  修正后的响应不包含工具调用，放弃执行工具")
+			return discardBrokenToolCall(responseText), finishReason, ToolCallInfo{}, false
+		}
+		truncated = isTruncatedToolCall(responseText, finishReason)
+		trace = append(trace, toolTraceEntry{Iteration: attempt, Response: responseText, Problem: toolCallProblem(truncated)})
 	}
-	
-	return "", false // 不是订单意图
+
+	logToolTrace(maxIterations, trace)
+	return maxToolIterationsReply, finishReason, ToolCallInfo{}, false
+}
+
+// toolCallProblem 工具调用无法解析的原因（用于调用记录）
+func toolCallProblem(truncated bool) string {
+	if truncated {
+		return "被截断"
+	}
+	return "格式有误"
+}
+
+// discardTruncatedToolCall 移除被截断的工具调用（包括末尾残缺的开始标签），保留说明文字并请用户重试
+func discardTruncatedToolCall(responseText string) string {
+	if idx := strings.Index(responseText, "<func_call>"); idx >= 0 {
+		responseText = responseText[:idx]
+	}
+	responseText = responseText[:len(responseText)-partialTagSuffix(responseText, "<func_call>")]
+	responseText = strings.TrimSpace(responseText)
+	if responseText == "" {
+		return truncatedToolCallNotice
+	}
+	return responseText + "\n\n" + truncatedToolCallNotice
 }
 
-// extractOrderInfo 从消息中提取订单信息
-func (h *ChatHandler) extractOrderInfo(message string) map[string]interface{} {
+// discardBrokenToolCall 移除无法解析的工具调用，保留说明文字
+func discardBrokenToolCall(responseText string) string {
+	if idx := strings.Index(responseText, "<func_call>"); idx >= 0 {
+		responseText = responseText[:idx]
+	}
+	responseText = strings.TrimSpace(responseText)
+	if responseText == "" {
+		return "抱歉，我没能正确处理您的请求，请换个说法或稍后再试。"
+	}
+	return responseText
+}
+
+// maxToolIterationsReply 工具调用轮数达到上限时的回复
+const maxToolIterationsReply = "抱歉,您的请求需要的操作步骤过多,超出了单次对话的处理上限。请把需求拆分得更具体一些(例如直接提供订单号或商品名称)后再试。"
+
+// toolTraceEntry 一轮工具调用的记录（用于排查工具调用循环）
+type toolTraceEntry struct {
+	Iteration int
+	Response  string // 模型输出
+	Problem   string // 无法执行的原因
+}
+
+// maxToolIterations 单次请求允许的最大工具调用轮数（包括首次调用 LLM）
+func (h *ChatHandler) maxToolIterations() int {
+	if h.cfg.MaxToolIterations > 0 {
+		return h.cfg.MaxToolIterations
+	}
+	return 5
+}
+
+// logToolTrace 工具调用轮数达到上限时输出完整的调用记录
+func logToolTrace(maxIterations int, trace []toolTraceEntry) {
+	log.Printf("🛑 工具调用达到上限 (%d 轮)，没有得到可执行的工具调用:", maxIterations)
+	for _, entry := range trace {
+		log.Printf("   [第 %d 轮] %s: %s", entry.Iteration, entry.Problem, truncateForLog(entry.Response, 200))
+	}
+}
+
+// extractOrderFieldsRegex 用正则表达式从消息中提取订单字段，只返回提取到的字段
+func extractOrderFieldsRegex(message string) map[string]interface{} {
 	// 使用正则表达式提取订单信息
 	// 格式示例："下单：商品ID=1，数量1，鹿城，13800138000，北京朝阳区建国路1号"
 	
@@ -357,48 +683,44 @@ func (h *ChatHandler) extractOrderInfo(message string) map[string]interface{} {
 	}
 	
 	// 提取姓名（简单规则：2-4个汉字）
-	if matched := regexp.MustCompile(`[姓名客户收货人][=是:：\s]*([\\p{Han}]{2,4})`).FindStringSubmatch(message); len(matched) > 1 {
+	if matched := regexp.MustCompile(`[姓名客户收货人][=是:：\s]*(\p{Han}{2,4})`).FindStringSubmatch(message); len(matched) > 1 {
 		name = matched[1]
-	} else if matched := regexp.MustCompile(`customerName[=:]\s*([\\p{Han}]+)`).FindStringSubmatch(message); len(matched) > 1 {
+	} else if matched := regexp.MustCompile(`customerName[=:]\s*(\p{Han}+)`).FindStringSubmatch(message); len(matched) > 1 {
 		name = matched[1]
 	} else {
 		// 尝试找到独立的中文名字
-		if matched := regexp.MustCompile(`[，,]\s*([\\p{Han}]{2,4})[，,]`).FindStringSubmatch(message); len(matched) > 1 {
+		if matched := regexp.MustCompile(`[，,]\s*(\p{Han}{2,4})[，,]`).FindStringSubmatch(message); len(matched) > 1 {
 			name = matched[1]
 		}
 	}
 	
-	// 提取电话（11位数字）
-	if matched := regexp.MustCompile(`1[3-9]\d{9}`).FindStringSubmatch(message); len(matched) > 0 {
-		phone = matched[0]
+	// 提取电话（11位数字，允许空格、短横线等分隔符）
+	if matched := messyPhoneRegex.FindString(message); matched != "" {
+		phone = normalizePhone(matched)
 	}
 	
 	// 提取地址（包含"市"、"区"、"路"等关键字的文本）
 	if matched := regexp.MustCompile(`[地址配送收货][=是:：\s]*(.+?)(?:[，,。]|$)`).FindStringSubmatch(message); len(matched) > 1 {
 		address = matched[1]
-	} else if matched := regexp.MustCompile(`([\\p{Han}]+[市区县][\\p{Han}]+[路街道号]\d*号?[\\p{Han}\\d]*)`).FindStringSubmatch(message); len(matched) > 0 {
+	} else if matched := regexp.MustCompile(`(\p{Han}+[市区县]\p{Han}+[路街道号]\d*号?[\p{Han}\d]*)`).FindStringSubmatch(message); len(matched) > 0 {
 		address = matched[0]
 	}
 	
-	// 验证是否所有必需信息都有
-	if productID > 0 && quantity > 0 && name != "" && phone != "" && address != "" {
-		return map[string]interface{}{
-			"productId":       productID,
-			"quantity":        quantity,
-			"customerName":    name,
-			"customerPhone":   phone,
-			"shippingAddress": address,
-		}
+	fields := make(map[string]interface{})
+	if productID > 0 {
+		fields["productId"] = productID
 	}
-	
-	return nil
-}
-
-// extractOrderNumber 从消息中提取订单号
-func (h *ChatHandler) extractOrderNumber(message string) string {
-	// 匹配 ORD-开头的订单号
-	if matched := regexp.MustCompile(`ORD-\d+`).FindStringSubmatch(message); len(matched) > 0 {
-		return matched[0]
+	if quantity > 0 {
+		fields["quantity"] = quantity
 	}
-	return ""
-}
\ No newline at end of file
+	if name != "" {
+		fields["customerName"] = name
+	}
+	if phone != "" {
+		fields["customerPhone"] = phone
+	}
+	if address != "" {
+		fields["shippingAddress"] = address
+	}
+	return fields
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-ai-service/config"
+	"go-ai-service/llm"
+	"go-ai-service/mcp"
+	"go-ai-service/rag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeLLM 按顺序返回预设回复的 DashScope 文本生成接口（回复用完后重复最后一条），嵌入接口始终返回错误
+type fakeLLM struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	replies  []string
+	requests []map[string]interface{} // 收到的文本生成请求体
+}
+
+// newFakeLLM 启动返回 replies 的 fakeLLM（测试结束时关闭）
+func newFakeLLM(t *testing.T, replies ...string) *fakeLLM {
+	t.Helper()
+	f := &fakeLLM{replies: replies}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeLLM) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/text-generation/generation") {
+		http.Error(w, `{"code":"InternalError","message":"fake"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+	f.mu.Lock()
+	f.requests = append(f.requests, payload)
+	reply := f.replies[0]
+	if len(f.replies) > 1 {
+		f.replies = f.replies[1:]
+	}
+	f.mu.Unlock()
+
+	choice := map[string]interface{}{
+		"finish_reason": "stop",
+		"message":       map[string]interface{}{"role": "assistant", "content": reply},
+	}
+	if r.Header.Get("X-DashScope-SSE") != "enable" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"request_id": "fake",
+			"output":     map[string]interface{}{"choices": []interface{}{choice}},
+		})
+		return
+	}
+
+	// 流式请求：每个字符一个事件，最后一个事件带结束原因
+	w.Header().Set("Content-Type", "text/event-stream")
+	runes := []rune(reply)
+	for i, r := range runes {
+		finish := "null"
+		if i == len(runes)-1 {
+			finish = "stop"
+		}
+		chunk, _ := json.Marshal(map[string]interface{}{
+			"request_id": "fake",
+			"output": map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+				"finish_reason": finish,
+				"message":       map[string]interface{}{"role": "assistant", "content": string(r)},
+			}}},
+		})
+		io.WriteString(w, "event:result\ndata:"+string(chunk)+"\n\n")
+		w.(http.Flusher).Flush()
+	}
+}
+
+// requestCount 收到的文本生成请求数
+func (f *fakeLLM) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// testConfig 加载默认配置，setup 可在创建处理器前修改
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	t.Setenv("DASHSCOPE_API_KEY", "test-key")
+	return config.LoadConfig()
+}
+
+// newTestHandler 创建使用 fakeLLM 的聊天处理器：知识库检索总是失败，工具执行器没有可用的 MCP Server 和商城
+func newTestHandler(t *testing.T, cfg *config.Config, fake *fakeLLM) *ChatHandler {
+	t.Helper()
+	llmClient := llm.NewDashScopeClient(cfg.DashScopeAPIKey, fake.server.Client())
+	llmClient.SetBaseURL(fake.server.URL)
+
+	ragClient := rag.NewChromaClient("127.0.0.1", "1", cfg.DashScopeAPIKey, nil)
+	ragClient.SetDashScopeBaseURL(fake.server.URL)
+	ragClient.SetEmbeddingRetry(0, 0, false)
+	ragClient.SetChromaRetry(0, 0)
+
+	return NewChatHandler(llmClient, ragClient, mcp.NewToolExecutor("http://127.0.0.1:1", nil), cfg)
+}
+
+// postChat 调用 HandleChat，返回响应
+func postChat(t *testing.T, h *ChatHandler, req map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	router := gin.New()
+	router.POST("/chat", h.HandleChat)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/chat", bytes.NewReader(body)))
+	return recorder
+}
+
+// decodeChat 解析 JSON 聊天响应
+func decodeChat(t *testing.T, recorder *httptest.ResponseRecorder) ChatResponse {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body = %s", recorder.Code, recorder.Body.String())
+	}
+	var resp ChatResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v, body = %s", err, recorder.Body.String())
+	}
+	return resp
+}
+
+// toolCallReply 模型输出的 XML 工具调用
+func toolCallReply(text, tool string, args map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString(text + "\n<func_call>\n<tool_name>" + tool + "</tool_name>\n<arguments>\n")
+	for name, value := range args {
+		sb.WriteString("<" + name + ">" + value + "</" + name + ">\n")
+	}
+	sb.WriteString("</arguments>\n</func_call>")
+	return sb.String()
+}
+
+func TestHandleChatPlainReply(t *testing.T) {
+	fake := newFakeLLM(t, "您好，山地车有货。")
+	h := newTestHandler(t, testConfig(t), fake)
+
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "有山地车吗", "sessionId": "s1"}))
+	if resp.Reply != "您好，山地车有货。" || resp.ToolCalled || resp.Action != ActionNone {
+		t.Errorf("响应 = %+v", resp)
+	}
+}
+
+func TestRepairToolCallUsesRoutedModel(t *testing.T) {
+	fake := newFakeLLM(t,
+		"<func_call>\n<arguments>\n<keyword>山地车</keyword>\n</arguments>\n</func_call>", // 缺少工具名，触发修正
+		"抱歉，请问您想找什么商品？",
+	)
+	cfg := testConfig(t)
+	cfg.ModelRouting = true
+	cfg.ModelRoutes = map[string]string{intentGeneral: "qwen-turbo"}
+	h := newTestHandler(t, cfg, fake)
+
+	decodeChat(t, postChat(t, h, map[string]interface{}{"message": "你好", "sessionId": "s1"}))
+	if fake.requestCount() != 2 {
+		t.Fatalf("LLM 请求数 = %d, want 2（首次调用和修正）", fake.requestCount())
+	}
+	for i, payload := range fake.requests {
+		if payload["model"] != "qwen-turbo" {
+			t.Errorf("第 %d 次请求的模型 = %v, want 路由选择的 qwen-turbo", i+1, payload["model"])
+		}
+	}
+}
+
+func TestRepairToolCallStopsAtMaxIterations(t *testing.T) {
+	broken := "<func_call>\n<arguments>\n<keyword>山地车</keyword>\n</arguments>\n</func_call>" // 缺少工具名
+
+	tests := []struct {
+		name          string
+		maxIterations int
+		replies       []string
+		wantRequests  int
+		wantReply     string
+	}{
+		{"始终格式有误时达到上限", 3, []string{broken}, 3, maxToolIterationsReply},
+		{"上限为 1 时不重试", 1, []string{broken}, 1, maxToolIterationsReply},
+		{"未配置时使用默认上限", 0, []string{broken}, 5, maxToolIterationsReply},
+		{"重试后放弃调用工具", 3, []string{broken, "请问您想找什么商品？"}, 2, "请问您想找什么商品？"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLLM(t, tt.replies...)
+			cfg := testConfig(t)
+			cfg.MaxToolIterations = tt.maxIterations
+			h := newTestHandler(t, cfg, fake)
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "有山地车吗", "sessionId": "s1"}))
+			if fake.requestCount() != tt.wantRequests {
+				t.Errorf("LLM 请求数 = %d, want %d", fake.requestCount(), tt.wantRequests)
+			}
+			if resp.Reply != tt.wantReply || resp.ToolCalled {
+				t.Errorf("响应 = %+v, want reply %q", resp, tt.wantReply)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"go-ai-service/llm"
+	"log"
+)
+
+// messageTokenOverhead 每条消息的固定开销（角色、分隔符等）的估算值
+const messageTokenOverhead = 4
+
+// estimateTokens 粗略估算文本的 token 数
+// 中文等非 ASCII 字符约 1 字符 1 token，ASCII 约 4 字符 1 token
+func estimateTokens(text string) int {
+	asciiCount := 0
+	tokens := 0
+	for _, r := range text {
+		if r < 0x80 {
+			asciiCount++
+		} else {
+			tokens++
+		}
+	}
+	return tokens + (asciiCount+3)/4
+}
+
+// estimateMessagesTokens 估算消息列表的总 token 数
+func estimateMessagesTokens(messages []llm.Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content) + messageTokenOverhead
+	}
+	return total
+}
+
+// trimToTokenBudget 按轮次丢弃最早的历史消息，直到估算 token 数不超过预算
+// 开头的 system 消息和最后一条（当前用户）消息永远保留，返回裁剪后的消息和丢弃的轮数
+func trimToTokenBudget(messages []llm.Message, budget int) ([]llm.Message, int) {
+	if budget <= 0 || estimateMessagesTokens(messages) <= budget || len(messages) < 2 {
+		return messages, 0
+	}
+
+	// 开头的 system 消息（系统提示词、知识库上下文）
+	head := 0
+	for head < len(messages)-1 && messages[head].Role == "system" {
+		head++
+	}
+
+	history := messages[head : len(messages)-1]
+	current := messages[len(messages)-1]
+
+	fits := func(history []llm.Message) bool {
+		total := estimateMessagesTokens(messages[:head]) + estimateMessagesTokens(history) + estimateMessagesTokens([]llm.Message{current})
+		return total <= budget
+	}
+
+	droppedTurns := 0
+	for len(history) > 0 && !fits(history) {
+		// 丢弃一整轮：第一条消息及其后直到下一条用户消息之前的所有回复
+		history = history[1:]
+		for len(history) > 0 && history[0].Role != "user" {
+			history = history[1:]
+		}
+		droppedTurns++
+	}
+
+	trimmed := make([]llm.Message, 0, head+len(history)+1)
+	trimmed = append(trimmed, messages[:head]...)
+	trimmed = append(trimmed, history...)
+	trimmed = append(trimmed, current)
+
+	if !fits(history) {
+		log.Printf("⚠️  丢弃全部历史后仍超出 token 预算 (%d)", budget)
+	}
+
+	return trimmed, droppedTurns
+}
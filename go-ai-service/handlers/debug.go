@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"go-ai-service/rag"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// debugContextKey gin.Context 中保存调试信息的键
+const debugContextKey = "chatDebugInfo"
+
+// DebugInfo 调试信息（仅在授权的 debug 请求中返回）
+type DebugInfo struct {
+	ToolCall       *ToolCallInfo  `json:"toolCall,omitempty"`       // 解析出的工具调用
+	RawToolResults []string       `json:"rawToolResults,omitempty"` // MCP Server 返回的原始结果
+	RAGDocuments   []rag.Document `json:"ragDocuments,omitempty"`   // 检索到的知识库文档
+	Reasoning      []string       `json:"reasoning,omitempty"`      // 推理模型的思考过程（每次 LLM 调用一条）
+}
+
+// startDebug 为授权的 debug 请求创建调试信息并保存到上下文，未授权时返回 nil
+func (h *ChatHandler) startDebug(c *gin.Context, requested bool) *DebugInfo {
+	if !requested {
+		return nil
+	}
+	if !apiKeyValid(c, h.cfg.AdminAPIKey) {
+		log.Printf("⚠️  未授权的 debug 请求，忽略调试输出")
+		return nil
+	}
+
+	debugInfo := &DebugInfo{}
+	c.Set(debugContextKey, debugInfo)
+	return debugInfo
+}
+
+// debugFromContext 获取当前请求的调试信息
+func debugFromContext(c *gin.Context) *DebugInfo {
+	if value, ok := c.Get(debugContextKey); ok {
+		if debugInfo, ok := value.(*DebugInfo); ok {
+			return debugInfo
+		}
+	}
+	return nil
+}
+
+// setDocuments 记录检索到的文档
+func (d *DebugInfo) setDocuments(docs []rag.Document) {
+	if d != nil {
+		d.RAGDocuments = docs
+	}
+}
+
+// setToolCall 记录解析出的工具调用
+func (d *DebugInfo) setToolCall(toolCall ToolCallInfo) {
+	if d != nil {
+		d.ToolCall = &toolCall
+	}
+}
+
+// addRawToolResult 记录工具原始结果
+func (d *DebugInfo) addRawToolResult(result string) {
+	if d != nil {
+		d.RawToolResults = append(d.RawToolResults, result)
+	}
+}
+
+// addReasoning 记录推理模型的思考过程并输出到日志（思考过程从不出现在回复中，只在授权的 debug 请求中可见）
+func (d *DebugInfo) addReasoning(reasoning string) {
+	if d != nil && reasoning != "" {
+		log.Printf("🧠 模型思考过程: %s", reasoning)
+		d.Reasoning = append(d.Reasoning, reasoning)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"go-ai-service/llm"
+	"go-ai-service/rag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmbedRequest 文本向量请求
+type EmbedRequest struct {
+	Texts []string `json:"texts"`
+}
+
+// EmbedResult 单条文本的向量（Index 为文本在请求中的位置）
+type EmbedResult struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbedResponse 文本向量响应，结果顺序与请求中的文本一致
+type EmbedResponse struct {
+	Model      string        `json:"model"`
+	Embeddings []EmbedResult `json:"embeddings"`
+}
+
+// HandleEmbed 使用与知识库检索相同的嵌入模型生成文本向量，供其他内部工具复用，避免各自实现 DashScope 调用。
+// 文本按 rag.EmbeddingBatchSize 分批请求，单次请求最多 maxTexts 条（<= 0 表示不限制）
+func HandleEmbed(llmClient *llm.DashScopeClient, maxTexts int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmbedRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if respondBindError(c, err) {
+				return
+			}
+		}
+
+		var problems []FieldError
+		if len(req.Texts) == 0 {
+			problems = append(problems, FieldError{Field: "texts", Message: "不能为空"})
+		}
+		if maxTexts > 0 && len(req.Texts) > maxTexts {
+			problems = append(problems, FieldError{Field: "texts", Message: fmt.Sprintf("最多 %d 条", maxTexts)})
+		}
+		for i, text := range req.Texts {
+			if strings.TrimSpace(text) == "" {
+				problems = append(problems, FieldError{Field: fmt.Sprintf("texts[%d]", i), Message: "不能为空"})
+			}
+		}
+		if len(problems) > 0 {
+			respondValidationError(c, problems)
+			return
+		}
+
+		results := make([]EmbedResult, 0, len(req.Texts))
+		for start := 0; start < len(req.Texts); start += rag.EmbeddingBatchSize {
+			end := start + rag.EmbeddingBatchSize
+			if end > len(req.Texts) {
+				end = len(req.Texts)
+			}
+
+			embeddings, err := llmClient.Embedding(req.Texts[start:end])
+			if err != nil {
+				log.Printf("❌ 生成文本向量失败 (第 %d-%d 条): %v", start+1, end, err)
+				respondLLMError(c, err)
+				return
+			}
+			for i, embedding := range embeddings {
+				if len(embedding) == 0 {
+					log.Printf("❌ 嵌入接口未返回第 %d 条文本的向量", start+i+1)
+					respondError(c, http.StatusBadGateway, ErrCodeUpstreamLLMError, "嵌入接口返回的向量不完整")
+					return
+				}
+				results = append(results, EmbedResult{Index: start + i, Embedding: embedding})
+			}
+		}
+
+		log.Printf("🧮 生成文本向量: %d 条", len(results))
+		c.JSON(http.StatusOK, EmbedResponse{Model: llm.EmbeddingModel, Embeddings: results})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"go-ai-service/llm"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 机器可读的错误码，前端可据此展示不同提示或决定是否重试
+const (
+	ErrCodeInvalidRequest   = "INVALID_REQUEST"
+	ErrCodeUnauthorized     = "UNAUTHORIZED"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"
+	ErrCodeRateLimited      = "RATE_LIMITED"
+	ErrCodeUpstreamLLMError = "UPSTREAM_LLM_ERROR"
+	ErrCodeReplyInterrupted = "REPLY_INTERRUPTED"
+	ErrCodeToolError        = "TOOL_ERROR"
+	ErrCodeInternal         = "INTERNAL"
+)
+
+// APIError 结构化错误
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"` // 参数校验失败时的字段明细
+}
+
+// ErrorResponse 错误响应: {"error": {"code": ..., "message": ...}}
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// respondError 返回结构化错误响应（流式响应已经开始时以 error 事件返回）
+func respondError(c *gin.Context, status int, code, message string) {
+	if sendStreamError(c, code, message) {
+		return
+	}
+	c.JSON(status, ErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+// respondLLMError 根据 LLM 错误类型返回限流、回复中断或上游错误
+func respondLLMError(c *gin.Context, err error) {
+	if errors.Is(err, llm.ErrInterrupted) {
+		respondError(c, http.StatusBadGateway, ErrCodeReplyInterrupted, "回复中断，请重试")
+		return
+	}
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) && apiErr.IsRateLimited() {
+		respondError(c, http.StatusTooManyRequests, ErrCodeRateLimited, "请求过于频繁,请稍后再试")
+		return
+	}
+	respondError(c, http.StatusBadGateway, ErrCodeUpstreamLLMError, "处理失败,请稍后再试")
+}
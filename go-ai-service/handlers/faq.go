@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"go-ai-service/rag"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// faqCategory 知识库中常见问题文档的分类
+const faqCategory = "常见问题"
+
+// faqPattern 常见问题的关键词（退换货、配送、质保、支付等）
+var faqPattern = regexp.MustCompile(`退货|退款|换货|退换|运费|配送|发货|快递|多久能到|几天到|质保|保修|维修|支付|付款|分期|货到付款`)
+
+// faqFastPathReply 对高置信度的常见问题直接返回知识库内容，跳过 LLM 调用
+func (h *ChatHandler) faqFastPathReply(message string, docs []rag.Document) (string, bool) {
+	if !h.cfg.FAQFastPath || len(docs) == 0 {
+		return "", false
+	}
+
+	if !faqPattern.MatchString(message) {
+		return "", false
+	}
+
+	best := docs[0]
+	for _, doc := range docs[1:] {
+		if doc.Relevance() > best.Relevance() {
+			best = doc
+		}
+	}
+
+	if category, _ := best.Metadata["category"].(string); category != faqCategory {
+		return "", false
+	}
+
+	minRelevance := h.faqMinRelevance(best.Metric)
+	if best.Relevance() < minRelevance {
+		log.Printf("❓ FAQ 快速通道未命中: 最佳文档 %s 相关度 %.4f 低于阈值 %.4f (距离 %.4f)", best.ID, best.Relevance(), minRelevance, best.Distance)
+		return "", false
+	}
+
+	log.Printf("⚡ FAQ 快速通道命中: 文档 %s (相关度 %.4f, 距离 %.4f)", best.ID, best.Relevance(), best.Distance)
+	return fmt.Sprintf("您好，关于您咨询的问题：\n\n%s\n\n如还有其他疑问，欢迎继续咨询。", strings.TrimSpace(best.Text)), true
+}
+
+// faqMinRelevance FAQ 快速通道要求的最低相关度：优先使用 FAQ_MIN_RELEVANCE，
+// 未配置时把旧的距离阈值 FAQ_DISTANCE_THRESHOLD 按距离度量换算为相关度
+func (h *ChatHandler) faqMinRelevance(metric string) float64 {
+	if h.cfg.FAQMinRelevance > 0 {
+		return h.cfg.FAQMinRelevance
+	}
+	return rag.Similarity(h.cfg.FAQDistanceThreshold, metric)
+}
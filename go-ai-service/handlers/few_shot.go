@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-ai-service/llm"
+	"os"
+	"strings"
+)
+
+// FewShotExample 一组示例对话（用户消息与期望的助手回复）
+type FewShotExample struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// LoadFewShotExamples 从 JSON 文件加载示例对话，格式为 [{"user": "...", "assistant": "..."}]
+func LoadFewShotExamples(path string) ([]FewShotExample, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取示例文件失败: %w", err)
+	}
+
+	var examples []FewShotExample
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("示例文件格式错误（应为 [{\"user\": ..., \"assistant\": ...}]）: %w", err)
+	}
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("示例文件中没有示例")
+	}
+	for i, example := range examples {
+		if strings.TrimSpace(example.User) == "" || strings.TrimSpace(example.Assistant) == "" {
+			return nil, fmt.Errorf("第 %d 个示例缺少 user 或 assistant 内容", i+1)
+		}
+	}
+	return examples, nil
+}
+
+// SetFewShotExamples 设置插入在系统提示词之后的示例对话
+func (h *ChatHandler) SetFewShotExamples(examples []FewShotExample) {
+	h.fewShotExamples = examples
+}
+
+// fewShotMessages 将示例对话转换为 user/assistant 消息（未配置时为空）
+func (h *ChatHandler) fewShotMessages() []llm.Message {
+	messages := make([]llm.Message, 0, len(h.fewShotExamples)*2)
+	for _, example := range h.fewShotExamples {
+		messages = append(messages,
+			llm.Message{Role: "user", Content: example.User},
+			llm.Message{Role: "assistant", Content: example.Assistant},
+		)
+	}
+	return messages
+}
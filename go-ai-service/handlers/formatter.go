@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToolResult 结构化的工具执行结果
+type ToolResult struct {
+	ToolName string      `json:"toolName"`
+	Data     interface{} `json:"data,omitempty"` // 可识别的结构化数据（如商品列表）
+}
+
+// ProductItem 商品搜索结果中的单个商品
+type ProductItem struct {
+	ID       json.Number `json:"id,omitempty"`
+	Name     string      `json:"name"`
+	Price    json.Number `json:"price,omitempty"`
+	Stock    json.Number `json:"stock,omitempty"`
+	Category string      `json:"category,omitempty"`
+}
+
+// ShipmentEvent 物流轨迹中的一个节点
+type ShipmentEvent struct {
+	Time   string `json:"time,omitempty"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ShipmentTracking 物流查询结果
+type ShipmentTracking struct {
+	OrderNumber       string          `json:"orderNumber"`
+	Status            string          `json:"status"`
+	StatusDescription string          `json:"statusDescription,omitempty"`
+	TrackingNumber    string          `json:"trackingNumber,omitempty"`
+	ShippingAddress   string          `json:"shippingAddress,omitempty"`
+	Events            []ShipmentEvent `json:"events"`
+}
+
+// OrderItem 订单中的商品
+type OrderItem struct {
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unitPrice,omitempty"`
+}
+
+// OrderResult 结构化的订单信息，供前端渲染订单卡片
+type OrderResult struct {
+	OrderNumber     string      `json:"orderNumber"`
+	Status          string      `json:"status"`
+	StatusText      string      `json:"statusText"`
+	Items           []OrderItem `json:"items"`
+	Total           float64     `json:"total"`
+	CustomerName    string      `json:"customerName,omitempty"`
+	ShippingAddress string      `json:"shippingAddress,omitempty"`
+	TrackingNumber  string      `json:"trackingNumber,omitempty"`
+	CreatedAt       string      `json:"createdAt,omitempty"`
+	ETA             string      `json:"eta,omitempty"` // 预计送达时间（已送达时为实际送达时间）
+	CancelReason    string      `json:"cancelReason,omitempty"`
+}
+
+// OrderListItem 订单列表中的一个订单
+type OrderListItem struct {
+	OrderNumber string `json:"orderNumber"`
+	Product     string `json:"product,omitempty"`
+	Quantity    int    `json:"quantity,omitempty"`
+	Status      string `json:"status"`
+	StatusText  string `json:"statusText"`
+	CreatedAt   string `json:"createdAt,omitempty"`
+}
+
+// OrderListResult 结构化的订单列表（list_orders 的一页结果）
+type OrderListResult struct {
+	Total   int             `json:"total"`   // 满足条件的订单总数
+	Page    int             `json:"page"`    // 当前页码
+	Pages   int             `json:"pages"`   // 总页数
+	HasMore bool            `json:"hasMore"` // 是否还有下一页
+	Orders  []OrderListItem `json:"orders"`
+}
+
+// orderStatusText 订单状态的中文描述
+var orderStatusText = map[string]string{
+	"PENDING":   "待处理",
+	"CONFIRMED": "已确认",
+	"SHIPPED":   "已发货",
+	"DELIVERED": "已送达",
+	"CANCELLED": "已取消",
+}
+
+// formatToolResult 将工具结果格式化为适合展示的文本，并返回结构化结果
+// 无法识别的结构原样返回（保留原始 JSON / 文本）
+func formatToolResult(toolName, result string) (string, ToolResult) {
+	toolResult := ToolResult{ToolName: toolName}
+
+	switch toolName {
+	case "search_product":
+		if products, ok := parseProductList(result); ok {
+			toolResult.Data = products
+			return formatProductList(products), toolResult
+		}
+	case "query_order":
+		if order, ok := parseOrderResult(result); ok {
+			toolResult.Data = order
+			return formatOrderResult(order), toolResult
+		}
+	case "list_orders":
+		if list, ok := parseOrderListResult(result); ok {
+			toolResult.Data = list
+			return formatOrderList(list), toolResult
+		}
+	case "track_shipment":
+		if tracking, ok := parseShipmentTracking(result); ok {
+			toolResult.Data = tracking
+			return formatShipmentTracking(tracking), toolResult
+		}
+	}
+
+	// 未识别的结构：如果是合法 JSON 则作为原始数据返回
+	if json.Valid([]byte(result)) {
+		toolResult.Data = json.RawMessage(result)
+	}
+	return result, toolResult
+}
+
+// parseProductList 识别商品搜索结果的 JSON 结构
+// 支持 [{...}, ...] 以及 {"products": [...]} / {"data": [...]} 两种形式
+func parseProductList(result string) ([]ProductItem, bool) {
+	trimmed := strings.TrimSpace(result)
+	if trimmed == "" {
+		return nil, false
+	}
+
+	var products []ProductItem
+	if err := json.Unmarshal([]byte(trimmed), &products); err != nil {
+		var wrapper struct {
+			Products []ProductItem `json:"products"`
+			Data     []ProductItem `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &wrapper); err != nil {
+			return nil, false
+		}
+		products = wrapper.Products
+		if products == nil {
+			products = wrapper.Data
+		}
+		if products == nil {
+			return nil, false
+		}
+	}
+
+	for _, p := range products {
+		if strings.TrimSpace(p.Name) == "" {
+			return nil, false
+		}
+	}
+
+	return products, true
+}
+
+// formatProductList 将商品列表渲染为编号列表
+func formatProductList(products []ProductItem) string {
+	if len(products) == 0 {
+		return "❌ 未找到相关商品"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔍 找到 %d 个商品：\n\n", len(products)))
+	for i, p := range products {
+		sb.WriteString(fmt.Sprintf("%d. %s", i+1, p.Name))
+		if p.Price != "" {
+			sb.WriteString(fmt.Sprintf(" - ¥%s", p.Price))
+		}
+		if p.Stock != "" {
+			sb.WriteString(fmt.Sprintf("（库存 %s）", p.Stock))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// parseShipmentTracking 识别物流查询结果的 JSON 结构
+func parseShipmentTracking(result string) (*ShipmentTracking, bool) {
+	var tracking ShipmentTracking
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result)), &tracking); err != nil {
+		return nil, false
+	}
+	if tracking.OrderNumber == "" || tracking.Status == "" {
+		return nil, false
+	}
+	return &tracking, true
+}
+
+// formatShipmentTracking 将物流轨迹渲染为时间线，最新节点在前
+func formatShipmentTracking(tracking *ShipmentTracking) string {
+	status := tracking.StatusDescription
+	if status == "" {
+		status = tracking.Status
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🚚 物流信息\n\n")
+	sb.WriteString(fmt.Sprintf("订单号：%s\n", tracking.OrderNumber))
+	sb.WriteString(fmt.Sprintf("当前状态：%s\n", status))
+	if tracking.TrackingNumber != "" {
+		sb.WriteString(fmt.Sprintf("运单号：%s\n", tracking.TrackingNumber))
+	}
+	if tracking.ShippingAddress != "" {
+		sb.WriteString(fmt.Sprintf("收货地址：%s\n", tracking.ShippingAddress))
+	}
+
+	if len(tracking.Events) > 0 {
+		sb.WriteString("\n物流轨迹：\n")
+		for i := len(tracking.Events) - 1; i >= 0; i-- {
+			event := tracking.Events[i]
+			marker := "○"
+			if i == len(tracking.Events)-1 {
+				marker = "●"
+			}
+			sb.WriteString(fmt.Sprintf("%s %s", marker, event.Status))
+			if event.Time != "" {
+				sb.WriteString(fmt.Sprintf("  %s", formatEventTime(event.Time)))
+			}
+			if event.Detail != "" {
+				sb.WriteString(fmt.Sprintf("\n   %s", event.Detail))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatEventTime 将 ISO 时间（如 2024-05-01T10:30:00.123）转换为 2024-05-01 10:30，无法识别时原样返回
+func formatEventTime(value string) string {
+	if t, ok := parseShopTime(value); ok {
+		return t.Format("2006-01-02 15:04")
+	}
+	return value
+}
+
+// parseShopTime 解析 Java 商城返回的 ISO 时间（可能不带时区）
+func parseShopTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseOrderResult 识别 query_order 返回的订单 JSON（Java 商城的订单结构），转换为 OrderResult
+func parseOrderResult(result string) (*OrderResult, bool) {
+	var order struct {
+		OrderNumber string `json:"orderNumber"`
+		Product     *struct {
+			Name  string  `json:"name"`
+			Price float64 `json:"price"`
+		} `json:"product"`
+		Quantity          int     `json:"quantity"`
+		TotalPrice        float64 `json:"totalPrice"`
+		CustomerName      string  `json:"customerName"`
+		ShippingAddress   string  `json:"shippingAddress"`
+		Status            string  `json:"status"`
+		TrackingNumber    string  `json:"trackingNumber"`
+		CreatedAt         string  `json:"createdAt"`
+		EstimatedDelivery string  `json:"estimatedDelivery"`
+		CancelReason      string  `json:"cancelReason"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result)), &order); err != nil {
+		return nil, false
+	}
+	if order.OrderNumber == "" || order.Status == "" {
+		return nil, false
+	}
+
+	statusText := orderStatusText[order.Status]
+	if statusText == "" {
+		statusText = order.Status
+	}
+
+	items := []OrderItem{}
+	if order.Product != nil {
+		items = append(items, OrderItem{Name: order.Product.Name, Quantity: order.Quantity, UnitPrice: order.Product.Price})
+	}
+
+	return &OrderResult{
+		OrderNumber:     order.OrderNumber,
+		Status:          order.Status,
+		StatusText:      statusText,
+		Items:           items,
+		Total:           order.TotalPrice,
+		CustomerName:    order.CustomerName,
+		ShippingAddress: order.ShippingAddress,
+		TrackingNumber:  order.TrackingNumber,
+		CreatedAt:       order.CreatedAt,
+		ETA:             order.EstimatedDelivery,
+		CancelReason:    order.CancelReason,
+	}, true
+}
+
+// formatOrderResult 将订单渲染为订单详情文本
+func formatOrderResult(order *OrderResult) string {
+	var sb strings.Builder
+	sb.WriteString("📋 订单详情\n\n")
+	sb.WriteString(fmt.Sprintf("订单号：%s\n", order.OrderNumber))
+	for _, item := range order.Items {
+		sb.WriteString(fmt.Sprintf("商品：%s × %d\n", item.Name, item.Quantity))
+	}
+	sb.WriteString(fmt.Sprintf("总价：¥%.2f\n", order.Total))
+	if order.ShippingAddress != "" {
+		sb.WriteString(fmt.Sprintf("收货地址：%s\n", order.ShippingAddress))
+	}
+	sb.WriteString(fmt.Sprintf("订单状态：%s\n", order.StatusText))
+	if order.TrackingNumber != "" {
+		sb.WriteString(fmt.Sprintf("运单号：%s\n", order.TrackingNumber))
+	}
+	if order.ETA != "" {
+		label := "预计送达"
+		if order.Status == "DELIVERED" {
+			label = "送达时间"
+		}
+		eta := order.ETA
+		if t, ok := parseShopTime(order.ETA); ok {
+			eta = t.Format("2006-01-02")
+		}
+		sb.WriteString(fmt.Sprintf("%s：%s\n", label, eta))
+	}
+	if order.CancelReason != "" {
+		sb.WriteString(fmt.Sprintf("取消原因：%s\n", order.CancelReason))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// orderListHeaderRegex list_orders 结果的标题行，如"共有 12 个订单，第 1/2 页"（旧格式没有分页信息）
+var orderListHeaderRegex = regexp.MustCompile(`共有\s*(\d+)\s*个订单(?:，第\s*(\d+)/(\d+)\s*页)?`)
+
+// parseOrderListResult 识别 list_orders 返回的订单列表文本，转换为 OrderListResult
+func parseOrderListResult(result string) (*OrderListResult, bool) {
+	header := orderListHeaderRegex.FindStringSubmatch(result)
+	if header == nil {
+		return nil, false
+	}
+
+	list := &OrderListResult{Page: 1, Pages: 1, Orders: []OrderListItem{}}
+	list.Total, _ = strconv.Atoi(header[1])
+	if header[2] != "" {
+		list.Page, _ = strconv.Atoi(header[2])
+		list.Pages, _ = strconv.Atoi(header[3])
+	}
+	list.HasMore = list.Page < list.Pages
+
+	for _, order := range parseOrderList(result) {
+		statusText := orderStatusText[order.Status]
+		if statusText == "" {
+			statusText = order.Status
+		}
+		list.Orders = append(list.Orders, OrderListItem{
+			OrderNumber: order.OrderNumber,
+			Product:     order.Product,
+			Quantity:    order.Quantity,
+			Status:      order.Status,
+			StatusText:  statusText,
+			CreatedAt:   order.CreatedAt,
+		})
+	}
+	return list, true
+}
+
+// formatOrderList 将订单列表渲染为简洁的表格，说明订单总数以及是否还有更多
+func formatOrderList(list *OrderListResult) string {
+	if len(list.Orders) == 0 {
+		return fmt.Sprintf("📋 共有 %d 个订单，第 %d 页没有订单（共 %d 页）", list.Total, list.Page, list.Pages)
+	}
+
+	var sb strings.Builder
+	if list.Pages > 1 {
+		sb.WriteString(fmt.Sprintf("📋 共找到 %d 个订单，第 %d/%d 页（本页 %d 个）：\n\n", list.Total, list.Page, list.Pages, len(list.Orders)))
+	} else {
+		sb.WriteString(fmt.Sprintf("📋 共找到 %d 个订单：\n\n", list.Total))
+	}
+	sb.WriteString("订单号 | 商品 | 数量 | 状态 | 下单日期\n")
+	for _, order := range list.Orders {
+		createdAt := order.CreatedAt
+		if t, ok := parseShopTime(order.CreatedAt); ok {
+			createdAt = t.Format("2006-01-02")
+		}
+		product := order.Product
+		if product == "" {
+			product = "-"
+		}
+		sb.WriteString(fmt.Sprintf("%s | %s | %d | %s | %s\n", order.OrderNumber, product, order.Quantity, order.StatusText, createdAt))
+	}
+	if list.HasMore {
+		// 有下一页时之前各页都是满页，每页订单数即本页订单数
+		remaining := list.Total - list.Page*len(list.Orders)
+		sb.WriteString(fmt.Sprintf("\n还有 %d 个订单未显示，如需查看请告诉我\"看第 %d 页\"。", remaining, list.Page+1))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"go-ai-service/rag"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groundingContextKey gin.Context 中保存本次检索到的文档（用于判断回复是否有资料依据）的键
+const groundingContextKey = "groundingDocs"
+
+// setGroundingDocuments 记录本次检索到的文档，writeReply 时据此判断回复是否基于知识库
+func setGroundingDocuments(c *gin.Context, docs []rag.Document) {
+	c.Set(groundingContextKey, docs)
+}
+
+// groundingDocumentsFromContext 获取本次检索到的文档（未检索或检索失败时为 nil）
+func groundingDocumentsFromContext(c *gin.Context) []rag.Document {
+	if value, ok := c.Get(groundingContextKey); ok {
+		if docs, ok := value.([]rag.Document); ok {
+			return docs
+		}
+	}
+	return nil
+}
+
+// groundedOn 轻量的依据判断：相关度不低于 minRelevance 的文档中，回复有不少于 minOverlap 比例的字词（相邻两字）
+// 出现在文档里时，认为回复基于该文档。返回作为依据的原文档 ID（分块文档返回所属文档的 ID，去重并保持检索顺序）
+func groundedOn(docs []rag.Document, reply string, minRelevance, minOverlap float64) []string {
+	replyGrams := bigrams(reply)
+	if len(replyGrams) == 0 {
+		return nil
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		if doc.Relevance() < minRelevance {
+			continue
+		}
+		docGrams := bigrams(doc.Text)
+		shared := 0
+		for gram := range replyGrams {
+			if docGrams[gram] {
+				shared++
+			}
+		}
+		if float64(shared)/float64(len(replyGrams)) < minOverlap {
+			continue
+		}
+
+		id := doc.ID
+		if sourceID, ok := doc.Metadata["source_id"].(string); ok && sourceID != "" {
+			id = sourceID
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// bigrams 文本中相邻两个字（只计字母和数字，忽略标点空白，英文不区分大小写）组成的集合
+func bigrams(text string) map[string]bool {
+	var runes []rune
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes = append(runes, unicode.ToLower(r))
+		}
+	}
+
+	grams := make(map[string]bool, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		grams[string(runes[i:i+2])] = true
+	}
+	return grams
+}
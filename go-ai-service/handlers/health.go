@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"go-ai-service/mcp"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadyResponse 就绪检查响应
+type ReadyResponse struct {
+	Status string         `json:"status"` // ready / unready
+	MCP    mcp.ToolHealth `json:"mcp"`
+}
+
+// HandleReady 就绪检查：返回 MCP Server 当前声明的工具，缺少必需工具或 MCP 不可用时返回 503
+// （进程存活但 Python 服务部署不完整时，/health 仍为 ok，而 /ready 会报告不可用）
+func HandleReady(checker *mcp.ToolHealthChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := checker.Check()
+		if !health.Healthy {
+			log.Printf("⚠️  就绪检查未通过: 缺少工具 %v %s", health.Missing, health.Error)
+			c.JSON(http.StatusServiceUnavailable, ReadyResponse{Status: "unready", MCP: health})
+			return
+		}
+		c.JSON(http.StatusOK, ReadyResponse{Status: "ready", MCP: health})
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"unicode"
+)
+
+// normalizeContent 规范化消息内容（去除首尾空白并合并连续空白），用于重复检测
+func normalizeContent(content string) string {
+	return strings.Join(strings.Fields(content), " ")
+}
+
+// duplicateKey 生成用于比较当前消息的键：在 normalizeContent 基础上忽略大小写、标点和符号，
+// 前端对消息做了去空白、改标点等轻微调整时仍能识别为同一条消息
+func duplicateKey(content string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, normalizeContent(content))
+}
+
+// sanitizeHistory 清理前端传来的历史消息
+//   - 跳过空消息
+//   - 合并相邻的重复消息（同一角色、规范化内容相同）
+//   - 去掉末尾与当前消息相同（忽略空白、标点和大小写）的用户消息（前端会在 history 末尾包含当前消息）
+func sanitizeHistory(history []HistoryMessage, currentMessage string) []HistoryMessage {
+	cleaned := make([]HistoryMessage, 0, len(history))
+	for _, msg := range history {
+		normalized := normalizeContent(msg.Content)
+		if normalized == "" {
+			log.Printf("   跳过空消息 (%s)", msg.Role)
+			continue
+		}
+
+		if n := len(cleaned); n > 0 && cleaned[n-1].Role == msg.Role && normalizeContent(cleaned[n-1].Content) == normalized {
+			log.Printf("   跳过重复消息 (%s)", msg.Role)
+			continue
+		}
+
+		cleaned = append(cleaned, msg)
+	}
+
+	// 只比较最后一条消息，且必须是用户消息，避免误删更早的相同提问
+	if n := len(cleaned); n > 0 && cleaned[n-1].Role == "user" {
+		if key := duplicateKey(currentMessage); key != "" && duplicateKey(cleaned[n-1].Content) == key {
+			log.Printf("   检测到与当前消息重复的历史消息，已移除: %s", truncateForLog(cleaned[n-1].Content, 50))
+			cleaned = cleaned[:n-1]
+		}
+	}
+
+	return cleaned
+}
+
+// limitHistoryTurns 只保留最近 maxTurns 轮历史（一轮从一条用户消息开始），返回保留的历史和丢弃的轮数
+func limitHistoryTurns(history []HistoryMessage, maxTurns int) ([]HistoryMessage, int) {
+	if maxTurns <= 0 {
+		return history, 0
+	}
+
+	turns := 0
+	start := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role != "user" {
+			continue
+		}
+		turns++
+		if turns == maxTurns {
+			start = i
+		}
+	}
+
+	if turns <= maxTurns {
+		return history, 0
+	}
+	return history[start:], turns - maxTurns
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []HistoryMessage
+		current string
+		want    []HistoryMessage
+	}{
+		{
+			name:    "空历史",
+			history: nil,
+			current: "你好",
+			want:    []HistoryMessage{},
+		},
+		{
+			name: "跳过空消息",
+			history: []HistoryMessage{
+				{Role: "user", Content: "  \n "},
+				{Role: "assistant", Content: "您好"},
+			},
+			current: "在吗",
+			want:    []HistoryMessage{{Role: "assistant", Content: "您好"}},
+		},
+		{
+			name: "合并相邻重复消息",
+			history: []HistoryMessage{
+				{Role: "user", Content: "有山地车吗"},
+				{Role: "user", Content: " 有山地车吗 "},
+				{Role: "assistant", Content: "有的"},
+			},
+			current: "多少钱",
+			want: []HistoryMessage{
+				{Role: "user", Content: "有山地车吗"},
+				{Role: "assistant", Content: "有的"},
+			},
+		},
+		{
+			name: "不同角色的相同内容不合并",
+			history: []HistoryMessage{
+				{Role: "user", Content: "好的"},
+				{Role: "assistant", Content: "好的"},
+			},
+			current: "谢谢",
+			want: []HistoryMessage{
+				{Role: "user", Content: "好的"},
+				{Role: "assistant", Content: "好的"},
+			},
+		},
+		{
+			name: "去掉末尾与当前消息相同的用户消息",
+			history: []HistoryMessage{
+				{Role: "user", Content: "有山地车吗"},
+				{Role: "assistant", Content: "有的"},
+				{Role: "user", Content: "多少钱"},
+			},
+			current: "多少钱",
+			want: []HistoryMessage{
+				{Role: "user", Content: "有山地车吗"},
+				{Role: "assistant", Content: "有的"},
+			},
+		},
+		{
+			name: "忽略标点、空白和大小写的差异",
+			history: []HistoryMessage{
+				{Role: "assistant", Content: "您好"},
+				{Role: "user", Content: "有 iPhone 15 吗？"},
+			},
+			current: "有iphone15吗",
+			want:    []HistoryMessage{{Role: "assistant", Content: "您好"}},
+		},
+		{
+			name: "末尾是助手消息时不删除",
+			history: []HistoryMessage{
+				{Role: "user", Content: "多少钱"},
+				{Role: "assistant", Content: "多少钱"},
+			},
+			current: "多少钱",
+			want: []HistoryMessage{
+				{Role: "user", Content: "多少钱"},
+				{Role: "assistant", Content: "多少钱"},
+			},
+		},
+		{
+			name:    "只有标点的当前消息不删除历史",
+			history: []HistoryMessage{{Role: "user", Content: "？"}},
+			current: "?",
+			want:    []HistoryMessage{{Role: "user", Content: "？"}},
+		},
+		{
+			name: "不删除更早的相同提问",
+			history: []HistoryMessage{
+				{Role: "user", Content: "多少钱"},
+				{Role: "assistant", Content: "99 元"},
+			},
+			current: "多少钱",
+			want: []HistoryMessage{
+				{Role: "user", Content: "多少钱"},
+				{Role: "assistant", Content: "99 元"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeHistory(tt.history, tt.current)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sanitizeHistory() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"有山地车吗", "有山地车吗？", true},
+		{"  有 山地车 吗 ", "有山地车吗", true},
+		{"Hello, World!", "hello world", true},
+		{"订单 ORD-123", "订单ord123", true},
+		{"有山地车吗", "有公路车吗", false},
+		{"买 2 辆", "买 3 辆", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			if got := duplicateKey(tt.a) == duplicateKey(tt.b); got != tt.same {
+				t.Errorf("duplicateKey(%q) == duplicateKey(%q) = %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
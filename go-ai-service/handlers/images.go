@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxImagesPerMessage = 4
+	maxImageBytes       = 10 << 20 // 单张 base64 图片解码后的最大字节数
+)
+
+// base64ImagePrefixes 常见图片格式 base64 编码后的开头，用于推断 MIME 类型
+var base64ImagePrefixes = map[string]string{
+	"/9j/":   "image/jpeg",
+	"iVBORw": "image/png",
+	"R0lGOD": "image/gif",
+	"UklGR":  "image/webp",
+}
+
+// normalizeImages 校验并规范化请求中的图片：
+// 支持 http(s) URL、data URI（data:image/...;base64,...）和不带前缀的 base64，后者会补全为 data URI
+func normalizeImages(images []string) ([]string, error) {
+	if len(images) > maxImagesPerMessage {
+		return nil, fmt.Errorf("最多支持 %d 张图片", maxImagesPerMessage)
+	}
+
+	normalized := make([]string, 0, len(images))
+	for i, image := range images {
+		image = strings.TrimSpace(image)
+		switch {
+		case image == "":
+			continue
+		case strings.HasPrefix(image, "http://"), strings.HasPrefix(image, "https://"):
+			normalized = append(normalized, image)
+		case strings.HasPrefix(image, "data:image/"):
+			comma := strings.Index(image, ",")
+			if comma < 0 || !strings.HasSuffix(image[:comma], ";base64") {
+				return nil, fmt.Errorf("第 %d 张图片的 data URI 格式无效", i+1)
+			}
+			if err := checkBase64Image(image[comma+1:]); err != nil {
+				return nil, fmt.Errorf("第 %d 张图片%v", i+1, err)
+			}
+			normalized = append(normalized, image)
+		default:
+			if err := checkBase64Image(image); err != nil {
+				return nil, fmt.Errorf("第 %d 张图片既不是 URL 也不是有效的 base64: %v", i+1, err)
+			}
+			normalized = append(normalized, "data:"+base64ImageMIME(image)+";base64,"+image)
+		}
+	}
+
+	return normalized, nil
+}
+
+// checkBase64Image 校验 base64 图片数据及大小
+func checkBase64Image(data string) error {
+	if base64.StdEncoding.DecodedLen(len(data)) > maxImageBytes {
+		return fmt.Errorf("超过大小限制 (%d MB)", maxImageBytes>>20)
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return fmt.Errorf("base64 解码失败")
+	}
+	return nil
+}
+
+// base64ImageMIME 根据 base64 数据开头推断图片 MIME 类型，无法识别时按 JPEG 处理
+func base64ImageMIME(data string) string {
+	for prefix, mime := range base64ImagePrefixes {
+		if strings.HasPrefix(data, prefix) {
+			return mime
+		}
+	}
+	return "image/jpeg"
+}
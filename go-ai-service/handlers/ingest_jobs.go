@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go-ai-service/rag"
+	"sync"
+	"time"
+)
+
+// 导入任务状态
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// IngestJob 知识库后台导入任务
+type IngestJob struct {
+	ID        string    `json:"jobId"`
+	Status    string    `json:"status"`
+	Documents int       `json:"documents"` // 提交的文档数
+	Total     int       `json:"total"`     // 切分后的片段数
+	Processed int       `json:"processed"` // 已处理的片段数（含跳过的片段）
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Failed []rag.EmbeddingFailure `json:"failed,omitempty"` // 无法生成嵌入向量而被跳过的片段
+}
+
+// IngestJobStore 内存中的导入任务存储，已结束超过 ttl 的任务会被清理
+type IngestJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*IngestJob
+	ttl  time.Duration
+}
+
+// NewIngestJobStore 创建导入任务存储
+func NewIngestJobStore(ttl time.Duration) *IngestJobStore {
+	return &IngestJobStore{
+		jobs: make(map[string]*IngestJob),
+		ttl:  ttl,
+	}
+}
+
+// Create 创建一个待执行的任务
+func (s *IngestJobStore) Create(documents, total int) (*IngestJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evictExpiredLocked(now)
+
+	job := &IngestJob{
+		ID:        id,
+		Status:    JobPending,
+		Documents: documents,
+		Total:     total,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.jobs[id] = job
+	return job, nil
+}
+
+// Update 在写锁内修改任务状态
+func (s *IngestJobStore) Update(id string, update func(job *IngestJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	update(job)
+	job.UpdatedAt = time.Now()
+}
+
+// Get 获取任务副本
+func (s *IngestJobStore) Get(id string) (IngestJob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok || s.expired(job, time.Now()) {
+		return IngestJob{}, false
+	}
+	copied := *job
+	copied.Failed = append([]rag.EmbeddingFailure(nil), job.Failed...)
+	return copied, true
+}
+
+// expired 判断任务是否已结束且超过保留时间
+func (s *IngestJobStore) expired(job *IngestJob, now time.Time) bool {
+	finished := job.Status == JobDone || job.Status == JobFailed
+	return finished && s.ttl > 0 && now.Sub(job.UpdatedAt) > s.ttl
+}
+
+// evictExpiredLocked 清理过期任务（调用方需持有写锁）
+func (s *IngestJobStore) evictExpiredLocked(now time.Time) {
+	for id, job := range s.jobs {
+		if s.expired(job, now) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// newJobID 生成随机任务 ID
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成任务 ID 失败: %w", err)
+	}
+	return "job-" + hex.EncodeToString(b), nil
+}
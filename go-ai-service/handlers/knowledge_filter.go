@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"go-ai-service/config"
+	"go-ai-service/rag"
+	"log"
+	"sort"
+	"strings"
+)
+
+// inferKnowledgeFilter 根据查询中的关键词推断元数据过滤条件（Chroma where 语法），
+// 多条规则命中不同条件时用 $or 组合，未命中时返回 nil
+func inferKnowledgeFilter(query string, rules map[string]config.MetadataFilter) map[string]interface{} {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	// 按关键词排序，保证命中多条规则时生成的条件顺序稳定
+	keywords := make([]string, 0, len(rules))
+	for keyword := range rules {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+
+	seen := make(map[config.MetadataFilter]bool)
+	var conditions []map[string]interface{}
+	for _, keyword := range keywords {
+		filter := rules[keyword]
+		if !strings.Contains(query, keyword) || seen[filter] {
+			continue
+		}
+		seen[filter] = true
+		conditions = append(conditions, map[string]interface{}{
+			filter.Field: map[string]interface{}{"$eq": filter.Value},
+		})
+	}
+
+	switch len(conditions) {
+	case 0:
+		return nil
+	case 1:
+		return conditions[0]
+	default:
+		return map[string]interface{}{"$or": conditions}
+	}
+}
+
+// filteredSearch 带过滤条件检索知识库，过滤后没有结果时退回不过滤的检索
+func (h *ChatHandler) filteredSearch(client *rag.ChromaClient, query string, topK int, where map[string]interface{}) ([]rag.Document, error) {
+	if where == nil {
+		return client.SearchKnowledge(query, topK)
+	}
+
+	docs, err := client.SearchKnowledgeWithFilter(query, topK, where)
+	if err == nil && len(docs) > 0 {
+		return docs, nil
+	}
+	if err != nil {
+		log.Printf("⚠️  带过滤条件的检索失败，改为不过滤检索: %v", err)
+	} else {
+		log.Printf("🔎 过滤条件 %v 没有匹配的文档，改为不过滤检索", where)
+	}
+	return client.SearchKnowledge(query, topK)
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"fmt"
+	"go-ai-service/config"
+	"go-ai-service/rag"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ingestBatchSize 每批写入 Chroma 的片段数（每批完成后更新任务进度；批内按 EMBEDDING_CONCURRENCY 并行生成嵌入向量）
+const ingestBatchSize = 50
+
+// KnowledgeHandler 知识库导入处理器
+type KnowledgeHandler struct {
+	ragClient    *rag.ChromaClient
+	scopes       map[string]config.ChromaScope // 商户凭证 -> 商户知识库
+	jobs         *IngestJobStore
+	chunkSize    int
+	chunkOverlap int
+
+	ingestMu sync.Mutex // 导入任务串行执行，避免并发初始化集合和挤占嵌入接口配额
+}
+
+// NewKnowledgeHandler 创建知识库导入处理器
+func NewKnowledgeHandler(ragClient *rag.ChromaClient, cfg *config.Config) *KnowledgeHandler {
+	return &KnowledgeHandler{
+		ragClient:    ragClient,
+		scopes:       cfg.MerchantScopes,
+		jobs:         NewIngestJobStore(cfg.KnowledgeJobTTL),
+		chunkSize:    cfg.KnowledgeChunkSize,
+		chunkOverlap: cfg.KnowledgeChunkOverlap,
+	}
+}
+
+// IngestRequest 知识库导入请求
+type IngestRequest struct {
+	Documents []rag.Document `json:"documents" binding:"required"`
+}
+
+// HandleIngest 提交知识库导入任务，立即返回任务 ID，导入在后台执行
+func (h *KnowledgeHandler) HandleIngest(c *gin.Context) {
+	client, ok := resolveKnowledgeClient(c, h.ragClient, h.scopes)
+	if !ok {
+		return
+	}
+
+	var req IngestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if respondBindError(c, err) {
+			return
+		}
+	}
+
+	var problems []FieldError
+	if len(req.Documents) == 0 {
+		problems = append(problems, FieldError{Field: "documents", Message: "不能为空"})
+	}
+	for i, doc := range req.Documents {
+		if strings.TrimSpace(doc.ID) == "" {
+			problems = append(problems, FieldError{Field: fmt.Sprintf("documents[%d].id", i), Message: "不能为空"})
+		}
+		if strings.TrimSpace(doc.Text) == "" {
+			problems = append(problems, FieldError{Field: fmt.Sprintf("documents[%d].text", i), Message: "不能为空"})
+		}
+	}
+	if len(problems) > 0 {
+		respondValidationError(c, problems)
+		return
+	}
+
+	chunks := rag.ChunkDocuments(req.Documents, h.chunkSize, h.chunkOverlap)
+	job, err := h.jobs.Create(len(req.Documents), len(chunks))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "创建导入任务失败")
+		return
+	}
+
+	log.Printf("📥 知识库导入任务 %s: %d 个文档，切分为 %d 个片段", job.ID, len(req.Documents), len(chunks))
+	go h.runIngest(client, job.ID, chunks)
+
+	c.JSON(http.StatusAccepted, gin.H{"jobId": job.ID, "status": job.Status})
+}
+
+// HandleGetJob 查询导入任务状态与进度
+func (h *KnowledgeHandler) HandleGetJob(c *gin.Context) {
+	job, ok := h.jobs.Get(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "任务不存在或已过期")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// HandleStats 返回知识库集合的文档数、嵌入向量维度与距离度量
+func (h *KnowledgeHandler) HandleStats(c *gin.Context) {
+	client, ok := resolveKnowledgeClient(c, h.ragClient, h.scopes)
+	if !ok {
+		return
+	}
+
+	stats, err := client.CollectionStats()
+	if err != nil {
+		log.Printf("⚠️  获取知识库统计失败: %v", err)
+		respondError(c, http.StatusBadGateway, ErrCodeInternal, "获取知识库统计失败")
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// runIngest 后台分批写入 client 对应的知识库并更新任务进度
+func (h *KnowledgeHandler) runIngest(client *rag.ChromaClient, jobID string, chunks []rag.Document) {
+	h.ingestMu.Lock()
+	defer h.ingestMu.Unlock()
+
+	h.jobs.Update(jobID, func(job *IngestJob) { job.Status = JobRunning })
+
+	failed := 0
+
+	for start := 0; start < len(chunks); start += ingestBatchSize {
+		end := start + ingestBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+
+		report, err := client.AddDocuments(chunks[start:end])
+		if err != nil {
+			log.Printf("❌ 知识库导入任务 %s 失败（已处理 %d/%d）: %v", jobID, start, len(chunks), err)
+			h.jobs.Update(jobID, func(job *IngestJob) {
+				job.Status = JobFailed
+				job.Error = err.Error()
+				job.Failed = append(job.Failed, report.Failed...)
+			})
+			return
+		}
+
+		processed := end
+		failed += len(report.Failed)
+		h.jobs.Update(jobID, func(job *IngestJob) {
+			job.Processed = processed
+			job.Failed = append(job.Failed, report.Failed...)
+		})
+	}
+
+	log.Printf("✅ 知识库导入任务 %s 完成，共写入 %d 个片段，跳过 %d 个", jobID, len(chunks)-failed, failed)
+	h.jobs.Update(jobID, func(job *IngestJob) { job.Status = JobDone })
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"go-ai-service/rag"
+
+	"github.com/gin-gonic/gin"
+)
+
+// knowledgeContextKey gin.Context 中保存本次检索资料的键
+const knowledgeContextKey = "knowledgeSources"
+
+// internalMetadataKeys 仅供内部使用、不返回给前端的文档 metadata（分块时记录的原文档 ID 与分块序号）
+var internalMetadataKeys = map[string]bool{
+	"source_id": true,
+	"chunk":     true,
+}
+
+// KnowledgeSource 回答参考的知识库资料（请求开启 includeKnowledge 时返回，供前端展示"根据以下资料"）
+type KnowledgeSource struct {
+	ID         string                 `json:"id"`                 // 原文档 ID（分块文档返回所属文档的 ID）
+	Title      string                 `json:"title"`              // 标题（metadata 中没有时为文档 ID）
+	URL        string                 `json:"url,omitempty"`      // 链接
+	Text       string                 `json:"text"`               // 检索到的文本
+	Metadata   map[string]interface{} `json:"metadata,omitempty"` // 去除内部字段后的 metadata
+	Similarity float64                `json:"similarity"`         // 与问题的相似度（0~1）
+}
+
+// setKnowledgeSources 请求开启 includeKnowledge 时记录本次检索到的资料，由 writeReply 附加到回复中
+func (h *ChatHandler) setKnowledgeSources(c *gin.Context, req *ChatRequest, docs []rag.Document) {
+	if !req.IncludeKnowledge {
+		return
+	}
+	c.Set(knowledgeContextKey, knowledgeSources(docs))
+}
+
+// knowledgeSourcesFromContext 获取本次检索到的资料（未开启 includeKnowledge 时为 nil）
+func knowledgeSourcesFromContext(c *gin.Context) []KnowledgeSource {
+	if value, ok := c.Get(knowledgeContextKey); ok {
+		if sources, ok := value.([]KnowledgeSource); ok {
+			return sources
+		}
+	}
+	return nil
+}
+
+// knowledgeSources 将检索到的文档转换为返回给前端的资料，去除内部字段，距离换算为相似度
+func knowledgeSources(docs []rag.Document) []KnowledgeSource {
+	sources := make([]KnowledgeSource, 0, len(docs))
+	for _, doc := range docs {
+		title, url := rag.DocumentReference(doc)
+
+		id := doc.ID
+		if sourceID, ok := doc.Metadata["source_id"].(string); ok && sourceID != "" {
+			id = sourceID
+		}
+
+		var metadata map[string]interface{}
+		for key, value := range doc.Metadata {
+			if internalMetadataKeys[key] {
+				continue
+			}
+			if metadata == nil {
+				metadata = make(map[string]interface{})
+			}
+			metadata[key] = value
+		}
+
+		sources = append(sources, KnowledgeSource{
+			ID:         id,
+			Title:      title,
+			URL:        url,
+			Text:       doc.Text,
+			Metadata:   metadata,
+			Similarity: doc.Relevance(),
+		})
+	}
+	return sources
+}
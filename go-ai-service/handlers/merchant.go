@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"go-ai-service/config"
+	"go-ai-service/rag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// merchantKeyHeader 商户凭证请求头，用于选择商户自己的知识库
+const merchantKeyHeader = "X-Merchant-Key"
+
+// resolveKnowledgeClient 根据请求携带的商户凭证返回对应 tenant/database 的知识库客户端，
+// 未携带凭证时使用默认知识库；凭证未配置时返回 401 并返回 false
+func resolveKnowledgeClient(c *gin.Context, client *rag.ChromaClient, scopes map[string]config.ChromaScope) (*rag.ChromaClient, bool) {
+	provided := c.GetHeader(merchantKeyHeader)
+	if provided == "" {
+		return client, true
+	}
+
+	scope, ok := lookupMerchantScope(provided, scopes)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "无效的商户凭证")
+		return nil, false
+	}
+
+	tenant, _ := client.Tenant()
+	if scope.Tenant != "" {
+		tenant = scope.Tenant
+	}
+	return client.WithTenant(tenant, scope.Database), true
+}
+
+// lookupMerchantScope 按商户凭证查找知识库配置（逐个常量时间比较，避免通过响应时间猜测凭证）
+func lookupMerchantScope(provided string, scopes map[string]config.ChromaScope) (config.ChromaScope, bool) {
+	var found config.ChromaScope
+	matched := false
+	for key, scope := range scopes {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			found = scope
+			matched = true
+		}
+	}
+	return found, matched
+}
+
+// resolveCollection 返回检索指定知识库集合的客户端，name 为空时使用默认集合；
+// 集合不在白名单中时返回 400 并返回 false
+func resolveCollection(c *gin.Context, client *rag.ChromaClient, name string, allowed map[string]bool) (*rag.ChromaClient, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == client.CollectionName() {
+		return client, true
+	}
+	if !allowed[name] {
+		respondValidationError(c, []FieldError{{Field: "collection", Message: "不在允许的知识库集合中"}})
+		return nil, false
+	}
+	log.Printf("📚 请求指定知识库集合: %s", name)
+	return client.WithCollection(name), true
+}
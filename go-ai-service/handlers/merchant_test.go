@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"go-ai-service/config"
+	"go-ai-service/rag"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveKnowledgeClient(t *testing.T) {
+	client := rag.NewChromaClient("chroma", "8000", "test-key", nil)
+	client.SetTenant("shop", "default_database")
+	scopes := map[string]config.ChromaScope{
+		"key-a": {Tenant: "shop_a", Database: "knowledge"},
+		"key-b": {Database: "shop_b_db"},
+	}
+
+	tests := []struct {
+		name         string
+		merchantKey  string
+		wantOK       bool
+		wantTenant   string
+		wantDatabase string
+	}{
+		{"未携带商户凭证时使用默认知识库", "", true, "shop", "default_database"},
+		{"商户的 tenant 和 database", "key-a", true, "shop_a", "knowledge"},
+		{"未配置 tenant 时沿用默认 tenant", "key-b", true, "shop", "shop_b_db"},
+		{"未配置的商户凭证", "key-x", false, "", ""},
+		{"凭证前缀不能匹配", "key", false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/chat", nil)
+			if tt.merchantKey != "" {
+				c.Request.Header.Set(merchantKeyHeader, tt.merchantKey)
+			}
+
+			scoped, ok := resolveKnowledgeClient(c, client, scopes)
+			if ok != tt.wantOK {
+				t.Fatalf("resolveKnowledgeClient ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if recorder.Code != http.StatusUnauthorized {
+					t.Errorf("状态码 = %d, want 401", recorder.Code)
+				}
+				return
+			}
+			if tenant, database := scoped.Tenant(); tenant != tt.wantTenant || database != tt.wantDatabase {
+				t.Errorf("Tenant() = %s/%s, want %s/%s", tenant, database, tt.wantTenant, tt.wantDatabase)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// 消息 ID：面向用户的固定提示语统一在消息目录中维护，逻辑代码只引用 ID
+const (
+	msgListSeparator       = "list.separator"
+	msgMissingArgs         = "order.missing_args"
+	msgOrderFlowCancelled  = "order.flow_cancelled"
+	msgOrderProfileFilled  = "order.profile_filled"
+	msgOrderConfirmPrompt  = "order.confirm_prompt"
+	msgOrderDemoFilled     = "order.demo_filled"
+	msgFieldCustomerName   = "order.field.customer_name"
+	msgFieldCustomerPhone  = "order.field.customer_phone"
+	msgFieldShippingAddr   = "order.field.shipping_address"
+	msgOrderCancelNeedsID  = "order.cancel_needs_number"
+	msgToolFailed          = "tool.failed"
+	msgCancelLookupFailed  = "cancel.lookup_failed"
+	msgCancelNoCandidates  = "cancel.no_candidates"
+	msgCancelConfirmOne    = "cancel.confirm_one"
+	msgCancelChooseMany    = "cancel.choose_many"
+	msgCancelKept          = "cancel.kept"
+	msgCancelKeptAll       = "cancel.kept_all"
+	msgCancelOrderPlacedAt = "cancel.order_placed_at"
+	msgCancelOrderSep      = "cancel.order_separator"
+)
+
+// orderFieldLabels 可由默认资料或演示数据补全的下单字段对应的名称消息
+var orderFieldLabels = map[string]string{
+	"customerName":    msgFieldCustomerName,
+	"customerPhone":   msgFieldCustomerPhone,
+	"shippingAddress": msgFieldShippingAddr,
+}
+
+// defaultMessageLocale 默认语言（其他语言缺少的消息也从这里回退）
+const defaultMessageLocale = "zh-CN"
+
+// messageCatalogs 内置的消息目录（语言 -> 消息 ID -> 文本），文本中的 {name} 为占位符
+var messageCatalogs = map[string]map[string]string{
+	"zh-CN": {
+		msgListSeparator:       "、",
+		msgMissingArgs:         "为了帮您完成操作，还需要您提供以下信息：{fields}。",
+		msgOrderFlowCancelled:  "好的，已取消本次下单。如有其他需要请随时告诉我。",
+		msgOrderProfileFilled:  "订单中的{fields}已使用您账户中的默认信息。",
+		msgOrderConfirmPrompt:  "确认下单请回复\"确认\"；如需修改，请直接告诉我新的信息；回复\"不买了\"取消下单。",
+		msgOrderDemoFilled:     "⚠️ 演示模式：订单中的{fields}为系统填充的演示数据，并非您提供的真实信息。",
+		msgFieldCustomerName:   "姓名",
+		msgFieldCustomerPhone:  "电话",
+		msgFieldShippingAddr:   "收货地址",
+		msgOrderCancelNeedsID:  "请告诉我要取消的订单号，我来帮您取消。",
+		msgToolFailed:          "抱歉，订单处理失败: {error}",
+		msgCancelLookupFailed:  "抱歉，暂时无法查询您的订单，请直接提供要取消的订单号。",
+		msgCancelNoCandidates:  "没有找到您账号下可以取消的订单（只有待处理或已确认的订单可以取消）。如有疑问请提供订单号。",
+		msgCancelConfirmOne:    "找到您最近的订单：{order}。\n\n确认要取消这个订单吗？回复\"确认\"取消，回复\"不用了\"保留订单。",
+		msgCancelChooseMany:    "找到多个可以取消的订单：\n\n{orders}\n请回复要取消的订单序号或订单号，回复\"不用了\"保留订单。",
+		msgCancelKept:          "好的，已为您保留订单。如有其他需要请随时告诉我。",
+		msgCancelKeptAll:       "好的，已为您保留所有订单。如有其他需要请随时告诉我。",
+		msgCancelOrderPlacedAt: "下单于 {time}",
+		msgCancelOrderSep:      "，",
+	},
+	"en-US": {
+		msgListSeparator:       ", ",
+		msgMissingArgs:         "To complete this for you, I still need the following: {fields}.",
+		msgOrderFlowCancelled:  "OK, this order has been cancelled. Let me know if there's anything else I can help with.",
+		msgOrderProfileFilled:  "The {fields} on this order were filled in from your account.",
+		msgOrderConfirmPrompt:  "Reply \"yes\" to place the order, tell me any details you'd like to change, or reply \"no\" to cancel.",
+		msgOrderDemoFilled:     "⚠️ Demo mode: the {fields} on this order are demo data filled in by the system, not information you provided.",
+		msgFieldCustomerName:   "name",
+		msgFieldCustomerPhone:  "phone number",
+		msgFieldShippingAddr:   "shipping address",
+		msgOrderCancelNeedsID:  "Please tell me the number of the order you'd like to cancel and I'll take care of it.",
+		msgToolFailed:          "Sorry, your order could not be processed: {error}",
+		msgCancelLookupFailed:  "Sorry, I can't look up your orders right now. Please tell me the number of the order to cancel.",
+		msgCancelNoCandidates:  "I couldn't find any orders on your account that can be cancelled (only pending or confirmed orders can be cancelled). If in doubt, please provide the order number.",
+		msgCancelConfirmOne:    "I found your most recent order: {order}.\n\nDo you want to cancel it? Reply \"yes\" to cancel or \"no\" to keep it.",
+		msgCancelChooseMany:    "I found several orders that can be cancelled:\n\n{orders}\nPlease reply with the number in the list or the order number, or \"no\" to keep them.",
+		msgCancelKept:          "OK, your order has been kept. Let me know if there's anything else I can help with.",
+		msgCancelKeptAll:       "OK, all your orders have been kept. Let me know if there's anything else I can help with.",
+		msgCancelOrderPlacedAt: "placed on {time}",
+		msgCancelOrderSep:      ", ",
+	},
+}
+
+// MessageCatalog 按语言查找面向用户的提示语，未配置的语言或消息回退到简体中文
+type MessageCatalog struct {
+	locale    string
+	overrides map[string]string // 自定义文本（消息 ID -> 文本），优先于内置目录
+}
+
+// NewMessageCatalog 创建指定语言的消息目录，不支持的语言回退到简体中文
+func NewMessageCatalog(locale string) *MessageCatalog {
+	if _, ok := messageCatalogs[locale]; !ok {
+		if locale != "" {
+			log.Printf("⚠️  不支持的消息语言 %s，使用 %s", locale, defaultMessageLocale)
+		}
+		locale = defaultMessageLocale
+	}
+	return &MessageCatalog{locale: locale}
+}
+
+// LoadMessageOverrides 从 JSON 文件加载自定义提示语，格式为 {"消息 ID": "文本"}，消息 ID 须为内置目录中已有的 ID
+func LoadMessageOverrides(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取提示语文件失败: %w", err)
+	}
+
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("提示语文件格式错误（应为 {\"消息 ID\": \"文本\"}）: %w", err)
+	}
+	for id := range overrides {
+		if _, ok := messageCatalogs[defaultMessageLocale][id]; !ok {
+			return nil, fmt.Errorf("未知的消息 ID: %s", id)
+		}
+	}
+	return overrides, nil
+}
+
+// SetMessageOverrides 设置自定义提示语（品牌话术等），覆盖当前语言的内置文本
+func (h *ChatHandler) SetMessageOverrides(overrides map[string]string) {
+	h.messages.overrides = overrides
+}
+
+// fieldList 按当前语言列出下单字段的名称，如"姓名、电话"
+func (m *MessageCatalog) fieldList(fields []string) string {
+	labels := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if id, ok := orderFieldLabels[field]; ok {
+			labels = append(labels, m.Text(id))
+		} else {
+			labels = append(labels, field)
+		}
+	}
+	return strings.Join(labels, m.Text(msgListSeparator))
+}
+
+// Locale 当前使用的语言
+func (m *MessageCatalog) Locale() string {
+	return m.locale
+}
+
+// Text 查找消息并替换占位符，params 为成对的占位符名称和值，如 Text(msgToolFailed, "error", err.Error())
+func (m *MessageCatalog) Text(id string, params ...string) string {
+	text, ok := m.overrides[id]
+	if !ok {
+		text, ok = messageCatalogs[m.locale][id]
+	}
+	if !ok {
+		text, ok = messageCatalogs[defaultMessageLocale][id]
+	}
+	if !ok {
+		log.Printf("⚠️  消息目录中没有消息: %s", id)
+		return id
+	}
+	if len(params) == 0 {
+		return text
+	}
+
+	pairs := make([]string, 0, len(params))
+	for i := 0; i+1 < len(params); i += 2 {
+		pairs = append(pairs, "{"+params[i]+"}", params[i+1])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// placeholderRegex 消息文本中的占位符
+var placeholderRegex = regexp.MustCompile(`\{\w+\}`)
+
+func TestMessageCatalogsMatchDefaultLocale(t *testing.T) {
+	defaults := messageCatalogs[defaultMessageLocale]
+	for locale, catalog := range messageCatalogs {
+		for id, text := range defaults {
+			translated, ok := catalog[id]
+			if !ok {
+				t.Errorf("%s 缺少消息 %s", locale, id)
+				continue
+			}
+			if got, want := placeholders(translated), placeholders(text); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s 的 %s 占位符 = %v, want %v", locale, id, got, want)
+			}
+		}
+		for id := range catalog {
+			if _, ok := defaults[id]; !ok {
+				t.Errorf("%s 中的消息 %s 不在 %s 中", locale, id, defaultMessageLocale)
+			}
+		}
+	}
+}
+
+// placeholders 文本中出现的占位符（排序后）
+func placeholders(text string) []string {
+	found := placeholderRegex.FindAllString(text, -1)
+	sort.Strings(found)
+	return found
+}
+
+func TestMessageCatalogText(t *testing.T) {
+	tests := []struct {
+		name      string
+		locale    string
+		overrides map[string]string
+		id        string
+		params    []string
+		want      string
+	}{
+		{"默认语言", "", nil, msgCancelOrderPlacedAt, []string{"time", "2024-01-02"}, "下单于 2024-01-02"},
+		{"英文", "en-US", nil, msgCancelOrderPlacedAt, []string{"time", "2024-01-02"}, "placed on 2024-01-02"},
+		{"不支持的语言回退到中文", "fr-FR", nil, msgCancelKept, nil, messageCatalogs[defaultMessageLocale][msgCancelKept]},
+		{"多个占位符", "zh-CN", map[string]string{msgCancelKept: "订单 {order}：{error}"}, msgCancelKept, []string{"order", "ORD-1", "error", "超时"}, "订单 ORD-1：超时"},
+		{"自定义文本优先", "en-US", map[string]string{msgCancelKept: "Done, {name}."}, msgCancelKept, []string{"name", "Alice"}, "Done, Alice."},
+		{"未知消息返回 ID", "zh-CN", nil, "unknown.id", nil, "unknown.id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := NewMessageCatalog(tt.locale)
+			catalog.overrides = tt.overrides
+			if got := catalog.Text(tt.id, tt.params...); got != tt.want {
+				t.Errorf("Text(%s) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelFlowUsesMessageLocale(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.MessageLocale = "en-US"
+	h := newTestHandler(t, cfg, newFakeLLM(t, "好的"))
+	h.SetProfileProvider(staticProfiles{"u1": {CustomerPhone: "13800138000"}})
+	useFakeShop(t, h)
+
+	chat := func(message string) string {
+		return decodeChat(t, postChat(t, h, map[string]interface{}{"message": message, "userId": "u1", "sessionId": "s1"})).Reply
+	}
+
+	reply := chat("帮我取消订单")
+	if !strings.HasPrefix(reply, "I found your most recent order: ORD-1, placed on 2024-01-02T10:00:00.") {
+		t.Errorf("Reply = %q, want 英文的候选订单确认", reply)
+	}
+	if reply := chat("no"); reply != messageCatalogs["en-US"][msgCancelKept] {
+		t.Errorf("Reply = %q, want 英文的保留订单提示", reply)
+	}
+}
+
+func TestOrderConfirmationUsesMessageLocale(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"zh-CN", []string{"订单中的姓名、电话、收货地址已使用您账户中的默认信息。", "确认下单请回复\"确认\""}},
+		{"en-US", []string{"The name, phone number, shipping address on this order were filled in from your account.", "Reply \"yes\" to place the order"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MessageLocale = tt.locale
+			fake := newFakeLLM(t, toolCallReply("好的", "create_order", map[string]string{"productName": "山地车", "quantity": "1"}))
+			h := newTestHandler(t, cfg, fake)
+			h.SetProfileProvider(staticProfiles{"u1": {CustomerName: "张三", CustomerPhone: "13712345678", ShippingAddress: "北京市朝阳区建国路1号"}})
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "我要买一辆山地车", "userId": "u1", "sessionId": "s1"}))
+			for _, want := range tt.want {
+				if !strings.Contains(resp.Reply, want) {
+					t.Errorf("Reply = %q, want 包含 %q", resp.Reply, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDemoDefaultsNote(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"zh-CN", "\n\n⚠️ 演示模式：订单中的姓名、收货地址为系统填充的演示数据，并非您提供的真实信息。"},
+		{"en-US", "\n\n⚠️ Demo mode: the name, shipping address on this order are demo data filled in by the system, not information you provided."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MessageLocale = tt.locale
+			h := newTestHandler(t, cfg, newFakeLLM(t, "好的"))
+			if got := h.demoDefaultsNote([]string{"customerName", "shippingAddress"}); got != tt.want {
+				t.Errorf("demoDefaultsNote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"regexp"
+)
+
+// 用户意图分类
+const (
+	intentOrder   = "order"   // 下单、查询或取消订单
+	intentProduct = "product" // 商品咨询与推荐
+	intentFAQ     = "faq"     // 售后、配送等常见问题
+	intentGeneral = "general" // 其他闲聊
+)
+
+// orderIntentPattern 订单操作相关的关键词
+var orderIntentPattern = regexp.MustCompile(`买|下单|购买|订购|订单|取消|快递|物流|收货地址|地址|电话|手机号`)
+
+// productIntentPattern 商品咨询相关的关键词
+var productIntentPattern = regexp.MustCompile(`推荐|价格|多少钱|有没有|型号|配置|参数|对比|商品|手机|电脑|耳机`)
+
+// classifyIntent 根据关键词对用户消息进行意图分类
+func classifyIntent(message string) string {
+	switch {
+	case orderIntentPattern.MatchString(message),
+		orderNumberRegex.MatchString(message),
+		messyPhoneRegex.MatchString(message):
+		return intentOrder
+	case faqPattern.MatchString(message):
+		return intentFAQ
+	case productIntentPattern.MatchString(message):
+		return intentProduct
+	default:
+		return intentGeneral
+	}
+}
+
+// routeModel 按意图选择模型；未启用路由或意图未配置模型时返回空字符串（使用默认模型）
+// 当前消息无法判断意图时参考上一条用户消息，避免下单流程中补充信息的消息被路由到小模型
+func (h *ChatHandler) routeModel(message string, history []HistoryMessage) string {
+	if !h.cfg.ModelRouting {
+		return ""
+	}
+
+	intent := classifyIntent(message)
+	if intent == intentGeneral {
+		for i := len(history) - 1; i >= 0; i-- {
+			if history[i].Role == "user" {
+				if previous := classifyIntent(history[i].Content); previous == intentOrder {
+					intent = previous
+				}
+				break
+			}
+		}
+	}
+
+	model := h.cfg.ModelRoutes[intent]
+	if model == "" {
+		log.Printf("🧭 模型路由: 意图=%s, 模型=默认", intent)
+		return ""
+	}
+
+	log.Printf("🧭 模型路由: 意图=%s, 模型=%s", intent, model)
+	return model
+}
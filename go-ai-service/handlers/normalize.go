@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"go-ai-service/mcp"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// phoneSeparatorRegex 电话号码中常见的分隔符
+var phoneSeparatorRegex = regexp.MustCompile(`[\s\-.()（）]`)
+
+// mobilePhoneRegex 11 位手机号
+var mobilePhoneRegex = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+// messyPhoneRegex 匹配带分隔符的手机号，如 138-0013-8000、138 0013 8000、+86 13800138000
+var messyPhoneRegex = regexp.MustCompile(`(?:\+?86[\s\-]?)?1[3-9]\d[\s\-]?\d{4}[\s\-]?\d{4}`)
+
+// orderNumberRegex 匹配大小写、空格、分隔符不一致的订单号，如 ord-123、ORD 123、Ord_123
+var orderNumberRegex = regexp.MustCompile(`(?i)\bORD\s*[-_]?\s*(\d+)`)
+
+// normalizePhone 去除电话号码中的分隔符和国家码，得到 11 位手机号；无法识别时返回去除首尾空白的原值
+func normalizePhone(phone string) string {
+	trimmed := strings.TrimSpace(phone)
+	digits := phoneSeparatorRegex.ReplaceAllString(trimmed, "")
+	digits = strings.TrimPrefix(digits, "+")
+	if len(digits) == 13 && strings.HasPrefix(digits, "86") {
+		digits = digits[2:]
+	}
+	if mobilePhoneRegex.MatchString(digits) {
+		return digits
+	}
+	return trimmed
+}
+
+// normalizeOrderNumber 统一订单号格式为 ORD-<数字>；无法识别时返回去除空白并转大写的原值
+func normalizeOrderNumber(orderNumber string) string {
+	trimmed := strings.TrimSpace(orderNumber)
+	if matched := orderNumberRegex.FindStringSubmatch(trimmed); len(matched) > 1 && len(matched[0]) == len(trimmed) {
+		return "ORD-" + matched[1]
+	}
+	return strings.ToUpper(strings.Join(strings.Fields(trimmed), ""))
+}
+
+// normalizeToolArguments 按工具定义转换参数类型，并规范化电话号码和订单号；
+// 无法转换的参数保持原值，执行工具前由 ToolExecutor 再次校验并拒绝
+func normalizeToolArguments(toolName string, args map[string]interface{}) {
+	if err := mcp.CoerceArguments(toolName, args); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+	if phone, ok := args["customerPhone"]; ok {
+		args["customerPhone"] = normalizePhone(stringifyArg(phone))
+	}
+	if orderNumber, ok := args["orderNumber"]; ok {
+		args["orderNumber"] = normalizeOrderNumber(stringifyArg(orderNumber))
+	}
+	if statuses, ok := args["status"].([]string); ok {
+		args["status"] = normalizeOrderStatuses(statuses)
+	}
+}
+
+// normalizeOrderStatuses 将订单状态统一为大写的状态码（如"已发货"、"shipped" 转换为 SHIPPED），去除重复值
+func normalizeOrderStatuses(statuses []string) []string {
+	normalized := make([]string, 0, len(statuses))
+	seen := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		status = strings.TrimSpace(status)
+		code := strings.ToUpper(status)
+		for statusCode, text := range orderStatusText {
+			if status == text {
+				code = statusCode
+				break
+			}
+		}
+		if code != "" && !seen[code] {
+			seen[code] = true
+			normalized = append(normalized, code)
+		}
+	}
+	return normalized
+}
+
+// stringifyArg 将参数值转换为字符串（JSON 中的数字会被解析为 float64）
+func stringifyArg(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	default:
+		return ""
+	}
+}
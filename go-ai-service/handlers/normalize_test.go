@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"13800138000", "13800138000"},
+		{" 138-0013-8000 ", "13800138000"},
+		{"138 0013 8000", "13800138000"},
+		{"+86 13800138000", "13800138000"},
+		{"+86-138-0013-8000", "13800138000"},
+		{"(138)00138000", "13800138000"},
+		{"010-12345678", "010-12345678"}, // 座机号无法识别，保持原值
+		{"  12345 ", "12345"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			if got := normalizePhone(tt.phone); got != tt.want {
+				t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOrderNumber(t *testing.T) {
+	tests := []struct {
+		orderNumber string
+		want        string
+	}{
+		{"ORD-1234567890", "ORD-1234567890"},
+		{"ord-123", "ORD-123"},
+		{"ORD 123", "ORD-123"},
+		{"Ord_123", "ORD-123"},
+		{" ORD123 ", "ORD-123"},
+		{"abc 123", "ABC123"}, // 无法识别，去除空白并转大写
+		{"ORD-123-extra", "ORD-123-EXTRA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.orderNumber, func(t *testing.T) {
+			if got := normalizeOrderNumber(tt.orderNumber); got != tt.want {
+				t.Errorf("normalizeOrderNumber(%q) = %q, want %q", tt.orderNumber, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeToolArguments(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		args map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "下单参数",
+			tool: "create_order",
+			args: map[string]interface{}{"productName": "山地自行车", "quantity": "2", "customerPhone": "138-0013-8000"},
+			want: map[string]interface{}{"productName": "山地自行车", "quantity": 2, "customerPhone": "13800138000"},
+		},
+		{
+			name: "数字形式的电话号码",
+			tool: "create_order",
+			args: map[string]interface{}{"customerPhone": float64(13800138000)},
+			want: map[string]interface{}{"customerPhone": "13800138000"},
+		},
+		{
+			name: "订单号",
+			tool: "query_order",
+			args: map[string]interface{}{"orderNumber": "ord 42"},
+			want: map[string]interface{}{"orderNumber": "ORD-42"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizeToolArguments(tt.tool, tt.args)
+			if !reflect.DeepEqual(tt.args, tt.want) {
+				t.Errorf("normalizeToolArguments() = %#v, want %#v", tt.args, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOrderStatuses(t *testing.T) {
+	got := normalizeOrderStatuses([]string{"shipped", "已发货", " pending ", ""})
+	want := []string{"SHIPPED", "PENDING"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeOrderStatuses() = %v, want %v", got, want)
+	}
+}
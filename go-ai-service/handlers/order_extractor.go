@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-ai-service/llm"
+	"go-ai-service/tracing"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderExtractionTurns 提取订单信息时参考的最近历史消息条数
+const orderExtractionTurns = 10
+
+// orderFields create_order 的参数字段
+var orderFields = []string{"productName", "quantity", "customerName", "customerPhone", "shippingAddress"}
+
+// orderExtractionPrompt 从对话中提取下单信息的提示词（只输出 JSON）
+const orderExtractionPrompt = `你是订单信息提取器。根据下面的对话，提取用户本次要下单的信息，只输出一个 JSON 对象，不要输出任何其他内容。
+字段：
+- productName: 商品名称（字符串）
+- quantity: 购买数量（整数，如"两台"为 2）
+- customerName: 收货人姓名
+- customerPhone: 收货人手机号
+- shippingAddress: 收货地址
+对话中没有明确提到的字段填 null，不要猜测或编造。
+
+对话：
+%s`
+
+// fillOrderArguments 为 create_order 补全模型没有填写的参数：优先用 LLM 从整段对话中提取，不可用时退回正则提取
+// 只填写缺失或为空的字段，模型已给出的参数保持不变
+func (h *ChatHandler) fillOrderArguments(span *tracing.Span, req *ChatRequest, arguments string, masker *piiMasker) string {
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments
+	}
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+
+	var missing []string
+	for _, field := range orderFields {
+		if value, ok := args[field]; !ok || isBlankValue(value) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		return arguments
+	}
+
+	extracted := h.extractOrderFields(span, req, masker)
+	var filled []string
+	for _, field := range missing {
+		if value, ok := extracted[field]; ok && !isBlankValue(value) {
+			args[field] = value
+			filled = append(filled, field)
+		}
+	}
+	if len(filled) == 0 {
+		return arguments
+	}
+
+	normalizeToolArguments("create_order", args)
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return arguments
+	}
+	log.Printf("🧾 从对话中补全下单参数: %v", filled)
+	return string(argsJSON)
+}
+
+// extractOrderFields 提取对话中的下单信息：开启 LLM 提取时优先使用，失败或未开启时用正则提取当前消息
+func (h *ChatHandler) extractOrderFields(span *tracing.Span, req *ChatRequest, masker *piiMasker) map[string]interface{} {
+	if h.cfg.OrderExtractionLLM {
+		fields, err := h.extractOrderFieldsLLM(span, req, masker)
+		if err == nil {
+			return fields
+		}
+		log.Printf("⚠️  LLM 提取下单信息失败，改用正则提取: %v", err)
+	}
+	fields := extractOrderFieldsRegex(req.Message)
+	// 正则按单字匹配提示词，容易把"收货人"之类的文字误当作地址，不像地址时丢弃
+	if address, ok := fields["shippingAddress"].(string); ok && !addressShapeRegex.MatchString(address) {
+		delete(fields, "shippingAddress")
+	}
+	return fields
+}
+
+// extractOrderFieldsLLM 用一次独立的 LLM 调用从最近的对话中提取下单信息
+func (h *ChatHandler) extractOrderFieldsLLM(parent *tracing.Span, req *ChatRequest, masker *piiMasker) (map[string]interface{}, error) {
+	history := req.History
+	if len(history) > orderExtractionTurns {
+		history = history[len(history)-orderExtractionTurns:]
+	}
+
+	var sb strings.Builder
+	for _, msg := range history {
+		role := "用户"
+		if msg.Role == "assistant" {
+			role = "客服"
+		}
+		sb.WriteString(fmt.Sprintf("%s：%s\n", role, masker.Mask(msg.Content)))
+	}
+	sb.WriteString(fmt.Sprintf("用户：%s", masker.Mask(req.Message)))
+
+	messages := []llm.Message{{
+		Role:    "user",
+		Content: fmt.Sprintf(orderExtractionPrompt, sb.String()),
+	}}
+	params := llm.GenerationParams{Name: "extract", Temperature: 0, TopP: 0.1}
+
+	type result struct {
+		text string
+		err  error
+	}
+	done := make(chan result, 1)
+	span := parent.Child("llm.extract_order", tracing.KindClient)
+	span.SetAttribute("llm.model", h.cfg.OrderExtractionModel)
+	go func() {
+		response, err := h.llmClient.ChatWithOptions(h.cfg.OrderExtractionModel, params, messages, nil)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{text: h.llmClient.GetTextResponse(response)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		fields, err := parseOrderFields(masker.Unmask(r.text))
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("🧾 LLM 提取的下单信息字段: %d 个", len(fields))
+		return fields, nil
+	case <-time.After(h.cfg.OrderExtractionTimeout):
+		return nil, fmt.Errorf("超时 (%s)", h.cfg.OrderExtractionTimeout)
+	}
+}
+
+// parseOrderFields 解析提取结果中的 JSON 对象（允许包裹在代码块或说明文字中），只保留有值的订单字段
+func parseOrderFields(text string) (map[string]interface{}, error) {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("响应中没有 JSON 对象: %s", truncateForLog(text, 100))
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+
+	fields := make(map[string]interface{})
+	for _, field := range orderFields {
+		value := strings.TrimSpace(stringifyArg(raw[field]))
+		if value == "" || value == "null" {
+			continue
+		}
+		if field == "quantity" {
+			quantity, err := strconv.Atoi(value)
+			if err != nil || quantity <= 0 {
+				continue
+			}
+			fields[field] = quantity
+			continue
+		}
+		fields[field] = value
+	}
+	return fields, nil
+}
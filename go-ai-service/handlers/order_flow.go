@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-ai-service/mcp"
+	"go-ai-service/tracing"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderFlow 会话中进行中的"补全下单信息"流程：记住已收集的 create_order 参数，逐轮询问缺失的字段；
+// 使用了用户默认资料或开启了下单确认时，信息补全后先请用户确认再提交。
+// 用户中途问了别的问题时保留已收集的参数（连续 orderFlowMaxIdleTurns 轮没有提供下单信息才放弃），
+// 之后模型再次发起的 create_order 与已收集的参数合并
+type orderFlow struct {
+	UserID        string // 发起流程的用户，会话被其他用户使用时放弃流程（参数中可能有该用户资料中的个人信息）
+	DryRun        bool   // 发起流程的请求为模拟执行，只能由同为模拟执行的请求完成
+	Arguments     map[string]interface{}
+	ProfileFilled []string // 使用用户默认资料补全的字段名
+	Confirming    bool     // 信息已补全，等待用户确认
+	IdleTurns     int      // 连续没有提供下单信息的轮数
+}
+
+// orderFlowMaxIdleTurns 连续多少轮没有提供下单信息后放弃已收集的参数
+const orderFlowMaxIdleTurns = 3
+
+// orderSlotMaxRunes 整条回复作为单个字段值时的最大字数，超出的视为不是在回答问题
+const orderSlotMaxRunes = 40
+
+var (
+	// orderFlowDeclineRegex 放弃下单
+	orderFlowDeclineRegex = regexp.MustCompile(`^(不买了|不要了|算了|不用了?|取消下单|先不买了?|不下单了)[。!！.]*$`)
+	// orderConfirmRegex 确认下单
+	orderConfirmRegex = regexp.MustCompile(`^(确认|确定|确认下单|下单吧?|是的?|对|好的?|可以|没问题|嗯|yes|ok)[。!！.]*$`)
+	// orderChangeVerbRegex 修改信息时的字段名和动词，如"地址改成…"、"电话换成…"，解析字段前去掉
+	orderChangeVerbRegex = regexp.MustCompile(`(?:收货地址|地址|电话|手机号?|联系方式|收货人|收件人|姓名|名字|数量|商品)?(?:改成|改为|换成|换为|更改为|修改为)[:：]?`)
+	// orderConfirmDeclineRegex 等待确认时放弃下单
+	orderConfirmDeclineRegex = regexp.MustCompile(`^(不要|取消吧?|否|不是|先不|no)[。!！.]*$`)
+	// nameLabelRegex 带提示词的姓名，如"收货人：张三"、"我叫张三"
+	nameLabelRegex = regexp.MustCompile(`(?:姓名|名字|收货人|收件人|联系人|我叫)(?:是|为|:|：)?\s*(\p{Han}{2,4})`)
+	// quantityRegex 带量词的数量，如"2件"、"两台"
+	quantityRegex = regexp.MustCompile(`(\d+|[一二两三四五六七八九十])\s*(?:件|个|台|份|双|只|套|瓶|盒|部|本)`)
+	// productLabelRegex 带提示词的商品名称，如"商品：山地自行车"
+	productLabelRegex = regexp.MustCompile(`(?:商品|产品)(?:名称|名)?(?:是|为|:|：)\s*([^\s,，。;；!！?？]+)`)
+	// slotSeparatorRegex 回复中分隔多个信息的符号
+	slotSeparatorRegex = regexp.MustCompile(`[\s,，。;；、!！]+`)
+	// slotQuestionRegex 提问的语气，说明用户没有在回答缺失的信息
+	slotQuestionRegex = regexp.MustCompile(`[?？]|吗|呢|怎么|什么|多少|哪|为什么|能不能`)
+	// slotNameRegex 直接回复的姓名：2-4 个汉字或英文名
+	slotNameRegex = regexp.MustCompile(`^(?:\p{Han}{2,4}|[A-Za-z][A-Za-z .]{1,29})$`)
+)
+
+// quantityDigits 中文数量
+var quantityDigits = map[string]int{"一": 1, "二": 2, "两": 2, "三": 3, "四": 4, "五": 5, "六": 6, "七": 7, "八": 8, "九": 9, "十": 10}
+
+// startOrderFlow 缺少必需参数的下单请求：保存已有的参数，后续对话中只询问缺失的字段
+func (h *ChatHandler) startOrderFlow(req *ChatRequest, arguments string, profileFilled []string) {
+	if req.SessionID == "" {
+		return
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		args = make(map[string]interface{})
+	}
+	h.sessions.SetOrderFlow(req.SessionID, &orderFlow{UserID: req.UserID, DryRun: req.DryRun, Arguments: args, ProfileFilled: profileFilled})
+	log.Printf("🗂️  下单信息不完整，开始逐步收集: %v", missingOrderFields(args))
+}
+
+// startOrderConfirmation 信息完整但需要确认的下单请求（使用了用户默认资料或开启了下单确认）：保存参数并返回请用户确认的提示
+func (h *ChatHandler) startOrderConfirmation(req *ChatRequest, arguments string, profileFilled []string) (string, bool) {
+	var args map[string]interface{}
+	if req.SessionID == "" || json.Unmarshal([]byte(arguments), &args) != nil || args == nil {
+		return "", false
+	}
+	h.sessions.SetOrderFlow(req.SessionID, &orderFlow{UserID: req.UserID, DryRun: req.DryRun, Arguments: args, ProfileFilled: profileFilled, Confirming: true})
+	log.Printf("🗂️  下单信息已完整（默认资料 %v），等待用户确认", profileFilled)
+	return h.orderConfirmReply(args, profileFilled), true
+}
+
+// resumeOrderFlow 模型发起 create_order 时合并会话中已收集的下单参数：本次调用中非空的参数优先，
+// 缺失或为空的字段使用已收集的值。合并后结束原流程（仍缺字段时由调用方重新开始收集），返回合并后的参数
+// 及原流程中使用默认资料补全的字段
+func (h *ChatHandler) resumeOrderFlow(req *ChatRequest, arguments string) (string, []string) {
+	flow := h.currentOrderFlow(req)
+	if flow == nil {
+		return arguments, nil
+	}
+	h.sessions.SetOrderFlow(req.SessionID, nil)
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		args = make(map[string]interface{})
+	}
+	merged := 0
+	for field, value := range flow.Arguments {
+		if current, ok := args[field]; (!ok || isBlankValue(current)) && !isBlankValue(value) {
+			args[field] = value
+			merged++
+		}
+	}
+	if merged == 0 {
+		return arguments, flow.ProfileFilled
+	}
+
+	data, err := json.Marshal(args)
+	if err != nil {
+		return arguments, flow.ProfileFilled
+	}
+	log.Printf("🗂️  合并已收集的下单参数: %d 个字段", merged)
+	return string(data), flow.ProfileFilled
+}
+
+// currentOrderFlow 当前请求可以继续的下单流程：流程由会话中的其他用户发起，或与当前请求一个是模拟执行、
+// 一个是实际执行时放弃流程并返回 nil（避免模拟执行中收集的订单被普通请求实际提交，反之亦然）
+func (h *ChatHandler) currentOrderFlow(req *ChatRequest) *orderFlow {
+	if req.SessionID == "" {
+		return nil
+	}
+	flow := h.sessions.OrderFlow(req.SessionID)
+	if flow == nil {
+		return nil
+	}
+	if flow.UserID != req.UserID {
+		log.Printf("⚠️  会话 %s 的下单流程属于其他用户，放弃流程", req.SessionID)
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		return nil
+	}
+	if flow.DryRun != req.DryRun {
+		log.Printf("⚠️  会话 %s 的下单流程与当前请求的模拟执行设置不同，放弃流程", req.SessionID)
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		return nil
+	}
+	return flow
+}
+
+// handleOrderFlow 处理补全下单信息流程中的回复：合并本轮提供的字段，仍有缺失时继续询问，补全后执行下单。
+// 返回 false 表示当前没有进行中的流程或用户转而谈论其他话题，继续正常处理
+func (h *ChatHandler) handleOrderFlow(c *gin.Context, req *ChatRequest, span *tracing.Span, timings *requestTimings, masker *piiMasker) bool {
+	flow := h.currentOrderFlow(req)
+	if flow == nil {
+		return false
+	}
+	if !h.isToolAllowed("create_order") {
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		return false
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if orderFlowDeclineRegex.MatchString(message) || flow.Confirming && orderConfirmDeclineRegex.MatchString(message) {
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		h.writeReply(c, ChatResponse{Reply: h.messages.Text(msgOrderFlowCancelled), SessionID: req.SessionID})
+		return true
+	}
+
+	if flow.Confirming && orderConfirmRegex.MatchString(message) {
+		log.Printf("🗂️  用户确认下单")
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		if argsJSON, err := json.Marshal(flow.Arguments); err == nil {
+			h.submitOrder(c, req, span, timings, string(argsJSON))
+			return true
+		}
+		return false
+	}
+
+	// 等待确认时用户可以修改任一字段，否则只收集缺失的字段
+	missing := missingOrderFields(flow.Arguments)
+	slotsText := message
+	if flow.Confirming {
+		missing = orderFields
+		slotsText = orderChangeVerbRegex.ReplaceAllString(message, " ")
+	}
+	fields := parseOrderSlots(slotsText, missing)
+	if h.cfg.OrderExtractionLLM && !flow.Confirming && len(fields) < len(missing) {
+		if extracted, err := h.extractOrderFieldsLLM(span, req, masker); err == nil {
+			for _, field := range missing {
+				if _, ok := fields[field]; !ok && extracted[field] != nil {
+					fields[field] = extracted[field]
+				}
+			}
+		} else {
+			log.Printf("⚠️  LLM 提取下单信息失败: %v", err)
+		}
+	}
+	if len(fields) == 0 {
+		// 用户转而谈论其他话题：等待确认的订单直接放弃，收集中的参数保留几轮，交给正常流程回答
+		flow.IdleTurns++
+		if flow.Confirming || flow.IdleTurns >= orderFlowMaxIdleTurns {
+			log.Printf("🗂️  回复中没有下单信息，结束补全下单信息流程")
+			h.sessions.SetOrderFlow(req.SessionID, nil)
+			return false
+		}
+		log.Printf("🗂️  回复中没有下单信息，保留已收集的下单参数（%d/%d）", flow.IdleTurns, orderFlowMaxIdleTurns)
+		h.sessions.SetOrderFlow(req.SessionID, flow)
+		return false
+	}
+	flow.IdleTurns = 0
+
+	for field, value := range fields {
+		flow.Arguments[field] = value
+	}
+	normalizeToolArguments("create_order", flow.Arguments)
+	argsJSON, err := json.Marshal(flow.Arguments)
+	if err != nil {
+		h.sessions.SetOrderFlow(req.SessionID, nil)
+		return false
+	}
+	log.Printf("🗂️  补全下单信息: %d 个字段", len(fields))
+
+	if labels := mcp.MissingRequiredArgs("create_order", string(argsJSON)); len(labels) > 0 {
+		h.sessions.SetOrderFlow(req.SessionID, flow)
+		h.writeReply(c, ChatResponse{
+			Reply:     h.missingArgsReply("", labels),
+			SessionID: req.SessionID,
+		})
+		return true
+	}
+
+	// 使用了默认资料或开启了下单确认的订单提交前请用户确认（修改信息后再次确认）
+	if len(flow.ProfileFilled) > 0 || h.cfg.OrderConfirmation {
+		flow.Confirming = true
+		h.sessions.SetOrderFlow(req.SessionID, flow)
+		h.writeReply(c, ChatResponse{
+			Reply:     h.orderConfirmReply(flow.Arguments, flow.ProfileFilled),
+			SessionID: req.SessionID,
+		})
+		return true
+	}
+
+	h.sessions.SetOrderFlow(req.SessionID, nil)
+	h.submitOrder(c, req, span, timings, string(argsJSON))
+	return true
+}
+
+// submitOrder 执行补全（及确认）后的 create_order
+func (h *ChatHandler) submitOrder(c *gin.Context, req *ChatRequest, span *tracing.Span, timings *requestTimings, arguments string) {
+	toolCall := ToolCallInfo{ToolName: "create_order", Arguments: arguments}
+	debugFromContext(c).setToolCall(toolCall)
+	h.runToolCall(c, req, span, timings, toolCall, "", "", nil)
+}
+
+// missingOrderFields 返回 create_order 中缺失或为空的字段名称
+func missingOrderFields(args map[string]interface{}) []string {
+	var missing []string
+	for _, field := range orderFields {
+		if value, ok := args[field]; !ok || isBlankValue(value) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// parseOrderSlots 从用户的回复中提取缺失的下单字段：先按手机号、地址、提示词等特征识别，
+// 回复中只剩一段文字时（如直接回复"张三"），只缺一个字段则作为该字段的值，缺多个字段时只在形如姓名时作为姓名
+func parseOrderSlots(message string, missing []string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	want := make(map[string]bool, len(missing))
+	for _, field := range missing {
+		want[field] = true
+	}
+
+	rest := message
+	take := func(field string, value interface{}, matched string) {
+		fields[field] = value
+		rest = strings.Replace(rest, matched, " ", 1)
+	}
+
+	// 手机号即使已收集过也从剩余文字中去掉，避免干扰后面按整段文字识别姓名
+	if match := messyPhoneRegex.FindString(rest); match != "" {
+		if want["customerPhone"] {
+			take("customerPhone", normalizePhone(match), match)
+		} else {
+			rest = strings.Replace(rest, match, " ", 1)
+		}
+	}
+	if want["shippingAddress"] {
+		if match := addressLabelRegex.FindStringSubmatch(rest); match != nil && addressShapeRegex.MatchString(match[1]) {
+			take("shippingAddress", match[1], match[0])
+		} else if match := addressSegmentRegex.FindString(rest); match != "" {
+			take("shippingAddress", match, match)
+		}
+	}
+	if want["customerName"] {
+		if match := nameLabelRegex.FindStringSubmatch(rest); match != nil {
+			take("customerName", match[1], match[0])
+		}
+	}
+	if want["quantity"] {
+		if match := quantityRegex.FindStringSubmatch(rest); match != nil {
+			if quantity, ok := parseQuantity(match[1]); ok {
+				take("quantity", quantity, match[0])
+			}
+		}
+	}
+	if want["productName"] {
+		if match := productLabelRegex.FindStringSubmatch(rest); match != nil {
+			take("productName", match[1], match[0])
+		}
+	}
+
+	var remaining []string
+	for _, field := range missing {
+		if _, ok := fields[field]; !ok {
+			remaining = append(remaining, field)
+		}
+	}
+	if len(remaining) == 0 {
+		return fields
+	}
+
+	var pieces []string
+	for _, piece := range slotSeparatorRegex.Split(rest, -1) {
+		if piece != "" {
+			pieces = append(pieces, piece)
+		}
+	}
+	if len(pieces) != 1 || slotQuestionRegex.MatchString(pieces[0]) || len([]rune(pieces[0])) > orderSlotMaxRunes {
+		return fields
+	}
+
+	value := pieces[0]
+	if len(remaining) > 1 {
+		if want["customerName"] && fields["customerName"] == nil && slotNameRegex.MatchString(value) && !addressShapeRegex.MatchString(value) {
+			fields["customerName"] = value
+		}
+		return fields
+	}
+	switch field := remaining[0]; field {
+	case "quantity":
+		if quantity, ok := parseQuantity(value); ok {
+			fields[field] = quantity
+		}
+	case "shippingAddress":
+		if addressShapeRegex.MatchString(value) {
+			fields[field] = value
+		}
+	case "customerName":
+		if slotNameRegex.MatchString(value) {
+			fields[field] = value
+		}
+	default:
+		fields[field] = value
+	}
+	return fields
+}
+
+// parseQuantity 解析阿拉伯数字或中文数字表示的正整数数量
+func parseQuantity(value string) (int, bool) {
+	if quantity, ok := quantityDigits[value]; ok {
+		return quantity, true
+	}
+	quantity, err := strconv.Atoi(value)
+	if err != nil || quantity <= 0 {
+		return 0, false
+	}
+	return quantity, true
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResumeOrderFlow(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      *orderFlow
+		arguments   string
+		want        map[string]interface{}
+		wantCarried []string
+	}{
+		{
+			name:      "没有进行中的流程",
+			arguments: `{"productName":"山地车"}`,
+			want:      map[string]interface{}{"productName": "山地车"},
+		},
+		{
+			name:      "补充已收集的字段",
+			stored:    &orderFlow{Arguments: map[string]interface{}{"productName": "山地车", "quantity": float64(2)}},
+			arguments: `{"customerName":"张三"}`,
+			want:      map[string]interface{}{"productName": "山地车", "quantity": float64(2), "customerName": "张三"},
+		},
+		{
+			name:      "本次调用中的非空参数优先",
+			stored:    &orderFlow{Arguments: map[string]interface{}{"productName": "山地车", "quantity": float64(2)}},
+			arguments: `{"productName":"公路车","quantity":""}`,
+			want:      map[string]interface{}{"productName": "公路车", "quantity": float64(2)},
+		},
+		{
+			name:        "保留使用默认资料补全的字段",
+			stored:      &orderFlow{Arguments: map[string]interface{}{"customerPhone": "13800138000"}, ProfileFilled: []string{"customerPhone"}},
+			arguments:   `{"productName":"山地车"}`,
+			want:        map[string]interface{}{"productName": "山地车", "customerPhone": "13800138000"},
+			wantCarried: []string{"customerPhone"},
+		},
+		{
+			name:      "参数无法解析时使用已收集的字段",
+			stored:    &orderFlow{Arguments: map[string]interface{}{"productName": "山地车"}},
+			arguments: `not json`,
+			want:      map[string]interface{}{"productName": "山地车"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+			if tt.stored != nil {
+				h.sessions.SetOrderFlow("s1", tt.stored)
+			}
+
+			arguments, carried := h.resumeOrderFlow(&ChatRequest{SessionID: "s1"}, tt.arguments)
+			var got map[string]interface{}
+			if err := json.Unmarshal([]byte(arguments), &got); err != nil {
+				t.Fatalf("合并后的参数不是 JSON: %q", arguments)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("合并后的参数 = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(carried, tt.wantCarried) {
+				t.Errorf("默认资料字段 = %v, want %v", carried, tt.wantCarried)
+			}
+			if h.sessions.OrderFlow("s1") != nil {
+				t.Error("合并后应结束原流程")
+			}
+		})
+	}
+}
+
+func TestOrderFlowSurvivesOffTopicTurns(t *testing.T) {
+	tests := []struct {
+		name       string
+		confirming bool
+		offTopic   int // 连续的无关提问数
+		wantKept   bool
+	}{
+		{"一轮无关提问后保留", false, 1, true},
+		{"未达到上限时保留", false, orderFlowMaxIdleTurns - 1, true},
+		{"连续达到上限后放弃", false, orderFlowMaxIdleTurns, false},
+		{"等待确认时立即放弃", true, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLLM(t, "周末也正常发货。")
+			h := newTestHandler(t, testConfig(t), fake)
+			h.sessions.SetOrderFlow("s1", &orderFlow{
+				Arguments:  map[string]interface{}{"productName": "山地车", "quantity": float64(2)},
+				Confirming: tt.confirming,
+			})
+
+			for i := 0; i < tt.offTopic; i++ {
+				resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "你们周末发货吗？", "sessionId": "s1"}))
+				if resp.Reply != "周末也正常发货。" {
+					t.Fatalf("无关提问应交给模型回答，回复 = %q", resp.Reply)
+				}
+			}
+
+			flow := h.sessions.OrderFlow("s1")
+			if (flow != nil) != tt.wantKept {
+				t.Fatalf("流程保留 = %v, want %v", flow != nil, tt.wantKept)
+			}
+			if flow != nil && (flow.IdleTurns != tt.offTopic || flow.Arguments["productName"] != "山地车") {
+				t.Errorf("流程 = %+v, want 保留已收集的参数且 IdleTurns = %d", flow, tt.offTopic)
+			}
+		})
+	}
+}
+
+func TestOrderFlowMergesNewToolCallAfterOffTopicTurn(t *testing.T) {
+	fake := newFakeLLM(t,
+		"周末也正常发货。",
+		toolCallReply("好的，继续为您下单。", "create_order", map[string]string{"customerName": "张三"}),
+	)
+	h := newTestHandler(t, testConfig(t), fake)
+	h.sessions.SetOrderFlow("s1", &orderFlow{Arguments: map[string]interface{}{"productName": "山地车", "quantity": float64(2)}})
+
+	decodeChat(t, postChat(t, h, map[string]interface{}{"message": "你们周末发货吗？", "sessionId": "s1"}))
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "那继续下单吧？", "sessionId": "s1"}))
+
+	// 模型重新发起的 create_order 只有姓名，合并后只询问仍缺失的电话和地址
+	if resp.ToolCalled || strings.Contains(resp.Reply, "商品") || strings.Contains(resp.Reply, "数量") {
+		t.Errorf("回复 = %q, want 只询问缺失的字段", resp.Reply)
+	}
+	flow := h.sessions.OrderFlow("s1")
+	if flow == nil {
+		t.Fatal("仍缺少字段时应继续收集")
+	}
+	want := map[string]interface{}{"productName": "山地车", "quantity": float64(2), "customerName": "张三"}
+	for field, value := range want {
+		if got := flow.Arguments[field]; got != value {
+			t.Errorf("%s = %#v, want %#v", field, got, value)
+		}
+	}
+}
+
+func TestOrderFlowCannotBeConfirmedByAnotherUser(t *testing.T) {
+	fake := newFakeLLM(t,
+		toolCallReply("好的，马上为您下单。", "create_order", map[string]string{"productName": "山地车", "quantity": "1"}),
+		"您好，请问有什么可以帮您？",
+	)
+	h := newTestHandler(t, testConfig(t), fake)
+	h.SetProfileProvider(staticProfiles{"u1": {CustomerName: "张三", CustomerPhone: "13712345678", ShippingAddress: "北京市朝阳区建国路1号"}})
+
+	// u1 的订单使用默认资料补全后等待确认
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "我要买一辆山地车", "userId": "u1", "sessionId": "s1"}))
+	if flow := h.sessions.OrderFlow("s1"); flow == nil || !flow.Confirming {
+		t.Fatalf("使用默认资料的订单应等待确认, reply = %q", resp.Reply)
+	}
+
+	// 同一会话中的其他用户回复"确认"不能提交 u1 的订单
+	resp = decodeChat(t, postChat(t, h, map[string]interface{}{"message": "确认", "userId": "u2", "sessionId": "s1"}))
+	if resp.ToolCalled || resp.Reply != "您好，请问有什么可以帮您？" {
+		t.Errorf("响应 = %+v, want 交给模型正常回答", resp)
+	}
+	if strings.Contains(resp.Reply, "张三") || strings.Contains(resp.Reply, "5678") {
+		t.Errorf("回复泄露了其他用户的资料: %s", resp.Reply)
+	}
+	if h.sessions.OrderFlow("s1") != nil {
+		t.Error("其他用户使用会话后应放弃下单流程")
+	}
+}
+
+func TestCurrentOrderFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   orderFlow
+		req      ChatRequest
+		wantKept bool
+	}{
+		{"同一用户", orderFlow{UserID: "u1"}, ChatRequest{UserID: "u1"}, true},
+		{"其他用户", orderFlow{UserID: "u1"}, ChatRequest{UserID: "u2"}, false},
+		{"未登录用户不能继续登录用户的流程", orderFlow{UserID: "u1"}, ChatRequest{}, false},
+		{"都是模拟执行", orderFlow{UserID: "u1", DryRun: true}, ChatRequest{UserID: "u1", DryRun: true}, true},
+		{"模拟执行的流程不能由普通请求完成", orderFlow{UserID: "u1", DryRun: true}, ChatRequest{UserID: "u1"}, false},
+		{"普通流程不能由模拟执行请求完成", orderFlow{UserID: "u1"}, ChatRequest{UserID: "u1", DryRun: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+			stored := tt.stored
+			h.sessions.SetOrderFlow("s1", &stored)
+
+			tt.req.SessionID = "s1"
+			if got := h.currentOrderFlow(&tt.req); (got != nil) != tt.wantKept {
+				t.Errorf("currentOrderFlow() = %+v, want 保留 %v", got, tt.wantKept)
+			}
+			if kept := h.sessions.OrderFlow("s1") != nil; kept != tt.wantKept {
+				t.Errorf("会话中的流程保留 = %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestDryRunOrderFlowIsNotSubmittedByNormalRequest(t *testing.T) {
+	fake := newFakeLLM(t, "您好，请问有什么可以帮您？")
+	h := newTestHandler(t, testConfig(t), fake)
+	h.sessions.SetOrderFlow("s1", &orderFlow{
+		UserID:     "u1",
+		DryRun:     true,
+		Arguments:  map[string]interface{}{"productName": "山地车", "quantity": float64(1), "customerName": "张三", "customerPhone": "13712345678", "shippingAddress": "北京市朝阳区建国路1号"},
+		Confirming: true,
+	})
+
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "确认", "userId": "u1", "sessionId": "s1"}))
+	if resp.ToolCalled || fake.requestCount() != 1 {
+		t.Errorf("响应 = %+v, want 不提交模拟执行中收集的订单", resp)
+	}
+	if h.sessions.OrderFlow("s1") != nil {
+		t.Error("普通请求应放弃模拟执行中的下单流程")
+	}
+}
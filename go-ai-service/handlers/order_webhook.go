@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// orderWebhookSignatureHeader 请求签名头，值为 "sha256=<HMAC-SHA256 十六进制>"
+const orderWebhookSignatureHeader = "X-ShopAI-Signature"
+
+// orderWebhookMaxAttempts 回调最多尝试次数（含首次）
+const orderWebhookMaxAttempts = 3
+
+// orderCreatedMarker create_order 成功时结果中包含的标记
+const orderCreatedMarker = "订单创建成功"
+
+// createdOrderNumberRegex 从 create_order 结果中提取订单号
+var createdOrderNumberRegex = regexp.MustCompile(`订单号[：:]\s*(\S+)`)
+
+// OrderCreatedEvent 订单创建回调的请求体
+type OrderCreatedEvent struct {
+	Event       string                 `json:"event"`
+	OrderNumber string                 `json:"orderNumber,omitempty"`
+	SessionID   string                 `json:"sessionId,omitempty"` // 会话关联 ID
+	UserID      string                 `json:"userId,omitempty"`
+	Order       map[string]interface{} `json:"order"`  // create_order 的参数
+	Result      string                 `json:"result"` // MCP Server 返回的原始结果
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+// OrderWebhook 订单创建后的外部回调（异步发送，失败有限次重试，不阻塞用户回复）
+type OrderWebhook struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+	retryDelay time.Duration
+}
+
+// NewOrderWebhook 创建订单回调，url 为空时返回 nil（表示未启用）
+func NewOrderWebhook(url, secret string, httpClient *http.Client) *OrderWebhook {
+	if url == "" {
+		return nil
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OrderWebhook{
+		url:        url,
+		secret:     secret,
+		httpClient: httpClient,
+		retryDelay: time.Second,
+	}
+}
+
+// SetOrderWebhook 设置订单创建回调
+func (h *ChatHandler) SetOrderWebhook(webhook *OrderWebhook) {
+	h.orderWebhook = webhook
+}
+
+// notifyOrderCreated create_order 成功后异步发送回调
+func (h *ChatHandler) notifyOrderCreated(req *ChatRequest, arguments, result string) {
+	if h.orderWebhook == nil || !strings.Contains(result, orderCreatedMarker) {
+		return
+	}
+
+	var order map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &order); err != nil {
+		log.Printf("⚠️  解析订单参数失败，回调中不包含订单参数: %v", err)
+	}
+
+	event := OrderCreatedEvent{
+		Event:     "order.created",
+		SessionID: req.SessionID,
+		UserID:    req.UserID,
+		Order:     order,
+		Result:    result,
+		CreatedAt: time.Now(),
+	}
+	if matches := createdOrderNumberRegex.FindStringSubmatch(result); len(matches) > 1 {
+		event.OrderNumber = matches[1]
+	}
+
+	go h.orderWebhook.send(event)
+}
+
+// send 发送回调，失败时按递增间隔重试
+func (w *OrderWebhook) send(event OrderCreatedEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("❌ 编码订单回调失败: %v", err)
+		return
+	}
+
+	for attempt := 1; attempt <= orderWebhookMaxAttempts; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			log.Printf("📮 订单回调已发送: %s", event.OrderNumber)
+			return
+		}
+		log.Printf("⚠️  订单回调发送失败（第 %d/%d 次）: %v", attempt, orderWebhookMaxAttempts, err)
+		if attempt < orderWebhookMaxAttempts {
+			time.Sleep(w.retryDelay * time.Duration(attempt))
+		}
+	}
+
+	log.Printf("❌ 订单回调最终失败: %s", event.OrderNumber)
+}
+
+// post 发送一次签名后的回调请求
+func (w *OrderWebhook) post(body []byte) error {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set(orderWebhookSignatureHeader, "sha256="+signWebhookPayload(w.secret, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signWebhookPayload 计算请求体的 HMAC-SHA256 签名
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
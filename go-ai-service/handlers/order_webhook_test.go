@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		secret string
+		body   string
+		want   string
+	}{
+		// RFC 4231 测试用例 2
+		{"Jefe", "what do ya want for nothing?", "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"secret", "", "f9e66e179b6747ae54108f82f8ade8b3c25d76fd30afde6c395822c530196169"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			if got := signWebhookPayload(tt.secret, []byte(tt.body)); got != tt.want {
+				t.Errorf("signWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// webhookReceiver 记录收到的回调，前 failures 次返回 500
+type webhookReceiver struct {
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	signatures []string
+	bodies     [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	r.signatures = append(r.signatures, req.Header.Get(orderWebhookSignatureHeader))
+	r.bodies = append(r.bodies, body)
+	if r.attempts <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func TestOrderWebhookSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		secret       string
+		failures     int
+		wantAttempts int
+	}{
+		{"首次成功", "s3cret", 0, 1},
+		{"失败后重试成功", "s3cret", 2, 3},
+		{"重试次数用完", "s3cret", 5, orderWebhookMaxAttempts},
+		{"未配置密钥不签名", "", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{failures: tt.failures}
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+
+			webhook := NewOrderWebhook(server.URL, tt.secret, server.Client())
+			webhook.retryDelay = time.Millisecond
+			webhook.send(OrderCreatedEvent{Event: "order.created", OrderNumber: "ORD-1"})
+
+			if receiver.attempts != tt.wantAttempts {
+				t.Errorf("尝试次数 = %d, want %d", receiver.attempts, tt.wantAttempts)
+			}
+			for i, signature := range receiver.signatures {
+				want := ""
+				if tt.secret != "" {
+					mac := hmac.New(sha256.New, []byte(tt.secret))
+					mac.Write(receiver.bodies[i])
+					want = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+				}
+				if signature != want {
+					t.Errorf("第 %d 次请求签名 = %q, want %q", i+1, signature, want)
+				}
+			}
+			var event OrderCreatedEvent
+			if err := json.Unmarshal(receiver.bodies[0], &event); err != nil || event.OrderNumber != "ORD-1" {
+				t.Errorf("回调内容 = %s (%v)", receiver.bodies[0], err)
+			}
+		})
+	}
+}
+
+func TestNewOrderWebhookDisabledWithoutURL(t *testing.T) {
+	if webhook := NewOrderWebhook("", "secret", nil); webhook != nil {
+		t.Errorf("未配置 URL 时应返回 nil")
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"go-ai-service/rag"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Persona 助手人设：名字、语气和所属品牌，用于按部署定制助手形象（白标）
+type Persona struct {
+	Name  string // 助手名字，如"小蜜"
+	Tone  string // 说话风格，如"贴心、活泼"
+	Brand string // 所属品牌/店铺名称
+}
+
+// personaMaxRunes 人设各字段的最大字数
+var personaMaxRunes = map[string]int{"name": 20, "tone": 40, "brand": 30}
+
+// personaToolMarker 工具调用块的标签名，人设中不允许出现
+const personaToolMarker = "func_call"
+
+// personaTemplate 追加在系统提示词（含工具调用规范）之后的人设说明，只影响称呼和语气
+var personaTemplate = template.Must(template.New("persona").Parse(`
+
+助手设定:
+{{- if .Name}}
+- 你的名字是"{{.Name}}",用户问你是谁时用这个名字介绍自己{{end}}
+{{- if .Brand}}
+- 你是"{{.Brand}}"的客服,代表该品牌为用户服务{{end}}
+{{- if .Tone}}
+- 说话风格: {{.Tone}}{{end}}
+- 以上设定只影响称呼和语气,能力范围和工具调用格式仍以上面的说明为准`))
+
+// SetPersona 设置助手人设并生成系统提示词中的人设说明，字段包含换行、标签或与工具调用规范冲突的指令时返回错误
+func (h *ChatHandler) SetPersona(persona Persona) error {
+	if persona == (Persona{}) {
+		h.personaNote = ""
+		return nil
+	}
+	fields := [][2]string{{"name", persona.Name}, {"tone", persona.Tone}, {"brand", persona.Brand}}
+	for _, field := range fields {
+		if err := validatePersonaField(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := personaTemplate.Execute(&buf, persona); err != nil {
+		return fmt.Errorf("生成人设说明失败: %w", err)
+	}
+	h.personaNote = buf.String()
+	return nil
+}
+
+// validatePersonaField 校验人设字段：限制长度，不允许换行/控制字符、标签和模板符号、类似指令的语句及工具名称
+func validatePersonaField(field, value string) error {
+	if limit := personaMaxRunes[field]; utf8.RuneCountInString(value) > limit {
+		return fmt.Errorf("人设 %s 不能超过 %d 个字", field, limit)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("人设 %s 不能包含换行或控制字符", field)
+		}
+		switch r {
+		case '<', '>', '{', '}', '`', '"':
+			return fmt.Errorf("人设 %s 不能包含 %q", field, r)
+		}
+	}
+	if rag.ContainsInstruction(value) {
+		return fmt.Errorf("人设 %s 包含类似指令的语句: %s", field, value)
+	}
+	if match := personaToolMention(value); match != "" {
+		return fmt.Errorf("人设 %s 包含工具调用相关的内容（%s）: %s", field, match, value)
+	}
+	return nil
+}
+
+// personaToolMention 返回文本中出现的工具名称或 func_call（会干扰模型选择和调用工具），没有时返回空字符串；
+// "不要啰嗦"、"ToolBox 工具城"之类的普通表述不受影响
+func personaToolMention(value string) string {
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, personaToolMarker) {
+		return personaToolMarker
+	}
+	for name := range knownTools {
+		if strings.Contains(lower, name) {
+			return name
+		}
+	}
+	return ""
+}
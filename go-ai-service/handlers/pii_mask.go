@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// piiMaskerContextKey gin.Context 中保存当前请求脱敏映射的键
+const piiMaskerContextKey = "piiMasker"
+
+// piiRule 一类敏感信息的识别规则，find 返回文本中需要脱敏的片段位置（[start, end) 字节下标）
+type piiRule struct {
+	kind string
+	find func(text string) [][]int
+}
+
+// piiRules 可用的脱敏规则，按 PII_MASK_TYPES 中的名称启用；新增类型时在此注册即可
+var piiRules = map[string]piiRule{
+	"phone":   {kind: "PHONE", find: findPhones},
+	"address": {kind: "ADDRESS", find: findAddresses},
+	"email":   {kind: "EMAIL", find: findEmails},
+}
+
+// piiRuleOrder 规则的执行顺序：先替换手机号，避免地址规则把紧挨着的号码一并吞掉
+var piiRuleOrder = []string{"phone", "email", "address"}
+
+// emailRegex 邮箱地址
+var emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// addressLabelRegex 带提示词的地址，如"地址：…"、"送到…"，分组 1 为地址本身
+var addressLabelRegex = regexp.MustCompile(`(?:收货地址|地址|送到|寄到|住在)(?:是|为|:|：)?\s*([^\s,，。;；!！?？、<>]+)`)
+
+// addressShapeRegex 判断片段是否像地址（包含行政区划或街道门牌）
+var addressShapeRegex = regexp.MustCompile(`省|市|区|县|镇|乡|村|路|街|道|巷|弄|号|小区`)
+
+// addressSegmentRegex 没有提示词时识别完整的地址片段：行政区划 + 街道 + 门牌号
+var addressSegmentRegex = regexp.MustCompile(`[\p{Han}A-Za-z0-9\-]*(?:省|市|区|县)[\p{Han}A-Za-z0-9\-]*?(?:路|街|道|巷|弄|村)[\p{Han}A-Za-z0-9\-]*?\d+号[\p{Han}A-Za-z0-9\-]*`)
+
+// piiPlaceholderRegex 匹配脱敏占位符，如 <PHONE_1>（模型偶尔会省略尖括号）
+var piiPlaceholderRegex = regexp.MustCompile(`<?\b([A-Z]+_\d+)\b>?`)
+
+// findPhones 查找手机号（含分隔符、国家码的写法），跳过更长数字串中的片段（如订单号）
+func findPhones(text string) [][]int {
+	var spans [][]int
+	for _, span := range messyPhoneRegex.FindAllStringIndex(text, -1) {
+		if span[0] > 0 && isASCIIDigit(text[span[0]-1]) {
+			continue
+		}
+		if span[1] < len(text) && isASCIIDigit(text[span[1]]) {
+			continue
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// findEmails 查找邮箱地址
+func findEmails(text string) [][]int {
+	return emailRegex.FindAllStringIndex(text, -1)
+}
+
+// findAddresses 查找带提示词的地址以及独立的完整地址片段
+func findAddresses(text string) [][]int {
+	var spans [][]int
+	for _, match := range addressLabelRegex.FindAllStringSubmatchIndex(text, -1) {
+		if addressShapeRegex.MatchString(text[match[2]:match[3]]) {
+			spans = append(spans, []int{match[2], match[3]})
+		}
+	}
+	for _, span := range addressSegmentRegex.FindAllStringIndex(text, -1) {
+		if !overlapsAny(span, spans) {
+			spans = append(spans, span)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	return spans
+}
+
+// overlapsAny 判断片段是否与已有片段重叠
+func overlapsAny(span []int, spans [][]int) bool {
+	for _, other := range spans {
+		if span[0] < other[1] && other[0] < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// isASCIIDigit 判断字节是否为 ASCII 数字
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// piiMasker 单个请求内的可逆脱敏映射：发送给 LLM 前把敏感信息替换为占位符，
+// 解析工具参数和返回回复前再还原为真实值。映射只在请求内有效，不会持久化
+type piiMasker struct {
+	rules  []piiRule
+	values map[string]string // 占位符名称（如 PHONE_1） -> 原值
+	names  map[string]string // 原值 -> 占位符名称，同一个值在请求内始终使用同一个占位符
+	counts map[string]int    // 每类敏感信息已分配的编号
+}
+
+// newPIIMasker 按类型名称创建脱敏器，未知类型会被忽略并记录警告
+func newPIIMasker(types map[string]bool) *piiMasker {
+	m := &piiMasker{
+		values: make(map[string]string),
+		names:  make(map[string]string),
+		counts: make(map[string]int),
+	}
+	for name := range types {
+		if _, ok := piiRules[name]; !ok {
+			log.Printf("⚠️  未知的脱敏类型: %s", name)
+		}
+	}
+	for _, name := range piiRuleOrder {
+		if types[name] {
+			m.rules = append(m.rules, piiRules[name])
+		}
+	}
+	return m
+}
+
+// startPIIMasking 开启脱敏时为当前请求创建脱敏器并保存到上下文，未开启时返回 nil
+func (h *ChatHandler) startPIIMasking(c *gin.Context) *piiMasker {
+	if !h.cfg.PIIMasking {
+		return nil
+	}
+	masker := newPIIMasker(h.cfg.PIIMaskTypes)
+	c.Set(piiMaskerContextKey, masker)
+	return masker
+}
+
+// piiMaskerFromContext 获取当前请求的脱敏器
+func piiMaskerFromContext(c *gin.Context) *piiMasker {
+	if value, ok := c.Get(piiMaskerContextKey); ok {
+		if masker, ok := value.(*piiMasker); ok {
+			return masker
+		}
+	}
+	return nil
+}
+
+// Mask 将文本中的敏感信息替换为占位符
+func (m *piiMasker) Mask(text string) string {
+	if m == nil || text == "" {
+		return text
+	}
+	for _, rule := range m.rules {
+		spans := rule.find(text)
+		if len(spans) == 0 {
+			continue
+		}
+
+		var sb strings.Builder
+		last := 0
+		for _, span := range spans {
+			if span[0] < last {
+				continue
+			}
+			sb.WriteString(text[last:span[0]])
+			sb.WriteString("<" + m.placeholder(rule.kind, text[span[0]:span[1]]) + ">")
+			last = span[1]
+		}
+		sb.WriteString(text[last:])
+		text = sb.String()
+	}
+	return text
+}
+
+// placeholder 返回原值对应的占位符名称，首次出现时分配新编号
+func (m *piiMasker) placeholder(kind, value string) string {
+	if name, ok := m.names[value]; ok {
+		return name
+	}
+	m.counts[kind]++
+	name := kind + "_" + strconv.Itoa(m.counts[kind])
+	m.names[value] = name
+	m.values[name] = value
+	return name
+}
+
+// Unmask 将文本中的占位符还原为真实值，未知的占位符保持原样
+func (m *piiMasker) Unmask(text string) string {
+	if m == nil || len(m.values) == 0 {
+		return text
+	}
+	return piiPlaceholderRegex.ReplaceAllStringFunc(text, func(match string) string {
+		name := piiPlaceholderRegex.FindStringSubmatch(match)[1]
+		if value, ok := m.values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// Count 已替换的不同敏感信息数量
+func (m *piiMasker) Count() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.values)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// allPIITypes 启用全部脱敏类型
+var allPIITypes = map[string]bool{"phone": true, "address": true, "email": true}
+
+func TestPIIMaskerMask(t *testing.T) {
+	tests := []struct {
+		name  string
+		types map[string]bool
+		text  string
+		want  string
+	}{
+		{"手机号", allPIITypes, "我的手机号是13800138000", "我的手机号是<PHONE_1>"},
+		{"带分隔符和国家码的手机号", allPIITypes, "电话 +86 138-0013-8000 谢谢", "电话 <PHONE_1> 谢谢"},
+		{"同一个号码使用同一个占位符", allPIITypes, "13800138000，再确认一次 13800138000", "<PHONE_1>，再确认一次 <PHONE_1>"},
+		{"不同号码分别编号", allPIITypes, "13800138000 或 13900139000", "<PHONE_1> 或 <PHONE_2>"},
+		{"订单号中的数字串不是手机号", allPIITypes, "订单 ORD-2024013800138000 到了吗", "订单 ORD-2024013800138000 到了吗"},
+		{"邮箱", allPIITypes, "发到 zhang.san@example.com 吧", "发到 <EMAIL_1> 吧"},
+		{"带提示词的地址", allPIITypes, "收货地址：北京市朝阳区建国路88号，电话13800138000", "收货地址：<ADDRESS_1>，电话<PHONE_1>"},
+		{"没有提示词的完整地址", allPIITypes, "寄往 上海市浦东新区世纪大道100号", "寄往 <ADDRESS_1>"},
+		{"提示词后不像地址的内容不脱敏", allPIITypes, "送到门口就行", "送到门口就行"},
+		{"只启用手机号", map[string]bool{"phone": true}, "地址：北京市朝阳区建国路88号 13800138000", "地址：北京市朝阳区建国路88号 <PHONE_1>"},
+		{"未知类型被忽略", map[string]bool{"idcard": true}, "13800138000", "13800138000"},
+		{"空文本", allPIITypes, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPIIMasker(tt.types).Mask(tt.text); got != tt.want {
+				t.Errorf("Mask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPIIMaskerUnmask(t *testing.T) {
+	masker := newPIIMasker(allPIITypes)
+	original := "手机 13800138000，地址：北京市朝阳区建国路88号"
+	masked := masker.Mask(original)
+	if masker.Count() != 2 {
+		t.Fatalf("Count() = %d, want 2 (masked = %q)", masker.Count(), masked)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"还原脱敏后的文本", masked, original},
+		{"模型省略尖括号", "已记录号码 PHONE_1", "已记录号码 13800138000"},
+		{"工具参数中的占位符", "<customerPhone><PHONE_1></customerPhone>", "<customerPhone>13800138000</customerPhone>"},
+		{"未知占位符保持原样", "<PHONE_9> 和 <EMAIL_1>", "<PHONE_9> 和 <EMAIL_1>"},
+		{"不含占位符", "您好", "您好"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := masker.Unmask(tt.text); got != tt.want {
+				t.Errorf("Unmask(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilPIIMasker(t *testing.T) {
+	var masker *piiMasker
+	if got := masker.Mask("13800138000"); got != "13800138000" {
+		t.Errorf("nil Mask = %q", got)
+	}
+	if got := masker.Unmask("<PHONE_1>"); got != "<PHONE_1>" {
+		t.Errorf("nil Unmask = %q", got)
+	}
+	if masker.Count() != 0 {
+		t.Errorf("nil Count = %d", masker.Count())
+	}
+}
+
+func TestHandleChatMasksPIIBeforeLLM(t *testing.T) {
+	tests := []struct {
+		name        string
+		masking     bool
+		wantVisible bool // LLM 请求中是否出现真实手机号
+	}{
+		{"开启脱敏", true, false},
+		{"关闭脱敏", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLLM(t, "好的，已记下您的手机号 <PHONE_2>。")
+			cfg := testConfig(t)
+			cfg.PIIMasking = tt.masking
+			h := newTestHandler(t, cfg, fake)
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{
+				"message":   "我的手机号是13712345678",
+				"sessionId": "s1",
+				"history":   []map[string]string{{"role": "user", "content": "之前留的号码是13698765432"}},
+			}))
+
+			payload, _ := json.Marshal(fake.requests[0])
+			// 号码不与系统提示词示例中的号码重复
+			for _, phone := range []string{"13712345678", "13698765432"} {
+				if visible := strings.Contains(string(payload), phone); visible != tt.wantVisible {
+					t.Errorf("LLM 请求中出现 %s = %v, want %v", phone, visible, tt.wantVisible)
+				}
+			}
+			if tt.masking && resp.Reply != "好的，已记下您的手机号 13712345678。" {
+				t.Errorf("回复中的占位符没有还原: %q", resp.Reply)
+			}
+		})
+	}
+}
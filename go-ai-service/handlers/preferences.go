@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"go-ai-service/config"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Preferences 会话偏好：回复语言、详略程度和语气，空字段表示沿用默认值
+type Preferences struct {
+	Locale    string `json:"locale,omitempty"`    // 回复语言（zh-CN、en-US）
+	Verbosity string `json:"verbosity,omitempty"` // concise（简洁）或 detailed（详细）
+	Tone      string `json:"tone,omitempty"`      // formal（正式）或 casual（轻松）
+}
+
+// 回复详略程度
+const (
+	VerbosityConcise  = "concise"
+	VerbosityDetailed = "detailed"
+)
+
+// 回复语气
+const (
+	ToneFormal = "formal"
+	ToneCasual = "casual"
+)
+
+// detailedRequirement 要求模型详细回答的回复要求
+const detailedRequirement = "回答可以详细展开,必要时分步骤说明并解释原因"
+
+// toneRequirements 各语气对应的回复要求
+var toneRequirements = map[string]string{
+	ToneFormal: "语气正式、礼貌,称呼用户为\"您\",避免口语和表情符号",
+	ToneCasual: "语气轻松亲切,可以适当口语化",
+}
+
+// localeLanguages 各语言的名称（用于要求模型使用该语言回复）
+var localeLanguages = map[string]string{
+	"zh-CN": "简体中文",
+	"en-US": "English",
+}
+
+// defaultPreferences 配置中的默认偏好：语言沿用提示语语言，未配置详略程度时按 CONCISE_REPLIES 决定，无效的值忽略
+func defaultPreferences(cfg *config.Config) Preferences {
+	prefs := Preferences{
+		Locale:    cfg.MessageLocale,
+		Verbosity: cfg.PrefsDefaultVerbosity,
+		Tone:      cfg.PrefsDefaultTone,
+	}
+	if _, ok := localeLanguages[prefs.Locale]; !ok {
+		prefs.Locale = defaultMessageLocale
+	}
+	if prefs.Verbosity == "" && cfg.ConciseReplies {
+		prefs.Verbosity = VerbosityConcise
+	}
+	for _, problem := range prefs.validate() {
+		log.Printf("⚠️  默认偏好 %s 无效（%s），已忽略", problem.Field, problem.Message)
+		switch problem.Field {
+		case "verbosity":
+			prefs.Verbosity = ""
+		case "tone":
+			prefs.Tone = ""
+		}
+	}
+	return prefs
+}
+
+// validate 校验偏好取值，空字段视为有效
+func (p Preferences) validate() []FieldError {
+	var problems []FieldError
+	if _, ok := localeLanguages[p.Locale]; p.Locale != "" && !ok {
+		problems = append(problems, FieldError{Field: "locale", Message: "只支持 zh-CN、en-US"})
+	}
+	if p.Verbosity != "" && p.Verbosity != VerbosityConcise && p.Verbosity != VerbosityDetailed {
+		problems = append(problems, FieldError{Field: "verbosity", Message: "只支持 concise、detailed"})
+	}
+	if _, ok := toneRequirements[p.Tone]; p.Tone != "" && !ok {
+		problems = append(problems, FieldError{Field: "tone", Message: "只支持 formal、casual"})
+	}
+	return problems
+}
+
+// merge 用 override 中的非空字段覆盖当前偏好
+func (p Preferences) merge(override Preferences) Preferences {
+	if override.Locale != "" {
+		p.Locale = override.Locale
+	}
+	if override.Verbosity != "" {
+		p.Verbosity = override.Verbosity
+	}
+	if override.Tone != "" {
+		p.Tone = override.Tone
+	}
+	return p
+}
+
+// sessionPreferences 会话生效的偏好（会话设置覆盖默认值）
+func (h *ChatHandler) sessionPreferences(sessionID string) Preferences {
+	prefs := h.defaultPrefs
+	if sessionPrefs, ok := h.sessions.Preferences(sessionID); ok {
+		prefs = prefs.merge(sessionPrefs)
+	}
+	return prefs
+}
+
+// replyRequirements 按偏好生成系统提示词中的回复要求
+func (h *ChatHandler) replyRequirements(prefs Preferences) []string {
+	var requirements []string
+	switch prefs.Verbosity {
+	case VerbosityConcise:
+		requirements = append(requirements, conciseRequirement(h.cfg.ReplyMaxLength))
+	case VerbosityDetailed:
+		requirements = append(requirements, detailedRequirement)
+	}
+	if requirement, ok := toneRequirements[prefs.Tone]; ok {
+		requirements = append(requirements, requirement)
+	}
+	// 系统提示词本身是中文，默认语言不需要额外说明
+	if language, ok := localeLanguages[prefs.Locale]; ok && prefs.Locale != defaultMessageLocale {
+		requirements = append(requirements, "使用 "+language+" 回复用户")
+	}
+	return requirements
+}
+
+// PreferencesResponse 设置会话偏好的响应
+type PreferencesResponse struct {
+	SessionID   string      `json:"sessionId"`
+	Preferences Preferences `json:"preferences"` // 生效的偏好（已合并默认值）
+}
+
+// HandleSetPreferences 设置已有会话的偏好，只更新请求中填写的字段，之后该会话的系统提示词按偏好生成
+func (h *ChatHandler) HandleSetPreferences(c *gin.Context) {
+	sessionID := strings.TrimSpace(c.Param("id"))
+
+	var req Preferences
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if respondBindError(c, err) {
+			return
+		}
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "请求体格式错误")
+		return
+	}
+	req.Locale = strings.TrimSpace(req.Locale)
+	req.Verbosity = strings.ToLower(strings.TrimSpace(req.Verbosity))
+	req.Tone = strings.ToLower(strings.TrimSpace(req.Tone))
+	if problems := req.validate(); len(problems) > 0 {
+		respondValidationError(c, problems)
+		return
+	}
+
+	current, _ := h.sessions.Preferences(sessionID)
+	if !h.sessions.SetPreferences(sessionID, current.merge(req)) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "会话不存在或已过期")
+		return
+	}
+	log.Printf("🎚️  会话 %s 偏好已更新: %+v", sessionID, req)
+
+	c.JSON(http.StatusOK, PreferencesResponse{
+		SessionID:   sessionID,
+		Preferences: h.sessionPreferences(sessionID),
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionStoreSetPreferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionID string
+		want      bool
+	}{
+		{"已有会话", "active", true},
+		{"不存在的会话", "unknown", false},
+		{"空会话 ID", "", false},
+		{"已过期的会话", "expired", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewSessionStore(time.Minute, 0)
+			store.RecordTurn("active", "u1", "你好", "您好")
+			store.RecordTurn("expired", "u1", "你好", "您好")
+			store.sessions["expired"].LastActive = time.Now().Add(-time.Hour)
+
+			prefs := Preferences{Tone: ToneCasual}
+			if got := store.SetPreferences(tt.sessionID, prefs); got != tt.want {
+				t.Fatalf("SetPreferences(%q) = %v, want %v", tt.sessionID, got, tt.want)
+			}
+			got, ok := store.Preferences(tt.sessionID)
+			if ok != tt.want || (ok && got != prefs) {
+				t.Errorf("Preferences(%q) = %+v, %v", tt.sessionID, got, ok)
+			}
+			if _, exists := store.Get(tt.sessionID); exists != tt.want {
+				t.Errorf("设置偏好后会话存在 = %v, want %v（不应创建会话）", exists, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSetPreferences(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		sessionID  string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"缺少 API Key", "", "s1", `{"tone":"casual"}`, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"API Key 错误", "wrong", "s1", `{"tone":"casual"}`, http.StatusUnauthorized, ErrCodeUnauthorized},
+		{"不存在的会话", "admin-key", "unknown", `{"tone":"casual"}`, http.StatusNotFound, ErrCodeNotFound},
+		{"偏好无效", "admin-key", "s1", `{"tone":"angry"}`, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"设置已有会话的偏好", "admin-key", "s1", `{"tone":"casual"}`, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, testConfig(t), newFakeLLM(t, "好的"))
+			h.sessions.RecordTurn("s1", "u1", "你好", "您好")
+
+			router := gin.New()
+			router.POST("/session/:id/prefs", RequireAPIKey("admin-key"), h.HandleSetPreferences)
+			request := httptest.NewRequest(http.MethodPost, "/session/"+tt.sessionID+"/prefs", bytes.NewReader([]byte(tt.body)))
+			if tt.apiKey != "" {
+				request.Header.Set("X-API-Key", tt.apiKey)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d, body = %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp ErrorResponse
+				json.Unmarshal(recorder.Body.Bytes(), &resp)
+				if resp.Error.Code != tt.wantCode {
+					t.Errorf("错误码 = %q, want %q", resp.Error.Code, tt.wantCode)
+				}
+				if _, ok := h.sessions.Get("unknown"); ok {
+					t.Error("请求失败时不应创建会话")
+				}
+				return
+			}
+			var resp PreferencesResponse
+			json.Unmarshal(recorder.Body.Bytes(), &resp)
+			if resp.SessionID != "s1" || resp.Preferences.Tone != ToneCasual {
+				t.Errorf("响应 = %+v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// profileUserIDPlaceholder 资料接口地址中的用户 ID 占位符
+const profileUserIDPlaceholder = "{userId}"
+
+// CustomerProfile 用户的默认收货信息
+type CustomerProfile struct {
+	CustomerName    string `json:"customerName"`
+	CustomerPhone   string `json:"customerPhone"`
+	ShippingAddress string `json:"shippingAddress"`
+}
+
+// ProfileProvider 按 userId 查询用户的默认收货信息，用户不存在时返回 false
+type ProfileProvider interface {
+	Profile(userID string) (CustomerProfile, bool, error)
+}
+
+// HTTPProfileProvider 通过 HTTP 接口查询用户资料：GET 地址中的 {userId} 替换为用户 ID，
+// 返回 JSON {"customerName", "customerPhone", "shippingAddress"}，404 表示没有该用户的资料
+type HTTPProfileProvider struct {
+	urlTemplate string
+	httpClient  *http.Client
+}
+
+// NewHTTPProfileProvider 创建 HTTP 用户资料查询，urlTemplate 为空时返回 nil（表示未启用）
+func NewHTTPProfileProvider(urlTemplate string, httpClient *http.Client) *HTTPProfileProvider {
+	if urlTemplate == "" {
+		return nil
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &HTTPProfileProvider{urlTemplate: urlTemplate, httpClient: httpClient}
+}
+
+// Profile 查询用户的默认收货信息
+func (p *HTTPProfileProvider) Profile(userID string) (CustomerProfile, bool, error) {
+	profileURL := strings.ReplaceAll(p.urlTemplate, profileUserIDPlaceholder, url.PathEscape(userID))
+	resp, err := p.httpClient.Get(profileURL)
+	if err != nil {
+		return CustomerProfile{}, false, fmt.Errorf("查询用户资料失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return CustomerProfile{}, false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return CustomerProfile{}, false, fmt.Errorf("读取用户资料失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return CustomerProfile{}, false, fmt.Errorf("查询用户资料失败 (状态码 %d): %s", resp.StatusCode, string(body))
+	}
+
+	var profile CustomerProfile
+	if err := json.Unmarshal(body, &profile); err != nil {
+		return CustomerProfile{}, false, fmt.Errorf("解析用户资料失败: %w", err)
+	}
+	return profile, true, nil
+}
+
+// SetProfileProvider 设置用户资料查询，下单缺少客户信息时用登录用户的默认收货信息补全（提交前需用户确认）
+func (h *ChatHandler) SetProfileProvider(provider ProfileProvider) {
+	h.profiles = provider
+}
+
+// applyProfileDefaults 用用户资料补全 create_order 中缺失的客户信息，返回补全后的参数及被补全的字段名。
+// 需要 userId（查询资料）和 sessionId（保存待确认的订单），未配置资料查询或查询失败时原样返回
+func (h *ChatHandler) applyProfileDefaults(req *ChatRequest, arguments string) (string, []string) {
+	if h.profiles == nil || req.UserID == "" || req.SessionID == "" {
+		return arguments, nil
+	}
+
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return arguments, nil
+	}
+	if args == nil {
+		args = make(map[string]interface{})
+	}
+	missing := missingOrderFields(args)
+	if len(missing) == 0 {
+		return arguments, nil
+	}
+
+	profile, ok, err := h.profiles.Profile(req.UserID)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return arguments, nil
+	}
+	if !ok {
+		return arguments, nil
+	}
+
+	defaults := []struct {
+		field string
+		value string
+	}{
+		{"customerName", profile.CustomerName},
+		{"customerPhone", normalizePhone(profile.CustomerPhone)},
+		{"shippingAddress", profile.ShippingAddress},
+	}
+
+	var filled []string
+	for _, d := range defaults {
+		if strings.TrimSpace(d.value) == "" {
+			continue
+		}
+		if value, ok := args[d.field]; ok && !isBlankValue(value) {
+			continue
+		}
+		args[d.field] = d.value
+		filled = append(filled, d.field)
+	}
+	if len(filled) == 0 {
+		return arguments, nil
+	}
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return arguments, nil
+	}
+	log.Printf("👤 使用用户 %s 的默认资料补全 %v", req.UserID, filled)
+	return string(argsJSON), filled
+}
+
+// orderConfirmReply 下单前请用户确认的提示：用预览模板把订单信息渲染为一句话（电话只显示前三位和后四位），
+// 使用了默认资料时说明哪些信息来自账户
+func (h *ChatHandler) orderConfirmReply(args map[string]interface{}, filled []string) string {
+	var sb strings.Builder
+	if len(filled) > 0 {
+		sb.WriteString(h.messages.Text(msgOrderProfileFilled, "fields", h.messages.fieldList(filled)) + "\n\n")
+	}
+	sb.WriteString(h.renderToolPreview("create_order", args))
+	sb.WriteString("\n\n" + h.messages.Text(msgOrderConfirmPrompt))
+	return sb.String()
+}
+
+// maskPhoneNumber 隐藏手机号中间四位，如 138****8000
+func maskPhoneNumber(phone string) string {
+	if runes := []rune(phone); len(runes) == 11 {
+		return string(runes[:3]) + "****" + string(runes[7:])
+	}
+	return phone
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"go-ai-service/config"
+	"strings"
+	"testing"
+)
+
+func TestIsToolAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		advisory bool
+		enabled  map[string]bool
+		tool     string
+		want     bool
+	}{
+		{"默认允许下单", false, nil, "create_order", true},
+		{"仅咨询模式禁止下单", true, nil, "create_order", false},
+		{"仅咨询模式禁止取消订单", true, nil, "cancel_order", false},
+		{"仅咨询模式允许查询", true, nil, "query_order", true},
+		{"不在启用列表中", false, map[string]bool{"search_product": true}, "query_order", false},
+		{"启用列表不能绕过仅咨询模式", true, map[string]bool{"create_order": true}, "create_order", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ChatHandler{cfg: &config.Config{AdvisoryOnly: tt.advisory, EnabledTools: tt.enabled}}
+			if got := h.isToolAllowed(tt.tool); got != tt.want {
+				t.Errorf("isToolAllowed(%s) = %v, want %v", tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemPromptAdvisoryMode(t *testing.T) {
+	for _, advisory := range []bool{false, true} {
+		h := &ChatHandler{cfg: &config.Config{AdvisoryOnly: advisory}}
+		prompt := h.systemPrompt(Preferences{})
+		if got := strings.Contains(prompt, "<tool_name>create_order</tool_name>"); got == advisory {
+			t.Errorf("advisory=%v: 系统提示词包含下单示例 = %v", advisory, got)
+		}
+	}
+}
+
+func TestHandleChatAdvisoryModeRedirectsOrders(t *testing.T) {
+	fake := newFakeLLM(t, toolCallReply("好的，马上为您下单", "create_order", map[string]string{
+		"productName":     "山地自行车",
+		"quantity":        "1",
+		"customerName":    "张三",
+		"customerPhone":   "13800138000",
+		"shippingAddress": "北京市朝阳区建国路1号",
+	}))
+	cfg := testConfig(t)
+	cfg.AdvisoryOnly = true
+	h := newTestHandler(t, cfg, fake)
+
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "帮我买一辆山地自行车", "sessionId": "s1"}))
+	if resp.Reply != advisoryRedirectReply {
+		t.Errorf("Reply = %q, want 仅咨询模式的引导回复", resp.Reply)
+	}
+	if resp.ToolCalled || resp.Action != ActionNone {
+		t.Errorf("仅咨询模式不应执行下单: %+v", resp)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"go-ai-service/tracing"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replyMoreMarker 回复被截断时追加的标记
+const replyMoreMarker = "…（展开更多）"
+
+// sentenceEnds 可作为截断位置的句末字符
+const sentenceEnds = "。！？；!?;\n"
+
+// chatRequestContextKey gin.Context 中保存当前聊天请求的键
+const chatRequestContextKey = "chatRequest"
+
+// traceSpanContextKey gin.Context 中保存当前请求根 span 的键
+const traceSpanContextKey = "traceSpan"
+
+// dryRunReplyPrefix 模拟执行请求的回复开头，提醒没有实际修改订单
+const dryRunReplyPrefix = "【模拟执行，未实际修改订单】\n"
+
+// 回复为空（模型只输出了工具调用或空白内容）时的默认回复
+const (
+	toolDoneReply  = "操作已完成"
+	emptyReplyText = "抱歉，我没有理解您的问题，能换个说法再问一次吗？"
+)
+
+// writeReply 对回复做最终处理（长度限制等）后返回给前端
+func (h *ChatHandler) writeReply(c *gin.Context, resp ChatResponse) {
+	if strings.TrimSpace(resp.Reply) == "" {
+		log.Printf("⚠️  回复内容为空，使用默认回复")
+		resp.Reply = emptyReply(resp.ToolCalled)
+	}
+
+	if h.cfg.ReplyMaxLength > 0 {
+		if truncated, ok := truncateAtSentence(resp.Reply, h.cfg.ReplyMaxLength); ok {
+			log.Printf("✂️  回复超出长度限制 (%d 字)，已截断", h.cfg.ReplyMaxLength)
+			resp.Reply = truncated + replyMoreMarker
+		}
+	}
+
+	// 记录到服务端会话；请求开启时附带推荐的追问问题
+	if value, ok := c.Get(chatRequestContextKey); ok {
+		if req, ok := value.(*ChatRequest); ok {
+			h.sessions.RecordTurn(resp.SessionID, req.UserID, req.Message, resp.Reply)
+			if req.Suggestions && resp.Error == nil {
+				masker := piiMaskerFromContext(c)
+				resp.Suggestions = h.suggestFollowUps(spanFromContext(c), masker.Mask(req.Message), masker.Mask(resp.Reply))
+			}
+		}
+	}
+
+	// 判断回复是否基于知识库资料（工具结果来自实时订单数据，不计入）
+	if !resp.ToolCalled && resp.Error == nil {
+		resp.GroundedOn = groundedOn(groundingDocumentsFromContext(c), resp.Reply, h.cfg.GroundingMinRelevance, h.cfg.GroundingMinOverlap)
+		resp.Grounded = len(resp.GroundedOn) > 0
+	}
+
+	// 模拟执行在记录会话之后再标注，避免标记进入后续对话的上下文
+	if value, ok := c.Get(chatRequestContextKey); ok {
+		if req, ok := value.(*ChatRequest); ok && req.DryRun {
+			resp.DryRun = true
+			resp.Reply = dryRunReplyPrefix + resp.Reply
+		}
+	}
+
+	action := actionFromContext(c)
+	resp.Action, resp.OrderNumber = action.Action, action.OrderNumber
+	resp.Knowledge = knowledgeSourcesFromContext(c)
+	resp.Debug = debugFromContext(c)
+	if resp.Debug != nil {
+		resp.Diagnostics = timingsFromContext(c).diagnostics()
+	}
+	sendChatResponse(c, resp)
+}
+
+// spanFromContext 获取当前请求的根 span（未启用追踪时为 nil）
+func spanFromContext(c *gin.Context) *tracing.Span {
+	if value, ok := c.Get(traceSpanContextKey); ok {
+		if span, ok := value.(*tracing.Span); ok {
+			return span
+		}
+	}
+	return nil
+}
+
+// emptyReply 回复为空时的默认内容：执行过工具时提示操作完成，否则请用户换个说法
+func emptyReply(toolCalled bool) string {
+	if toolCalled {
+		return toolDoneReply
+	}
+	return emptyReplyText
+}
+
+// truncateAtSentence 按字符数截断文本，尽量在最后一个完整句子处截断，返回是否发生截断
+func truncateAtSentence(text string, maxRunes int) (string, bool) {
+	runes := []rune(text)
+	if maxRunes <= 0 || len(runes) <= maxRunes {
+		return text, false
+	}
+
+	cut := runes[:maxRunes]
+	for i := len(cut) - 1; i >= len(cut)/2; i-- {
+		if strings.ContainsRune(sentenceEnds, cut[i]) {
+			return strings.TrimRight(string(cut[:i+1]), "\n"), true
+		}
+	}
+
+	// 没有合适的句末位置时直接按字符截断
+	return string(cut), true
+}
+
+// truncateForLog 按字符截断文本用于日志输出，避免截断多字节字符
+func truncateForLog(text string, maxRunes int) string {
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes]) + "..."
+}
+
+// conciseRequirement 要求模型简洁回答的回复要求
+func conciseRequirement(maxLength int) string {
+	if maxLength > 0 {
+		return fmt.Sprintf("回答要简洁明了,控制在 %d 字以内", maxLength)
+	}
+	return "回答要简洁明了,避免冗长"
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestBuildFinalReply(t *testing.T) {
+	call := "<func_call>\n<tool_name>query_order</tool_name>\n<arguments>\n<orderNumber>ORD-1</orderNumber>\n</arguments>\n</func_call>"
+
+	tests := []struct {
+		name        string
+		llmResponse string
+		toolResult  string
+		want        string
+	}{
+		{"说明文字加工具结果", "好的，我来查询。\n" + call, "订单已发货", "好的，我来查询。\n\n订单已发货"},
+		{"只有工具调用时返回工具结果", call, "订单已发货", "订单已发货"},
+		{"工具结果为空时只返回说明文字", "好的，我来查询。\n" + call, " \n", "好的，我来查询。"},
+		{"两者都为空时返回默认提示", call, "", toolDoneReply},
+		{"空白内容视为空", "  \n\t", "\n", toolDoneReply},
+	}
+
+	h := &ChatHandler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.buildFinalReply(tt.llmResponse, tt.toolResult); got != tt.want {
+				t.Errorf("buildFinalReply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyReply(t *testing.T) {
+	if got := emptyReply(true); got != toolDoneReply {
+		t.Errorf("emptyReply(true) = %q, want %q", got, toolDoneReply)
+	}
+	if got := emptyReply(false); got != emptyReplyText {
+		t.Errorf("emptyReply(false) = %q, want %q", got, emptyReplyText)
+	}
+}
+
+func TestHandleChatNeverRepliesEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		llmReply string
+		want     string
+	}{
+		{"空白内容", " \n\t ", emptyReplyText},
+		{"只有思考过程", "<think>用户在打招呼</think>\n", emptyReplyText},
+		{"正常回复", "您好！", "您好！"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeLLM(t, tt.llmReply)
+			cfg := testConfig(t)
+			cfg.CitationsEnabled = true
+			h := newTestHandler(t, cfg, fake)
+
+			resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "你好", "sessionId": "s1"}))
+			if resp.Reply != tt.want {
+				t.Errorf("回复 = %q, want %q", resp.Reply, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateAtSentence(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxRunes int
+		want     string
+		wantCut  bool
+	}{
+		{"未超出长度", "您好。", 10, "您好。", false},
+		{"不限制长度", "您好。", 0, "您好。", false},
+		{"在句末截断", "第一句话说完了。第二句话比较长", 10, "第一句话说完了。", true},
+		{"没有句末时按字符截断", "一二三四五六七八", 4, "一二三四", true},
+		{"句末太靠前时按字符截断", "好。一二三四五六七八", 8, "好。一二三四五六", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cut := truncateAtSentence(tt.text, tt.maxRunes)
+			if got != tt.want || cut != tt.wantCut {
+				t.Errorf("truncateAtSentence(%q, %d) = %q, %v, want %q, %v", tt.text, tt.maxRunes, got, cut, tt.want, tt.wantCut)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session 服务端保存的会话
+type Session struct {
+	ID         string           `json:"sessionId"`
+	UserID     string           `json:"userId,omitempty"`
+	History    []HistoryMessage `json:"history"`
+	Turns      int              `json:"turns"` // 累计对话轮数（不受历史条数上限影响）
+	LastActive time.Time        `json:"lastActive"`
+
+	Preferences *Preferences `json:"preferences,omitempty"` // 会话偏好（未设置时为空）
+
+	cancelFlow *cancelFlow // 进行中的"无订单号取消订单"流程
+	orderFlow  *orderFlow  // 进行中的"补全下单信息"流程
+}
+
+// SessionSummary 会话概要（用于列表）
+type SessionSummary struct {
+	ID         string    `json:"sessionId"`
+	UserID     string    `json:"userId,omitempty"`
+	Turns      int       `json:"turns"`
+	LastActive time.Time `json:"lastActive"`
+}
+
+// SessionStore 内存中的会话存储，超过 ttl 未活跃的会话视为过期并被清理
+type SessionStore struct {
+	mu          sync.RWMutex
+	sessions    map[string]*Session
+	ttl         time.Duration
+	maxMessages int // 每个会话最多保留的历史消息条数
+}
+
+// NewSessionStore 创建会话存储
+func NewSessionStore(ttl time.Duration, maxMessages int) *SessionStore {
+	return &SessionStore{
+		sessions:    make(map[string]*Session),
+		ttl:         ttl,
+		maxMessages: maxMessages,
+	}
+}
+
+// RecordTurn 记录一轮对话（用户消息和助手回复）
+func (s *SessionStore) RecordTurn(sessionID, userID, userMessage, reply string) {
+	if sessionID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evictExpiredLocked(now)
+
+	session := s.getOrCreateLocked(sessionID)
+	if userID != "" {
+		session.UserID = userID
+	}
+
+	session.History = append(session.History,
+		HistoryMessage{Role: "user", Content: userMessage},
+		HistoryMessage{Role: "assistant", Content: reply},
+	)
+	if s.maxMessages > 0 && len(session.History) > s.maxMessages {
+		session.History = session.History[len(session.History)-s.maxMessages:]
+	}
+	session.Turns++
+	session.LastActive = now
+}
+
+// CancelFlow 获取会话中进行中的取消订单流程
+func (s *SessionStore) CancelFlow(sessionID string) *cancelFlow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || s.expired(session, time.Now()) {
+		return nil
+	}
+	return session.cancelFlow
+}
+
+// SetCancelFlow 保存取消订单流程状态，flow 为 nil 时清除
+func (s *SessionStore) SetCancelFlow(sessionID string, flow *cancelFlow) {
+	if sessionID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.getOrCreateLocked(sessionID)
+	session.cancelFlow = flow
+	session.LastActive = time.Now()
+}
+
+// OrderFlow 获取会话中进行中的补全下单信息流程
+func (s *SessionStore) OrderFlow(sessionID string) *orderFlow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || s.expired(session, time.Now()) {
+		return nil
+	}
+	return session.orderFlow
+}
+
+// SetOrderFlow 保存补全下单信息流程状态，flow 为 nil 时清除
+func (s *SessionStore) SetOrderFlow(sessionID string, flow *orderFlow) {
+	if sessionID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session := s.getOrCreateLocked(sessionID)
+	session.orderFlow = flow
+	session.LastActive = time.Now()
+}
+
+// Preferences 获取会话设置的偏好
+func (s *SessionStore) Preferences(sessionID string) (Preferences, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || s.expired(session, time.Now()) || session.Preferences == nil {
+		return Preferences{}, false
+	}
+	return *session.Preferences, true
+}
+
+// SetPreferences 保存已有会话的偏好，会话不存在或已过期时返回 false（不创建会话）
+func (s *SessionStore) SetPreferences(sessionID string, prefs Preferences) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evictExpiredLocked(now)
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return false
+	}
+	session.Preferences = &prefs
+	session.LastActive = now
+	return true
+}
+
+// getOrCreateLocked 获取或创建会话（调用方需持有写锁）
+func (s *SessionStore) getOrCreateLocked(sessionID string) *Session {
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		session = &Session{ID: sessionID}
+		s.sessions[sessionID] = session
+	}
+	return session
+}
+
+// List 返回活跃会话概要，按最近活跃时间倒序
+func (s *SessionStore) List() []SessionSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	summaries := make([]SessionSummary, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		if s.expired(session, now) {
+			continue
+		}
+		summaries = append(summaries, SessionSummary{
+			ID:         session.ID,
+			UserID:     session.UserID,
+			Turns:      session.Turns,
+			LastActive: session.LastActive,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastActive.After(summaries[j].LastActive)
+	})
+	return summaries
+}
+
+// Get 获取会话副本
+func (s *SessionStore) Get(sessionID string) (Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok || s.expired(session, time.Now()) {
+		return Session{}, false
+	}
+
+	copied := *session
+	copied.History = append([]HistoryMessage(nil), session.History...)
+	return copied, true
+}
+
+// expired 判断会话是否已过期
+func (s *SessionStore) expired(session *Session, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(session.LastActive) > s.ttl
+}
+
+// evictExpiredLocked 清理过期会话（调用方需持有写锁）
+func (s *SessionStore) evictExpiredLocked(now time.Time) {
+	for id, session := range s.sessions {
+		if s.expired(session, now) {
+			delete(s.sessions, id)
+		}
+	}
+}
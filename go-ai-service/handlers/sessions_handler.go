@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSessionPageSize = 20
+	maxSessionPageSize     = 100
+)
+
+// SessionsResponse 会话列表响应
+type SessionsResponse struct {
+	Sessions []SessionSummary `json:"sessions"`
+	Total    int              `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"pageSize"`
+}
+
+// HandleListSessions 分页列出活跃会话（只读）
+func (h *ChatHandler) HandleListSessions(c *gin.Context) {
+	page := queryInt(c, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := queryInt(c, "pageSize", defaultSessionPageSize)
+	if pageSize < 1 || pageSize > maxSessionPageSize {
+		pageSize = defaultSessionPageSize
+	}
+
+	summaries := h.sessions.List()
+	start := (page - 1) * pageSize
+	if start > len(summaries) {
+		start = len(summaries)
+	}
+	end := start + pageSize
+	if end > len(summaries) {
+		end = len(summaries)
+	}
+
+	c.JSON(http.StatusOK, SessionsResponse{
+		Sessions: summaries[start:end],
+		Total:    len(summaries),
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// HandleGetSession 查看指定会话的历史消息（只读）
+func (h *ChatHandler) HandleGetSession(c *gin.Context) {
+	session, ok := h.sessions.Get(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "会话不存在或已过期")
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// queryInt 读取整数查询参数，缺失或无效时返回默认值
+func queryInt(c *gin.Context, key string, defaultValue int) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"go-ai-service/llm"
+	"go-ai-service/mcp"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replyStreamContextKey gin.Context 中保存当前请求 SSE 输出的键
+const replyStreamContextKey = "replyStream"
+
+// 流式聊天响应（stream: true）的 SSE 事件
+const (
+	streamEventDelta    = "delta"    // 回复文本增量，仅用于边生成边展示，最终回复以 done 为准
+	streamEventProgress = "progress" // 工具执行进度 StreamProgress
+	streamEventDone     = "done"     // 完整的 ChatResponse，之后流结束
+	streamEventError    = "error"    // 结构化错误 ErrorResponse，之后流结束
+)
+
+// StreamDelta delta 事件的内容
+type StreamDelta struct {
+	Text string `json:"text"`
+}
+
+// StreamProgress progress 事件的内容
+type StreamProgress struct {
+	Tool    string `json:"tool"`
+	Percent int    `json:"percent"` // 进度百分比，未知时为 -1
+	Message string `json:"message,omitempty"`
+}
+
+// replyStream 流式聊天请求的 SSE 输出：第一个事件发出时才写入响应头，
+// 之前出错仍按普通 JSON 返回错误状态码
+type replyStream struct {
+	c *gin.Context
+
+	mu      sync.Mutex // 工具进度回调来自 MCP 读取 goroutine
+	started bool       // 已写入响应头
+	closed  bool       // 已发送 done/error 事件
+
+	raw  strings.Builder // 模型已输出的原始内容
+	sent string          // 已通过 delta 事件发送的回复文本
+}
+
+// startReplyStream 请求开启流式响应时创建 SSE 输出并保存到上下文，未开启时返回 nil
+func startReplyStream(c *gin.Context, enabled bool) *replyStream {
+	if !enabled {
+		return nil
+	}
+	stream := &replyStream{c: c}
+	c.Set(replyStreamContextKey, stream)
+	return stream
+}
+
+// replyStreamFromContext 获取当前请求的 SSE 输出，非流式请求返回 nil
+func replyStreamFromContext(c *gin.Context) *replyStream {
+	if value, ok := c.Get(replyStreamContextKey); ok {
+		if stream, ok := value.(*replyStream); ok {
+			return stream
+		}
+	}
+	return nil
+}
+
+// send 发送一个 SSE 事件，done/error 之后的事件会被丢弃
+func (s *replyStream) send(event string, data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if !s.started {
+		header := s.c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no") // 关闭反向代理缓冲
+		s.c.Status(http.StatusOK)
+		s.started = true
+	}
+	if event == streamEventDone || event == streamEventError {
+		s.closed = true
+	}
+	s.c.SSEvent(event, data)
+	s.c.Writer.Flush()
+}
+
+// isStarted 是否已经开始输出事件（响应状态码已发送）
+func (s *replyStream) isStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// onDelta 接收模型的增量输出，把其中可以展示给用户的部分作为 delta 事件发送：
+// 工具调用和思考过程不发送，可能是未完整标签或占位符的结尾先保留，脱敏占位符还原为真实值
+func (s *replyStream) onDelta(delta string) {
+	s.raw.WriteString(delta)
+	visible := piiMaskerFromContext(s.c).Unmask(visibleStreamText(s.raw.String()))
+	if len(visible) <= len(s.sent) || !strings.HasPrefix(visible, s.sent) {
+		return
+	}
+	text := visible[len(s.sent):]
+	s.sent = visible
+	s.send(streamEventDelta, StreamDelta{Text: text})
+}
+
+// visibleStreamText 模型已输出内容中可以提前展示的部分：去掉开头的思考过程，
+// 在工具调用（<func_call> 或代码块）处截止，末尾未闭合的 < 之后的内容暂不展示
+func visibleStreamText(text string) string {
+	trimmed := strings.TrimLeft(text, " \t\n")
+	if strings.HasPrefix(trimmed, "<think>") {
+		end := strings.Index(trimmed, "</think>")
+		if end < 0 {
+			return ""
+		}
+		text = strings.TrimLeft(trimmed[end+len("</think>"):], " \t\n")
+	}
+	for _, marker := range []string{"<func_call", "```"} {
+		if i := strings.Index(text, marker); i >= 0 {
+			text = text[:i]
+		}
+	}
+	if i := strings.LastIndex(text, "<"); i >= 0 && !strings.Contains(text[i:], ">") {
+		text = text[:i]
+	}
+	return strings.TrimRight(text, "`")
+}
+
+// chatLLM 调用 LLM 生成回复，流式请求边生成边推送 delta 事件
+func (h *ChatHandler) chatLLM(c *gin.Context, model string, params llm.GenerationParams, messages []llm.Message) (*llm.ChatResponse, error) {
+	if stream := replyStreamFromContext(c); stream != nil {
+		return h.llmClient.ChatStream(c.Request.Context(), model, params, messages, stream.onDelta)
+	}
+	return h.llmClient.ChatWithOptions(model, params, messages, nil)
+}
+
+// clientDisconnected 客户端是否已断开连接（请求上下文已取消）
+func clientDisconnected(c *gin.Context) bool {
+	if err := c.Request.Context().Err(); err != nil {
+		log.Printf("🔌 客户端已断开连接，停止处理: %v", err)
+		return true
+	}
+	return false
+}
+
+// toolProgress 返回工具进度回调：记录日志，流式请求同时以 progress 事件推送给前端
+func toolProgress(c *gin.Context, toolName string) mcp.ProgressFunc {
+	logProgress := progressLogger(toolName)
+	stream := replyStreamFromContext(c)
+	if stream == nil {
+		return logProgress
+	}
+	return func(progress mcp.MCPProgress) {
+		logProgress(progress)
+		stream.send(streamEventProgress, StreamProgress{
+			Tool:    toolName,
+			Percent: progress.Percent(),
+			Message: progress.Message,
+		})
+	}
+}
+
+// sendChatResponse 返回聊天响应：流式请求以 done 事件发送，否则返回 JSON
+func sendChatResponse(c *gin.Context, resp ChatResponse) {
+	if stream := replyStreamFromContext(c); stream != nil {
+		stream.send(streamEventDone, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// sendStreamError 流式响应已经开始时以 error 事件返回错误，返回是否已处理
+func sendStreamError(c *gin.Context, code, message string) bool {
+	stream := replyStreamFromContext(c)
+	if stream == nil || !stream.isStarted() {
+		return false
+	}
+	log.Printf("❌ 流式响应中出错: %s - %s", code, message)
+	stream.send(streamEventError, ErrorResponse{Error: APIError{Code: code, Message: message}})
+	return true
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-ai-service/mcp"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVisibleStreamText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"普通文本", "您好，山地车有货。", "您好，山地车有货。"},
+		{"思考过程未结束", "<think>用户想买车", ""},
+		{"去掉思考过程", "<think>用户想买车</think>\n您好", "您好"},
+		{"工具调用之前的文本", "好的，马上为您下单\n<func_call>\n<tool_name>create_order", "好的，马上为您下单\n"},
+		{"未完整的标签先保留", "好的<func", "好的"},
+		{"未完整的占位符先保留", "您的手机号是 <PHONE", "您的手机号是 "},
+		{"完整的占位符", "您的手机号是 <PHONE_1>，", "您的手机号是 <PHONE_1>，"},
+		{"代码块中的工具调用", "好的\n```json\n{", "好的\n"},
+		{"未完整的代码块标记", "好的\n``", "好的\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := visibleStreamText(tt.text); got != tt.want {
+				t.Errorf("visibleStreamText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// streamChunk DashScope 流式响应中的一个 SSE 事件
+func streamChunk(content, finishReason string) string {
+	chunk, _ := json.Marshal(map[string]interface{}{
+		"request_id": "fake",
+		"output": map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+			"finish_reason": finishReason,
+			"message":       map[string]interface{}{"role": "assistant", "content": content},
+		}}},
+	})
+	return "event:result\ndata:" + string(chunk) + "\n\n"
+}
+
+// streamingLLM 以 serve 处理文本生成请求的 fakeLLM
+func streamingLLM(t *testing.T, serve http.HandlerFunc) *fakeLLM {
+	t.Helper()
+	f := &fakeLLM{server: httptest.NewServer(serve)}
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func TestHandleChatStreamInterrupted(t *testing.T) {
+	tests := []struct {
+		name  string
+		abort bool // 上游连接中途断开，否则正常关闭但没有结束原因
+	}{
+		{"上游连接中途断开", true},
+		{"流结束但没有结束原因", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := streamingLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, streamChunk("您好，", "null"))
+				io.WriteString(w, streamChunk("山地车", "null"))
+				w.(http.Flusher).Flush()
+				if tt.abort {
+					panic(http.ErrAbortHandler)
+				}
+			})
+			h := newTestHandler(t, testConfig(t), fake)
+
+			recorder := postChat(t, h, map[string]interface{}{"message": "有山地车吗", "sessionId": "s1", "stream": true})
+			body := recorder.Body.String()
+			if !strings.Contains(body, "event:delta") {
+				t.Fatalf("中断前应已推送 delta 事件, body = %s", body)
+			}
+			if strings.Contains(body, "event:done") || !strings.Contains(body, "event:error") {
+				t.Fatalf("body = %s, want 以 error 事件结束", body)
+			}
+			if !strings.Contains(body, ErrCodeReplyInterrupted) || !strings.Contains(body, "回复中断，请重试") {
+				t.Errorf("error 事件 = %s, want %s", body, ErrCodeReplyInterrupted)
+			}
+		})
+	}
+}
+
+func TestHandleChatStopsWhenClientDisconnects(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool // 流式请求中断在读取模型输出时，非流式请求在模型返回之后才发现
+	}{
+		{"流式请求", true},
+		{"非流式请求", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// 模型返回工具调用前客户端断开
+			replies := newFakeLLM(t, toolCallReply("好的，帮您查一下。", "search_product", map[string]string{"keyword": "山地车"}))
+			fake := streamingLLM(t, func(w http.ResponseWriter, r *http.Request) {
+				cancel()
+				replies.serve(w, r)
+			})
+			h := newTestHandler(t, testConfig(t), fake)
+
+			var shopRequests atomic.Int32
+			shop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				shopRequests.Add(1)
+				io.WriteString(w, "[]")
+			}))
+			t.Cleanup(shop.Close)
+			h.toolExecutor = mcp.NewToolExecutor(shop.URL, nil)
+
+			body, _ := json.Marshal(map[string]interface{}{"message": "有山地车吗", "sessionId": "s1", "stream": tt.stream})
+			router := gin.New()
+			router.POST("/chat", h.HandleChat)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/chat", bytes.NewReader(body)).WithContext(ctx))
+
+			if shopRequests.Load() != 0 {
+				t.Errorf("客户端断开后仍执行了工具（商城请求 %d 次）", shopRequests.Load())
+			}
+			if got := recorder.Body.String(); strings.Contains(got, "error") || strings.Contains(got, "done") || strings.Contains(got, "reply") {
+				t.Errorf("客户端断开后仍写入了响应: %s", got)
+			}
+			if _, ok := h.sessions.Get("s1"); ok {
+				t.Error("客户端断开后不应记录会话")
+			}
+		})
+	}
+}
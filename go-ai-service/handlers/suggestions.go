@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"go-ai-service/llm"
+	"go-ai-service/tracing"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	suggestionMaxRunes = 40 // 单条推荐问题的最大字数，超出的视为无效
+	suggestionsLimit   = 5  // 推荐问题条数上限（不受配置影响）
+)
+
+// suggestionPrefixRegex 模型输出中的编号或列表符号（如 "1." "2、" "- "）
+var suggestionPrefixRegex = regexp.MustCompile(`^\s*(?:\d+\s*[.、)）:：]|[-*•·])\s*`)
+
+// suggestionsPrompt 生成推荐问题的提示词
+const suggestionsPrompt = `你是电商客服助手。根据下面的对话，站在用户的角度给出 %d 个用户接下来最可能问的简短问题。
+要求：
+- 每行一个问题，不要编号，不要解释
+- 每个问题不超过 20 个字，与商品、订单、售后相关
+- 不要重复对话中已经回答过的问题
+
+用户：%s
+客服：%s`
+
+// suggestFollowUps 生成推荐的追问问题；超时或失败时返回 nil，不影响主回复
+func (h *ChatHandler) suggestFollowUps(parent *tracing.Span, userMessage, reply string) []string {
+	maxCount := h.cfg.SuggestionsMax
+	if maxCount <= 0 || strings.TrimSpace(reply) == "" {
+		return nil
+	}
+	if maxCount > suggestionsLimit {
+		maxCount = suggestionsLimit
+	}
+
+	messages := []llm.Message{{
+		Role:    "user",
+		Content: fmt.Sprintf(suggestionsPrompt, maxCount, userMessage, reply),
+	}}
+	params := llm.GenerationParams{Name: "suggest", Temperature: 0.7, TopP: 0.8}
+
+	type result struct {
+		text string
+		err  error
+	}
+	done := make(chan result, 1)
+	span := parent.Child("llm.suggestions", tracing.KindClient)
+	span.SetAttribute("llm.model", h.cfg.SuggestionsModel)
+	go func() {
+		// 超时后调用仍在后台完成，span 在调用结束时才结束，如实反映 LLM 耗时
+		response, err := h.llmClient.ChatWithOptions(h.cfg.SuggestionsModel, params, messages, nil)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{text: h.llmClient.GetTextResponse(response)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			log.Printf("⚠️  生成推荐问题失败: %v", r.err)
+			return nil
+		}
+		suggestions := parseSuggestions(r.text, maxCount)
+		log.Printf("💡 推荐问题: %v", suggestions)
+		return suggestions
+	case <-time.After(h.cfg.SuggestionsTimeout):
+		log.Printf("⚠️  生成推荐问题超时 (%s)，跳过", h.cfg.SuggestionsTimeout)
+		return nil
+	}
+}
+
+// parseSuggestions 按行解析推荐问题：去掉编号、去重，最多保留 maxCount 条
+func parseSuggestions(text string, maxCount int) []string {
+	seen := make(map[string]bool)
+	var suggestions []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(suggestionPrefixRegex.ReplaceAllString(line, ""))
+		line = strings.Trim(line, `"“”`)
+		if line == "" || seen[line] || len([]rune(line)) > suggestionMaxRunes {
+			continue
+		}
+		seen[line] = true
+		suggestions = append(suggestions, line)
+		if len(suggestions) == maxCount {
+			break
+		}
+	}
+	return suggestions
+}
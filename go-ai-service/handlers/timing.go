@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timingsContextKey gin.Context 中保存请求耗时的键
+const timingsContextKey = "requestTimings"
+
+// requestTimings 一次聊天请求各阶段的耗时
+type requestTimings struct {
+	start time.Time
+	rag   time.Duration // 知识库检索（含嵌入与重排序）
+	llm   time.Duration // LLM 调用（含工具调用格式修正）
+	tool  time.Duration // MCP 工具执行
+}
+
+// newRequestTimings 开始计时
+func newRequestTimings() *requestTimings {
+	return &requestTimings{start: time.Now()}
+}
+
+// Diagnostics 一次聊天请求各阶段的耗时（毫秒，仅在授权的 debug 请求中返回）
+type Diagnostics struct {
+	RAGMS   int64 `json:"rag_ms"`   // 知识库检索
+	LLMMS   int64 `json:"llm_ms"`   // LLM 调用
+	ToolMS  int64 `json:"tool_ms"`  // MCP 工具执行
+	TotalMS int64 `json:"total_ms"` // 截至返回回复时的总耗时
+}
+
+// timingsFromContext 获取当前请求的耗时记录
+func timingsFromContext(c *gin.Context) *requestTimings {
+	if value, ok := c.Get(timingsContextKey); ok {
+		if timings, ok := value.(*requestTimings); ok {
+			return timings
+		}
+	}
+	return nil
+}
+
+// diagnostics 返回截至当前的各阶段耗时
+func (t *requestTimings) diagnostics() *Diagnostics {
+	if t == nil {
+		return nil
+	}
+	return &Diagnostics{
+		RAGMS:   t.rag.Milliseconds(),
+		LLMMS:   t.llm.Milliseconds(),
+		ToolMS:  t.tool.Milliseconds(),
+		TotalMS: time.Since(t.start).Milliseconds(),
+	}
+}
+
+// measure 开始记录一个阶段的耗时，调用返回的函数结束记录（同一阶段多次调用时累加）
+func (t *requestTimings) measure(stage *time.Duration) func() {
+	begin := time.Now()
+	return func() {
+		*stage += time.Since(begin)
+	}
+}
+
+// logRequestTimings 记录请求耗时：超过慢请求阈值时输出各阶段明细，否则只输出一行摘要
+func (h *ChatHandler) logRequestTimings(req *ChatRequest, t *requestTimings) {
+	total := time.Since(t.start)
+	threshold := time.Duration(h.cfg.SlowRequestMS) * time.Millisecond
+
+	if h.cfg.SlowRequestMS <= 0 || total < threshold {
+		log.Printf("⏱️  请求完成 [%s] %dms", req.SessionID, total.Milliseconds())
+		return
+	}
+
+	other := total - t.rag - t.llm - t.tool
+	log.Printf("🐢 慢请求 [%s] 用户 %s 总耗时 %dms（阈值 %dms）: RAG %dms, LLM %dms, 工具 %dms, 其他 %dms, 消息: %s",
+		req.SessionID, req.UserID, total.Milliseconds(), h.cfg.SlowRequestMS,
+		t.rag.Milliseconds(), t.llm.Milliseconds(), t.tool.Milliseconds(), other.Milliseconds(),
+		truncateForLog(req.Message, 50))
+}
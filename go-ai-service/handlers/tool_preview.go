@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// defaultToolPreviewTemplates 内置的工具调用预览模板（Go text/template，参数按名称引用，如 {{.customerName}}）
+var defaultToolPreviewTemplates = map[string]string{
+	"create_order": `将为{{.customerName}}创建 {{.quantity}} 件{{.productName}}的订单，配送至{{.shippingAddress}}（联系电话 {{maskPhone .customerPhone}}），确认吗？`,
+}
+
+// toolPreviewFuncs 预览模板中可用的函数
+var toolPreviewFuncs = template.FuncMap{
+	"maskPhone": func(value interface{}) string {
+		return maskPhoneNumber(fmt.Sprint(value))
+	},
+}
+
+// LoadToolPreviewTemplates 从 JSON 文件加载工具调用预览模板，格式为 {"工具名": "模板"}
+func LoadToolPreviewTemplates(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取预览模板文件失败: %w", err)
+	}
+
+	var templates map[string]string
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("预览模板文件格式错误（应为 {\"工具名\": \"模板\"}）: %w", err)
+	}
+	return templates, nil
+}
+
+// builtinToolPreviewTemplates 解析后的内置预览模板
+func builtinToolPreviewTemplates() map[string]*template.Template {
+	parsed, err := parseToolPreviewTemplates(defaultToolPreviewTemplates)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// SetToolPreviewTemplates 覆盖工具调用预览模板（未覆盖的工具使用内置模板），模板语法错误时返回错误
+func (h *ChatHandler) SetToolPreviewTemplates(templates map[string]string) error {
+	merged := make(map[string]string, len(defaultToolPreviewTemplates)+len(templates))
+	for name, text := range defaultToolPreviewTemplates {
+		merged[name] = text
+	}
+	for name, text := range templates {
+		merged[name] = text
+	}
+
+	parsed, err := parseToolPreviewTemplates(merged)
+	if err != nil {
+		return err
+	}
+	h.previewTemplates = parsed
+	return nil
+}
+
+// parseToolPreviewTemplates 解析预览模板
+func parseToolPreviewTemplates(templates map[string]string) (map[string]*template.Template, error) {
+	parsed := make(map[string]*template.Template, len(templates))
+	for name, text := range templates {
+		tmpl, err := template.New(name).Funcs(toolPreviewFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("工具 %s 的预览模板有误: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+	return parsed, nil
+}
+
+// renderToolPreview 把工具参数渲染为给用户确认的自然语言描述，没有模板或渲染失败时使用通用描述
+func (h *ChatHandler) renderToolPreview(toolName string, args map[string]interface{}) string {
+	if tmpl, ok := h.previewTemplates[toolName]; ok {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, args); err == nil {
+			return strings.TrimSpace(sb.String())
+		}
+	}
+	return fmt.Sprintf("将执行 %s，确认吗？", toolName)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// previewOrderArgs 完整的下单参数
+var previewOrderArgs = map[string]interface{}{
+	"productName":     "山地自行车",
+	"quantity":        2,
+	"customerName":    "张三",
+	"customerPhone":   "13800138000",
+	"shippingAddress": "北京市朝阳区建国路1号",
+}
+
+func TestRenderToolPreview(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		tool      string
+		args      map[string]interface{}
+		want      string
+	}{
+		{
+			name: "内置下单模板隐藏手机号中间四位",
+			tool: "create_order",
+			args: previewOrderArgs,
+			want: "将为张三创建 2 件山地自行车的订单，配送至北京市朝阳区建国路1号（联系电话 138****8000），确认吗？",
+		},
+		{
+			name:      "覆盖内置模板",
+			overrides: map[string]string{"create_order": "  {{.customerName}}：{{.productName}} × {{.quantity}}  "},
+			tool:      "create_order",
+			args:      previewOrderArgs,
+			want:      "张三：山地自行车 × 2",
+		},
+		{
+			name:      "新增其他工具的模板",
+			overrides: map[string]string{"cancel_order": "将取消订单 {{.orderNumber}}，确认吗？"},
+			tool:      "cancel_order",
+			args:      map[string]interface{}{"orderNumber": "ORD-1"},
+			want:      "将取消订单 ORD-1，确认吗？",
+		},
+		{
+			name: "没有模板时使用通用描述",
+			tool: "cancel_order",
+			args: map[string]interface{}{"orderNumber": "ORD-1"},
+			want: "将执行 cancel_order，确认吗？",
+		},
+		{
+			name:      "渲染失败时使用通用描述",
+			overrides: map[string]string{"create_order": "{{index .items 3}}"},
+			tool:      "create_order",
+			args:      previewOrderArgs,
+			want:      "将执行 create_order，确认吗？",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ChatHandler{previewTemplates: builtinToolPreviewTemplates()}
+			if tt.overrides != nil {
+				if err := h.SetToolPreviewTemplates(tt.overrides); err != nil {
+					t.Fatalf("SetToolPreviewTemplates 失败: %v", err)
+				}
+			}
+			if got := h.renderToolPreview(tt.tool, tt.args); got != tt.want {
+				t.Errorf("renderToolPreview() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetToolPreviewTemplatesRejectsSyntaxErrors(t *testing.T) {
+	h := &ChatHandler{previewTemplates: builtinToolPreviewTemplates()}
+	err := h.SetToolPreviewTemplates(map[string]string{"create_order": "{{.customerName"})
+	if err == nil || !strings.Contains(err.Error(), "create_order") {
+		t.Fatalf("SetToolPreviewTemplates error = %v, want 指出 create_order 的模板有误", err)
+	}
+	// 出错时保留原有模板
+	if got := h.renderToolPreview("create_order", previewOrderArgs); !strings.HasPrefix(got, "将为张三创建") {
+		t.Errorf("出错后模板被修改: %q", got)
+	}
+}
+
+func TestLoadToolPreviewTemplates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantTools []string
+		wantError bool
+	}{
+		{"示例文件", filepath.Join("..", "tool_preview_templates.example.json"), []string{"create_order"}, false},
+		{"多个工具", write("ok.json", `{"create_order": "a", "cancel_order": "b"}`), []string{"cancel_order", "create_order"}, false},
+		{"格式错误", write("bad.json", `["create_order"]`), nil, true},
+		{"文件不存在", filepath.Join(dir, "missing.json"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates, err := LoadToolPreviewTemplates(tt.path)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("LoadToolPreviewTemplates error = %v, wantError %v", err, tt.wantError)
+			}
+			for _, tool := range tt.wantTools {
+				if _, ok := templates[tool]; !ok {
+					t.Errorf("缺少 %s 的模板: %v", tool, templates)
+				}
+			}
+			if len(templates) != len(tt.wantTools) {
+				t.Errorf("模板数 = %d, want %d", len(templates), len(tt.wantTools))
+			}
+		})
+	}
+}
+
+func TestHandleChatPreviewsOrderBeforeConfirmation(t *testing.T) {
+	fake := newFakeLLM(t, toolCallReply("好的，我来帮您下单。", "create_order", map[string]string{
+		"productName":     "山地自行车",
+		"quantity":        "2",
+		"customerName":    "张三",
+		"customerPhone":   "13800138000",
+		"shippingAddress": "北京市朝阳区建国路1号",
+	}))
+	cfg := testConfig(t)
+	cfg.OrderConfirmation = true
+	h := newTestHandler(t, cfg, fake)
+
+	resp := decodeChat(t, postChat(t, h, map[string]interface{}{"message": "买两辆山地自行车", "sessionId": "s1"}))
+	want := "将为张三创建 2 件山地自行车的订单，配送至北京市朝阳区建国路1号（联系电话 138****8000），确认吗？"
+	if !strings.Contains(resp.Reply, want) || resp.ToolCalled {
+		t.Errorf("回复 = %q, want 包含预览 %q 且不执行工具", resp.Reply, want)
+	}
+	if flow := h.sessions.OrderFlow("s1"); flow == nil || !flow.Confirming {
+		t.Error("应等待用户确认下单")
+	}
+}
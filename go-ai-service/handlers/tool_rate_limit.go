@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"go-ai-service/mcp"
+	"go-ai-service/tracing"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errToolRateLimited 修改类工具调用超过频率限制，工具没有执行
+var errToolRateLimited = errors.New("工具调用超过频率限制")
+
+// ToolRateLimiter 内存中的修改类工具调用频率限制（滑动窗口），键为用户 + 工具名称
+// 防止通过对话脚本批量创建/取消订单；限制只在当前进程内有效，重启后清零
+type ToolRateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	calls  map[string][]time.Time // 键 -> 窗口内的调用时间（升序）
+}
+
+// NewToolRateLimiter 创建工具调用频率限制，limit <= 0 或 window <= 0 时返回 nil（不限制）
+func NewToolRateLimiter(limit int, window time.Duration) *ToolRateLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &ToolRateLimiter{
+		limit:  limit,
+		window: window,
+		calls:  make(map[string][]time.Time),
+	}
+}
+
+// toolRateLimitKey 频率限制的键：优先使用用户 ID，其次会话 ID，都没有时使用客户端 IP
+func toolRateLimitKey(c *gin.Context, req *ChatRequest, toolName string) string {
+	switch {
+	case req.UserID != "":
+		return "user:" + req.UserID + "|" + toolName
+	case req.SessionID != "":
+		return "session:" + req.SessionID + "|" + toolName
+	default:
+		return "ip:" + c.ClientIP() + "|" + toolName
+	}
+}
+
+// Allow 判断本次调用是否允许，允许时记录一次调用
+func (l *ToolRateLimiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.evictExpiredLocked(now)
+
+	calls := l.calls[key]
+	if len(calls) >= l.limit {
+		return false
+	}
+	l.calls[key] = append(calls, now)
+	return true
+}
+
+// evictExpiredLocked 清理窗口外的调用记录，没有记录的键直接删除（调用方需持有锁）
+func (l *ToolRateLimiter) evictExpiredLocked(now time.Time) {
+	cutoff := now.Add(-l.window)
+	for key, calls := range l.calls {
+		i := 0
+		for i < len(calls) && !calls[i].After(cutoff) {
+			i++
+		}
+		if i == len(calls) {
+			delete(l.calls, key)
+		} else if i > 0 {
+			l.calls[key] = calls[i:]
+		}
+	}
+}
+
+// executeTool 检查频率限制后用请求对应的执行器执行工具，所有由对话触发的工具调用都经过这里；
+// 创建/取消订单（模拟执行除外）超过频率限制时不执行，返回 errToolRateLimited
+func (h *ChatHandler) executeTool(c *gin.Context, req *ChatRequest, span *tracing.Span, toolName, arguments string, onProgress mcp.ProgressFunc) (string, error) {
+	if mutatingTools[toolName] && !req.DryRun && !h.toolLimiter.Allow(toolRateLimitKey(c, req, toolName)) {
+		log.Printf("🚫 工具调用超过频率限制 [%s]: %s", req.UserID, toolName)
+		return "", errToolRateLimited
+	}
+	return h.executorFor(req).ExecuteTraced(span, toolName, arguments, onProgress)
+}
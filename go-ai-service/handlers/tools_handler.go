@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"go-ai-service/mcp"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ToolInfo 工具信息
+type ToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolsResponse 工具列表响应
+type ToolsResponse struct {
+	Tools []ToolInfo `json:"tools"`
+	Mode  string     `json:"mode"` // 工具安全模式：normal、readonly、disabled
+}
+
+// ToolModeRequest 切换工具安全模式的请求
+type ToolModeRequest struct {
+	Mode string `json:"mode" binding:"required"`
+}
+
+// HandleListTools 返回当前启用的工具及其参数定义
+func (h *ChatHandler) HandleListTools(c *gin.Context) {
+	tools := make([]ToolInfo, 0)
+	for _, tool := range mcp.GetTools() {
+		if tool.Function == nil || !h.isToolAllowed(tool.Function.Name) {
+			continue
+		}
+		tools = append(tools, ToolInfo{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+
+	c.JSON(http.StatusOK, ToolsResponse{Tools: tools, Mode: string(h.toolExecutor.Mode())})
+}
+
+// HandleGetToolMode 返回当前的工具安全模式
+func (h *ChatHandler) HandleGetToolMode(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"mode": h.toolExecutor.Mode()})
+}
+
+// HandleSetToolMode 切换工具安全模式（故障期间拦截下单/取消订单或所有工具，无需重启服务）
+func (h *ChatHandler) HandleSetToolMode(c *gin.Context) {
+	var req ToolModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if respondBindError(c, err) {
+			return
+		}
+		respondValidationError(c, []FieldError{{Field: "mode", Message: "不能为空"}})
+		return
+	}
+
+	mode, err := mcp.ParseToolMode(req.Mode)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	previous := h.toolExecutor.Mode()
+	h.toolExecutor.SetMode(mode)
+	log.Printf("🚧 工具安全模式已切换: %s -> %s", previous, mode)
+	c.JSON(http.StatusOK, gin.H{"mode": mode, "previous": previous})
+}
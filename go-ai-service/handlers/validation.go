@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 聊天请求字段限制
+const (
+	maxMessageRunes        = 4000
+	maxUserIDLength        = 64
+	maxHistoryEntries      = 100
+	maxHistoryContentRunes = 8000
+)
+
+// sessionIDRegex 会话 ID 格式：字母、数字及 _ - . :，最长 128 位（如 session-1729512345、UUID）
+var sessionIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+
+// allowedHistoryRoles 历史消息允许的角色
+var allowedHistoryRoles = map[string]bool{
+	"user":      true,
+	"assistant": true,
+}
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// bindErrorDetails 将 JSON 解析错误转换为字段错误（类型不匹配时指出具体字段）
+func bindErrorDetails(err error) []FieldError {
+	if errors.Is(err, io.EOF) {
+		return []FieldError{{Field: "body", Message: "请求体为空"}}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return []FieldError{{Field: "body", Message: "不是有效的 JSON（内容不完整）"}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return []FieldError{{Field: "body", Message: fmt.Sprintf("不是有效的 JSON（位置 %d）", syntaxErr.Offset)}}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		return []FieldError{{Field: field, Message: fmt.Sprintf("类型错误，应为 %s，实际为 %s", typeErr.Type.String(), typeErr.Value)}}
+	}
+
+	return nil
+}
+
+// validateChatRequest 校验聊天请求，返回所有不合法的字段；allowEmptyMessage 为 true 时允许空消息（初始化请求）
+func validateChatRequest(req *ChatRequest, allowEmptyMessage bool) []FieldError {
+	var problems []FieldError
+
+	if strings.TrimSpace(req.Message) == "" {
+		if !allowEmptyMessage {
+			problems = append(problems, FieldError{Field: "message", Message: "不能为空"})
+		}
+	} else if n := utf8.RuneCountInString(req.Message); n > maxMessageRunes {
+		problems = append(problems, FieldError{Field: "message", Message: fmt.Sprintf("长度 %d 超过上限 %d 字", n, maxMessageRunes)})
+	}
+
+	if len(req.UserID) > maxUserIDLength {
+		problems = append(problems, FieldError{Field: "userId", Message: fmt.Sprintf("长度超过上限 %d", maxUserIDLength)})
+	}
+
+	if req.SessionID != "" && !sessionIDRegex.MatchString(req.SessionID) {
+		problems = append(problems, FieldError{Field: "sessionId", Message: "格式无效，只能包含字母、数字及 _ - . :，最长 128 位"})
+	}
+
+	if len(req.History) > maxHistoryEntries {
+		problems = append(problems, FieldError{Field: "history", Message: fmt.Sprintf("条数 %d 超过上限 %d", len(req.History), maxHistoryEntries)})
+	}
+	for i, msg := range req.History {
+		if !allowedHistoryRoles[msg.Role] {
+			problems = append(problems, FieldError{
+				Field:   fmt.Sprintf("history[%d].role", i),
+				Message: fmt.Sprintf("无效的角色 %q，只能是 user 或 assistant", msg.Role),
+			})
+		}
+		if n := utf8.RuneCountInString(msg.Content); n > maxHistoryContentRunes {
+			problems = append(problems, FieldError{
+				Field:   fmt.Sprintf("history[%d].content", i),
+				Message: fmt.Sprintf("长度 %d 超过上限 %d 字", n, maxHistoryContentRunes),
+			})
+		}
+	}
+
+	return problems
+}
+
+// respondValidationError 返回包含所有字段错误的 400 响应
+func respondValidationError(c *gin.Context, problems []FieldError) {
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Field + ": " + problem.Message
+	}
+	c.JSON(http.StatusBadRequest, ErrorResponse{Error: APIError{
+		Code:    ErrCodeInvalidRequest,
+		Message: "请求参数无效: " + strings.Join(messages, "; "),
+		Details: problems,
+	}})
+}
@@ -3,30 +3,57 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"go-ai-service/mcp"
+	"html"
 	"log"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
 // ToolCallInfo 工具调用信息
 type ToolCallInfo struct {
-	ToolName  string
-	Arguments string // JSON 格式的参数
+	ToolName  string `json:"toolName"`
+	Arguments string `json:"arguments"` // JSON 格式的参数
 }
 
+// knownTools MCP Server 提供的工具名称
+var knownTools = map[string]bool{
+	"search_product": true,
+	"create_order":   true,
+	"query_order":    true,
+	"cancel_order":   true,
+	"list_orders":    true,
+	"track_shipment": true,
+}
+
+// isKnownTool 判断工具名称是否有效
+func isKnownTool(toolName string) bool {
+	return knownTools[toolName]
+}
+
+var (
+	// funcCallBlockRegex <func_call>...</func_call> 块（标签允许带属性）
+	funcCallBlockRegex = regexp.MustCompile(`<func_call(?:\s[^<>]*)?>([\s\S]*?)</func_call\s*>`)
+	// xmlOpenTagRegex 开始标签，分组 1 为标签名，分组 2 非空表示自闭合（如 <reason/>）
+	xmlOpenTagRegex = regexp.MustCompile(`<([A-Za-z_][\w.\-]*)(?:\s[^<>]*?)?(/?)>`)
+	// xmlCDATARegex CDATA 包裹的值
+	xmlCDATARegex = regexp.MustCompile(`^<!\[CDATA\[([\s\S]*?)\]\]>$`)
+	// toolNameRegex 有效的工具名称
+	toolNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+)
+
 // parseToolCallFromXML 从 LLM 响应中解析 XML 格式的工具调用
+// 容忍标签属性、CDATA、HTML 实体、值中的 "<" 和 JSON 形式的 arguments；无法识别时返回 false，不会 panic
 func (h *ChatHandler) parseToolCallFromXML(response string) (ToolCallInfo, bool) {
 	// 检查是否包含 <func_call> 标签
-	if !strings.Contains(response, "<func_call>") {
+	if !strings.Contains(response, "<func_call") {
 		return ToolCallInfo{}, false
 	}
 
 	log.Printf("🔍 检测到 <func_call> 标签，开始解析...")
 
 	// 提取 <func_call>...</func_call> 之间的内容
-	funcCallRegex := regexp.MustCompile(`<func_call>([\s\S]*?)</func_call>`)
-	matches := funcCallRegex.FindStringSubmatch(response)
+	matches := funcCallBlockRegex.FindStringSubmatch(response)
 	if len(matches) < 2 {
 		log.Printf("⚠️  无法提取 <func_call> 内容")
 		return ToolCallInfo{}, false
@@ -36,56 +63,28 @@ func (h *ChatHandler) parseToolCallFromXML(response string) (ToolCallInfo, bool)
 	log.Printf("📦 提取的内容: %s", funcCallContent)
 
 	// 提取 tool_name
-	toolNameRegex := regexp.MustCompile(`<tool_name>(.*?)</tool_name>`)
-	toolNameMatches := toolNameRegex.FindStringSubmatch(funcCallContent)
-	if len(toolNameMatches) < 2 {
+	rawToolName, ok := findXMLElement(funcCallContent, "tool_name")
+	if !ok {
 		log.Printf("⚠️  无法提取 tool_name")
 		return ToolCallInfo{}, false
 	}
-	toolName := strings.TrimSpace(toolNameMatches[1])
-
-	// 提取 <arguments>...</arguments> 之间的内容
-	argsRegex := regexp.MustCompile(`<arguments>([\s\S]*?)</arguments>`)
-	argsMatches := argsRegex.FindStringSubmatch(funcCallContent)
-	if len(argsMatches) < 2 {
-		log.Printf("⚠️  无法提取 arguments")
+	toolName := xmlText(rawToolName)
+	if !toolNameRegex.MatchString(toolName) {
+		log.Printf("⚠️  无效的 tool_name: %q", toolName)
 		return ToolCallInfo{}, false
 	}
-	argsContent := argsMatches[1]
 
-	// 解析 arguments 中的 XML 标签，转换为 JSON
-	args := make(map[string]interface{})
-
-	// 通用 XML 标签提取器（Go 不支持反向引用，需要手动匹配）
-	// 匹配格式: <key>value</key>
-	tagRegex := regexp.MustCompile(`<(\w+)>([^<]*)</(\w+)>`)
-	tagMatches := tagRegex.FindAllStringSubmatch(argsContent, -1)
-
-	for _, match := range tagMatches {
-		if len(match) >= 4 {
-			openTag := match[1]
-			value := strings.TrimSpace(match[2])
-			closeTag := match[3]
-
-			// 确保开闭标签一致
-			if openTag != closeTag {
-				continue
-			}
+	// 提取 <arguments>...</arguments> 之间的内容（缺少时按无参数处理，由必需参数检查询问用户）
+	argsContent, ok := findXMLElement(funcCallContent, "arguments")
+	if !ok {
+		log.Printf("⚠️  无法提取 arguments，按无参数处理")
+	}
 
-			// 特殊处理：电话号码和订单号应该是字符串，不要转换为数字
-			if openTag == "customerPhone" || openTag == "orderId" {
-				args[openTag] = value
-				continue
-			}
+	// 解析 arguments 中的 XML 标签，转换为 JSON
+	args := parseXMLArguments(argsContent, mcp.ArrayParameters(toolName))
 
-			// 尝试转换为数字
-			if intValue, err := strconv.Atoi(value); err == nil {
-				args[openTag] = intValue
-			} else {
-				args[openTag] = value
-			}
-		}
-	}
+	// 按工具定义转换参数类型，规范化电话号码、订单号
+	normalizeToolArguments(toolName, args)
 
 	// 转换为 JSON 字符串
 	argsJSON, err := json.Marshal(args)
@@ -102,19 +101,258 @@ func (h *ChatHandler) parseToolCallFromXML(response string) (ToolCallInfo, bool)
 	}, true
 }
 
+// findXMLElement 查找第一个名为 name 的元素并返回其原始内容（自闭合元素内容为空），
+// 开始标签允许带属性；没有找到或缺少结束标签时返回 false
+func findXMLElement(content, name string) (string, bool) {
+	rest := content
+	for {
+		loc := xmlOpenTagRegex.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			return "", false
+		}
+		tag := rest[loc[2]:loc[3]]
+		selfClosing := loc[5] > loc[4]
+		rest = rest[loc[1]:]
+		if tag != name {
+			continue
+		}
+		if selfClosing {
+			return "", true
+		}
+		start, _ := findCloseTag(rest, name)
+		if start < 0 {
+			return "", false
+		}
+		return rest[:start], true
+	}
+}
+
+// findCloseTag 查找 name 的结束标签（允许 "</name >" 这样带空白的写法），返回标签的起止位置，没有时返回 -1
+func findCloseTag(content, name string) (int, int) {
+	prefix := "</" + name
+	for offset := 0; offset < len(content); {
+		i := strings.Index(content[offset:], prefix)
+		if i < 0 {
+			return -1, -1
+		}
+		start := offset + i
+		end := start + len(prefix)
+		for end < len(content) && isXMLSpace(content[end]) {
+			end++
+		}
+		if end < len(content) && content[end] == '>' {
+			return start, end + 1
+		}
+		offset = start + len(prefix)
+	}
+	return -1, -1
+}
+
+// isXMLSpace 判断字节是否为 XML 空白字符
+func isXMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// parseXMLArguments 将 <key>value</key> 形式的参数转换为 map（值均为字符串，由 normalizeToolArguments 按工具定义转换类型）：
+// 同名参数只取第一个，没有结束标签的参数被跳过，整段内容为 JSON 对象时直接按 JSON 解析。
+// listParams 中的数组参数收集所有同名标签的值，值中嵌套的子元素（如 <status><item>PENDING</item></status>）逐个展开
+func parseXMLArguments(content string, listParams map[string]bool) map[string]interface{} {
+	args := make(map[string]interface{})
+
+	if trimmed := strings.TrimSpace(content); strings.HasPrefix(trimmed, "{") {
+		var jsonArgs map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &jsonArgs); err == nil && jsonArgs != nil {
+			return jsonArgs
+		}
+	}
+
+	// Go 正则不支持反向引用，逐个开始标签查找对应的结束标签
+	rest := content
+	for {
+		loc := xmlOpenTagRegex.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			return args
+		}
+		name := rest[loc[2]:loc[3]]
+		selfClosing := loc[5] > loc[4]
+		rest = rest[loc[1]:]
+		if selfClosing {
+			continue
+		}
+
+		start, end := findCloseTag(rest, name)
+		if start < 0 {
+			continue
+		}
+		if listParams[name] {
+			list, _ := args[name].([]interface{})
+			args[name] = append(list, xmlListItems(rest[:start])...)
+		} else if _, exists := args[name]; !exists {
+			args[name] = xmlText(rest[:start])
+		}
+		rest = rest[end:]
+	}
+}
+
+// xmlListItems 取出数组参数的值：包含子元素时返回各子元素的文本，否则返回元素自身的文本
+func xmlListItems(raw string) []interface{} {
+	if !xmlOpenTagRegex.MatchString(raw) || xmlCDATARegex.MatchString(strings.TrimSpace(raw)) {
+		return []interface{}{xmlText(raw)}
+	}
+
+	var items []interface{}
+	rest := raw
+	for {
+		loc := xmlOpenTagRegex.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			return items
+		}
+		name := rest[loc[2]:loc[3]]
+		selfClosing := loc[5] > loc[4]
+		rest = rest[loc[1]:]
+		if selfClosing {
+			continue
+		}
+		start, end := findCloseTag(rest, name)
+		if start < 0 {
+			continue
+		}
+		items = append(items, xmlText(rest[:start]))
+		rest = rest[end:]
+	}
+}
+
+// xmlText 取出元素的文本值：去掉 CDATA 包裹，还原 HTML 实体（如 &amp;），去除首尾空白
+func xmlText(raw string) string {
+	value := strings.TrimSpace(raw)
+	if match := xmlCDATARegex.FindStringSubmatch(value); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(html.UnescapeString(value))
+}
+
+// jsonToolCallRegex 匹配 ```json ... ``` 代码块
+var jsonToolCallRegex = regexp.MustCompile("```(?:json)?\\s*(\\{[\\s\\S]*?\\})\\s*```")
+
+// jsonToolCall JSON 格式的工具调用（部分 Qwen 版本的输出格式）
+type jsonToolCall struct {
+	Tool      string          `json:"tool"`
+	ToolName  string          `json:"tool_name"`
+	Args      json.RawMessage `json:"args"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// parseToolCallFromJSON 从 LLM 响应中解析 JSON 代码块格式的工具调用
+func (h *ChatHandler) parseToolCallFromJSON(response string) (ToolCallInfo, bool) {
+	matches := jsonToolCallRegex.FindAllStringSubmatch(response, -1)
+	for _, match := range matches {
+		var call jsonToolCall
+		if err := json.Unmarshal([]byte(match[1]), &call); err != nil {
+			continue
+		}
+
+		toolName := strings.TrimSpace(call.Tool)
+		if toolName == "" {
+			toolName = strings.TrimSpace(call.ToolName)
+		}
+		if toolName == "" {
+			continue
+		}
+
+		rawArgs := call.Args
+		if len(rawArgs) == 0 {
+			rawArgs = call.Arguments
+		}
+
+		// 参数可能是对象，也可能是 JSON 字符串
+		var args map[string]interface{}
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			var argsStr string
+			if err := json.Unmarshal(rawArgs, &argsStr); err != nil || json.Unmarshal([]byte(argsStr), &args) != nil {
+				log.Printf("⚠️  JSON 工具调用参数无法解析: %s", string(rawArgs))
+				continue
+			}
+		}
+		if args == nil {
+			args = make(map[string]interface{})
+		}
+		normalizeToolArguments(toolName, args)
+
+		argsJSON, err := json.Marshal(args)
+		if err != nil {
+			log.Printf("❌ 参数序列化失败: %v", err)
+			continue
+		}
+
+		log.Printf("✅ JSON 格式解析成功 - 工具: %s, 参数: %s", toolName, string(argsJSON))
+
+		return ToolCallInfo{
+			ToolName:  toolName,
+			Arguments: string(argsJSON),
+		}, true
+	}
+
+	return ToolCallInfo{}, false
+}
+
+// parseToolCall 解析工具调用，优先 XML 格式，其次 JSON 代码块格式
+func (h *ChatHandler) parseToolCall(response string) (ToolCallInfo, bool) {
+	if toolCall, found := h.parseToolCallFromXML(response); found {
+		return toolCall, true
+	}
+	return h.parseToolCallFromJSON(response)
+}
+
+// isTruncatedToolCall 判断响应中的工具调用是否被截断：有 <func_call> 但缺少 </func_call>，
+// 或因长度限制（finish_reason 为 length）停在了开始标签中途
+func isTruncatedToolCall(response, finishReason string) bool {
+	if open := strings.LastIndex(response, "<func_call>"); open >= 0 && !strings.Contains(response[open:], "</func_call>") {
+		return true
+	}
+	return finishReason == "length" && partialTagSuffix(response, "<func_call>") > 0
+}
+
+// partialTagSuffix 返回文本末尾残缺标签（tag 的前缀，至少 2 个字符）的长度，没有时返回 0
+func partialTagSuffix(text, tag string) int {
+	for n := len(tag) - 1; n >= 2; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// stripToolCallMarkup 移除响应中的工具调用标记（XML 标签和包含工具调用的 JSON 代码块）
+func stripToolCallMarkup(response string) string {
+	cleanResponse := funcCallBlockRegex.ReplaceAllString(response, "")
+
+	cleanResponse = jsonToolCallRegex.ReplaceAllStringFunc(cleanResponse, func(block string) string {
+		match := jsonToolCallRegex.FindStringSubmatch(block)
+		var call jsonToolCall
+		if err := json.Unmarshal([]byte(match[1]), &call); err == nil && (call.Tool != "" || call.ToolName != "") {
+			return ""
+		}
+		return block
+	})
+
+	return strings.TrimSpace(cleanResponse)
+}
+
 // buildFinalReply 构建最终回复（移除 XML 标签，添加工具执行结果）
 func (h *ChatHandler) buildFinalReply(llmResponse string, toolResult string) string {
-	// 移除 <func_call>...</func_call> 标签
-	funcCallRegex := regexp.MustCompile(`<func_call>[\s\S]*?</func_call>`)
-	cleanResponse := funcCallRegex.ReplaceAllString(llmResponse, "")
+	// 移除工具调用标记并清理多余的空行
+	cleanResponse := stripToolCallMarkup(llmResponse)
 
-	// 清理多余的空行
-	cleanResponse = strings.TrimSpace(cleanResponse)
-
-	// 如果 LLM 响应为空，只返回工具结果
+	// 如果 LLM 响应为空，只返回工具结果（两者都为空时返回默认提示）
 	if cleanResponse == "" {
+		if strings.TrimSpace(toolResult) == "" {
+			return toolDoneReply
+		}
 		return toolResult
 	}
+	if strings.TrimSpace(toolResult) == "" {
+		return cleanResponse
+	}
 
 	// 组合 LLM 响应和工具结果
 	return fmt.Sprintf("%s\n\n%s", cleanResponse, toolResult)
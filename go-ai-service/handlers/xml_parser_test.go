@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseToolCall(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		wantFound bool
+		wantTool  string
+		wantArgs  map[string]interface{}
+	}{
+		{
+			name:      "标准格式",
+			response:  "好的，我来帮您查询。\n<func_call>\n<tool_name>query_order</tool_name>\n<arguments>\n<orderNumber>ORD-1234567890</orderNumber>\n</arguments>\n</func_call>",
+			wantFound: true,
+			wantTool:  "query_order",
+			wantArgs:  map[string]interface{}{"orderNumber": "ORD-1234567890"},
+		},
+		{
+			name:      "标签属性、CDATA 和 HTML 实体",
+			response:  `<func_call id="1"><tool_name type="string">search_product</tool_name><arguments><keyword><![CDATA[山地车 <26寸>]]></keyword></arguments></func_call>`,
+			wantFound: true,
+			wantTool:  "search_product",
+			wantArgs:  map[string]interface{}{"keyword": "山地车 <26寸>"},
+		},
+		{
+			name:      "值中包含 <",
+			response:  "<func_call><tool_name>search_product</tool_name><arguments><keyword>价格 < 1000 的山地车</keyword></arguments></func_call>",
+			wantFound: true,
+			wantTool:  "search_product",
+			wantArgs:  map[string]interface{}{"keyword": "价格 < 1000 的山地车"},
+		},
+		{
+			name:      "缺少 arguments 按无参数处理",
+			response:  "<func_call><tool_name>list_orders</tool_name></func_call>",
+			wantFound: true,
+			wantTool:  "list_orders",
+			wantArgs:  map[string]interface{}{},
+		},
+		{
+			name:      "JSON 代码块格式",
+			response:  "```json\n{\"tool\": \"query_order\", \"args\": {\"orderNumber\": \"ORD-1\"}}\n```",
+			wantFound: true,
+			wantTool:  "query_order",
+			wantArgs:  map[string]interface{}{"orderNumber": "ORD-1"},
+		},
+		{
+			name:      "JSON 字符串形式的参数",
+			response:  "```json\n{\"tool_name\": \"query_order\", \"arguments\": \"{\\\"orderNumber\\\": \\\"ORD-1\\\"}\"}\n```",
+			wantFound: true,
+			wantTool:  "query_order",
+			wantArgs:  map[string]interface{}{"orderNumber": "ORD-1"},
+		},
+		{"没有工具调用", "您好，有什么可以帮您？", false, "", nil},
+		{"缺少 tool_name", "<func_call><arguments><keyword>山地车</keyword></arguments></func_call>", false, "", nil},
+		{"无效的 tool_name", "<func_call><tool_name>rm -rf /</tool_name></func_call>", false, "", nil},
+		{"被截断", "<func_call><tool_name>query_order</tool_name><arguments><orderNumber>ORD-1", false, "", nil},
+		{"JSON 代码块没有工具名", "```json\n{\"orderNumber\": \"ORD-1\"}\n```", false, "", nil},
+	}
+
+	h := &ChatHandler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := h.parseToolCall(tt.response)
+			if found != tt.wantFound {
+				t.Fatalf("parseToolCall() found = %v, want %v (%+v)", found, tt.wantFound, got)
+			}
+			if !found {
+				return
+			}
+			if got.ToolName != tt.wantTool {
+				t.Errorf("ToolName = %q, want %q", got.ToolName, tt.wantTool)
+			}
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(got.Arguments), &args); err != nil {
+				t.Fatalf("Arguments 不是 JSON 对象: %q", got.Arguments)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Arguments = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func FuzzParseToolCall(f *testing.F) {
+	seeds := []string{
+		"好的，我来帮您查询。\n<func_call>\n<tool_name>query_order</tool_name>\n<arguments>\n<orderNumber>ORD-1234567890</orderNumber>\n</arguments>\n</func_call>",
+		"<func_call>\n<tool_name>create_order</tool_name>\n<arguments>\n<productName>山地自行车</productName>\n<quantity>2</quantity>\n<customerName>张三</customerName>\n<customerPhone>138 0013 8000</customerPhone>\n<shippingAddress>北京市朝阳区建国路1号</shippingAddress>\n</arguments>\n</func_call>",
+		"<func_call><tool_name>list_orders</tool_name><arguments><status>PENDING</status><status>SHIPPED</status><page>2</page></arguments></func_call>",
+		`<func_call id="1"><tool_name type="string">search_product</tool_name><arguments><keyword><![CDATA[<26寸>]]></keyword><reason/></arguments></func_call>`,
+		"<func_call><tool_name>search_product</tool_name><arguments>{\"keyword\": \"山地车\"}</arguments></func_call>",
+		"<func_call><tool_name>search_product</tool_name><arguments><keyword>a &lt; b &amp; c</keyword></arguments></func_call>",
+		"<func_call><tool_name>query_order</tool_name><arguments><orderNumber>ORD-1",
+		"<func_call><tool_name></tool_name></func_call></func_call>",
+		"<func_call><tool_name><tool_name>x</tool_name></tool_name><arguments><a><b>1</b></a></arguments></func_call>",
+		"<think>先查询订单</think><func_call",
+		"```json\n{\"tool\": \"query_order\", \"args\": {\"orderNumber\": \"ORD-1\"}}\n```",
+		"```json\n{\"tool_name\": \"query_order\", \"arguments\": \"{\\\"orderNumber\\\": 1}\"}\n```",
+		"```\n{\"tool\": \"x\", \"args\": [1, 2]}\n```",
+		"",
+		"<",
+		"\xff<func_call>\xfe</func_call>",
+	}
+	for _, seed := range seeds {
+		f.Add(seed, "stop")
+	}
+	f.Add("<func_call", "length")
+
+	h := &ChatHandler{}
+	f.Fuzz(func(t *testing.T, response, finishReason string) {
+		toolCall, found := h.parseToolCall(response)
+		if found {
+			if toolCall.ToolName == "" {
+				t.Errorf("解析成功但工具名称为空: %q", response)
+			}
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(toolCall.Arguments), &args); err != nil {
+				t.Errorf("Arguments 不是 JSON 对象: %q (输入 %q)", toolCall.Arguments, response)
+			}
+		}
+
+		// 以下函数同样处理模型的原始输出，不能 panic
+		stripped := stripToolCallMarkup(response)
+		if utf8.ValidString(response) && !utf8.ValidString(stripped) {
+			t.Errorf("stripToolCallMarkup 产生了无效的 UTF-8: %q", stripped)
+		}
+		isTruncatedToolCall(response, finishReason)
+		discardBrokenToolCall(response)
+		discardTruncatedToolCall(response)
+		visibleStreamText(response)
+	})
+}
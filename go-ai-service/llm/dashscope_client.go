@@ -8,18 +8,45 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
+)
+
+const (
+	chatModel   = "qwen-max"
+	visionModel = "qwen-vl-max" // 支持图片输入的多模态模型
+
+	// DefaultBaseURL DashScope 公网地址
+	DefaultBaseURL = "https://dashscope.aliyuncs.com"
+
+	textGenerationPath       = "/api/v1/services/aigc/text-generation/generation"
+	multimodalGenerationPath = "/api/v1/services/aigc/multimodal-generation/generation"
+	// EmbeddingPath 文本向量接口路径
+	EmbeddingPath = "/api/v1/services/embeddings/text-embedding/text-embedding"
+	// EmbeddingModel 文本向量模型（与知识库检索使用的模型一致）
+	EmbeddingModel = "text-embedding-v2"
 )
 
 // DashScopeClient 代表 DashScope/Qwen API 客户端
 type DashScopeClient struct {
-	apiKey string
-	client *http.Client
+	apiKey  string
+	baseURL string
+	client  *http.Client
+
+	embeddingClient *http.Client // 嵌入请求使用的客户端（与聊天请求共享连接池，超时单独配置）
+
+	coalesce bool          // 是否合并相同的并发请求
+	inflight inflightGroup // 正在进行中的请求
+
+	stops []string // 停止序列（见 SetStopSequences）
+
+	inputShapes map[string]InputShape // 各模型的 input 格式（见 SetModelInputShapes）
 }
 
 // 请求和响应结构
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"-"` // 可选的图片 URL 或 data URI（存在时使用多模态模型）
 }
 
 type Tool struct {
@@ -50,18 +77,15 @@ type ChatRequest struct {
 	Temperature float64      `json:"temperature,omitempty"`
 }
 
+// ChatResponse 文本生成接口响应
+// 请求始终使用 result_format=message，内容、结束原因和工具调用都从 Output.Choices 读取；
+// Output.Text / Output.FinishReason 为旧版 text 格式的兼容字段，仅在 choices 为空时作为回退
 type ChatResponse struct {
 	RequestID string `json:"request_id"`
 	Output    struct {
-		Text         string `json:"text"`           // 🔧 直接的文本回复（qwen-max 使用这个格式）
-		FinishReason string `json:"finish_reason"`
-		Choices      []struct {                     // 保留以防某些模式使用
-			FinishReason string `json:"finish_reason"`
-			Message      struct {
-				Content   string     `json:"content"`
-				ToolCalls []ToolCall `json:"tool_calls"`
-			} `json:"message"`
-		} `json:"choices"`
+		Choices      []Choice `json:"choices"`
+		Text         string   `json:"text"`          // 旧版 text 格式（兼容回退）
+		FinishReason string   `json:"finish_reason"` // 旧版 text 格式（兼容回退）
 	} `json:"output"`
 	Usage struct {
 		InputTokens  int `json:"input_tokens"`
@@ -71,6 +95,21 @@ type ChatResponse struct {
 	Message string `json:"message"`
 }
 
+// Choice message 格式中的一个候选回复
+type Choice struct {
+	FinishReason string        `json:"finish_reason"`
+	Message      ChoiceMessage `json:"message"`
+}
+
+// ChoiceMessage 候选回复的消息内容
+// 推理模型（如 QwQ、开启思考的 Qwen3）会在 ReasoningContent 中返回思考过程，它不属于回复内容，不能展示给用户
+type ChoiceMessage struct {
+	Role             string     `json:"role"`
+	Content          string     `json:"content"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls"`
+}
+
 type EmbeddingRequest struct {
 	Model  string   `json:"model"`
 	Input  []string `json:"input"`
@@ -89,35 +128,142 @@ type EmbeddingResponse struct {
 	Message string `json:"message"`
 }
 
-// NewDashScopeClient 创建新的 DashScope 客户端
-func NewDashScopeClient(apiKey string) *DashScopeClient {
+// NewDashScopeClient 创建新的 DashScope 客户端，httpClient 为空时使用默认客户端
+func NewDashScopeClient(apiKey string, httpClient *http.Client) *DashScopeClient {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &DashScopeClient{
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiKey:  apiKey,
+		baseURL: DefaultBaseURL,
+		client:  httpClient,
+
+		embeddingClient: httpClient,
 	}
 }
 
+// SetEmbeddingTimeout 设置嵌入请求的超时时间（与聊天请求的超时相互独立），timeout <= 0 时沿用共享客户端的超时
+func (c *DashScopeClient) SetEmbeddingTimeout(timeout time.Duration) {
+	c.embeddingClient = WithTimeout(c.client, timeout)
+}
+
+// WithTimeout 返回与 client 共享连接池、仅超时时间不同的 HTTP 客户端，timeout <= 0 时直接返回 client
+func WithTimeout(client *http.Client, timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		return client
+	}
+	scoped := *client
+	scoped.Timeout = timeout
+	return &scoped
+}
+
+// SetBaseURL 设置 DashScope 服务地址（用于代理/网关或本地 mock）
+func (c *DashScopeClient) SetBaseURL(baseURL string) {
+	if baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/"); baseURL != "" {
+		c.baseURL = baseURL
+	}
+}
+
+// Models 返回默认聊天模型和多模态模型名称
+func (c *DashScopeClient) Models() (string, string) {
+	return chatModel, visionModel
+}
+
+// SetRequestCoalescing 设置是否合并完全相同的并发请求（模型、消息、工具均一致时共享一次上游调用）
+func (c *DashScopeClient) SetRequestCoalescing(enabled bool) {
+	c.coalesce = enabled
+}
+
 // Chat 发送聊天请求并获取响应
 func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse, error) {
-	log.Printf("📨 调用 Qwen Chat API, 消息数: %d, 工具数: %d", len(messages), len(tools))
+	return c.ChatWithOptions(chatModel, DefaultParams, messages, tools)
+}
+
+// ChatWithModel 使用指定模型发送聊天请求
+func (c *DashScopeClient) ChatWithModel(model string, messages []Message, tools []Tool) (*ChatResponse, error) {
+	return c.ChatWithOptions(model, DefaultParams, messages, tools)
+}
+
+// ChatWithParams 使用指定生成参数发送聊天请求
+func (c *DashScopeClient) ChatWithParams(params GenerationParams, messages []Message, tools []Tool) (*ChatResponse, error) {
+	return c.ChatWithOptions(chatModel, params, messages, tools)
+}
+
+// ChatWithOptions 使用指定模型和生成参数发送聊天请求（model 为空时使用默认模型，包含图片时始终使用多模态模型）
+func (c *DashScopeClient) ChatWithOptions(model string, params GenerationParams, messages []Message, tools []Tool) (*ChatResponse, error) {
+	if model == "" {
+		model = chatModel
+	}
+	if hasImages(messages) {
+		model = visionModel
+	}
+
+	if !c.coalesce {
+		return c.chat(model, params, messages, tools)
+	}
+
+	key, err := chatRequestKey(model, params, messages, tools)
+	if err != nil {
+		log.Printf("⚠️  计算请求标识失败，不合并请求: %v", err)
+		return c.chat(model, params, messages, tools)
+	}
+
+	resp, err, shared := c.inflight.Do(key, func() (*ChatResponse, error) {
+		return c.chat(model, params, messages, tools)
+	})
+	if shared {
+		log.Printf("🔗 合并相同的并发请求 (key: %s)", key[:12])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 返回副本，避免调用方之间相互影响
+	return resp.clone(), nil
+}
+
+// clone 深拷贝响应，候选回复与工具调用不与原响应共享底层数组
+func (r *ChatResponse) clone() *ChatResponse {
+	copied := *r
+	copied.Output.Choices = make([]Choice, len(r.Output.Choices))
+	for i, choice := range r.Output.Choices {
+		choice.Message.ToolCalls = append([]ToolCall(nil), choice.Message.ToolCalls...)
+		copied.Output.Choices[i] = choice
+	}
+	return &copied
+}
+
+// chat 实际发送聊天请求
+func (c *DashScopeClient) chat(model string, params GenerationParams, messages []Message, tools []Tool) (*ChatResponse, error) {
+	log.Printf("📨 调用 Qwen Chat API (%s), 消息数: %d, 工具数: %d", model, len(messages), len(tools))
+	log.Printf("🎛️  生成参数配置: %s (temperature=%.2f, top_p=%.2f)", params.Name, params.Temperature, params.TopP)
+
+	// 包含图片时走多模态接口
+	if hasImages(messages) {
+		return c.chatMultimodal(params, messages)
+	}
 	
-	// DashScope 格式：需要将请求包装在 input 对象中
+	// DashScope 格式：需要将请求包装在 input 中，input 的格式由模型能力表决定
+	// 消息格式的模型始终使用 message 格式返回，内容与工具调用统一从 choices 读取；
+	// 提示词格式的模型只支持旧版 text 格式返回，由 Output.Text 回退读取
+	shape := c.inputShape(model)
+	parameters := params.toPayload()
+	if shape != InputPrompt {
+		parameters["result_format"] = "message"
+	}
+	c.applyStopSequences(parameters)
 	payload := map[string]interface{}{
-		"model": "qwen-max",
-		"input": map[string]interface{}{
-			"messages": messages,
-		},
-		"parameters": map[string]interface{}{
-			"temperature": 0.1,  // 降低随机性，更倾向于调用工具
-			"top_p":       0.8,
-		},
+		"model":      model,
+		"input":      buildInput(shape, messages),
+		"parameters": parameters,
 	}
-	
-	// ✅ 如果有工具，添加 tools 并设置 result_format（注意：result_format 必须在顶层！）
-	if len(tools) > 0 {
-		payload["tools"] = tools
-		payload["result_format"] = "message"  // ✅ 顶层参数，不在 parameters 里
-		log.Printf("🔧 启用工具调用模式, result_format=message")
+
+	// 如果有工具，工具定义放在 parameters 中（提示词格式的模型不支持工具调用）
+	if len(tools) > 0 && shape == InputPrompt {
+		log.Printf("⚠️  模型 %s 使用提示词格式，不支持工具调用，忽略 %d 个工具定义", model, len(tools))
+	} else if len(tools) > 0 {
+		parameters["tools"] = tools
+		log.Printf("🔧 启用工具调用模式, 工具数: %d", len(tools))
 	}
 
 	reqBody, err := json.Marshal(payload)
@@ -128,9 +274,7 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 	// 🔍 打印请求 payload 用于调试
 	log.Printf("🔍 请求 Payload: %s", string(reqBody))
 
-	httpReq, err := http.NewRequest("POST",
-		"https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation",
-		bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequest("POST", c.baseURL+textGenerationPath, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
@@ -146,7 +290,7 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %v", err)
+		return nil, fmt.Errorf("读取响应失败: %w", interruptedError(err))
 	}
 
 	// 🔍 打印原始响应用于调试
@@ -156,7 +300,7 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("❌ API 返回非 200 状态码: %d", resp.StatusCode)
 		log.Printf("❌ 响应体: %s", string(body))
-		return nil, fmt.Errorf("API 错误 (状态码 %d): %s", resp.StatusCode, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
 	}
 
 	var chatResp ChatResponse
@@ -164,7 +308,7 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 	if err != nil {
 		log.Printf("❌ 解析 JSON 失败: %v", err)
 		log.Printf("❌ 响应体: %s", string(body))
-		return nil, fmt.Errorf("解析响应失败: %v", err)
+		return nil, fmt.Errorf("解析响应失败: %w", interruptedError(err))
 	}
 
 	// ✅ 添加详细日志
@@ -172,12 +316,13 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 	
 	// 🔍 添加调试日志 - 检查响应结构
 	log.Printf("🔍🔍🔍 调试: Choices 数量 = %d", len(chatResp.Output.Choices))
-	log.Printf("🔍🔍🔍 调试: Text = '%s'", chatResp.Output.Text)
-	
-	if len(chatResp.Output.Choices) > 0 {
-		choice := chatResp.Output.Choices[0]
+
+	if choice := firstChoice(&chatResp); choice != nil {
 		log.Printf("🔍 finish_reason: %s", choice.FinishReason)
 		log.Printf("🔍 message.content: %s", choice.Message.Content)
+		if choice.Message.ReasoningContent != "" {
+			log.Printf("🔍 reasoning_content: %d 字（不返回给用户）", len([]rune(choice.Message.ReasoningContent)))
+		}
 		log.Printf("🔍 tool_calls 数量: %d", len(choice.Message.ToolCalls))
 		if len(choice.Message.ToolCalls) > 0 {
 			for i, tc := range choice.Message.ToolCalls {
@@ -188,12 +333,146 @@ func (c *DashScopeClient) Chat(messages []Message, tools []Tool) (*ChatResponse,
 
 	if chatResp.Code != "" && chatResp.Code != "Success" {
 		log.Printf("❌ API 返回错误代码: %s - %s", chatResp.Code, chatResp.Message)
-		return nil, fmt.Errorf("API 错误: %s - %s", chatResp.Code, chatResp.Message)
+		return nil, &APIError{Code: chatResp.Code, Message: chatResp.Message}
+	}
+	if err := checkFinished(&chatResp); err != nil {
+		log.Printf("❌ 回复没有正常结束: %v", err)
+		return nil, err
 	}
 
+	c.restoreStopSequences(&chatResp)
 	return &chatResp, nil
 }
 
+// hasImages 判断消息中是否包含图片
+func hasImages(messages []Message) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// multimodalContent 多模态消息内容片段（图片或文本二选一）
+type multimodalContent struct {
+	Image string `json:"image,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+// multimodalMessage 多模态消息
+type multimodalMessage struct {
+	Role    string              `json:"role"`
+	Content []multimodalContent `json:"content"`
+}
+
+// multimodalResponse 多模态接口响应（content 为片段数组）
+type multimodalResponse struct {
+	RequestID string `json:"request_id"`
+	Output    struct {
+		Choices []struct {
+			FinishReason string `json:"finish_reason"`
+			Message      struct {
+				Content []multimodalContent `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// chatMultimodal 调用 Qwen-VL 多模态接口，并将结果转换为 ChatResponse
+func (c *DashScopeClient) chatMultimodal(params GenerationParams, messages []Message) (*ChatResponse, error) {
+	log.Printf("🖼️  检测到图片输入，使用多模态模型 %s", visionModel)
+
+	mmMessages := make([]multimodalMessage, 0, len(messages))
+	for _, msg := range messages {
+		content := make([]multimodalContent, 0, len(msg.Images)+1)
+		for _, image := range msg.Images {
+			content = append(content, multimodalContent{Image: image})
+		}
+		if msg.Content != "" {
+			content = append(content, multimodalContent{Text: msg.Content})
+		}
+		mmMessages = append(mmMessages, multimodalMessage{Role: msg.Role, Content: content})
+	}
+
+	parameters := params.toPayload()
+	c.applyStopSequences(parameters)
+	payload := map[string]interface{}{
+		"model": visionModel,
+		"input": map[string]interface{}{
+			"messages": mmMessages,
+		},
+		"parameters": parameters,
+	}
+
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("编码请求失败: %v", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", c.baseURL+multimodalGenerationPath, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", interruptedError(err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ 多模态 API 返回非 200 状态码: %d", resp.StatusCode)
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+
+	var mmResp multimodalResponse
+	if err := json.Unmarshal(body, &mmResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", interruptedError(err))
+	}
+
+	if mmResp.Code != "" && mmResp.Code != "Success" {
+		return nil, &APIError{Code: mmResp.Code, Message: mmResp.Message}
+	}
+
+	// 转换为 message 格式的 ChatResponse（多模态内容片段拼接为文本），调用方无需区分
+	chatResp := &ChatResponse{RequestID: mmResp.RequestID}
+	chatResp.Usage = mmResp.Usage
+	for _, choice := range mmResp.Output.Choices {
+		var text strings.Builder
+		for _, part := range choice.Message.Content {
+			text.WriteString(part.Text)
+		}
+		chatResp.Output.Choices = append(chatResp.Output.Choices, Choice{
+			FinishReason: choice.FinishReason,
+			Message:      ChoiceMessage{Role: "assistant", Content: text.String()},
+		})
+	}
+
+	if err := checkFinished(chatResp); err != nil {
+		log.Printf("❌ 回复没有正常结束: %v", err)
+		return nil, err
+	}
+
+	log.Printf("✅ Qwen-VL API 响应成功, RequestID: %s", chatResp.RequestID)
+	c.restoreStopSequences(chatResp)
+	return chatResp, nil
+}
+
 // Embedding 生成文本的嵌入向量
 func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
@@ -202,7 +481,7 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 
 	// DashScope 标准 Embedding API 格式
 	payload := map[string]interface{}{
-		"model": "text-embedding-v2",
+		"model": EmbeddingModel,
 		"input": map[string]interface{}{
 			"texts": texts,
 		},
@@ -213,9 +492,7 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 		return nil, fmt.Errorf("编码请求失败: %v", err)
 	}
 
-	httpReq, err := http.NewRequest("POST",
-		"https://dashscope.aliyuncs.com/api/v1/services/embeddings/text-embedding/text-embedding",
-		bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequest("POST", c.baseURL+EmbeddingPath, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
@@ -223,7 +500,7 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := c.embeddingClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
@@ -235,7 +512,7 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API 错误 (状态码 %d): %s", resp.StatusCode, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
 	}
 
 	var embeddingResp EmbeddingResponse
@@ -245,7 +522,7 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 	}
 
 	if embeddingResp.Code != "" && embeddingResp.Code != "Success" {
-		return nil, fmt.Errorf("API 错误: %s - %s", embeddingResp.Code, embeddingResp.Message)
+		return nil, &APIError{Code: embeddingResp.Code, Message: embeddingResp.Message}
 	}
 
 	// 提取嵌入向量，保持原始顺序
@@ -259,68 +536,79 @@ func (c *DashScopeClient) Embedding(texts []string) ([][]float32, error) {
 	return embeddings, nil
 }
 
-// GetTextResponse 从聊天响应中提取文本内容
+// ValidateAPIKey 用一次低成本的嵌入调用校验 API Key 在当前服务地址下是否可用
+func (c *DashScopeClient) ValidateAPIKey() error {
+	if _, err := c.Embedding([]string{"ping"}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// firstChoice 返回第一个候选回复，没有 choices 时返回 nil
+func firstChoice(resp *ChatResponse) *Choice {
+	if resp == nil || len(resp.Output.Choices) == 0 {
+		return nil
+	}
+	return &resp.Output.Choices[0]
+}
+
+// GetTextResponse 从聊天响应中提取文本内容（不含推理模型的思考过程）
 func (c *DashScopeClient) GetTextResponse(resp interface{}) string {
 	chatResp, ok := resp.(*ChatResponse)
 	if !ok {
 		log.Printf("⚠️  响应不是 ChatResponse 类型")
 		return ""
 	}
-	
-	// 🔧 优先使用 text 字段（qwen-max 格式）
-	if chatResp.Output.Text != "" {
+
+	choice := firstChoice(chatResp)
+	if choice == nil {
+		// 旧版 text 格式回退
+		if chatResp.Output.Text == "" {
+			log.Printf("⚠️  响应中没有 choices 也没有 text")
+		}
 		return chatResp.Output.Text
 	}
-	
-	// 兼容 choices 格式
-	if len(chatResp.Output.Choices) == 0 {
-		log.Printf("⚠️  响应中没有 text 也没有 choices")
-		return ""
-	}
-	
-	content := chatResp.Output.Choices[0].Message.Content
+
+	_, content := splitInlineReasoning(choice.Message.Content)
 	if content == "" {
-		log.Printf("⚠️  AI 响应内容为空, FinishReason: %s", chatResp.Output.Choices[0].FinishReason)
+		log.Printf("⚠️  AI 响应内容为空, FinishReason: %s", choice.FinishReason)
 	}
 	return content
 }
 
+// GetFinishReason 从聊天响应中提取结束原因
+func (c *DashScopeClient) GetFinishReason(resp interface{}) string {
+	chatResp, ok := resp.(*ChatResponse)
+	if !ok {
+		return ""
+	}
+
+	choice := firstChoice(chatResp)
+	if choice == nil {
+		// 旧版 text 格式回退
+		return chatResp.Output.FinishReason
+	}
+	return choice.FinishReason
+}
+
 // GetToolCalls 从聊天响应中提取工具调用
 func (c *DashScopeClient) GetToolCalls(resp interface{}) []ToolCall {
 	chatResp, ok := resp.(*ChatResponse)
 	if !ok {
 		return nil
 	}
-	
-	// text 格式不支持工具调用
-	if chatResp.Output.Text != "" {
-		return nil
-	}
-	
-	// choices 格式支持工具调用
-	if len(chatResp.Output.Choices) == 0 {
+
+	choice := firstChoice(chatResp)
+	if choice == nil {
 		return nil
 	}
-	return chatResp.Output.Choices[0].Message.ToolCalls
+	return choice.Message.ToolCalls
 }
 
 // ShouldCallTool 判断是否应该调用工具
 func (c *DashScopeClient) ShouldCallTool(resp interface{}) bool {
-	chatResp, ok := resp.(*ChatResponse)
-	if !ok {
-		return false
+	if len(c.GetToolCalls(resp)) > 0 {
+		return true
 	}
-	
-	// text 格式不支持工具调用
-	if chatResp.Output.Text != "" {
-		return false
-	}
-	
-	// choices 格式检查工具调用
-	if len(chatResp.Output.Choices) == 0 {
-		return false
-	}
-	
-	finishReason := chatResp.Output.Choices[0].FinishReason
-	return strings.Contains(finishReason, "tool_calls")
+	return strings.Contains(c.GetFinishReason(resp), "tool_calls")
 }
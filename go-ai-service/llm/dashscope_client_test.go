@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// jsonServer 返回固定响应体的文本生成接口，收到的请求体写入 payload
+func jsonServer(t *testing.T, body string, payload *map[string]interface{}) *DashScopeClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(payload)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewDashScopeClient("test-key", server.Client())
+	client.SetBaseURL(server.URL)
+	return client
+}
+
+func TestChatRequestsMessageFormat(t *testing.T) {
+	tests := []struct {
+		model      string
+		wantFormat interface{}
+	}{
+		{"qwen-max", "message"},
+		{"qwen-turbo", "message"},
+		{"baichuan-7b-v1", nil}, // 提示词格式的模型只支持旧版 text 格式
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			var payload map[string]interface{}
+			client := jsonServer(t, `{"output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"好"}}]}}`, &payload)
+			if _, err := client.ChatWithModel(tt.model, []Message{{Role: "user", Content: "你好"}}, nil); err != nil {
+				t.Fatalf("ChatWithModel 失败: %v", err)
+			}
+			parameters, _ := payload["parameters"].(map[string]interface{})
+			if got := parameters["result_format"]; got != tt.wantFormat {
+				t.Errorf("result_format = %v, want %v", got, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestResponseGetters(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantText      string
+		wantFinish    string
+		wantReasoning string
+		wantToolCall  bool
+	}{
+		{
+			name:       "message 格式",
+			body:       `{"output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"您好"}}]}}`,
+			wantText:   "您好",
+			wantFinish: "stop",
+		},
+		{
+			name:       "旧版 text 格式回退",
+			body:       `{"output":{"text":"您好","finish_reason":"stop"}}`,
+			wantText:   "您好",
+			wantFinish: "stop",
+		},
+		{
+			name:          "内联思考过程",
+			body:          `{"output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"<think>用户在打招呼</think>\n您好"}}]}}`,
+			wantText:      "您好",
+			wantFinish:    "stop",
+			wantReasoning: "用户在打招呼",
+		},
+		{
+			name:          "reasoning_content",
+			body:          `{"output":{"choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"您好","reasoning_content":"打招呼"}}]}}`,
+			wantText:      "您好",
+			wantFinish:    "stop",
+			wantReasoning: "打招呼",
+		},
+		{
+			name:         "原生工具调用",
+			body:         `{"output":{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":"","tool_calls":[{"id":"1","type":"function","function":{"name":"search_product","arguments":"{}"}}]}}]}}`,
+			wantFinish:   "tool_calls",
+			wantToolCall: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			client := jsonServer(t, tt.body, &payload)
+			resp, err := client.Chat([]Message{{Role: "user", Content: "你好"}}, nil)
+			if err != nil {
+				t.Fatalf("Chat 失败: %v", err)
+			}
+			if got := client.GetTextResponse(resp); got != tt.wantText {
+				t.Errorf("GetTextResponse = %q, want %q", got, tt.wantText)
+			}
+			if got := client.GetFinishReason(resp); got != tt.wantFinish {
+				t.Errorf("GetFinishReason = %q, want %q", got, tt.wantFinish)
+			}
+			if got := client.GetReasoningContent(resp); got != tt.wantReasoning {
+				t.Errorf("GetReasoningContent = %q, want %q", got, tt.wantReasoning)
+			}
+			if got := client.ShouldCallTool(resp); got != tt.wantToolCall {
+				t.Errorf("ShouldCallTool = %v, want %v", got, tt.wantToolCall)
+			}
+		})
+	}
+}
+
+func TestChatResponseClone(t *testing.T) {
+	var original ChatResponse
+	body := `{"output":{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":"好","tool_calls":[{"id":"1","type":"function","function":{"name":"search_product","arguments":"{}"}}]}}]}}`
+	if err := json.Unmarshal([]byte(body), &original); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*ChatResponse)
+	}{
+		{"修改回复内容", func(r *ChatResponse) { r.Output.Choices[0].Message.Content = "改" }},
+		{"修改工具调用参数", func(r *ChatResponse) { r.Output.Choices[0].Message.ToolCalls[0].Function.Arguments = `{"x":1}` }},
+		{"追加候选回复", func(r *ChatResponse) { r.Output.Choices = append(r.Output.Choices[:0], Choice{FinishReason: "stop"}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mutate(original.clone())
+			choice := original.Output.Choices[0]
+			if choice.FinishReason != "tool_calls" || choice.Message.Content != "好" || choice.Message.ToolCalls[0].Function.Arguments != "{}" {
+				t.Errorf("修改副本影响了原响应: %+v", choice)
+			}
+		})
+	}
+}
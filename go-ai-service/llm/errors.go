@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// APIError DashScope API 返回的错误
+type APIError struct {
+	StatusCode int    // HTTP 状态码（业务错误码场景下为 0）
+	Code       string // DashScope 错误码
+	Message    string // 错误信息或原始响应体
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("API 错误 (状态码 %d): %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API 错误: %s - %s", e.Code, e.Message)
+}
+
+// IsRateLimited 判断是否为限流错误
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests || strings.HasPrefix(e.Code, "Throttling")
+}
+
+// IsAuthError 判断是否为鉴权错误（API Key 无效或与地域不匹配）
+func (e *APIError) IsAuthError() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.Code == "InvalidApiKey"
+}
+
+// ErrInterrupted 回复在正常结束前中断（连接中途断开、响应体不完整或没有结束原因），
+// 内容可能被截断，调用方不能据此解析或执行工具调用
+var ErrInterrupted = errors.New("LLM 回复中断")
+
+// interruptedError 将读取/解析响应时的中断包装为 ErrInterrupted，其他错误原样返回
+func interruptedError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || strings.Contains(err.Error(), "unexpected end of JSON input") {
+		return fmt.Errorf("%w: %v", ErrInterrupted, err)
+	}
+	return err
+}
+
+// checkFinished 回复中的每个结果都必须带有结束原因（stop、length 等），缺失说明生成没有正常结束
+func checkFinished(resp *ChatResponse) error {
+	for _, choice := range resp.Output.Choices {
+		if choice.FinishReason == "" || choice.FinishReason == "null" {
+			return fmt.Errorf("%w: 没有结束原因", ErrInterrupted)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package llm
+
+// GenerationParams 生成参数配置
+type GenerationParams struct {
+	Name        string  `json:"name"` // 配置名称（用于日志）
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+}
+
+// DefaultParams 默认生成参数：低随机性，更倾向于调用工具
+var DefaultParams = GenerationParams{Name: "default", Temperature: 0.1, TopP: 0.8}
+
+// toPayload 转换为 DashScope 请求中的 parameters 字段
+func (p GenerationParams) toPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"temperature": p.Temperature,
+		"top_p":       p.TopP,
+	}
+}
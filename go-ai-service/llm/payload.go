@@ -0,0 +1,96 @@
+package llm
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// InputShape 文本生成请求中 input 字段的格式，不同 DashScope 模型要求的格式不同
+type InputShape string
+
+const (
+	// InputMessages input 为对象，消息列表放在 input.messages 中（Qwen 系列，默认格式）
+	InputMessages InputShape = "messages"
+	// InputPrompt input 为对象，只接受单段提示词 input.prompt（部分第三方模型）
+	InputPrompt InputShape = "prompt"
+	// InputArray input 直接为消息数组
+	InputArray InputShape = "array"
+)
+
+// builtinInputShapes 内置的模型能力表，未列出的模型使用 InputMessages
+var builtinInputShapes = map[string]InputShape{
+	"qwen-turbo":     InputMessages,
+	"qwen-plus":      InputMessages,
+	"qwen-max":       InputMessages,
+	"baichuan-7b-v1": InputPrompt,
+	"dolly-12b-v2":   InputPrompt,
+}
+
+// promptRoleLabels 拼接提示词时各角色消息的前缀（system 消息原样输出）
+var promptRoleLabels = map[string]string{
+	"user":      "用户：",
+	"assistant": "助手：",
+	"tool":      "工具结果：",
+}
+
+// SetModelInputShapes 在内置能力表的基础上按模型覆盖 input 格式（值为 messages / prompt / array）
+func (c *DashScopeClient) SetModelInputShapes(overrides map[string]string) error {
+	shapes := make(map[string]InputShape, len(builtinInputShapes)+len(overrides))
+	for model, shape := range builtinInputShapes {
+		shapes[model] = shape
+	}
+	for model, raw := range overrides {
+		shape := InputShape(strings.ToLower(strings.TrimSpace(raw)))
+		switch shape {
+		case InputMessages, InputPrompt, InputArray:
+		default:
+			return fmt.Errorf("模型 %s 的 input 格式无效: %q（可选 messages / prompt / array）", model, raw)
+		}
+		shapes[model] = shape
+		log.Printf("🧩 模型 %s 使用 input 格式: %s", model, shape)
+	}
+	c.inputShapes = shapes
+	return nil
+}
+
+// inputShape 返回模型的 input 格式，未配置时使用内置能力表
+func (c *DashScopeClient) inputShape(model string) InputShape {
+	shapes := c.inputShapes
+	if shapes == nil {
+		shapes = builtinInputShapes
+	}
+	if shape, ok := shapes[model]; ok {
+		return shape
+	}
+	return InputMessages
+}
+
+// buildInput 按 input 格式构造请求中的 input 字段
+func buildInput(shape InputShape, messages []Message) interface{} {
+	switch shape {
+	case InputPrompt:
+		return map[string]interface{}{"prompt": flattenPrompt(messages)}
+	case InputArray:
+		return messages
+	default:
+		return map[string]interface{}{"messages": messages}
+	}
+}
+
+// flattenPrompt 把多轮消息拼接为单段提示词：只有一条用户消息时直接使用其内容，
+// 否则按"用户：/助手："标注每轮对话，并以"助手："结尾引导模型续写回复
+func flattenPrompt(messages []Message) string {
+	if len(messages) == 1 && messages[0].Role == "user" {
+		return messages[0].Content
+	}
+
+	var sb strings.Builder
+	for _, msg := range messages {
+		sb.WriteString(promptRoleLabels[msg.Role])
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(promptRoleLabels["assistant"])
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package llm
+
+import (
+	"regexp"
+	"strings"
+)
+
+// thinkBlockRegex 部分推理模型把思考过程以 <think>...</think> 的形式写在 content 开头
+var thinkBlockRegex = regexp.MustCompile(`(?s)^\s*<think>(.*?)</think>\s*`)
+
+// splitInlineReasoning 拆分 content 开头内联的思考过程，返回（思考过程, 最终回答）
+// 思考过程被截断（只有 <think> 没有 </think>）时整段视为思考过程，最终回答为空
+func splitInlineReasoning(content string) (string, string) {
+	if match := thinkBlockRegex.FindStringSubmatch(content); match != nil {
+		return strings.TrimSpace(match[1]), content[len(match[0]):]
+	}
+	if trimmed := strings.TrimSpace(content); strings.HasPrefix(trimmed, "<think>") {
+		return strings.TrimSpace(strings.TrimPrefix(trimmed, "<think>")), ""
+	}
+	return "", content
+}
+
+// GetReasoningContent 从聊天响应中提取推理模型的思考过程（reasoning_content 或内联的 <think> 块），
+// 思考过程只用于日志和调试，不能展示给用户
+func (c *DashScopeClient) GetReasoningContent(resp interface{}) string {
+	chatResp, ok := resp.(*ChatResponse)
+	if !ok {
+		return ""
+	}
+
+	choice := firstChoice(chatResp)
+	if choice == nil {
+		return ""
+	}
+
+	var parts []string
+	if reasoning := strings.TrimSpace(choice.Message.ReasoningContent); reasoning != "" {
+		parts = append(parts, reasoning)
+	}
+	if inline, _ := splitInlineReasoning(choice.Message.Content); inline != "" {
+		parts = append(parts, inline)
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// inflightCall 正在进行中的请求
+type inflightCall struct {
+	wg   sync.WaitGroup
+	resp *ChatResponse
+	err  error
+	dups int
+}
+
+// inflightGroup 合并相同的并发请求（singleflight），同一时刻相同 key 只发起一次上游调用
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+// Do 执行 fn；若相同 key 的请求正在进行，则等待并共享其结果，shared 表示结果是否被共享
+func (g *inflightGroup) Do(key string, fn func() (*ChatResponse, error)) (resp *ChatResponse, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*inflightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		call.dups++
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.resp, call.err, true
+	}
+	call := &inflightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.resp, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	shared = call.dups > 0
+	g.mu.Unlock()
+
+	return call.resp, call.err, shared
+}
+
+// chatRequestKey 根据模型、生成参数、消息（含图片）和工具计算请求的唯一标识
+func chatRequestKey(model string, params GenerationParams, messages []Message, tools []Tool) (string, error) {
+	type keyMessage struct {
+		Role    string   `json:"role"`
+		Content string   `json:"content"`
+		Images  []string `json:"images,omitempty"`
+	}
+
+	keyMessages := make([]keyMessage, len(messages))
+	for i, msg := range messages {
+		keyMessages[i] = keyMessage{Role: msg.Role, Content: msg.Content, Images: msg.Images}
+	}
+
+	data, err := json.Marshal(struct {
+		Model    string           `json:"model"`
+		Params   GenerationParams `json:"params"`
+		Messages []keyMessage     `json:"messages"`
+		Tools    []Tool           `json:"tools,omitempty"`
+	}{model, params, keyMessages, tools})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"log"
+	"strings"
+)
+
+// SetStopSequences 设置停止序列：生成内容即将包含任一序列时停止生成（如 </func_call>，工具调用之后不再继续输出），为空表示不设置
+func (c *DashScopeClient) SetStopSequences(stops []string) {
+	c.stops = nil
+	for _, stop := range stops {
+		if stop != "" {
+			c.stops = append(c.stops, stop)
+		}
+	}
+}
+
+// applyStopSequences 将停止序列写入请求的 parameters
+func (c *DashScopeClient) applyStopSequences(parameters map[string]interface{}) {
+	if len(c.stops) > 0 {
+		parameters["stop"] = c.stops
+	}
+}
+
+// restoreStopSequences DashScope 返回的内容不包含命中的停止序列：停止序列为闭合标签（如 </func_call>）
+// 且内容中对应的标签未闭合时补回闭合标签，保证工具调用解析看到完整的块
+func (c *DashScopeClient) restoreStopSequences(resp *ChatResponse) {
+	if len(c.stops) == 0 || resp == nil {
+		return
+	}
+	for i := range resp.Output.Choices {
+		choice := &resp.Output.Choices[i]
+		if choice.FinishReason != "stop" {
+			continue
+		}
+		for _, stop := range c.stops {
+			if closed, ok := closeStoppedTag(choice.Message.Content, stop); ok {
+				log.Printf("✂️  生成在停止序列 %s 处结束，补回闭合标签", stop)
+				choice.Message.Content = closed
+				break
+			}
+		}
+	}
+}
+
+// closeStoppedTag stop 为闭合标签且 content 中的开始标签多于闭合标签时，在末尾补上 stop
+func closeStoppedTag(content, stop string) (string, bool) {
+	if !strings.HasPrefix(stop, "</") || !strings.HasSuffix(stop, ">") {
+		return content, false
+	}
+	open := "<" + stop[2:]
+	if strings.Count(content, open) <= strings.Count(content, stop) {
+		return content, false
+	}
+	return strings.TrimRight(content, " \t\n") + "\n" + stop, true
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// maxStreamLineBytes 流式响应中单行 SSE 数据的最大长度
+const maxStreamLineBytes = 1 << 20
+
+// DeltaFunc 流式回复中每收到一段新增内容时的回调（内容为模型原始输出，可能包含工具调用标签或思考过程）
+type DeltaFunc func(delta string)
+
+// ChatStream 以流式（SSE）方式发送聊天请求，每收到一段新增内容调用 onDelta，流结束后返回与 ChatWithOptions 相同结构的完整响应。
+// ctx 取消（如客户端断开）时中止上游请求；包含图片或模型只支持提示词格式时退回非流式请求，不调用 onDelta
+func (c *DashScopeClient) ChatStream(ctx context.Context, model string, params GenerationParams, messages []Message, onDelta DeltaFunc) (*ChatResponse, error) {
+	if model == "" {
+		model = chatModel
+	}
+	if hasImages(messages) || c.inputShape(model) == InputPrompt {
+		log.Printf("⚠️  模型 %s 或多模态请求不支持流式输出，使用普通请求", model)
+		return c.ChatWithOptions(model, params, messages, nil)
+	}
+
+	log.Printf("📨 调用 Qwen Chat API (%s, 流式), 消息数: %d", model, len(messages))
+	log.Printf("🎛️  生成参数配置: %s (temperature=%.2f, top_p=%.2f)", params.Name, params.Temperature, params.TopP)
+
+	// 流式请求始终使用 message 格式，incremental_output 让每个事件只包含新增内容
+	parameters := params.toPayload()
+	parameters["result_format"] = "message"
+	parameters["incremental_output"] = true
+	c.applyStopSequences(parameters)
+	payload := map[string]interface{}{
+		"model":      model,
+		"input":      buildInput(c.inputShape(model), messages),
+		"parameters": parameters,
+	}
+
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("编码请求失败: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+textGenerationPath, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("X-DashScope-SSE", "enable")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("❌ API 返回非 200 状态码: %d", resp.StatusCode)
+		log.Printf("❌ 响应体: %s", string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(body)}
+	}
+
+	chatResp, err := readStream(resp.Body, onDelta)
+	if err != nil {
+		log.Printf("❌ 读取流式响应失败: %v", err)
+		return nil, err
+	}
+	log.Printf("✅ Qwen API 流式响应结束, RequestID: %s", chatResp.RequestID)
+	c.restoreStopSequences(chatResp)
+
+	if err := checkFinished(chatResp); err != nil {
+		log.Printf("❌ 回复没有正常结束: %v", err)
+		return nil, err
+	}
+	return chatResp, nil
+}
+
+// readStream 读取 DashScope 的 SSE 事件流，把各事件的增量内容拼接为一个完整的响应
+func readStream(body io.Reader, onDelta DeltaFunc) (*ChatResponse, error) {
+	var result ChatResponse
+	var content, reasoning strings.Builder
+	finishReason := ""
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineBytes)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // id/event/注释行
+		}
+
+		var chunk ChatResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return nil, fmt.Errorf("解析流式响应失败: %w", interruptedError(err))
+		}
+		if chunk.Code != "" && chunk.Code != "Success" {
+			log.Printf("❌ API 返回错误代码: %s - %s", chunk.Code, chunk.Message)
+			return nil, &APIError{Code: chunk.Code, Message: chunk.Message}
+		}
+		if chunk.RequestID != "" {
+			result.RequestID = chunk.RequestID
+		}
+		result.Usage = chunk.Usage
+
+		choice := firstChoice(&chunk)
+		if choice == nil {
+			continue
+		}
+		reasoning.WriteString(choice.Message.ReasoningContent)
+		if delta := choice.Message.Content; delta != "" {
+			content.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+		if choice.FinishReason != "" && choice.FinishReason != "null" {
+			finishReason = choice.FinishReason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取流式响应失败: %w", interruptedError(err))
+	}
+
+	result.Output.Choices = []Choice{{
+		FinishReason: finishReason,
+		Message: ChoiceMessage{
+			Role:             "assistant",
+			Content:          content.String(),
+			ReasoningContent: reasoning.String(),
+		},
+	}}
+	return &result, nil
+}
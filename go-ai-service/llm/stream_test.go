@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+// sseServer 返回按顺序输出 events（每个为一行 data 的 JSON）的 DashScope 流式接口
+func sseServer(t *testing.T, events ...string) *DashScopeClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-DashScope-SSE") != "enable" {
+			t.Errorf("流式请求缺少 X-DashScope-SSE 头")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, event := range events {
+			io.WriteString(w, "id:"+strconv.Itoa(i+1)+"\nevent:result\n:HTTP_STATUS/200\ndata:"+event+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewDashScopeClient("test-key", server.Client())
+	client.SetBaseURL(server.URL)
+	return client
+}
+
+func TestChatStream(t *testing.T) {
+	client := sseServer(t,
+		`{"output":{"choices":[{"message":{"role":"assistant","content":"您好，"},"finish_reason":"null"}]},"request_id":"req-1"}`,
+		`{"output":{"choices":[{"message":{"role":"assistant","content":"山地车"},"finish_reason":"null"}]},"request_id":"req-1"}`,
+		`{"output":{"choices":[{"message":{"role":"assistant","content":"有货。"},"finish_reason":"stop"}]},"usage":{"input_tokens":12,"output_tokens":6},"request_id":"req-1"}`,
+	)
+
+	var deltas []string
+	resp, err := client.ChatStream(context.Background(), "", DefaultParams, []Message{{Role: "user", Content: "有山地车吗"}}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+	if got := strings.Join(deltas, "|"); got != "您好，|山地车|有货。" {
+		t.Errorf("deltas = %q", got)
+	}
+	if got := client.GetTextResponse(resp); got != "您好，山地车有货。" {
+		t.Errorf("完整回复 = %q", got)
+	}
+	if got := client.GetFinishReason(resp); got != "stop" {
+		t.Errorf("finish_reason = %q, want stop", got)
+	}
+	if resp.RequestID != "req-1" || resp.Usage.OutputTokens != 6 {
+		t.Errorf("RequestID/Usage = %q/%+v", resp.RequestID, resp.Usage)
+	}
+}
+
+func TestChatStreamErrorEvent(t *testing.T) {
+	client := sseServer(t, `{"code":"Throttling.RateQuota","message":"Requests rate limit exceeded","request_id":"req-2"}`)
+
+	_, err := client.ChatStream(context.Background(), "", DefaultParams, []Message{{Role: "user", Content: "你好"}}, nil)
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("error = %v, want *APIError", err)
+	}
+	if !apiErr.IsRateLimited() {
+		t.Errorf("error = %v, want 限流错误", apiErr)
+	}
+}
+
+func TestChatStreamStopSequences(t *testing.T) {
+	var parameters map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Parameters map[string]interface{} `json:"parameters"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		parameters = payload.Parameters
+
+		// 命中停止序列时 DashScope 返回的内容不包含 </func_call>
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data:{"output":{"choices":[{"message":{"role":"assistant","content":"好的\n<func_call>\n<tool_name>search_product</tool_name>\n"},"finish_reason":"null"}]}}`+"\n\n")
+		io.WriteString(w, `data:{"output":{"choices":[{"message":{"role":"assistant","content":"<arguments></arguments>\n"},"finish_reason":"stop"}]}}`+"\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewDashScopeClient("test-key", server.Client())
+	client.SetBaseURL(server.URL)
+	client.SetStopSequences([]string{"</func_call>", ""})
+
+	resp, err := client.ChatStream(context.Background(), "", DefaultParams, []Message{{Role: "user", Content: "有山地车吗"}}, nil)
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+	if got := fmt.Sprint(parameters["stop"]); got != "[</func_call>]" {
+		t.Errorf("请求的 stop = %v, want [</func_call>]", parameters["stop"])
+	}
+	if got := client.GetTextResponse(resp); !strings.HasSuffix(got, "<arguments></arguments>\n</func_call>") {
+		t.Errorf("完整回复 = %q, want 补回闭合标签", got)
+	}
+}
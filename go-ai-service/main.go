@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
 	"go-ai-service/config"
 	"go-ai-service/handlers"
 	"go-ai-service/llm"
 	"go-ai-service/mcp"
 	"go-ai-service/rag"
+	"go-ai-service/tracing"
 	"io"
 	"log"
 	"os"
@@ -14,6 +16,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// version 服务版本，构建时通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
+
 func main() {
 	// 设置日志输出编码为 UTF-8（修复中文乱码）
 	log.SetOutput(io.Writer(os.Stdout))
@@ -21,6 +26,10 @@ func main() {
 	// 加载配置
 	cfg := config.LoadConfig()
 
+	// 分布式追踪（按 OTEL_* 环境变量配置，未配置时不启用）
+	tracing.Init(version)
+	defer tracing.Shutdown()
+
 	// 🔌 初始化 MCP Client（启动 Python MCP Server）
 	log.Println("🔌 初始化 MCP Client...")
 	if err := mcp.InitMCPClient(); err != nil {
@@ -28,17 +37,107 @@ func main() {
 	}
 	defer mcp.CloseMCPClient()
 
+	// 共享的 HTTP 客户端（复用连接池）
+	httpClient := cfg.NewHTTPClient()
+
 	// 初始化 LLM 客户端
-	llmClient := llm.NewDashScopeClient(cfg.DashScopeAPIKey)
+	llmClient := llm.NewDashScopeClient(cfg.DashScopeAPIKey, httpClient)
+	llmClient.SetBaseURL(cfg.DashScopeBaseURL)
+	llmClient.SetRequestCoalescing(cfg.LLMCoalesceRequests)
+	llmClient.SetStopSequences(cfg.LLMStopSequences)
+	if err := llmClient.SetModelInputShapes(cfg.LLMModelInputShapes); err != nil {
+		log.Fatalf("❌ 模型 input 格式配置错误: %v", err)
+	}
+	llmClient.SetEmbeddingTimeout(cfg.EmbeddingTimeout)
+
+	// 启动时校验 API Key，地域不匹配时快速失败
+	if cfg.DashScopeValidateKey {
+		if err := llmClient.ValidateAPIKey(); err != nil {
+			var apiErr *llm.APIError
+			if errors.As(err, &apiErr) && apiErr.IsAuthError() {
+				log.Fatalf("❌ DashScope API Key 校验失败（请确认 DASHSCOPE_REGION=%s 与账号地域一致）: %v", cfg.DashScopeRegion, err)
+			}
+			log.Printf("⚠️  DashScope API Key 校验未完成: %v", err)
+		} else {
+			log.Println("✅ DashScope API Key 校验通过")
+		}
+	}
 
 	// 初始化 RAG 客户端
-	ragClient := rag.NewChromaClient(cfg.ChromaHost, cfg.ChromaPort, cfg.DashScopeAPIKey)
+	ragClient := rag.NewChromaClient(cfg.ChromaHost, cfg.ChromaPort, cfg.DashScopeAPIKey, httpClient)
+	ragClient.SetDashScopeBaseURL(cfg.DashScopeBaseURL)
+	ragClient.SetEmbeddingMaxTokens(cfg.EmbeddingMaxTokens)
+	ragClient.SetEmbeddingRetry(cfg.EmbeddingRetries, cfg.EmbeddingRetryDelay, cfg.EmbeddingSkipFailed)
+	ragClient.SetEmbeddingTimeout(cfg.EmbeddingTimeout)
+	ragClient.SetEmbeddingConcurrency(cfg.EmbeddingConcurrency)
+	ragClient.SetQueryConcurrency(cfg.RAGQueryConcurrency)
+	ragClient.SetTenant(cfg.ChromaTenant, cfg.ChromaDatabase)
+	ragClient.SetCollection(cfg.ChromaCollection)
+	ragClient.SetChromaRetry(cfg.ChromaRetries, cfg.ChromaRetryDelay)
+	ragClient.SetMetadataFields(cfg.ChromaMetadataFields)
+	if err := ragClient.SetDistanceMetric(cfg.ChromaDistanceMetric); err != nil {
+		log.Fatalf("❌ CHROMA_DISTANCE_METRIC 配置无效: %v", err)
+	}
+	if cfg.RAGRerank {
+		ragClient.SetReranker(llmClient, cfg.RAGRerankModel)
+	}
+
+	// 预热：确保知识库集合存在（全新部署时自动创建）
+	if cfg.ChromaAutoCreate {
+		if err := ragClient.EnsureCollection(cfg.ChromaHNSWSpace); err != nil {
+			log.Printf("⚠️  知识库集合初始化失败: %v", err)
+		}
+	}
 
 	// 初始化 MCP 工具执行器（现在使用 MCP Client 而不是直接 HTTP）
-	toolExecutor := mcp.NewToolExecutor(cfg.JavaShopURL)
+	toolPolicies := mcp.ApplyToolOverrides(mcp.DefaultToolPolicies(), cfg.ToolTimeouts, cfg.ToolRetries)
+	toolExecutor := mcp.NewToolExecutor(cfg.JavaShopURL, toolPolicies)
+	if cfg.ToolsDisabled {
+		toolExecutor.SetMode(mcp.ToolModeDisabled)
+	} else if cfg.ToolsReadOnly {
+		toolExecutor.SetMode(mcp.ToolModeReadOnly)
+	}
+	if cfg.ToolCacheEnabled {
+		toolExecutor.EnableResultCache(cfg.ToolCacheTTL)
+		log.Printf("⚡ 已启用只读工具结果缓存 (TTL %s)", cfg.ToolCacheTTL)
+	}
 
 	// 初始化处理器
-	chatHandler := handlers.NewChatHandler(llmClient, ragClient, toolExecutor)
+	chatHandler := handlers.NewChatHandler(llmClient, ragClient, toolExecutor, cfg)
+	chatHandler.SetOrderWebhook(handlers.NewOrderWebhook(cfg.OrderWebhookURL, cfg.OrderWebhookSecret, httpClient))
+	if provider := handlers.NewHTTPProfileProvider(cfg.ProfileURL, httpClient); provider != nil {
+		chatHandler.SetProfileProvider(provider)
+	}
+	if cfg.FewShotExamplesFile != "" {
+		examples, err := handlers.LoadFewShotExamples(cfg.FewShotExamplesFile)
+		if err != nil {
+			log.Fatalf("❌ 加载示例对话失败 (%s): %v", cfg.FewShotExamplesFile, err)
+		}
+		chatHandler.SetFewShotExamples(examples)
+		log.Printf("✅ 已加载 %d 组示例对话", len(examples))
+	}
+	if cfg.MessagesFile != "" {
+		overrides, err := handlers.LoadMessageOverrides(cfg.MessagesFile)
+		if err != nil {
+			log.Fatalf("❌ 加载提示语失败 (%s): %v", cfg.MessagesFile, err)
+		}
+		chatHandler.SetMessageOverrides(overrides)
+		log.Printf("✅ 已加载 %d 条自定义提示语", len(overrides))
+	}
+	persona := handlers.Persona{Name: cfg.AssistantName, Tone: cfg.AssistantTone, Brand: cfg.AssistantBrand}
+	if err := chatHandler.SetPersona(persona); err != nil {
+		log.Fatalf("❌ 助手人设配置错误: %v", err)
+	}
+	if cfg.ToolPreviewTemplatesFile != "" {
+		templates, err := handlers.LoadToolPreviewTemplates(cfg.ToolPreviewTemplatesFile)
+		if err == nil {
+			err = chatHandler.SetToolPreviewTemplates(templates)
+		}
+		if err != nil {
+			log.Fatalf("❌ 加载工具预览模板失败 (%s): %v", cfg.ToolPreviewTemplatesFile, err)
+		}
+		log.Printf("✅ 已加载 %d 个工具预览模板", len(templates))
+	}
 
 	// 设置路由
 	router := gin.Default()
@@ -47,26 +146,73 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Merchant-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 
+	// 请求体大小限制（防止超大请求体占满内存）
+	router.Use(handlers.LimitBodySize(cfg.MaxBodyBytes))
+
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// 就绪检查：MCP Server 缺少必需工具（如 Python 服务部署不完整）时返回 503
+	router.GET("/ready", handlers.HandleReady(mcp.NewToolHealthChecker(cfg.MCPRequiredTools, cfg.MCPToolsCacheTTL)))
+
+	// 版本与配置信息（便于排查线上部署）
+	router.GET("/version", func(c *gin.Context) {
+		chatModel, visionModel := llmClient.Models()
+		protocolVersion := ""
+		if mcpClient := mcp.GetMCPClient(); mcpClient != nil {
+			protocolVersion = mcpClient.ProtocolVersion()
+		}
+		c.JSON(200, gin.H{
+			"version":            version,
+			"llmModel":           chatModel,
+			"visionModel":        visionModel,
+			"modelRouting":       cfg.ModelRouting,
+			"embeddingModel":     ragClient.EmbeddingModel(),
+			"chromaCollection":   ragClient.CollectionName(),
+			"mcpProtocolVersion": protocolVersion,
+		})
+	})
+
 	// 聊天接口
 	router.POST("/chat", chatHandler.HandleChat)
 
+	// 工具列表（需要 API Key）
+	router.GET("/tools", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleListTools)
+
+	// 工具安全模式（运行期间切换，需要 API Key）
+	router.GET("/tools/mode", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleGetToolMode)
+	router.PUT("/tools/mode", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleSetToolMode)
+
+	// 会话查看（只读，需要 API Key）
+	router.GET("/sessions", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleListSessions)
+	router.GET("/sessions/:id", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleGetSession)
+
+	// 会话偏好（回复语言、详略程度、语气），按会话设置（需要 API Key）
+	router.POST("/session/:id/prefs", handlers.RequireAPIKey(cfg.AdminAPIKey), chatHandler.HandleSetPreferences)
+
+	// 知识库导入（后台执行，返回任务 ID，需要 API Key）
+	knowledgeHandler := handlers.NewKnowledgeHandler(ragClient, cfg)
+	router.POST("/knowledge", handlers.RequireAPIKey(cfg.AdminAPIKey), knowledgeHandler.HandleIngest)
+	router.GET("/knowledge/jobs/:id", handlers.RequireAPIKey(cfg.AdminAPIKey), knowledgeHandler.HandleGetJob)
+	router.GET("/knowledge/stats", handlers.RequireAPIKey(cfg.AdminAPIKey), knowledgeHandler.HandleStats)
+
+	// 文本向量（与知识库检索相同的嵌入模型，供内部工具使用，需要 API Key）
+	router.POST("/embed", handlers.RequireAPIKey(cfg.AdminAPIKey), handlers.HandleEmbed(llmClient, cfg.EmbedMaxTexts))
+
 	// 启动服务
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
 
-	log.Printf("🚀 Go AI 服务启动在端口 %s", port)
+	log.Printf("🚀 Go AI 服务 (%s) 启动在端口 %s", version, port)
 	if err := router.Run(":" + port); err != nil {
 		log.Fatalf("服务启动失败: %v", err)
 	}
@@ -0,0 +1,146 @@
+package mcp
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CoerceArguments 按工具定义中各参数的类型（properties.*.type）就地转换参数值：
+// string 参数的数字转换为字符串（如模型把手机号输出为数字），integer 参数的数字字符串和整数值的浮点数转换为 int，
+// array 参数（字符串数组）的单个值或逗号分隔的字符串转换为 []string。
+// 无法转换的参数保持原值并返回错误；未知工具、未定义的参数和空值（由必需参数检查处理）不做处理
+func CoerceArguments(toolName string, args map[string]interface{}) error {
+	function := toolFunction(toolName)
+	if function == nil || len(args) == 0 {
+		return nil
+	}
+	properties, _ := function.Parameters["properties"].(map[string]interface{})
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		value := args[name]
+		property, ok := properties[name].(map[string]interface{})
+		if !ok || isBlankArg(value) {
+			continue
+		}
+		paramType, _ := property["type"].(string)
+
+		var coerced interface{}
+		switch paramType {
+		case "string":
+			coerced, ok = coerceString(value)
+		case "integer":
+			coerced, ok = coerceInteger(value)
+		case "array":
+			coerced, ok = coerceStringList(value)
+		default:
+			continue
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s 应为 %s 类型，实际为 %v", name, paramType, value))
+			continue
+		}
+		args[name] = coerced
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("工具 %s 参数类型错误: %s", toolName, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ArrayParameters 返回工具定义中类型为 array 的参数名称（用于解析 XML 中重复或嵌套的参数标签）
+func ArrayParameters(toolName string) map[string]bool {
+	function := toolFunction(toolName)
+	if function == nil {
+		return nil
+	}
+	properties, _ := function.Parameters["properties"].(map[string]interface{})
+
+	params := make(map[string]bool)
+	for name, raw := range properties {
+		if property, ok := raw.(map[string]interface{}); ok && property["type"] == "array" {
+			params[name] = true
+		}
+	}
+	return params
+}
+
+// listSeparatorRegex 字符串形式的列表中的分隔符，如 "PENDING,SHIPPED"、"PENDING、SHIPPED"
+var listSeparatorRegex = regexp.MustCompile(`[\s,，、;；|]+`)
+
+// coerceStringList 将数组、单个值或分隔符连接的字符串转换为字符串列表，空元素被丢弃
+func coerceStringList(value interface{}) ([]string, bool) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
+	}
+
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		text, ok := coerceString(item)
+		if !ok {
+			return nil, false
+		}
+		for _, part := range listSeparatorRegex.Split(text, -1) {
+			if part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list, true
+}
+
+// coerceString 将数字和布尔值转换为字符串，数组和对象无法转换
+func coerceString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// coerceInteger 将整数值的浮点数（JSON 数字）和整数字符串（如 XML 中的 "2"）转换为 int
+func coerceInteger(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	default:
+		return 0, false
+	}
+}
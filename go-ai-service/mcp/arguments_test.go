@@ -0,0 +1,149 @@
+package mcp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoerceArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		tool      string
+		args      map[string]interface{}
+		want      map[string]interface{}
+		wantError bool
+	}{
+		{
+			name: "数字手机号转换为字符串，数量字符串转换为整数",
+			tool: "create_order",
+			args: map[string]interface{}{"productName": "山地车", "quantity": "2", "customerPhone": float64(13800138000)},
+			want: map[string]interface{}{"productName": "山地车", "quantity": 2, "customerPhone": "13800138000"},
+		},
+		{
+			name: "整数值的浮点数转换为整数",
+			tool: "create_order",
+			args: map[string]interface{}{"quantity": float64(3)},
+			want: map[string]interface{}{"quantity": 3},
+		},
+		{
+			name: "数量字符串两端的空白",
+			tool: "create_order",
+			args: map[string]interface{}{"quantity": " 5 "},
+			want: map[string]interface{}{"quantity": 5},
+		},
+		{
+			name: "单个状态转换为列表",
+			tool: "list_orders",
+			args: map[string]interface{}{"status": "PENDING"},
+			want: map[string]interface{}{"status": []string{"PENDING"}},
+		},
+		{
+			name: "分隔符连接的状态拆分为列表",
+			tool: "list_orders",
+			args: map[string]interface{}{"status": "PENDING、SHIPPED, DELIVERED", "page": "2"},
+			want: map[string]interface{}{"status": []string{"PENDING", "SHIPPED", "DELIVERED"}, "page": 2},
+		},
+		{
+			name: "数组中的元素",
+			tool: "list_orders",
+			args: map[string]interface{}{"status": []interface{}{"PENDING", "SHIPPED,CANCELLED"}},
+			want: map[string]interface{}{"status": []string{"PENDING", "SHIPPED", "CANCELLED"}},
+		},
+		{
+			name: "空值和未定义的参数不处理",
+			tool: "create_order",
+			args: map[string]interface{}{"quantity": " ", "customerPhone": nil, "note": float64(1)},
+			want: map[string]interface{}{"quantity": " ", "customerPhone": nil, "note": float64(1)},
+		},
+		{
+			name: "未知工具不处理",
+			tool: "unknown_tool",
+			args: map[string]interface{}{"quantity": "2"},
+			want: map[string]interface{}{"quantity": "2"},
+		},
+		{
+			name:      "无法转换的参数保持原值并返回错误",
+			tool:      "create_order",
+			args:      map[string]interface{}{"quantity": "两个", "customerPhone": map[string]interface{}{"a": 1}, "productName": "山地车"},
+			want:      map[string]interface{}{"quantity": "两个", "customerPhone": map[string]interface{}{"a": 1}, "productName": "山地车"},
+			wantError: true,
+		},
+		{
+			name:      "小数数量",
+			tool:      "create_order",
+			args:      map[string]interface{}{"quantity": 1.5},
+			want:      map[string]interface{}{"quantity": 1.5},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CoerceArguments(tt.tool, tt.args)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("CoerceArguments error = %v, wantError %v", err, tt.wantError)
+			}
+			if !reflect.DeepEqual(tt.args, tt.want) {
+				t.Errorf("参数 = %#v, want %#v", tt.args, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoerceInteger(t *testing.T) {
+	tests := []struct {
+		value  interface{}
+		want   int
+		wantOK bool
+	}{
+		{2, 2, true},
+		{float64(7), 7, true},
+		{float64(-1), -1, true},
+		{"12", 12, true},
+		{2.5, 0, false},
+		{float64(1 << 40), 0, false},
+		{"1e3", 0, false},
+		{"", 0, false},
+		{true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := coerceInteger(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("coerceInteger(%#v) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCoerceString(t *testing.T) {
+	tests := []struct {
+		value  interface{}
+		want   string
+		wantOK bool
+	}{
+		{"ORD-1", "ORD-1", true},
+		{float64(13800138000), "13800138000", true},
+		{1.25, "1.25", true},
+		{3, "3", true},
+		{false, "false", true},
+		{[]interface{}{"a"}, "", false},
+		{map[string]interface{}{}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := coerceString(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("coerceString(%#v) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestArrayParameters(t *testing.T) {
+	if got := ArrayParameters("list_orders"); !reflect.DeepEqual(got, map[string]bool{"status": true}) {
+		t.Errorf("ArrayParameters(list_orders) = %v", got)
+	}
+	if got := ArrayParameters("create_order"); len(got) != 0 {
+		t.Errorf("ArrayParameters(create_order) = %v, want 空", got)
+	}
+	if got := ArrayParameters("unknown_tool"); got != nil {
+		t.Errorf("ArrayParameters(unknown_tool) = %v, want nil", got)
+	}
+}
@@ -3,22 +3,40 @@ package mcp
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MCPClient MCP 客户端 - 通过 stdio 与 Python MCP Server 通信
+// 由后台 goroutine 统一读取 stdout，按请求 ID 分发响应，并处理服务端通知
 type MCPClient struct {
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
 	stderr io.ReadCloser
-	mu     sync.Mutex
+	reader *bufio.Reader
+	mu     sync.Mutex // 保护 stdin 写入与 msgID
 	msgID  int
+
+	pendingMu sync.Mutex
+	pending   map[int]chan MCPResponse       // 等待响应的请求
+	progress  map[string]ProgressFunc        // 按 progressToken 注册的进度回调
+	notifiers map[string]NotificationHandler // 按方法名注册的通知处理器
+	readErr   error                          // 读取循环退出原因
+	done      chan struct{}                  // 读取循环退出时关闭
+
+	stderrDone chan struct{} // stderr 日志 goroutine 退出时关闭
+	closeOnce  sync.Once
+
+	protocolVersion string             // 协商后的协议版本
+	capabilities    ServerCapabilities // 服务端声明的能力（用于功能开关）
 }
 
 // MCPRequest MCP 请求格式
@@ -43,6 +61,34 @@ type MCPError struct {
 	Message string `json:"message"`
 }
 
+// MCPProgress 工具执行进度（notifications/progress）
+type MCPProgress struct {
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// Percent 返回进度百分比，total 未知时返回 -1
+func (p MCPProgress) Percent() int {
+	if p.Total <= 0 {
+		return -1
+	}
+	return int(p.Progress / p.Total * 100)
+}
+
+// ProgressFunc 进度回调
+type ProgressFunc func(progress MCPProgress)
+
+// mcpMessage 从 stdout 读取的通用 JSON-RPC 消息（响应、通知或服务端请求）
+type mcpMessage struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      *int            `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *MCPError       `json:"error,omitempty"`
+}
+
 // MCPToolResult 工具调用结果
 type MCPToolResult struct {
 	Content []struct {
@@ -51,12 +97,16 @@ type MCPToolResult struct {
 	} `json:"content"`
 }
 
-// NewMCPClient 创建并启动 MCP 客户端
+// NewMCPClient 创建并启动 MCP 客户端（用 python3 运行 mcpServerPath 处的 MCP Server）
 func NewMCPClient(mcpServerPath string) (*MCPClient, error) {
-	log.Printf("🔌 启动 MCP Server: python3 %s", mcpServerPath)
+	return NewMCPClientCommand("python3", mcpServerPath)
+}
+
+// NewMCPClientCommand 以任意命令启动 MCP Server 并创建客户端（如 cmd/fake-mcp-server 编译出的测试服务端）
+func NewMCPClientCommand(name string, args ...string) (*MCPClient, error) {
+	log.Printf("🔌 启动 MCP Server: %s", strings.Join(append([]string{name}, args...), " "))
 
-	// 启动 Python MCP Server
-	cmd := exec.Command("python3", mcpServerPath)
+	cmd := exec.Command(name, args...)
 
 	// 获取 stdin/stdout/stderr 管道
 	stdin, err := cmd.StdinPipe()
@@ -84,12 +134,25 @@ func NewMCPClient(mcpServerPath string) (*MCPClient, error) {
 		stdin:  stdin,
 		stdout: stdout,
 		stderr: stderr,
+		reader: bufio.NewReader(stdout),
 		msgID:  0,
+
+		pending:  make(map[int]chan MCPResponse),
+		progress: make(map[string]ProgressFunc),
+		done:     make(chan struct{}),
+
+		stderrDone: make(chan struct{}),
 	}
 
+	// 注册内置的通知处理器（需在读取循环启动前完成）
+	client.registerBuiltinNotifications()
+
 	// 启动 stderr 日志输出
 	go client.logStderr()
 
+	// 启动 stdout 读取循环
+	go client.readLoop()
+
 	// 初始化会话
 	if err := client.initialize(); err != nil {
 		client.Close()
@@ -100,22 +163,79 @@ func NewMCPClient(mcpServerPath string) (*MCPClient, error) {
 	return client, nil
 }
 
-// logStderr 输出 MCP Server 的 stderr 日志
+// logStderr 输出 MCP Server 的 stderr 日志，stderr 关闭（进程退出）后返回
 func (c *MCPClient) logStderr() {
+	defer close(c.stderrDone)
 	scanner := bufio.NewScanner(c.stderr)
 	for scanner.Scan() {
 		log.Printf("[MCP Server] %s", scanner.Text())
 	}
 }
 
-// initialize 初始化 MCP 会话
+// clientProtocolVersion 客户端请求的 MCP 协议版本
+const clientProtocolVersion = "2024-11-05"
+
+// supportedProtocolVersions 客户端能够处理的协议版本
+var supportedProtocolVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+}
+
+const (
+	initializeTimeout     = 10 * time.Second
+	initializeMaxAttempts = 3
+)
+
+// ServerCapabilities 服务端在 initialize 响应中声明的能力
+type ServerCapabilities struct {
+	Tools *struct {
+		ListChanged bool `json:"listChanged,omitempty"`
+	} `json:"tools,omitempty"`
+	Resources *struct {
+		Subscribe   bool `json:"subscribe,omitempty"`
+		ListChanged bool `json:"listChanged,omitempty"`
+	} `json:"resources,omitempty"`
+	Prompts *struct {
+		ListChanged bool `json:"listChanged,omitempty"`
+	} `json:"prompts,omitempty"`
+	Logging map[string]interface{} `json:"logging,omitempty"`
+}
+
+// initializeResult initialize 响应结果
+type initializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+}
+
+// initialize 初始化 MCP 会话：协商协议版本并记录服务端能力，超时时重试
 func (c *MCPClient) initialize() error {
+	var lastErr error
+	for attempt := 1; attempt <= initializeMaxAttempts; attempt++ {
+		err := c.tryInitialize()
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, errRequestTimeout) {
+			return err
+		}
+		lastErr = err
+		log.Printf("⚠️  MCP 初始化超时（第 %d/%d 次）", attempt, initializeMaxAttempts)
+	}
+	return fmt.Errorf("MCP 初始化失败: %w", lastErr)
+}
+
+// tryInitialize 发送一次 initialize 请求并处理协商结果
+func (c *MCPClient) tryInitialize() error {
 	req := MCPRequest{
 		Jsonrpc: "2.0",
 		ID:      c.nextID(),
 		Method:  "initialize",
 		Params: map[string]interface{}{
-			"protocolVersion": "2024-11-05",
+			"protocolVersion": clientProtocolVersion,
 			"capabilities":    map[string]interface{}{},
 			"clientInfo": map[string]string{
 				"name":    "go-ai-service",
@@ -125,19 +245,85 @@ func (c *MCPClient) initialize() error {
 	}
 
 	var resp MCPResponse
-	if err := c.sendRequest(req, &resp); err != nil {
+	if err := c.sendRequestWithTimeout(req, &resp, initializeTimeout); err != nil {
 		return err
 	}
 
 	if resp.Error != nil {
-		return fmt.Errorf("MCP 初始化错误: %s", resp.Error.Message)
+		return fmt.Errorf("MCP 服务端拒绝初始化（客户端协议版本 %s）: %s", clientProtocolVersion, resp.Error.Message)
+	}
+
+	var result initializeResult
+	if err := json.Unmarshal(resp.Result, &result); err != nil {
+		return fmt.Errorf("解析 MCP 初始化响应失败: %w", err)
+	}
+
+	if !supportedProtocolVersions[result.ProtocolVersion] {
+		return fmt.Errorf("MCP 服务端协议版本 %q 不受支持（客户端请求 %s）", result.ProtocolVersion, clientProtocolVersion)
 	}
 
+	c.protocolVersion = result.ProtocolVersion
+	c.capabilities = result.Capabilities
+
+	capsJSON, _ := json.Marshal(result.Capabilities)
+	log.Printf("🤝 MCP 协议版本: %s, 服务端: %s %s", result.ProtocolVersion, result.ServerInfo.Name, result.ServerInfo.Version)
+	log.Printf("🤝 MCP 服务端能力: %s", capsJSON)
+
+	// 通知服务端初始化完成
+	return c.sendNotification("notifications/initialized", nil)
+}
+
+// ProtocolVersion 返回协商后的协议版本
+func (c *MCPClient) ProtocolVersion() string {
+	return c.protocolVersion
+}
+
+// Capabilities 返回服务端声明的能力
+func (c *MCPClient) Capabilities() ServerCapabilities {
+	return c.capabilities
+}
+
+// SupportsTools 服务端是否声明了工具能力
+func (c *MCPClient) SupportsTools() bool {
+	return c.capabilities.Tools != nil
+}
+
+// SupportsResources 服务端是否声明了资源能力
+func (c *MCPClient) SupportsResources() bool {
+	return c.capabilities.Resources != nil
+}
+
+// sendNotification 发送通知（无 ID，不等待响应）
+func (c *MCPClient) sendNotification(method string, params interface{}) error {
+	notification := struct {
+		Jsonrpc string      `json:"jsonrpc"`
+		Method  string      `json:"method"`
+		Params  interface{} `json:"params,omitempty"`
+	}{Jsonrpc: "2.0", Method: method, Params: params}
+
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("序列化通知失败: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("发送通知失败: %w", err)
+	}
 	return nil
 }
 
+// listToolsTimeout tools/list 等待响应的时间
+const listToolsTimeout = 10 * time.Second
+
 // ListTools 列出所有可用工具
 func (c *MCPClient) ListTools() ([]string, error) {
+	return c.ListToolsWithTimeout(listToolsTimeout)
+}
+
+// ListToolsWithTimeout 列出所有可用工具，服务端在 timeout 内没有响应时返回超时错误
+func (c *MCPClient) ListToolsWithTimeout(timeout time.Duration) ([]string, error) {
 	req := MCPRequest{
 		Jsonrpc: "2.0",
 		ID:      c.nextID(),
@@ -145,7 +331,10 @@ func (c *MCPClient) ListTools() ([]string, error) {
 	}
 
 	var resp MCPResponse
-	if err := c.sendRequest(req, &resp); err != nil {
+	if err := c.sendRequestWithTimeout(req, &resp, timeout); err != nil {
+		if errors.Is(err, errRequestTimeout) {
+			return nil, fmt.Errorf("列出工具超时 (%s): %w", timeout, err)
+		}
 		return nil, err
 	}
 
@@ -172,18 +361,60 @@ func (c *MCPClient) ListTools() ([]string, error) {
 
 // CallTool 调用 MCP 工具
 func (c *MCPClient) CallTool(toolName string, arguments map[string]interface{}) (string, error) {
+	return c.CallToolWithProgress(toolName, arguments, 0, nil)
+}
+
+// CallToolWithTimeout 带超时地调用 MCP 工具
+func (c *MCPClient) CallToolWithTimeout(toolName string, arguments map[string]interface{}, timeout time.Duration) (string, error) {
+	return c.CallToolWithProgress(toolName, arguments, timeout, nil)
+}
+
+// CallToolWithProgress 调用 MCP 工具，并将服务端上报的进度转发给 onProgress
+// timeout <= 0 时使用默认超时（defaultRequestTimeout）；onProgress 为空时不请求进度通知
+func (c *MCPClient) CallToolWithProgress(toolName string, arguments map[string]interface{}, timeout time.Duration, onProgress ProgressFunc) (string, error) {
+	return c.CallToolTraced(toolName, arguments, timeout, onProgress, "")
+}
+
+// CallToolTraced 调用 MCP 工具，traceparent 不为空时通过 _meta.traceparent 传递追踪上下文
+func (c *MCPClient) CallToolTraced(toolName string, arguments map[string]interface{}, timeout time.Duration, onProgress ProgressFunc, traceparent string) (string, error) {
+	id := c.nextID()
+	params := map[string]interface{}{
+		"name":      toolName,
+		"arguments": arguments,
+	}
+
+	meta := make(map[string]interface{})
+	if traceparent != "" {
+		meta["traceparent"] = traceparent
+	}
+
+	// 通过 _meta.progressToken 请求进度通知
+	if onProgress != nil {
+		token := fmt.Sprintf("progress-%d", id)
+		meta["progressToken"] = token
+		c.registerProgress(token, onProgress)
+		defer c.unregisterProgress(token)
+	}
+
+	if len(meta) > 0 {
+		params["_meta"] = meta
+	}
+
 	req := MCPRequest{
 		Jsonrpc: "2.0",
-		ID:      c.nextID(),
+		ID:      id,
 		Method:  "tools/call",
-		Params: map[string]interface{}{
-			"name":      toolName,
-			"arguments": arguments,
-		},
+		Params:  params,
 	}
 
 	var resp MCPResponse
-	if err := c.sendRequest(req, &resp); err != nil {
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	if err := c.sendRequestWithTimeout(req, &resp, timeout); err != nil {
+		if errors.Is(err, errRequestTimeout) {
+			return "", fmt.Errorf("工具 %s 调用超时 (%s): %w", toolName, timeout, err)
+		}
 		return "", err
 	}
 
@@ -205,10 +436,17 @@ func (c *MCPClient) CallTool(toolName string, arguments map[string]interface{})
 	return "", fmt.Errorf("工具返回空结果")
 }
 
-// sendRequest 发送请求并接收响应
-func (c *MCPClient) sendRequest(req MCPRequest, resp *MCPResponse) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// errRequestTimeout 请求等待响应超时
+var errRequestTimeout = errors.New("请求超时")
+
+// defaultRequestTimeout 未指定超时的请求等待响应的最长时间，服务端不响应时不会永久阻塞
+const defaultRequestTimeout = 30 * time.Second
+
+// sendRequestWithTimeout 发送请求并等待对应 ID 的响应，timeout <= 0 时使用 defaultRequestTimeout
+func (c *MCPClient) sendRequestWithTimeout(req MCPRequest, resp *MCPResponse, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
 
 	// 序列化请求
 	reqJSON, err := json.Marshal(req)
@@ -216,34 +454,146 @@ func (c *MCPClient) sendRequest(req MCPRequest, resp *MCPResponse) error {
 		return fmt.Errorf("序列化请求失败: %w", err)
 	}
 
+	// 先登记等待通道，再发送，避免响应先于登记到达
+	ch := make(chan MCPResponse, 1)
+	c.pendingMu.Lock()
+	if c.readErr != nil {
+		err := c.readErr
+		c.pendingMu.Unlock()
+		return fmt.Errorf("MCP 连接已断开: %w", err)
+	}
+	c.pending[req.ID] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, req.ID)
+		c.pendingMu.Unlock()
+	}()
+
 	// 发送请求（以换行符结尾）
-	if _, err := c.stdin.Write(append(reqJSON, '\n')); err != nil {
+	c.mu.Lock()
+	_, err = c.stdin.Write(append(reqJSON, '\n'))
+	c.mu.Unlock()
+	if err != nil {
 		return fmt.Errorf("发送请求失败: %w", err)
 	}
 
-	// 读取响应
-	reader := bufio.NewReader(c.stdout)
-	respLine, err := reader.ReadBytes('\n')
-	if err != nil {
-		return fmt.Errorf("读取响应失败: %w", err)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-ch:
+		*resp = r
+		return nil
+	case <-c.done:
+		return fmt.Errorf("读取响应失败: %w", c.readErr)
+	case <-timer.C:
+		return errRequestTimeout
+	}
+}
+
+// readLoop 持续读取 stdout，分发响应与通知
+func (c *MCPClient) readLoop() {
+	var err error
+	for {
+		var line []byte
+		line, err = c.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			c.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
 	}
 
-	// 解析响应
-	if err := json.Unmarshal(respLine, resp); err != nil {
-		return fmt.Errorf("解析响应失败: %w", err)
+	if err == io.EOF {
+		err = fmt.Errorf("MCP Server 已关闭输出")
 	}
+	log.Printf("🔌 MCP 读取循环退出: %v", err)
 
-	return nil
+	c.pendingMu.Lock()
+	c.readErr = err
+	c.pendingMu.Unlock()
+	close(c.done)
+}
+
+// dispatch 处理一条来自服务端的消息
+func (c *MCPClient) dispatch(line []byte) {
+	var msg mcpMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		log.Printf("⚠️  无法解析 MCP 消息: %v, 内容: %s", err, string(line))
+		return
+	}
+
+	switch {
+	case msg.Method != "" && msg.ID == nil:
+		// 通知
+		c.handleNotification(msg.Method, msg.Params)
+	case msg.Method != "":
+		// 服务端发起的请求
+		c.handleServerRequest(*msg.ID, msg.Method)
+	case msg.ID != nil:
+		// 响应
+		c.pendingMu.Lock()
+		ch, ok := c.pending[*msg.ID]
+		c.pendingMu.Unlock()
+		if !ok {
+			log.Printf("⚠️  收到未知或已超时请求的响应 (ID: %d)", *msg.ID)
+			return
+		}
+		select {
+		case ch <- MCPResponse{Jsonrpc: msg.Jsonrpc, ID: *msg.ID, Result: msg.Result, Error: msg.Error}:
+		default:
+			log.Printf("⚠️  收到重复的响应 (ID: %d)", *msg.ID)
+		}
+	default:
+		log.Printf("⚠️  忽略无法识别的 MCP 消息: %s", string(line))
+	}
+}
+
+// registerProgress 注册进度回调
+func (c *MCPClient) registerProgress(token string, onProgress ProgressFunc) {
+	c.pendingMu.Lock()
+	c.progress[token] = onProgress
+	c.pendingMu.Unlock()
+}
+
+// unregisterProgress 注销进度回调
+func (c *MCPClient) unregisterProgress(token string) {
+	c.pendingMu.Lock()
+	delete(c.progress, token)
+	c.pendingMu.Unlock()
+}
+
+// Alive 判断与 MCP Server 的连接是否仍然可用（读取循环未退出）
+func (c *MCPClient) Alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
 }
 
 // nextID 生成下一个消息 ID
 func (c *MCPClient) nextID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.msgID++
 	return c.msgID
 }
 
-// Close 关闭 MCP 客户端
+// closeTimeout 关闭时等待 MCP Server 自行退出的时间，超时后强制结束进程
+const closeTimeout = 5 * time.Second
+
+// Close 关闭 MCP 客户端，等待读取 stdout/stderr 的 goroutine 退出（可重复调用）
 func (c *MCPClient) Close() error {
+	c.closeOnce.Do(c.close)
+	return nil
+}
+
+// close 关闭 stdin 通知 server 退出；超时未退出时强制结束进程，保证后台 goroutine 都能返回
+func (c *MCPClient) close() {
 	log.Println("🔌 关闭 MCP Client...")
 
 	// 关闭 stdin（通知 server 退出）
@@ -251,28 +601,50 @@ func (c *MCPClient) Close() error {
 		c.stdin.Close()
 	}
 
-	// 等待进程结束
+	// 进程退出后 stdout/stderr 会收到 EOF，读取循环和日志 goroutine 随之返回
+	exited := make(chan struct{})
+	go func() {
+		<-c.done
+		<-c.stderrDone
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(closeTimeout):
+		log.Printf("⚠️  MCP Server 未在 %s 内退出，强制结束", closeTimeout)
+		if c.cmd != nil && c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		<-exited
+	}
+
+	// 回收进程（须在管道读取结束后调用）
 	if c.cmd != nil && c.cmd.Process != nil {
 		if err := c.cmd.Wait(); err != nil {
 			log.Printf("⚠️  MCP Server 退出异常: %v", err)
 		}
 	}
-
-	return nil
 }
 
 // 启动 MCP Client（全局单例）
 var globalMCPClient *MCPClient
 
-// InitMCPClient 初始化全局 MCP 客户端
+// InitMCPClient 初始化全局 MCP 客户端：配置了 MCP_SERVER_COMMAND 时直接运行该命令（按空格分隔参数），
+// 否则用 python3 运行 MCP_SERVER_PATH
 func InitMCPClient() error {
-	// 确定 MCP Server 路径
-	mcpServerPath := os.Getenv("MCP_SERVER_PATH")
-	if mcpServerPath == "" {
-		mcpServerPath = "/root/mcp-server/server.py"
+	var client *MCPClient
+	var err error
+	if command := strings.Fields(os.Getenv("MCP_SERVER_COMMAND")); len(command) > 0 {
+		client, err = NewMCPClientCommand(command[0], command[1:]...)
+	} else {
+		// 确定 MCP Server 路径
+		mcpServerPath := os.Getenv("MCP_SERVER_PATH")
+		if mcpServerPath == "" {
+			mcpServerPath = "/root/mcp-server/server.py"
+		}
+		client, err = NewMCPClient(mcpServerPath)
 	}
-
-	client, err := NewMCPClient(mcpServerPath)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,187 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeServerPath 测试前编译出的 cmd/fake-mcp-server
+var fakeServerPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fake-mcp-server")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建临时目录失败: %v\n", err)
+		os.Exit(1)
+	}
+	fakeServerPath = filepath.Join(dir, "fake-mcp-server")
+
+	build := exec.Command("go", "build", "-o", fakeServerPath, "go-ai-service/cmd/fake-mcp-server")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "编译 fake-mcp-server 失败: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	// 客户端和 fake server 的 stderr 日志很多，测试中不输出
+	log.SetOutput(io.Discard)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startFakeServer 按 env 设置环境变量后启动 fake-mcp-server，返回已完成初始化的客户端（测试结束时关闭）
+func startFakeServer(t *testing.T, env map[string]string) *MCPClient {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	client, err := NewMCPClientCommand(fakeServerPath)
+	if err != nil {
+		t.Fatalf("启动 fake-mcp-server 失败: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// useGlobalClient 让 ToolExecutor 在测试期间使用 client
+func useGlobalClient(t *testing.T, client *MCPClient) {
+	t.Helper()
+	previous := globalMCPClient
+	globalMCPClient = client
+	t.Cleanup(func() { globalMCPClient = previous })
+}
+
+func TestListTools(t *testing.T) {
+	client := startFakeServer(t, nil)
+
+	tools, err := client.ListTools()
+	if err != nil {
+		t.Fatalf("ListTools 失败: %v", err)
+	}
+	want := []string{"search_product", "create_order", "query_order", "cancel_order"}
+	if fmt.Sprint(tools) != fmt.Sprint(want) {
+		t.Errorf("ListTools = %v, want %v", tools, want)
+	}
+}
+
+func TestListToolsTimesOutWhenServerNeverReplies(t *testing.T) {
+	client := startFakeServer(t, map[string]string{"FAKE_MCP_SILENT_METHODS": "tools/list"})
+
+	start := time.Now()
+	_, err := client.ListToolsWithTimeout(200 * time.Millisecond)
+	if !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("ListToolsWithTimeout error = %v, want errRequestTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("超时后过了 %s 才返回", elapsed)
+	}
+	if !client.Alive() {
+		t.Error("请求超时后连接不应断开")
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	policies := ApplyToolOverrides(DefaultToolPolicies(),
+		map[string]time.Duration{"search_product": 2 * time.Second, "custom_tool": 7 * time.Second},
+		map[string]int{"query_order": 4, "create_order": 3})
+	executor := NewToolExecutor("http://shop.test", policies)
+
+	tests := []struct {
+		tool        string
+		wantTimeout time.Duration
+		wantRetries int
+	}{
+		{"search_product", 2 * time.Second, 2},
+		{"query_order", 10 * time.Second, 4},
+		{"list_orders", 10 * time.Second, 2},
+		{"create_order", 30 * time.Second, 0}, // 非幂等工具的重试配置被忽略
+		{"cancel_order", 15 * time.Second, 0},
+		{"custom_tool", 7 * time.Second, 0}, // 未知工具视为非幂等
+		{"unknown_tool", defaultToolPolicy.Timeout, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			policy := executor.policyFor(tt.tool)
+			if policy.Timeout != tt.wantTimeout || policy.MaxRetries != tt.wantRetries {
+				t.Errorf("policyFor(%s) = %+v, want timeout %s retries %d", tt.tool, policy, tt.wantTimeout, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestExecuteRetriesOnlyIdempotentTools(t *testing.T) {
+	client := startFakeServer(t, nil) // query_order 默认 1 分钟后才响应
+	useGlobalClient(t, client)
+
+	const timeout = 100 * time.Millisecond
+	executor := NewToolExecutor("http://shop.test", map[string]ToolPolicy{
+		"query_order": {Timeout: timeout, MaxRetries: 2},
+	})
+
+	start := time.Now()
+	_, err := executor.Execute("query_order", `{"orderNumber":"ORD-1"}`)
+	elapsed := time.Since(start)
+	if !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("Execute error = %v, want errRequestTimeout", err)
+	}
+	// 首次调用加 2 次重试，每次都等满超时
+	if elapsed < 3*timeout {
+		t.Errorf("耗时 %s，少于 3 次调用的超时之和，说明没有按策略重试", elapsed)
+	}
+}
+
+func TestCloseWaitsForBackgroundGoroutines(t *testing.T) {
+	client := startFakeServer(t, nil)
+
+	// query_order 默认 1 分钟后才响应，关闭时应立即以连接断开结束
+	callErr := make(chan error, 1)
+	go func() {
+		_, err := client.CallToolWithTimeout("query_order", map[string]interface{}{"orderNumber": "ORD-1"}, time.Minute)
+		callErr <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	client.Close()
+	if elapsed := time.Since(start); elapsed >= closeTimeout {
+		t.Errorf("Close 耗时 %s，fake server 应在关闭 stdin 后自行退出", elapsed)
+	}
+
+	// Close 返回时读取循环、stderr 日志 goroutine 和进程都已结束
+	for name, ch := range map[string]chan struct{}{"读取循环": client.done, "stderr 日志": client.stderrDone} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("Close 返回时%s goroutine 仍在运行", name)
+		}
+	}
+	if client.cmd.ProcessState == nil {
+		t.Error("Close 返回时 MCP Server 进程尚未回收")
+	}
+	if client.Alive() {
+		t.Error("Close 之后 Alive 应返回 false")
+	}
+
+	select {
+	case err := <-callErr:
+		if err == nil || errors.Is(err, errRequestTimeout) {
+			t.Errorf("进行中的调用 error = %v, want 连接断开", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close 之后进行中的调用没有返回")
+	}
+
+	// 重复关闭不阻塞
+	if err := client.Close(); err != nil {
+		t.Errorf("重复 Close 返回 %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DryRunResultPrefix 模拟执行结果的开头标记
+const DryRunResultPrefix = "🧪 模拟执行"
+
+// DryRun 返回模拟执行的执行器：修改订单的工具只校验参数并返回模拟结果，不调用 MCP Server 或 Java 商城；
+// 只读工具照常执行（查询不会修改数据，取消订单等流程需要真实的查询结果才能继续）
+func (e *ToolExecutor) DryRun() *ToolExecutor {
+	dry := &ToolExecutor{
+		javaShopURL: e.javaShopURL,
+		policies:    e.policies,
+		shop:        e.shop,
+		cache:       e.cache,
+		dryRun:      true,
+	}
+	dry.SetMode(e.Mode())
+	return dry
+}
+
+// simulate 描述将要执行的工具调用，作为模拟执行的结果返回
+func simulate(toolName string, args map[string]interface{}) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%v", args))
+	}
+	return fmt.Sprintf("%s：未实际调用 %s（不会修改订单数据）\n参数：%s", DryRunResultPrefix, toolName, data)
+}
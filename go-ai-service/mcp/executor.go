@@ -1,45 +1,313 @@
-﻿package mcp
+package mcp
 
 import (
-"encoding/json"
-"fmt"
-"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ai-service/tracing"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// ToolPolicy 单个工具的超时与重试策略
+type ToolPolicy struct {
+	Timeout    time.Duration // 单次调用超时
+	MaxRetries int           // 失败后的最大重试次数（仅对幂等工具生效）
+}
+
+// defaultToolPolicy 未单独配置的工具使用的策略
+var defaultToolPolicy = ToolPolicy{Timeout: 15 * time.Second, MaxRetries: 0}
+
+// idempotentTools 可安全重试的只读工具
+var idempotentTools = map[string]bool{
+	"search_product": true,
+	"query_order":    true,
+	"list_orders":    true,
+	"track_shipment": true,
+}
+
+// fallbackTools MCP 不可用时可直接调用 Java 商城接口的只读工具（修改订单的工具不降级）
+var fallbackTools = map[string]bool{
+	"search_product": true,
+	"query_order":    true,
+	"list_orders":    true,
+}
+
+// DefaultToolPolicies 默认的工具策略
+//   - search_product: 5s 超时，重试 2 次
+//   - query_order:    10s 超时，重试 2 次
+//   - list_orders:    10s 超时，重试 2 次
+//   - track_shipment: 10s 超时，重试 2 次
+//   - create_order:   30s 超时，不重试（避免重复下单）
+//   - cancel_order:   15s 超时，不重试
+func DefaultToolPolicies() map[string]ToolPolicy {
+	return map[string]ToolPolicy{
+		"search_product": {Timeout: 5 * time.Second, MaxRetries: 2},
+		"query_order":    {Timeout: 10 * time.Second, MaxRetries: 2},
+		"list_orders":    {Timeout: 10 * time.Second, MaxRetries: 2},
+		"track_shipment": {Timeout: 10 * time.Second, MaxRetries: 2},
+		"create_order":   {Timeout: 30 * time.Second, MaxRetries: 0},
+		"cancel_order":   {Timeout: 15 * time.Second, MaxRetries: 0},
+	}
+}
+
+// ApplyToolOverrides 用配置中的超时/重试覆盖工具策略
+func ApplyToolOverrides(policies map[string]ToolPolicy, timeouts map[string]time.Duration, retries map[string]int) map[string]ToolPolicy {
+	for name, timeout := range timeouts {
+		policy, ok := policies[name]
+		if !ok {
+			policy = defaultToolPolicy
+		}
+		policy.Timeout = timeout
+		policies[name] = policy
+	}
+	for name, maxRetries := range retries {
+		policy, ok := policies[name]
+		if !ok {
+			policy = defaultToolPolicy
+		}
+		if maxRetries > 0 && !idempotentTools[name] {
+			log.Printf("⚠️  工具 %s 不是幂等操作，忽略重试配置", name)
+			maxRetries = 0
+		}
+		policy.MaxRetries = maxRetries
+		policies[name] = policy
+	}
+	return policies
+}
+
 // ToolExecutor 工具执行器（通过 MCP Client）
 type ToolExecutor struct {
-javaShopURL string
+	javaShopURL string
+	policies    map[string]ToolPolicy
+	shop        *JavaShopClient  // MCP 不可用时只读工具的降级通道
+	cache       *toolResultCache // 只读工具结果缓存（为空表示未启用）
+	mode        atomic.Value     // 工具安全模式（ToolMode），可在运行期间切换
+	dryRun      bool             // 模拟执行修改订单的工具（见 DryRun）
+}
+
+// NewToolExecutor 创建新的工具执行器，policies 为空时使用默认策略
+func NewToolExecutor(javaShopURL string, policies map[string]ToolPolicy) *ToolExecutor {
+	if policies == nil {
+		policies = DefaultToolPolicies()
+	}
+	return &ToolExecutor{
+		javaShopURL: javaShopURL,
+		policies:    policies,
+		shop:        NewJavaShopClient(javaShopURL, nil),
+	}
 }
 
-// NewToolExecutor 创建新的工具执行器
-func NewToolExecutor(javaShopURL string) *ToolExecutor {
-return &ToolExecutor{
-javaShopURL: javaShopURL,
+// EnableResultCache 启用只读工具的结果缓存，ttl 内相同工具和参数的调用直接返回缓存结果
+func (e *ToolExecutor) EnableResultCache(ttl time.Duration) {
+	if ttl > 0 {
+		e.cache = newToolResultCache(ttl)
+	}
 }
+
+// policyFor 获取工具策略，非幂等工具强制不重试
+func (e *ToolExecutor) policyFor(toolName string) ToolPolicy {
+	policy, ok := e.policies[toolName]
+	if !ok {
+		policy = defaultToolPolicy
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultToolPolicy.Timeout
+	}
+	if !idempotentTools[toolName] || policy.MaxRetries < 0 {
+		policy.MaxRetries = 0
+	}
+	return policy
 }
 
 // Execute 执行工具调用 - 通过 MCP Client
 func (e *ToolExecutor) Execute(toolName string, arguments string) (string, error) {
-log.Printf(" 执行工具: %s, 参数: %s", toolName, arguments)
+	return e.ExecuteWithProgress(toolName, arguments, nil)
+}
 
-// 使用 MCP Client 调用工具
-mcpClient := GetMCPClient()
-if mcpClient == nil {
-return "", fmt.Errorf("MCP Client 未初始化")
+// ExecuteWithProgress 执行工具调用，并将工具上报的进度转发给 onProgress
+func (e *ToolExecutor) ExecuteWithProgress(toolName string, arguments string, onProgress ProgressFunc) (string, error) {
+	return e.ExecuteTraced(nil, toolName, arguments, onProgress)
 }
 
-// 解析参数
-var args map[string]interface{}
-if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-return "", fmt.Errorf("参数格式错误: %w", err)
+// ExecuteTraced 执行工具调用并记录为 parent 的子 span，trace 上下文通过 MCP _meta 传递给 MCP Server
+func (e *ToolExecutor) ExecuteTraced(parent *tracing.Span, toolName string, arguments string, onProgress ProgressFunc) (result string, err error) {
+	log.Printf(" 执行工具: %s, 参数: %s", toolName, arguments)
+
+	start := time.Now()
+	span := parent.Child("tool.execute", tracing.KindClient)
+	span.SetAttribute("tool.name", toolName)
+	defer func() {
+		log.Printf("⏱️  工具 %s 执行耗时 %dms", toolName, time.Since(start).Milliseconds())
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// 安全模式下拦截工具，直接返回维护提示
+	if reply, blocked := e.blockedReply(toolName); blocked {
+		log.Printf("🚧 工具模式为 %s，拦截工具调用: %s", e.Mode(), toolName)
+		span.SetAttribute("tool.blocked", true)
+		return reply, nil
+	}
+
+	// 解析参数
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return "", fmt.Errorf("参数格式错误: %w", err)
+	}
+	// 按工具定义校验并转换参数类型（电话号码始终为字符串、数量始终为整数）后再调用
+	if err := CoerceArguments(toolName, args); err != nil {
+		return "", fmt.Errorf("参数格式错误: %w", err)
+	}
+
+	// 模拟执行：修改订单的工具不实际调用，返回将要执行的调用
+	if e.dryRun && !idempotentTools[toolName] {
+		log.Printf("🧪 模拟执行工具: %s", toolName)
+		span.SetAttribute("tool.dry_run", true)
+		return simulate(toolName, args), nil
+	}
+
+	policy := e.policyFor(toolName)
+
+	// 只读工具优先返回缓存结果；修改订单的工具从不缓存，执行后清空缓存避免返回过期的订单状态
+	var cacheKey string
+	cacheable := false
+	if e.cache != nil && idempotentTools[toolName] {
+		cacheKey, cacheable = toolCacheKey(toolName, args)
+	}
+	if cacheable {
+		if cached, ok := e.cache.Get(cacheKey); ok {
+			log.Printf("⚡ 命中工具缓存: %s", toolName)
+			span.SetAttribute("tool.cache_hit", true)
+			return cached, nil
+		}
+	}
+	defer func() {
+		if !idempotentTools[toolName] {
+			e.cache.Clear()
+			return
+		}
+		if cacheable && err == nil && !strings.HasPrefix(result, "❌") {
+			e.cache.Set(cacheKey, result)
+		}
+	}()
+
+	// 使用 MCP Client 调用工具，MCP 不可用时只读工具直接调用 Java 商城
+	mcpClient := GetMCPClient()
+	if mcpClient == nil || !mcpClient.Alive() {
+		if fallbackTools[toolName] {
+			log.Printf("⚠️  MCP 不可用，工具 %s 降级为直接调用 Java 商城", toolName)
+			span.SetAttribute("tool.fallback", true)
+			return e.executeFallback(toolName, args, policy.Timeout, span.Traceparent())
+		}
+		return "", fmt.Errorf("MCP Client 不可用")
+	}
+
+	// 调用 MCP 工具（幂等工具失败后按策略重试）
+	var lastErr error
+	for attempt := 0; attempt <= policy.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("🔁 重试工具 %s（第 %d/%d 次）", toolName, attempt, policy.MaxRetries)
+		}
+		span.SetAttribute("tool.attempts", attempt+1)
+
+		result, err := mcpClient.CallToolTraced(toolName, args, policy.Timeout, onProgress, span.Traceparent())
+		if err == nil {
+			log.Printf(" 工具执行成功")
+			return result, nil
+		}
+
+		lastErr = err
+		log.Printf("⚠️  工具 %s 调用失败: %v", toolName, err)
+
+		// 调用过程中 MCP 连接断开：只读工具改走 Java 商城，不再重试 MCP
+		if !mcpClient.Alive() && fallbackTools[toolName] {
+			log.Printf("⚠️  MCP 连接已断开，工具 %s 降级为直接调用 Java 商城", toolName)
+			span.SetAttribute("tool.fallback", true)
+			return e.executeFallback(toolName, args, policy.Timeout, span.Traceparent())
+		}
+	}
+
+	return "", fmt.Errorf("工具调用失败: %w", lastErr)
 }
 
-// 调用 MCP 工具
-result, err := mcpClient.CallTool(toolName, args)
-if err != nil {
-return "", fmt.Errorf("工具调用失败: %w", err)
+// executeFallback 直接调用 Java 商城接口执行只读工具，结果格式与 MCP Server 保持一致，traceparent 随请求头传给 Java 商城
+func (e *ToolExecutor) executeFallback(toolName string, args map[string]interface{}, timeout time.Duration, traceparent string) (string, error) {
+	switch toolName {
+	case "search_product":
+		keyword, _ := args["keyword"].(string)
+		products, err := e.shop.SearchProducts(keyword, timeout, traceparent)
+		if err != nil {
+			return "", fmt.Errorf("工具调用失败: %w", err)
+		}
+		if len(products) == 0 {
+			return fmt.Sprintf("❌ 未找到与 '%s' 相关的商品", keyword), nil
+		}
+		// 返回 JSON 商品列表，由回复格式化逻辑渲染
+		data, err := json.Marshal(products)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+
+	case "query_order":
+		orderNumber, _ := args["orderNumber"].(string)
+		if orderNumber == "" {
+			orders, err := e.shop.ListOrders(timeout, traceparent)
+			if err != nil {
+				return "", fmt.Errorf("工具调用失败: %w", err)
+			}
+			return formatShopOrders(orders), nil
+		}
+
+		order, err := e.shop.GetOrder(orderNumber, timeout, traceparent)
+		if errors.Is(err, errOrderNotFound) {
+			return fmt.Sprintf("❌ 未找到订单：%s", orderNumber), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("工具调用失败: %w", err)
+		}
+		// 返回 JSON 订单，由回复格式化逻辑渲染
+		data, err := json.Marshal(order)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+
+	case "list_orders":
+		query, err := parseOrderListQuery(args)
+		if err != nil {
+			return "❌ " + err.Error(), nil
+		}
+		orders, err := e.shop.ListOrders(timeout, traceparent)
+		if err != nil {
+			return "", fmt.Errorf("工具调用失败: %w", err)
+		}
+		return formatOrderListPage(orders, query), nil
+	}
+
+	return "", fmt.Errorf("工具 %s 不支持降级调用", toolName)
 }
 
-log.Printf(" 工具执行成功")
-return result, nil
+// formatShopOrders 订单列表文本
+func formatShopOrders(orders []ShopOrder) string {
+	if len(orders) == 0 {
+		return "📋 暂无订单记录"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📋 共有 %d 个订单：\n\n", len(orders)))
+	for _, order := range orders {
+		sb.WriteString(fmt.Sprintf("订单号：%s\n", order.OrderNumber))
+		if order.Product != nil {
+			sb.WriteString(fmt.Sprintf("商品：%s\n", order.Product.Name))
+		}
+		sb.WriteString(fmt.Sprintf("数量：%d\n", order.Quantity))
+		sb.WriteString(fmt.Sprintf("客户：%s\n", order.CustomerName))
+		sb.WriteString(fmt.Sprintf("状态：%s\n", order.Status))
+		sb.WriteString("---\n")
+	}
+	return sb.String()
 }
@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecuteAgainstFakeServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		tool      string
+		arguments string
+		timeout   time.Duration
+		want      string // 结果中应包含的内容
+		wantErr   string // 错误中应包含的内容
+		timedOut  bool
+	}{
+		{
+			name:      "搜索商品成功",
+			tool:      "search_product",
+			arguments: `{"keyword":"山地车"}`,
+			want:      `"name":"山地车"`,
+		},
+		{
+			name:      "创建订单成功",
+			tool:      "create_order",
+			arguments: `{"productName":"山地车","quantity":"2","customerName":"张三","customerPhone":"13800138000","shippingAddress":"北京市朝阳区"}`,
+			want:      "订单号：ORD-FAKE-0001",
+		},
+		{
+			name:      "取消订单返回错误",
+			tool:      "cancel_order",
+			arguments: `{"orderNumber":"ORD-1"}`,
+			wantErr:   "模拟的服务端错误",
+		},
+		{
+			name:      "查询订单不响应时超时",
+			tool:      "query_order",
+			arguments: `{"orderNumber":"ORD-1"}`,
+			timeout:   200 * time.Millisecond,
+			timedOut:  true,
+		},
+		{
+			name:      "查询订单在超时前响应",
+			env:       map[string]string{"FAKE_MCP_SLOW_DELAY": "50ms"},
+			tool:      "query_order",
+			arguments: `{"orderNumber":"ORD-1"}`,
+			timeout:   5 * time.Second,
+			want:      "订单号：ORD-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := startFakeServer(t, tt.env)
+			useGlobalClient(t, client)
+
+			// 商城地址不可用，调用结果只能来自 fake server
+			policies := DefaultToolPolicies()
+			if tt.timeout > 0 {
+				policies[tt.tool] = ToolPolicy{Timeout: tt.timeout}
+			}
+			executor := NewToolExecutor("http://127.0.0.1:1", policies)
+
+			start := time.Now()
+			result, err := executor.Execute(tt.tool, tt.arguments)
+			elapsed := time.Since(start)
+
+			switch {
+			case tt.timedOut:
+				if !errors.Is(err, errRequestTimeout) {
+					t.Fatalf("Execute error = %v, want errRequestTimeout", err)
+				}
+				if elapsed > 2*time.Second {
+					t.Errorf("超时后过了 %s 才返回", elapsed)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute error = %v, want 包含 %q", err, tt.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Execute 失败: %v", err)
+				}
+				if !strings.Contains(result, tt.want) {
+					t.Errorf("Execute = %q, want 包含 %q", result, tt.want)
+				}
+			}
+			if !client.Alive() {
+				t.Error("工具调用之后连接不应断开")
+			}
+		})
+	}
+}
+
+func TestToolHealthAgainstFakeServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		required    map[string]bool
+		wantHealthy bool
+		wantMissing []string
+	}{
+		{"必需工具齐全", map[string]bool{"search_product": true, "create_order": true}, true, nil},
+		{"缺少必需工具", map[string]bool{"search_product": true, "list_orders": true}, false, []string{"list_orders"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useGlobalClient(t, startFakeServer(t, nil))
+
+			health := NewToolHealthChecker(tt.required, time.Minute).Check()
+			if health.Healthy != tt.wantHealthy || strings.Join(health.Missing, ",") != strings.Join(tt.wantMissing, ",") {
+				t.Errorf("Check() = %+v, want healthy %v missing %v", health, tt.wantHealthy, tt.wantMissing)
+			}
+		})
+	}
+}
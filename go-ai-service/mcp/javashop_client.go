@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errOrderNotFound Java 商城中不存在该订单
+var errOrderNotFound = errors.New("订单不存在")
+
+// ShopProduct Java 商城商品
+type ShopProduct struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Price       float64 `json:"price"`
+	Stock       int     `json:"stock"`
+	Category    string  `json:"category,omitempty"`
+}
+
+// ShopOrder Java 商城订单
+type ShopOrder struct {
+	OrderNumber     string       `json:"orderNumber"`
+	Product         *ShopProduct `json:"product,omitempty"`
+	Quantity        int          `json:"quantity"`
+	TotalPrice      float64      `json:"totalPrice"`
+	CustomerName    string       `json:"customerName"`
+	CustomerPhone   string       `json:"customerPhone"`
+	ShippingAddress string       `json:"shippingAddress"`
+	Status          string       `json:"status"`
+
+	CreatedAt         string `json:"createdAt,omitempty"`
+	TrackingNumber    string `json:"trackingNumber,omitempty"`
+	EstimatedDelivery string `json:"estimatedDelivery,omitempty"`
+	CancelReason      string `json:"cancelReason,omitempty"`
+}
+
+// JavaShopClient 直接调用 Java 商城 REST 接口的只读客户端（MCP 不可用时的降级通道）
+type JavaShopClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewJavaShopClient 创建 Java 商城客户端，httpClient 为空时使用默认客户端
+func NewJavaShopClient(baseURL string, httpClient *http.Client) *JavaShopClient {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &JavaShopClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// SearchProducts 按关键词搜索商品（GET /api/products/search），traceparent 不为空时作为请求头传给 Java 商城
+func (c *JavaShopClient) SearchProducts(keyword string, timeout time.Duration, traceparent string) ([]ShopProduct, error) {
+	var products []ShopProduct
+	path := "/api/products/search?keyword=" + url.QueryEscape(keyword)
+	if err := c.getJSON(path, timeout, traceparent, &products); err != nil {
+		return nil, fmt.Errorf("搜索商品失败: %w", err)
+	}
+	return products, nil
+}
+
+// GetOrder 按订单号查询订单（GET /api/orders/{orderNumber}）
+func (c *JavaShopClient) GetOrder(orderNumber string, timeout time.Duration, traceparent string) (*ShopOrder, error) {
+	var order ShopOrder
+	if err := c.getJSON("/api/orders/"+url.PathEscape(orderNumber), timeout, traceparent, &order); err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	return &order, nil
+}
+
+// ListOrders 查询全部订单（GET /api/orders）
+func (c *JavaShopClient) ListOrders(timeout time.Duration, traceparent string) ([]ShopOrder, error) {
+	var orders []ShopOrder
+	if err := c.getJSON("/api/orders", timeout, traceparent, &orders); err != nil {
+		return nil, fmt.Errorf("查询订单失败: %w", err)
+	}
+	return orders, nil
+}
+
+// getJSON 发送 GET 请求并解析 JSON 响应，404 返回 errOrderNotFound
+func (c *JavaShopClient) getJSON(path string, timeout time.Duration, traceparent string, out interface{}) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if traceparent != "" {
+		req.Header.Set("traceparent", traceparent)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errOrderNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,126 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// NotificationHandler 服务端通知处理器（params 为通知的原始参数）
+type NotificationHandler func(params json.RawMessage)
+
+// JSON-RPC 标准错误码：方法不存在
+const jsonRPCMethodNotFound = -32601
+
+// RegisterNotificationHandler 注册指定方法的通知处理器，同名处理器会被替换
+func (c *MCPClient) RegisterNotificationHandler(method string, handler NotificationHandler) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if c.notifiers == nil {
+		c.notifiers = make(map[string]NotificationHandler)
+	}
+	c.notifiers[method] = handler
+}
+
+// registerBuiltinNotifications 注册内置通知处理器：进度与日志
+func (c *MCPClient) registerBuiltinNotifications() {
+	c.RegisterNotificationHandler("notifications/progress", c.handleProgressNotification)
+	c.RegisterNotificationHandler("notifications/message", handleLogNotification)
+}
+
+// handleNotification 将服务端通知分发给已注册的处理器，未注册的通知记录后忽略
+func (c *MCPClient) handleNotification(method string, params json.RawMessage) {
+	c.pendingMu.Lock()
+	handler, ok := c.notifiers[method]
+	c.pendingMu.Unlock()
+	if !ok {
+		log.Printf("📨 忽略 MCP 通知: %s", method)
+		return
+	}
+
+	handler(params)
+}
+
+// handleProgressNotification 将进度通知转发给对应 progressToken 的回调
+func (c *MCPClient) handleProgressNotification(params json.RawMessage) {
+	var progress struct {
+		ProgressToken interface{} `json:"progressToken"`
+		MCPProgress
+	}
+	if err := json.Unmarshal(params, &progress); err != nil {
+		log.Printf("⚠️  无法解析进度通知: %v", err)
+		return
+	}
+
+	token := fmt.Sprint(progress.ProgressToken)
+	c.pendingMu.Lock()
+	onProgress, ok := c.progress[token]
+	c.pendingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	onProgress(progress.MCPProgress)
+}
+
+// handleLogNotification 输出服务端日志通知（notifications/message）
+func handleLogNotification(params json.RawMessage) {
+	var message struct {
+		Level  string          `json:"level"`
+		Logger string          `json:"logger"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(params, &message); err != nil {
+		log.Printf("⚠️  无法解析日志通知: %v", err)
+		return
+	}
+
+	// data 为字符串时直接输出内容，其他类型输出 JSON
+	var text string
+	if err := json.Unmarshal(message.Data, &text); err != nil {
+		text = string(message.Data)
+	}
+
+	if message.Logger != "" {
+		log.Printf("[MCP Server][%s][%s] %s", message.Level, message.Logger, text)
+	} else {
+		log.Printf("[MCP Server][%s] %s", message.Level, text)
+	}
+}
+
+// handleServerRequest 响应服务端发起的请求：支持 ping，其余返回"方法不存在"
+func (c *MCPClient) handleServerRequest(id int, method string) {
+	var err error
+	if method == "ping" {
+		err = c.sendResponse(id, struct{}{}, nil)
+	} else {
+		log.Printf("⚠️  不支持的服务端请求: %s (ID: %d)", method, id)
+		err = c.sendResponse(id, nil, &MCPError{Code: jsonRPCMethodNotFound, Message: "Method not found: " + method})
+	}
+	if err != nil {
+		log.Printf("⚠️  响应服务端请求失败: %v", err)
+	}
+}
+
+// sendResponse 向服务端发送响应（result 与 rpcErr 二选一）
+func (c *MCPClient) sendResponse(id int, result interface{}, rpcErr *MCPError) error {
+	response := struct {
+		Jsonrpc string      `json:"jsonrpc"`
+		ID      int         `json:"id"`
+		Result  interface{} `json:"result,omitempty"`
+		Error   *MCPError   `json:"error,omitempty"`
+	}{Jsonrpc: "2.0", ID: id, Result: result, Error: rpcErr}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("序列化响应失败: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("发送响应失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// orderListQuery list_orders 的筛选与分页条件
+type orderListQuery struct {
+	CustomerPhone string
+	StartDate     string // YYYY-MM-DD（含），为空表示不限制
+	EndDate       string // YYYY-MM-DD（含），为空表示不限制
+	Statuses      map[string]bool
+	Page          int
+	PageSize      int
+}
+
+// parseOrderListQuery 从（已按工具定义转换类型的）参数中读取筛选与分页条件，日期格式错误时返回错误
+func parseOrderListQuery(args map[string]interface{}) (orderListQuery, error) {
+	query := orderListQuery{Page: 1, PageSize: DefaultOrderPageSize}
+	query.CustomerPhone, _ = args["customerPhone"].(string)
+	query.StartDate, _ = args["startDate"].(string)
+	query.EndDate, _ = args["endDate"].(string)
+	for _, date := range []string{query.StartDate, query.EndDate} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return query, fmt.Errorf("日期格式错误：%s，应为 YYYY-MM-DD", date)
+		}
+	}
+
+	if statuses, ok := args["status"].([]string); ok && len(statuses) > 0 {
+		query.Statuses = make(map[string]bool, len(statuses))
+		for _, status := range statuses {
+			query.Statuses[strings.ToUpper(status)] = true
+		}
+	}
+	if page, ok := args["page"].(int); ok && page > 1 {
+		query.Page = page
+	}
+	if pageSize, ok := args["pageSize"].(int); ok && pageSize > 0 {
+		query.PageSize = pageSize
+	}
+	if query.PageSize > MaxOrderPageSize {
+		query.PageSize = MaxOrderPageSize
+	}
+	return query, nil
+}
+
+// matches 判断订单是否满足筛选条件（下单时间为 ISO 格式，按前 10 位比较日期）
+func (q orderListQuery) matches(order ShopOrder) bool {
+	if order.CustomerPhone != q.CustomerPhone {
+		return false
+	}
+	createdDate := order.CreatedAt
+	if len(createdDate) > 10 {
+		createdDate = createdDate[:10]
+	}
+	if q.StartDate != "" && createdDate < q.StartDate {
+		return false
+	}
+	if q.EndDate != "" && createdDate > q.EndDate {
+		return false
+	}
+	return len(q.Statuses) == 0 || q.Statuses[strings.ToUpper(order.Status)]
+}
+
+// formatOrderListPage 筛选、排序（按下单时间倒序）并分页，输出与 MCP Server 的 list_orders 相同格式的文本
+func formatOrderListPage(orders []ShopOrder, query orderListQuery) string {
+	var matched []ShopOrder
+	for _, order := range orders {
+		if query.matches(order) {
+			matched = append(matched, order)
+		}
+	}
+	if len(matched) == 0 {
+		return "📋 暂无订单记录"
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].CreatedAt > matched[j].CreatedAt
+	})
+
+	total := len(matched)
+	pages := (total + query.PageSize - 1) / query.PageSize
+	start := (query.Page - 1) * query.PageSize
+	if start >= total {
+		return fmt.Sprintf("📋 共有 %d 个订单，第 %d/%d 页没有订单", total, query.Page, pages)
+	}
+	end := start + query.PageSize
+	if end > total {
+		end = total
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📋 共有 %d 个订单，第 %d/%d 页：\n\n", total, query.Page, pages))
+	for _, order := range matched[start:end] {
+		sb.WriteString(fmt.Sprintf("订单号：%s\n", order.OrderNumber))
+		productName := ""
+		if order.Product != nil {
+			productName = order.Product.Name
+		}
+		sb.WriteString(fmt.Sprintf("商品：%s\n", productName))
+		sb.WriteString(fmt.Sprintf("数量：%d\n", order.Quantity))
+		sb.WriteString(fmt.Sprintf("状态：%s\n", order.Status))
+		sb.WriteString(fmt.Sprintf("下单时间：%s\n", order.CreatedAt))
+		sb.WriteString("---\n")
+	}
+	if query.Page < pages {
+		sb.WriteString(fmt.Sprintf("还有 %d 个订单未显示，可查看第 %d 页\n", total-end, query.Page+1))
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToolMode 工具安全模式（故障期间的总开关）
+type ToolMode string
+
+const (
+	ToolModeNormal   ToolMode = "normal"   // 所有工具正常执行
+	ToolModeReadOnly ToolMode = "readonly" // 只允许只读工具，拦截创建/取消订单
+	ToolModeDisabled ToolMode = "disabled" // 拦截所有工具
+)
+
+// 安全模式下拦截工具时返回给用户的提示
+const (
+	createOrderBlockedReply = "下单功能暂时维护中，请稍后再试"
+	mutatingBlockedReply    = "订单修改功能暂时维护中，请稍后再试"
+	toolsDisabledReply      = "订单查询与办理功能暂时维护中，请稍后再试"
+)
+
+// ParseToolMode 解析工具安全模式名称
+func ParseToolMode(value string) (ToolMode, error) {
+	switch mode := ToolMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case ToolModeNormal, ToolModeReadOnly, ToolModeDisabled:
+		return mode, nil
+	}
+	return "", fmt.Errorf("未知的工具模式: %s（可选 normal、readonly、disabled）", value)
+}
+
+// SetMode 切换工具安全模式，运行期间可随时切换
+func (e *ToolExecutor) SetMode(mode ToolMode) {
+	e.mode.Store(mode)
+}
+
+// Mode 当前的工具安全模式
+func (e *ToolExecutor) Mode() ToolMode {
+	if mode, ok := e.mode.Load().(ToolMode); ok {
+		return mode
+	}
+	return ToolModeNormal
+}
+
+// blockedReply 当前模式下工具被拦截时返回提示文本
+func (e *ToolExecutor) blockedReply(toolName string) (string, bool) {
+	switch e.Mode() {
+	case ToolModeDisabled:
+		return toolsDisabledReply, true
+	case ToolModeReadOnly:
+		if idempotentTools[toolName] {
+			return "", false
+		}
+		if toolName == "create_order" {
+			return createOrderBlockedReply, true
+		}
+		return mutatingBlockedReply, true
+	}
+	return "", false
+}
+
+// IsBlockedReply 工具结果是否为安全模式下的拦截提示（工具没有实际执行）
+func IsBlockedReply(result string) bool {
+	switch result {
+	case createOrderBlockedReply, mutatingBlockedReply, toolsDisabledReply:
+		return true
+	}
+	return false
+}
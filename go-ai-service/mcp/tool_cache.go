@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// toolCacheMaxEntries 工具结果缓存的最大条目数，超出时不再写入新结果（直到过期条目被清理）
+const toolCacheMaxEntries = 1000
+
+// toolCacheEntry 缓存的工具结果
+type toolCacheEntry struct {
+	result    string
+	expiresAt time.Time
+}
+
+// toolResultCache 只读工具结果的短时缓存，键为工具名称 + 规范化后的参数
+type toolResultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]toolCacheEntry
+}
+
+// newToolResultCache 创建工具结果缓存
+func newToolResultCache(ttl time.Duration) *toolResultCache {
+	return &toolResultCache{
+		ttl:     ttl,
+		entries: make(map[string]toolCacheEntry),
+	}
+}
+
+// toolCacheKey 生成缓存键：字符串参数去除首尾空白，JSON 序列化时 map 按键排序，参数顺序不影响结果
+func toolCacheKey(toolName string, args map[string]interface{}) (string, bool) {
+	normalized := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		if s, ok := value.(string); ok {
+			value = strings.TrimSpace(s)
+		}
+		normalized[key] = value
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", false
+	}
+	return toolName + ":" + string(data), true
+}
+
+// Get 获取未过期的缓存结果
+func (c *toolResultCache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.result, true
+}
+
+// Set 缓存工具结果
+func (c *toolResultCache) Set(key, result string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= toolCacheMaxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= toolCacheMaxEntries {
+			return
+		}
+	}
+	c.entries[key] = toolCacheEntry{result: result, expiresAt: now.Add(c.ttl)}
+}
+
+// Clear 清空缓存（修改订单后调用，避免返回过期的订单状态）
+func (c *toolResultCache) Clear() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]toolCacheEntry)
+}
@@ -0,0 +1,153 @@
+package mcp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestToolCacheKey(t *testing.T) {
+	base, _ := toolCacheKey("search_product", map[string]interface{}{"keyword": "山地车", "page": 1})
+
+	tests := []struct {
+		name     string
+		tool     string
+		args     map[string]interface{}
+		wantSame bool
+	}{
+		{"相同参数", "search_product", map[string]interface{}{"keyword": "山地车", "page": 1}, true},
+		{"字符串参数首尾空白", "search_product", map[string]interface{}{"keyword": "  山地车\n", "page": 1}, true},
+		{"参数值不同", "search_product", map[string]interface{}{"keyword": "公路车", "page": 1}, false},
+		{"多出参数", "search_product", map[string]interface{}{"keyword": "山地车", "page": 1, "sort": "price"}, false},
+		{"工具不同", "query_order", map[string]interface{}{"keyword": "山地车", "page": 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := toolCacheKey(tt.tool, tt.args)
+			if !ok {
+				t.Fatal("toolCacheKey 返回 false")
+			}
+			if same := key == base; same != tt.wantSame {
+				t.Errorf("toolCacheKey() = %q, 与 %q 相同 = %v, want %v", key, base, same, tt.wantSame)
+			}
+		})
+	}
+
+	if _, ok := toolCacheKey("search_product", map[string]interface{}{"bad": func() {}}); ok {
+		t.Error("无法序列化的参数不应生成缓存键")
+	}
+}
+
+func TestToolResultCache(t *testing.T) {
+	cache := newToolResultCache(50 * time.Millisecond)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("空缓存不应命中")
+	}
+	cache.Set("a", "结果 A")
+	if got, ok := cache.Get("a"); !ok || got != "结果 A" {
+		t.Fatalf("Get(a) = %q, %v, want 结果 A", got, ok)
+	}
+
+	cache.Clear()
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Clear 之后不应命中")
+	}
+
+	cache.Set("b", "结果 B")
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get("b"); ok {
+		t.Error("过期后不应命中")
+	}
+
+	// 未启用缓存时所有操作都是空操作
+	var disabled *toolResultCache
+	disabled.Set("a", "结果 A")
+	disabled.Clear()
+	if _, ok := disabled.Get("a"); ok {
+		t.Error("nil 缓存不应命中")
+	}
+}
+
+func TestToolResultCacheMaxEntries(t *testing.T) {
+	cache := newToolResultCache(time.Minute)
+	for i := 0; i < toolCacheMaxEntries; i++ {
+		cache.Set(strings.Repeat("k", i+1), "v")
+	}
+	cache.Set("new", "v")
+	if _, ok := cache.Get("new"); ok {
+		t.Error("缓存已满且没有过期条目时不应写入新结果")
+	}
+	if _, ok := cache.Get("k"); !ok {
+		t.Error("缓存已满时不应淘汰未过期的条目")
+	}
+}
+
+func TestExecuteCachesReadOnlyTools(t *testing.T) {
+	useGlobalClient(t, nil) // MCP 不可用，只读工具降级为直接调用 fake 商城
+
+	var searches atomic.Int32
+	shop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/products/search" {
+			http.NotFound(w, r)
+			return
+		}
+		searches.Add(1)
+		if r.URL.Query().Get("keyword") == "缺货" {
+			io.WriteString(w, `[]`)
+			return
+		}
+		io.WriteString(w, `[{"id":1,"name":"山地车","price":1999,"stock":3}]`)
+	}))
+	t.Cleanup(shop.Close)
+
+	executor := NewToolExecutor(shop.URL, nil)
+	executor.EnableResultCache(time.Minute)
+
+	steps := []struct {
+		name         string
+		tool         string
+		args         string
+		wantSearches int32
+	}{
+		{"首次查询", "search_product", `{"keyword":"山地车"}`, 1},
+		{"相同参数命中缓存", "search_product", `{"keyword":" 山地车 "}`, 1},
+		{"不同参数", "search_product", `{"keyword":"公路车"}`, 2},
+		{"未找到商品的结果不缓存", "search_product", `{"keyword":"缺货"}`, 3},
+		{"未找到商品的结果再次查询", "search_product", `{"keyword":"缺货"}`, 4},
+		{"修改订单的工具清空缓存", "cancel_order", `{"orderNumber":"ORD-1"}`, 4},
+		{"清空后重新查询", "search_product", `{"keyword":"山地车"}`, 5},
+	}
+	for _, step := range steps {
+		executor.Execute(step.tool, step.args)
+		if got := searches.Load(); got != step.wantSearches {
+			t.Fatalf("%s: 商城搜索请求数 = %d, want %d", step.name, got, step.wantSearches)
+		}
+	}
+}
+
+func TestExecuteWithoutCache(t *testing.T) {
+	useGlobalClient(t, nil)
+
+	var searches atomic.Int32
+	shop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searches.Add(1)
+		io.WriteString(w, `[{"id":1,"name":"山地车","price":1999,"stock":3}]`)
+	}))
+	t.Cleanup(shop.Close)
+
+	executor := NewToolExecutor(shop.URL, nil)
+	executor.EnableResultCache(0) // ttl 为 0 时不启用
+	for i := 0; i < 2; i++ {
+		if _, err := executor.Execute("search_product", `{"keyword":"山地车"}`); err != nil {
+			t.Fatalf("Execute 失败: %v", err)
+		}
+	}
+	if searches.Load() != 2 {
+		t.Errorf("未启用缓存时商城搜索请求数 = %d, want 2", searches.Load())
+	}
+}
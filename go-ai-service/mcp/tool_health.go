@@ -0,0 +1,94 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ToolHealth MCP 工具可用性检查结果
+type ToolHealth struct {
+	Healthy   bool      `json:"healthy"`
+	Tools     []string  `json:"tools"`             // MCP Server 当前声明的工具
+	Missing   []string  `json:"missing,omitempty"` // 缺失的必需工具
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// ToolHealthChecker 检查 MCP Server 是否声明了所有必需工具，工具列表在 ttl 内复用，避免每次探测都请求 MCP Server
+type ToolHealthChecker struct {
+	required []string
+	ttl      time.Duration
+
+	mu     sync.Mutex
+	last   ToolHealth
+	cached bool
+}
+
+// NewToolHealthChecker 创建工具可用性检查器，required 为必需的工具名称集合
+func NewToolHealthChecker(required map[string]bool, ttl time.Duration) *ToolHealthChecker {
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &ToolHealthChecker{required: names, ttl: ttl}
+}
+
+// Check 返回 MCP 工具可用性，缓存未过期时直接返回上次结果
+func (h *ToolHealthChecker) Check() ToolHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached && time.Since(h.last.CheckedAt) < h.ttl {
+		return h.last
+	}
+
+	h.last = h.check(GetMCPClient())
+	h.cached = true
+	return h.last
+}
+
+// check 列出 MCP Server 的工具并与必需工具比对
+func (h *ToolHealthChecker) check(client *MCPClient) ToolHealth {
+	health := ToolHealth{Tools: []string{}, CheckedAt: time.Now()}
+
+	var err error
+	switch {
+	case client == nil:
+		err = fmt.Errorf("MCP Client 未初始化")
+	case !client.Alive():
+		err = fmt.Errorf("MCP Server 连接已断开")
+	default:
+		var tools []string
+		if tools, err = client.ListTools(); err == nil && tools != nil {
+			health.Tools = tools
+		}
+	}
+	if err != nil {
+		health.Error = err.Error()
+		health.Missing = append([]string(nil), h.required...)
+		return health
+	}
+
+	health.Missing = missingTools(h.required, health.Tools)
+	health.Healthy = len(health.Missing) == 0
+	return health
+}
+
+// missingTools 返回 required 中未出现在 tools 里的工具
+func missingTools(required, tools []string) []string {
+	available := make(map[string]bool, len(tools))
+	for _, name := range tools {
+		available[name] = true
+	}
+
+	var missing []string
+	for _, name := range required {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -1,23 +1,52 @@
 package mcp
 
 import (
+	"encoding/json"
+	"fmt"
 	"go-ai-service/llm"
+	"strings"
+)
+
+// OrderStatuses 订单状态（与 Java 商城保持一致）
+var OrderStatuses = []string{"PENDING", "CONFIRMED", "SHIPPED", "DELIVERED", "CANCELLED"}
+
+// list_orders 分页的默认与最大每页订单数（与 MCP Server 保持一致）
+const (
+	DefaultOrderPageSize = 10
+	MaxOrderPageSize     = 50
 )
 
 // GetTools 获取所有工具定义
 func GetTools() []llm.Tool {
 	return []llm.Tool{
+		{
+			Type: "function",
+			Function: &llm.Function{
+				Name:        "search_product",
+				Description: "搜索商品。当用户询问商品信息、价格、库存时使用此工具。",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"keyword": map[string]interface{}{
+							"type":        "string",
+							"description": "商品名称关键词",
+						},
+					},
+					"required": []string{"keyword"},
+				},
+			},
+		},
 		{
 			Type: "function",
 			Function: &llm.Function{
 				Name:        "create_order",
-				Description: "创建新订单。当用户明确表达购买意图(如'我要买'、'帮我下单'、'购买')并提供了商品ID、数量、姓名、电话、收货地址等完整信息时,必须使用此工具创建订单。",
+				Description: "创建新订单。当用户明确表达购买意图(如'我要买'、'帮我下单'、'购买')并提供了商品名称、数量、姓名、电话、收货地址等完整信息时,必须使用此工具创建订单。",
 				Parameters: map[string]interface{}{
 					"type": "object",
 					"properties": map[string]interface{}{
-						"productId": map[string]interface{}{
-							"type":        "integer",
-							"description": "商品ID",
+						"productName": map[string]interface{}{
+							"type":        "string",
+							"description": "商品名称",
 						},
 						"quantity": map[string]interface{}{
 							"type":        "integer",
@@ -36,7 +65,7 @@ func GetTools() []llm.Tool {
 							"description": "收货地址",
 						},
 					},
-					"required": []string{"productId", "quantity", "customerName", "customerPhone", "shippingAddress"},
+					"required": []string{"productName", "quantity", "customerName", "customerPhone", "shippingAddress"},
 				},
 			},
 		},
@@ -44,7 +73,7 @@ func GetTools() []llm.Tool {
 			Type: "function",
 			Function: &llm.Function{
 				Name:        "query_order",
-				Description: "查询订单状态。当用户询问订单信息、订单状态、物流信息时使用此工具。",
+				Description: "查询订单状态。当用户询问订单信息、订单状态时使用此工具。",
 				Parameters: map[string]interface{}{
 					"type": "object",
 					"properties": map[string]interface{}{
@@ -57,6 +86,61 @@ func GetTools() []llm.Tool {
 				},
 			},
 		},
+		{
+			Type: "function",
+			Function: &llm.Function{
+				Name:        "track_shipment",
+				Description: "查询订单物流轨迹。当用户询问快递到哪了、物流进度、什么时候送到时使用此工具。",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"orderNumber": map[string]interface{}{
+							"type":        "string",
+							"description": "订单号,格式如 ORD-001",
+						},
+					},
+					"required": []string{"orderNumber"},
+				},
+			},
+		},
+		{
+			Type: "function",
+			Function: &llm.Function{
+				Name:        "list_orders",
+				Description: "按客户手机号列出订单(按下单时间倒序),可按下单日期范围和订单状态筛选并分页。当用户想查看自己的订单(如'我这周的所有订单'、'还没发货的订单')但没有提供订单号时使用此工具。",
+				Parameters: map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"customerPhone": map[string]interface{}{
+							"type":        "string",
+							"description": "客户手机号",
+						},
+						"startDate": map[string]interface{}{
+							"type":        "string",
+							"description": "下单日期起始(含),格式 YYYY-MM-DD,如'这周'为本周一;不限制时不要填写",
+						},
+						"endDate": map[string]interface{}{
+							"type":        "string",
+							"description": "下单日期截止(含),格式 YYYY-MM-DD;不限制时不要填写",
+						},
+						"status": map[string]interface{}{
+							"type":        "array",
+							"items":       map[string]interface{}{"type": "string", "enum": OrderStatuses},
+							"description": "订单状态筛选(可多选): PENDING 待处理、CONFIRMED 已确认、SHIPPED 已发货、DELIVERED 已送达、CANCELLED 已取消;不限制时不要填写",
+						},
+						"page": map[string]interface{}{
+							"type":        "integer",
+							"description": "页码,从 1 开始,默认 1",
+						},
+						"pageSize": map[string]interface{}{
+							"type":        "integer",
+							"description": fmt.Sprintf("每页订单数,默认 %d,最多 %d", DefaultOrderPageSize, MaxOrderPageSize),
+						},
+					},
+					"required": []string{"customerPhone"},
+				},
+			},
+		},
 		{
 			Type: "function",
 			Function: &llm.Function{
@@ -69,6 +153,10 @@ func GetTools() []llm.Tool {
 							"type":        "string",
 							"description": "要取消的订单号,格式如 ORD-001",
 						},
+						"reason": map[string]interface{}{
+							"type":        "string",
+							"description": "取消原因(可选),如'质量问题'、'不想要了',用户未说明时不要填写",
+						},
 					},
 					"required": []string{"orderNumber"},
 				},
@@ -76,3 +164,61 @@ func GetTools() []llm.Tool {
 		},
 	}
 }
+
+// toolFunction 返回指定工具的定义，未知工具返回 nil
+func toolFunction(toolName string) *llm.Function {
+	for _, tool := range GetTools() {
+		if tool.Function != nil && tool.Function.Name == toolName {
+			return tool.Function
+		}
+	}
+	return nil
+}
+
+// MissingRequiredArgs 根据工具定义的 required 列表检查缺失或为空的参数，返回缺失参数的描述
+func MissingRequiredArgs(toolName string, arguments string) []string {
+	function := toolFunction(toolName)
+	if function == nil {
+		return nil
+	}
+
+	required, _ := function.Parameters["required"].([]string)
+	if len(required) == 0 {
+		return nil
+	}
+
+	var args map[string]interface{}
+	if strings.TrimSpace(arguments) != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+
+	properties, _ := function.Parameters["properties"].(map[string]interface{})
+
+	var missing []string
+	for _, name := range required {
+		if value, ok := args[name]; ok && !isBlankArg(value) {
+			continue
+		}
+		label := name
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if description, ok := property["description"].(string); ok && description != "" {
+				label = description
+			}
+		}
+		missing = append(missing, label)
+	}
+
+	return missing
+}
+
+// isBlankArg 判断参数值是否为空
+func isBlankArg(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	default:
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package rag
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Chroma 请求的默认重试参数：重试间隔较短，避免 Chroma 重启期间过长地拖慢聊天回复
+const (
+	defaultChromaRetries    = 2
+	defaultChromaRetryDelay = 200 * time.Millisecond
+	maxChromaRetryDelay     = time.Second
+)
+
+// backoffDelay 第 attempt 次重试前的等待时间：base × 2^(attempt-1)，不超过 maxDelay，
+// 并在 [delay/2, delay] 内随机抖动，避免多个请求同时重试
+func backoffDelay(base, maxDelay time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+	delay := base
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// SetChromaRetry 设置 Chroma 请求遇到临时错误（连接被拒绝、503 等）时的重试次数与初始间隔
+func (c *ChromaClient) SetChromaRetry(retries int, delay time.Duration) {
+	if retries >= 0 {
+		c.chromaRetries = retries
+	}
+	if delay > 0 {
+		c.chromaRetryDelay = delay
+	}
+}
+
+// withChromaRetry 执行 Chroma 请求，遇到临时错误时按指数退避重试，其余错误直接返回
+func (c *ChromaClient) withChromaRetry(operation string, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || attempt >= c.chromaRetries || !isTransientChromaError(err) {
+			return err
+		}
+		delay := backoffDelay(c.chromaRetryDelay, maxChromaRetryDelay, attempt+1)
+		log.Printf("🔁 Chroma %s失败，%s 后重试（第 %d/%d 次）: %v", operation, delay, attempt+1, c.chromaRetries, err)
+		time.Sleep(delay)
+	}
+}
+
+// isTransientChromaError 判断是否为 Chroma 重启或过载期间的临时错误：连接被拒绝/重置、响应中断，或 502/503/504
+// 请求超时不重试（已经等待了完整的超时时间）
+func isTransientChromaError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "状态码 502") ||
+		strings.Contains(msg, "状态码 503") ||
+		strings.Contains(msg, "状态码 504") ||
+		strings.Contains(msg, "connection refused")
+}
@@ -0,0 +1,137 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		maxDelay time.Duration
+		attempt  int
+		want     time.Duration // 抖动前的间隔，结果应在 [want/2, want] 内
+	}{
+		{"第 1 次重试", 200 * time.Millisecond, time.Second, 1, 200 * time.Millisecond},
+		{"第 2 次重试翻倍", 200 * time.Millisecond, time.Second, 2, 400 * time.Millisecond},
+		{"第 3 次重试", 200 * time.Millisecond, time.Second, 3, 800 * time.Millisecond},
+		{"不超过上限", 200 * time.Millisecond, time.Second, 10, time.Second},
+		{"未配置间隔时使用 1 秒", 0, 30 * time.Second, 1, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				got := backoffDelay(tt.base, tt.maxDelay, tt.attempt)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoffDelay() = %s, want [%s, %s]", got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTransientChromaError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"连接被拒绝", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"连接被重置", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"响应中断", fmt.Errorf("读取响应失败: %w", io.ErrUnexpectedEOF), true},
+		{"EOF", io.EOF, true},
+		{"502", errors.New("查询失败 (状态码 502): bad gateway"), true},
+		{"503", errors.New("获取集合列表失败 (状态码 503): unavailable"), true},
+		{"504", errors.New("查询失败 (状态码 504): timeout"), true},
+		{"连接被拒绝的错误文本", errors.New("dial tcp 127.0.0.1:8000: connect: connection refused"), true},
+		{"请求超时", fmt.Errorf("查询失败: %w", timeoutError{}), false},
+		{"404", errors.New("查询失败 (状态码 404): not found"), false},
+		{"500", errors.New("查询失败 (状态码 500): internal"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientChromaError(tt.err); got != tt.want {
+				t.Errorf("isTransientChromaError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithChromaRetry(t *testing.T) {
+	transient := errors.New("查询失败 (状态码 503): unavailable")
+	permanent := errors.New("查询失败 (状态码 400): bad request")
+
+	tests := []struct {
+		name      string
+		retries   int
+		errs      []error // 每次调用返回的错误，用完后返回 nil
+		wantCalls int
+		wantError error
+	}{
+		{"首次成功", 2, nil, 1, nil},
+		{"临时错误后成功", 2, []error{transient, transient}, 3, nil},
+		{"重试次数用完", 2, []error{transient, transient, transient}, 3, transient},
+		{"其他错误不重试", 2, []error{permanent}, 1, permanent},
+		{"不重试", 0, []error{transient}, 1, transient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewChromaClient("127.0.0.1", "1", "test-key", nil)
+			client.SetChromaRetry(tt.retries, time.Millisecond)
+
+			calls := 0
+			err := client.withChromaRetry("查询", func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if err != tt.wantError {
+				t.Errorf("withChromaRetry error = %v, want %v", err, tt.wantError)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("调用次数 = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFindCollectionRetriesWhileChromaRestarts(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `[{"id":"col-1","name":"shop_knowledge"}]`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewChromaClient("127.0.0.1", "1", "test-key", server.Client())
+	client.baseURL = server.URL
+	client.SetChromaRetry(2, time.Millisecond)
+
+	id, found, err := client.findCollection("shop_knowledge")
+	if err != nil || !found || id != "col-1" {
+		t.Fatalf("findCollection() = %q, %v, %v, want col-1", id, found, err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("请求数 = %d, want 3", requests.Load())
+	}
+}
@@ -4,54 +4,140 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"go-ai-service/llm"
 	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	collectionName             = "shop_knowledge"
-	dashScopeEmbeddingAPI      = "https://dashscope.aliyuncs.com/api/v1/services/embeddings/text-embedding/text-embedding"
-	embeddingModel             = "text-embedding-v2"
-	defaultTopK                = 3
+	defaultCollectionName     = "shop_knowledge"
+	embeddingModel            = "text-embedding-v2"
+	defaultTopK               = 3
+	defaultEmbeddingMaxTokens = 2048 // text-embedding-v2 单条输入上限
 )
 
 // ChromaClient Chroma 向量数据库客户端
 type ChromaClient struct {
 	baseURL      string
 	apiKey       string
+	embeddingURL string
 	httpClient   *http.Client
+	embedClient  *http.Client // 嵌入请求使用的客户端（与 httpClient 共享连接池，超时单独配置）
 	tenant       string
 	database     string
 	collectionID string
+
+	collection    string             // 知识库集合名称（为空时使用 shop_knowledge）
+	collectionIDs *collectionIDCache // 各 tenant/database/集合 的集合 ID（WithTenant、WithCollection 派生的客户端共享）
+
+	embeddingMaxTokens int // 超出 token 上限时截断到的长度
+
+	embeddingRetries    int           // 批量嵌入失败后的重试次数
+	embeddingRetryDelay time.Duration // 重试间隔
+	embeddingSkipFailed bool          // 重试后仍失败时拆分批次，仅跳过出错的文档
+
+	embeddingSlots embeddingSemaphore // 导入时同时进行的批量嵌入请求数上限
+
+	distanceMetric string // 集合的距离度量（cosine/l2/ip），用于把检索距离换算为相关度
+
+	queryConcurrency int // 多查询检索时并发查询 Chroma 的上限
+
+	chromaRetries    int           // Chroma 临时错误（连接被拒绝、503 等）的重试次数
+	chromaRetryDelay time.Duration // 首次重试前的等待时间，之后按指数退避
+
+	metadataFields map[string]bool // 导入时写入的 metadata 字段白名单（为空表示全部保留）
+
+	rerankLLM   *llm.DashScopeClient // 重排序使用的 LLM 客户端（为空表示未启用）
+	rerankModel string
 }
 
-// NewChromaClient 创建新的 Chroma 客户端
-func NewChromaClient(host, port, apiKey string) *ChromaClient {
+// NewChromaClient 创建新的 Chroma 客户端，httpClient 为空时使用默认客户端
+func NewChromaClient(host, port, apiKey string, httpClient *http.Client) *ChromaClient {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
 	return &ChromaClient{
-		baseURL:    fmt.Sprintf("http://%s:%s", host, port),
-		apiKey:     apiKey,
-		httpClient: &http.Client{},
-		tenant:     "default_tenant",
-		database:   "default_database",
+		baseURL:      fmt.Sprintf("http://%s:%s", host, port),
+		apiKey:       apiKey,
+		embeddingURL: llm.DefaultBaseURL + llm.EmbeddingPath,
+		httpClient:   httpClient,
+		embedClient:  httpClient,
+		tenant:       DefaultTenant,
+		database:     DefaultDatabase,
+
+		collectionIDs: &collectionIDCache{ids: make(map[string]string)},
+
+		embeddingMaxTokens: defaultEmbeddingMaxTokens,
+		embeddingSlots:     make(embeddingSemaphore, defaultEmbeddingConcurrency),
+		queryConcurrency:   defaultQueryConcurrency,
+		chromaRetries:      defaultChromaRetries,
+		chromaRetryDelay:   defaultChromaRetryDelay,
+	}
+}
+
+// CollectionName 返回知识库集合名称
+func (c *ChromaClient) CollectionName() string {
+	if c.collection == "" {
+		return defaultCollectionName
+	}
+	return c.collection
+}
+
+// EmbeddingModel 返回嵌入模型名称
+func (c *ChromaClient) EmbeddingModel() string {
+	return embeddingModel
+}
+
+// SetDashScopeBaseURL 设置嵌入接口使用的 DashScope 服务地址
+func (c *ChromaClient) SetDashScopeBaseURL(baseURL string) {
+	if baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/"); baseURL != "" {
+		c.embeddingURL = baseURL + llm.EmbeddingPath
+	}
+}
+
+// SetEmbeddingTimeout 设置嵌入请求的超时时间（与 Chroma 查询、聊天请求的超时相互独立），timeout <= 0 时沿用共享客户端的超时
+func (c *ChromaClient) SetEmbeddingTimeout(timeout time.Duration) {
+	c.embedClient = llm.WithTimeout(c.httpClient, timeout)
+}
+
+// SetEmbeddingMaxTokens 设置嵌入模型的最大输入 token 数
+func (c *ChromaClient) SetEmbeddingMaxTokens(maxTokens int) {
+	if maxTokens > 0 {
+		c.embeddingMaxTokens = maxTokens
 	}
 }
 
 // Document 文档结构
 type Document struct {
-	ID       string  `json:"id"`
-	Text     string  `json:"text"`
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
 	Metadata map[string]interface{} `json:"metadata"`
-	Distance float64 `json:"distance"`
+	Distance float64                `json:"distance"`
+	Metric   string                 `json:"-"` // Distance 的距离度量（cosine/l2/ip），由检索时的客户端配置填入
 }
 
 // SearchKnowledge 搜索知识库
 func (c *ChromaClient) SearchKnowledge(query string, topK int) ([]Document, error) {
+	return c.SearchKnowledgeWithFilter(query, topK, nil)
+}
+
+// SearchKnowledgeWithFilter 按元数据过滤条件（Chroma where 语法）搜索知识库，where 为空时不过滤
+func (c *ChromaClient) SearchKnowledgeWithFilter(query string, topK int, where map[string]interface{}) ([]Document, error) {
 	if topK <= 0 {
 		topK = defaultTopK
 	}
 
-	log.Printf("🔍 搜索知识库: %s (Top %d)", query, topK)
+	if len(where) > 0 {
+		log.Printf("🔍 搜索知识库: %s (Top %d, 过滤条件 %v)", query, topK, where)
+	} else {
+		log.Printf("🔍 搜索知识库: %s (Top %d)", query, topK)
+	}
 
 	// 初始化 collection ID（首次调用时）
 	if c.collectionID == "" {
@@ -67,7 +153,7 @@ func (c *ChromaClient) SearchKnowledge(query string, topK int) ([]Document, erro
 	}
 
 	// 2. 在 Chroma 中查询
-	documents, err := c.queryChroma(embedding, topK)
+	documents, err := c.queryChroma(embedding, topK, where)
 	if err != nil {
 		return nil, fmt.Errorf("查询 Chroma 失败: %w", err)
 	}
@@ -77,8 +163,23 @@ func (c *ChromaClient) SearchKnowledge(query string, topK int) ([]Document, erro
 	return documents, nil
 }
 
-// generateEmbedding 使用 DashScope 生成嵌入向量
+// generateEmbedding 使用 DashScope 生成嵌入向量，超出 token 上限时截断后重试一次
 func (c *ChromaClient) generateEmbedding(text string) ([]float64, error) {
+	embedding, err := c.requestEmbedding(text)
+	if err == nil || !isTokenLimitError(err) {
+		return embedding, err
+	}
+
+	truncated, ok := truncateRunes(text, c.embeddingMaxTokens)
+	if !ok {
+		return nil, err
+	}
+	log.Printf("✂️  文本超出嵌入模型 token 上限，截断至 %d 字符后重试 (原长度 %d)", c.embeddingMaxTokens, len([]rune(text)))
+	return c.requestEmbedding(truncated)
+}
+
+// requestEmbedding 调用 DashScope Embedding API 生成单条文本的嵌入向量
+func (c *ChromaClient) requestEmbedding(text string) ([]float64, error) {
 	// DashScope Embedding API 标准格式
 	reqBody := map[string]interface{}{
 		"model": embeddingModel,
@@ -92,7 +193,7 @@ func (c *ChromaClient) generateEmbedding(text string) ([]float64, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", dashScopeEmbeddingAPI, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", c.embeddingURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -100,7 +201,7 @@ func (c *ChromaClient) generateEmbedding(text string) ([]float64, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.embedClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -150,16 +251,55 @@ func (c *ChromaClient) generateEmbedding(text string) ([]float64, error) {
 
 // initializeCollection 初始化集合 ID（从 Chroma v2 API 获取）
 func (c *ChromaClient) initializeCollection() error {
-	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections", c.baseURL, c.tenant, c.database)
+	// 查找 shop_knowledge 集合（兼容不同版本的列表格式与分页）
+	id, found, err := c.findCollection(c.CollectionName())
+	if err != nil {
+		return err
+	}
+	if found {
+		c.setCollectionID(id)
+		log.Printf("✅ 找到集合 '%s' (ID: %s, 数据库: %s)", c.CollectionName(), id, c.tenantKey())
+		return nil
+	}
+
+	return fmt.Errorf("集合 '%s' 在 %s 中不存在", c.CollectionName(), c.tenantKey())
+}
+
+// EnsureCollection 确保知识库集合存在，不存在时按指定的 HNSW 距离度量创建（幂等）
+func (c *ChromaClient) EnsureCollection(space string) error {
+	if space == "" {
+		space = "cosine"
+	}
+	switch space {
+	case "cosine", "l2", "ip":
+	default:
+		return fmt.Errorf("不支持的 HNSW 距离度量: %s", space)
+	}
+
+	url := c.collectionsURL()
+
+	reqBody := map[string]interface{}{
+		"name": c.CollectionName(),
+		"metadata": map[string]interface{}{
+			"hnsw:space": space,
+		},
+		"get_or_create": true,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("创建集合请求失败: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -168,31 +308,27 @@ func (c *ChromaClient) initializeCollection() error {
 		return err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("获取集合列表失败: %s", string(body))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("创建集合失败: %s", string(body))
 	}
 
-	var collections []map[string]interface{}
-	if err := json.Unmarshal(body, &collections); err != nil {
-		return err
+	var collection map[string]interface{}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return fmt.Errorf("解析集合信息失败: %w", err)
 	}
 
-	// 查找 shop_knowledge 集合
-	for _, col := range collections {
-		if name, ok := col["name"].(string); ok && name == collectionName {
-			if id, ok := col["id"].(string); ok {
-				c.collectionID = id
-				log.Printf("✅ 找到集合 '%s' (ID: %s)", collectionName, id)
-				return nil
-			}
-		}
+	id, ok := collection["id"].(string)
+	if !ok || id == "" {
+		return fmt.Errorf("创建集合失败: 响应中缺少集合 ID")
 	}
 
-	return fmt.Errorf("集合 '%s' 不存在", collectionName)
+	c.setCollectionID(id)
+	log.Printf("✅ 集合 '%s' 已就绪 (ID: %s, space: %s)", c.CollectionName(), id, space)
+	return nil
 }
 
-// queryChroma 在 Chroma v2 中查询（使用更新的 API）
-func (c *ChromaClient) queryChroma(embedding []float64, topK int) ([]Document, error) {
+// queryChroma 在 Chroma v2 中查询（使用更新的 API），where 不为空时按元数据过滤
+func (c *ChromaClient) queryChroma(embedding []float64, topK int, where map[string]interface{}) ([]Document, error) {
 	// 使用 Chroma v2 API 格式
 	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s/query", 
 		c.baseURL, c.tenant, c.database, c.collectionID)
@@ -202,34 +338,26 @@ func (c *ChromaClient) queryChroma(embedding []float64, topK int) ([]Document, e
 		"n_results":        topK,
 		"include":          []string{"documents", "metadatas", "distances"},
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	if len(where) > 0 {
+		reqBody["where"] = where
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
+	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Chroma 重启期间的临时错误（连接被拒绝、503 等）短暂退避后重试
+	var body []byte
+	err = c.withChromaRetry("查询", func() error {
+		var err error
+		body, err = c.postChroma(url, jsonData, "Chroma 查询错误")
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Chroma 查询错误 (状态码 %d): %s", resp.StatusCode, string(body))
-	}
-
 	var result struct {
 		IDs       [][]string                   `json:"ids"`
 		Documents [][]string                   `json:"documents"`
@@ -246,8 +374,9 @@ func (c *ChromaClient) queryChroma(embedding []float64, topK int) ([]Document, e
 	if len(result.Documents) > 0 && len(result.Documents[0]) > 0 {
 		for i := 0; i < len(result.Documents[0]); i++ {
 			doc := Document{
-				ID:   result.IDs[0][i],
-				Text: result.Documents[0][i],
+				ID:     result.IDs[0][i],
+				Text:   result.Documents[0][i],
+				Metric: c.DistanceMetric(),
 			}
 
 			if len(result.Metadatas) > 0 && len(result.Metadatas[0]) > i {
@@ -265,25 +394,276 @@ func (c *ChromaClient) queryChroma(embedding []float64, topK int) ([]Document, e
 	return documents, nil
 }
 
-// FormatContext 格式化检索到的上下文
-func FormatContext(documents []Document) string {
+// postChroma 向 Chroma 发送 JSON POST 请求并返回响应体，非 200 响应返回带状态码的错误（errPrefix 为错误描述）
+func (c *ChromaClient) postChroma(url string, jsonData []byte, errPrefix string) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s (状态码 %d): %s", errPrefix, resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// GetDocuments 按 ID 获取文档（Chroma v2 get 接口），按请求的顺序返回，不存在的 ID 会被忽略
+func (c *ChromaClient) GetDocuments(ids []string) ([]Document, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// 初始化 collection ID（首次调用时）
+	if c.collectionID == "" {
+		if err := c.initializeCollection(); err != nil {
+			return nil, fmt.Errorf("初始化集合失败: %w", err)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s/get",
+		c.baseURL, c.tenant, c.database, c.collectionID)
+
+	reqBody := map[string]interface{}{
+		"ids":     ids,
+		"include": []string{"documents", "metadatas"},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Chroma 获取文档错误 (状态码 %d): %s", resp.StatusCode, string(body))
+	}
+
+	// get 接口返回一维数组（与 query 的二维数组不同）
+	var result struct {
+		IDs       []string                 `json:"ids"`
+		Documents []string                 `json:"documents"`
+		Metadatas []map[string]interface{} `json:"metadatas"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]Document, len(result.IDs))
+	for i, id := range result.IDs {
+		doc := Document{ID: id}
+		if i < len(result.Documents) {
+			doc.Text = result.Documents[i]
+		}
+		if i < len(result.Metadatas) {
+			doc.Metadata = result.Metadatas[i]
+		}
+		found[id] = doc
+	}
+
+	// Chroma 不保证返回顺序，按请求顺序重新排列
+	documents := make([]Document, 0, len(found))
+	for _, id := range ids {
+		if doc, ok := found[id]; ok {
+			documents = append(documents, doc)
+			delete(found, id) // 请求中重复的 ID 只返回一次
+		}
+	}
+
+	return documents, nil
+}
+
+// documentEllipsis 单个文档超出长度上限被截断时追加的省略号
+const documentEllipsis = "…"
+
+// FormatContext 格式化检索到的上下文，maxDocRunes > 0 时每个文档正文最多保留 maxDocRunes 个字符
+func FormatContext(documents []Document, maxDocRunes int) string {
+	if len(documents) == 0 {
+		return ""
+	}
+
+	// 检索内容视为不可信数据，用分隔标签包裹并说明不得作为指令
+	context := untrustedContextHeader + "\n\n" + referenceOpenTag + "\n"
+	for i, doc := range documents {
+		context += fmt.Sprintf("%d. %s\n", i+1, escapeReferenceTags(clipDocumentText(doc.Text, maxDocRunes)))
+		if category, ok := doc.Metadata["category"].(string); ok {
+			context += fmt.Sprintf("   分类: %s\n", category)
+		}
+	}
+	context += referenceCloseTag + "\n"
+
+	return context
+}
+
+// isTokenLimitError 判断是否为输入超出 token 上限的错误
+func isTokenLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "range of input length") ||
+		strings.Contains(msg, "input length") ||
+		strings.Contains(msg, "too long") ||
+		(strings.Contains(msg, "token") && strings.Contains(msg, "exceed"))
+}
+
+// truncateRunes 按字符截断文本（避免截断多字节字符），返回是否发生截断
+// 中文文本中一个字符约对应一个 token，以字符数近似 token 数
+func truncateRunes(text string, maxRunes int) (string, bool) {
+	runes := []rune(text)
+	if maxRunes <= 0 || len(runes) <= maxRunes {
+		return text, false
+	}
+	return string(runes[:maxRunes]), true
+}
+
+// clipDocumentText 截断超长的文档正文并追加省略号，避免单个超长文档（如整页政策）挤占其他参考资料
+func clipDocumentText(text string, maxRunes int) string {
+	clipped, truncated := truncateRunes(text, maxRunes)
+	if !truncated {
+		return text
+	}
+	return strings.TrimRight(clipped, " \t\r\n") + documentEllipsis
+}
+
+// citationInstruction 要求模型标注引用的说明
+const citationInstruction = "回答中如使用了以上知识库信息,请在相应句子末尾用 [编号] 标注来源,例如 [1]。不要编造不存在的编号。"
+
+// FormatContextWithCitations 格式化检索到的上下文，并为每个文档标注引用编号 [n]，maxDocRunes 同 FormatContext
+func FormatContextWithCitations(documents []Document, maxDocRunes int) string {
 	if len(documents) == 0 {
 		return ""
 	}
 
-	context := "以下是相关的知识库信息:\n\n"
+	context := untrustedContextHeader + "\n\n" + referenceOpenTag + "\n"
 	for i, doc := range documents {
-		context += fmt.Sprintf("%d. %s\n", i+1, doc.Text)
+		title, _ := DocumentReference(doc)
+		context += fmt.Sprintf("[%d] (%s) %s\n", i+1, escapeReferenceTags(title), escapeReferenceTags(clipDocumentText(doc.Text, maxDocRunes)))
 		if category, ok := doc.Metadata["category"].(string); ok {
 			context += fmt.Sprintf("   分类: %s\n", category)
 		}
 	}
+	context += referenceCloseTag + "\n\n" + citationInstruction
 
 	return context
 }
 
-// generateBatchEmbeddings 批量生成嵌入向量
+// urlRegex 匹配文档正文中的链接
+var urlRegex = regexp.MustCompile(`https?://[^\s,，。;；)）]+`)
+
+// DocumentReference 返回文档的标题和链接（优先使用 metadata 中的 title/url，其次使用 ID 和正文中的链接）
+func DocumentReference(doc Document) (string, string) {
+	title, _ := doc.Metadata["title"].(string)
+	if title == "" {
+		if id, ok := doc.Metadata["id"].(string); ok && id != "" {
+			title = id
+		} else {
+			title = doc.ID
+		}
+	}
+
+	url, _ := doc.Metadata["url"].(string)
+	if url == "" {
+		url = urlRegex.FindString(doc.Text)
+	}
+
+	return title, url
+}
+
+// citationMarkerRegex 匹配回复中的引用标记 [n] 或 【n】
+var citationMarkerRegex = regexp.MustCompile(`[\[【](\d+)[\]】]`)
+
+// AppendCitations 根据回复中出现的引用标记，在末尾追加"参考资料"列表
+// 只包含实际检索到且被引用的文档；showRelevance 为 true 时在每条资料后标注相关度
+func AppendCitations(reply string, documents []Document, showRelevance bool) string {
+	seen := make(map[int]bool)
+	var refs []int
+	for _, match := range citationMarkerRegex.FindAllStringSubmatch(reply, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil || n < 1 || n > len(documents) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		refs = append(refs, n)
+	}
+
+	if len(refs) == 0 {
+		return reply
+	}
+	sort.Ints(refs)
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(reply, "\n"))
+	sb.WriteString("\n\n参考资料:\n")
+	for _, n := range refs {
+		title, url := DocumentReference(documents[n-1])
+		if url != "" {
+			sb.WriteString(fmt.Sprintf("[%d] %s - %s", n, title, url))
+		} else {
+			sb.WriteString(fmt.Sprintf("[%d] %s", n, title))
+		}
+		if showRelevance {
+			sb.WriteString(fmt.Sprintf("（相关度 %.0f%%）", documents[n-1].Relevance()*100))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// generateBatchEmbeddings 批量生成嵌入向量，超出 token 上限时截断过长文本后重试一次
 func (c *ChromaClient) generateBatchEmbeddings(texts []string) ([][]float64, error) {
+	embeddings, err := c.requestBatchEmbeddings(texts)
+	if err == nil || !isTokenLimitError(err) {
+		return embeddings, err
+	}
+
+	truncatedTexts := make([]string, len(texts))
+	truncatedCount := 0
+	for i, text := range texts {
+		truncated, ok := truncateRunes(text, c.embeddingMaxTokens)
+		if ok {
+			truncatedCount++
+			log.Printf("✂️  第 %d 条文本超出嵌入模型 token 上限，截断至 %d 字符 (原长度 %d)", i+1, c.embeddingMaxTokens, len([]rune(text)))
+		}
+		truncatedTexts[i] = truncated
+	}
+	if truncatedCount == 0 {
+		return nil, err
+	}
+
+	log.Printf("✂️  共截断 %d 条文本，重试批量嵌入", truncatedCount)
+	return c.requestBatchEmbeddings(truncatedTexts)
+}
+
+// requestBatchEmbeddings 调用 DashScope Embedding API 批量生成嵌入向量
+func (c *ChromaClient) requestBatchEmbeddings(texts []string) ([][]float64, error) {
 	if len(texts) == 0 {
 		return [][]float64{}, nil
 	}
@@ -301,7 +681,7 @@ func (c *ChromaClient) generateBatchEmbeddings(texts []string) ([][]float64, err
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", dashScopeEmbeddingAPI, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", c.embeddingURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -309,7 +689,7 @@ func (c *ChromaClient) generateBatchEmbeddings(texts []string) ([][]float64, err
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.embedClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -343,9 +723,13 @@ func (c *ChromaClient) generateBatchEmbeddings(texts []string) ([][]float64, err
 		return nil, fmt.Errorf("embedding API 错误: %s - %s", result.Code, result.Message)
 	}
 
-	// 转换结果，保持顺序
+	// 转换结果，按 text_index 保持与输入相同的顺序
 	embeddings := make([][]float64, len(texts))
 	for _, emb := range result.Output.Embeddings {
+		if emb.TextIndex < 0 || emb.TextIndex >= len(texts) {
+			log.Printf("⚠️  忽略越界的嵌入结果 text_index=%d (输入 %d 条)", emb.TextIndex, len(texts))
+			continue
+		}
 		embedding64 := make([]float64, len(emb.Embedding))
 		for i, v := range emb.Embedding {
 			embedding64[i] = float64(v)
@@ -356,28 +740,38 @@ func (c *ChromaClient) generateBatchEmbeddings(texts []string) ([][]float64, err
 	return embeddings, nil
 }
 
+// missingEmbeddings 返回缺少嵌入向量（为空或未返回）的输入索引
+func missingEmbeddings(embeddings [][]float64, count int) []int {
+	var missing []int
+	for i := 0; i < count; i++ {
+		if i >= len(embeddings) || len(embeddings[i]) == 0 {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
 // AddDocuments 添加文档到知识库（使用 Chroma v2 API）
-func (c *ChromaClient) AddDocuments(docs []Document) error {
+// 开启 embeddingSkipFailed 时无法生成嵌入向量的文档会被跳过，并记录在返回的报告中
+func (c *ChromaClient) AddDocuments(docs []Document) (AddReport, error) {
 	if len(docs) == 0 {
-		return nil
+		return AddReport{}, nil
 	}
 
 	// 初始化 collection ID（首次调用时）
 	if c.collectionID == "" {
 		if err := c.initializeCollection(); err != nil {
-			return fmt.Errorf("初始化集合失败: %w", err)
+			return AddReport{}, fmt.Errorf("初始化集合失败: %w", err)
 		}
 	}
 
 	// 生成嵌入向量
-	texts := make([]string, len(docs))
-	for i, doc := range docs {
-		texts[i] = doc.Text
-	}
-
-	embeddings, err := c.generateBatchEmbeddings(texts)
+	docs, embeddings, report, err := c.embedDocuments(docs)
 	if err != nil {
-		return fmt.Errorf("生成嵌入向量失败: %w", err)
+		return report, fmt.Errorf("生成嵌入向量失败: %w", err)
+	}
+	if len(docs) == 0 {
+		return report, nil
 	}
 
 	// 准备 Chroma 请求
@@ -385,10 +779,14 @@ func (c *ChromaClient) AddDocuments(docs []Document) error {
 	documents := make([]string, len(docs))
 	metadatas := make([]map[string]interface{}, len(docs))
 
+	dropped := make(map[string]bool)
 	for i, doc := range docs {
 		ids[i] = doc.ID
 		documents[i] = doc.Text
-		metadatas[i] = doc.Metadata
+		metadatas[i] = c.filterMetadata(doc.Metadata, dropped)
+	}
+	if len(dropped) > 0 {
+		log.Printf("🧹 丢弃不在白名单中的 metadata 字段: %s", strings.Join(sortedKeys(dropped), ", "))
 	}
 
 	// 使用 Chroma v2 API 格式
@@ -404,27 +802,28 @@ func (c *ChromaClient) AddDocuments(docs []Document) error {
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return report, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Chroma 添加文档错误 (状态码 %d): %s", resp.StatusCode, string(body))
+		return report, fmt.Errorf("Chroma 添加文档错误 (状态码 %d): %s", resp.StatusCode, string(body))
 	}
 
+	report.Added = len(docs)
 	log.Printf("✅ 成功添加 %d 条文档到 Chroma", len(docs))
-	return nil
+	return report, nil
 }
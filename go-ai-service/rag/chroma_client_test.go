@@ -0,0 +1,201 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// embedFunc 模拟嵌入接口：按输入文本返回状态码和响应体
+type embedFunc func(texts []string) (int, string)
+
+// embeddingsBody 为 indexes 中的输入生成嵌入接口的成功响应
+func embeddingsBody(indexes ...int) string {
+	var items []string
+	for _, i := range indexes {
+		items = append(items, fmt.Sprintf(`{"embedding":[0.1,0.2],"text_index":%d}`, i))
+	}
+	return `{"output":{"embeddings":[` + strings.Join(items, ",") + `]}}`
+}
+
+// fakeBackend 同时模拟 DashScope 嵌入接口和 Chroma 集合接口，记录写入 Chroma 的文档 ID
+type fakeBackend struct {
+	embed embedFunc
+
+	mu         sync.Mutex
+	embedCalls int
+	added      []string
+}
+
+func (b *fakeBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/text-embedding"):
+		var req struct {
+			Input struct {
+				Texts []string `json:"texts"`
+			} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		b.mu.Lock()
+		b.embedCalls++
+		b.mu.Unlock()
+		status, body := b.embed(req.Input.Texts)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	case strings.HasSuffix(r.URL.Path, "/add"):
+		var req struct {
+			IDs []string `json:"ids"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		b.mu.Lock()
+		b.added = append(b.added, req.IDs...)
+		b.mu.Unlock()
+		io.WriteString(w, "{}")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestChroma 创建指向 fakeBackend 的客户端（集合 ID 已解析，重试不等待）
+func newTestChroma(t *testing.T, embed embedFunc) (*ChromaClient, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{embed: embed}
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+
+	client := NewChromaClient("127.0.0.1", "1", "test-key", server.Client())
+	client.baseURL = server.URL
+	client.SetDashScopeBaseURL(server.URL)
+	client.SetEmbeddingRetry(0, 0, false)
+	client.setCollectionID("col-1")
+	return client, backend
+}
+
+// testDocs 按 ID 生成文档（正文与 ID 相同）
+func testDocs(ids ...string) []Document {
+	docs := make([]Document, len(ids))
+	for i, id := range ids {
+		docs[i] = Document{ID: id, Text: id}
+	}
+	return docs
+}
+
+func TestMissingEmbeddings(t *testing.T) {
+	tests := []struct {
+		name       string
+		embeddings [][]float64
+		count      int
+		want       []int
+	}{
+		{"全部存在", [][]float64{{1}, {2}}, 2, nil},
+		{"中间为空", [][]float64{{1}, nil, {3}}, 3, []int{1}},
+		{"结果少于输入", [][]float64{{1}}, 3, []int{1, 2}},
+		{"没有结果", nil, 2, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingEmbeddings(tt.embeddings, tt.count); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingEmbeddings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsRejectsMissingEmbeddings(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantError bool
+	}{
+		{"全部返回", embeddingsBody(0, 1, 2), false},
+		{"缺少部分结果", embeddingsBody(0), true},
+		{"越界的 text_index 被忽略", embeddingsBody(0, 1, 2, 7), false},
+		{"越界结果不能顶替缺失的结果", embeddingsBody(0, 1, 5), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, backend := newTestChroma(t, func([]string) (int, string) { return http.StatusOK, tt.body })
+
+			_, err := client.AddDocuments(testDocs("a", "b", "c"))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("AddDocuments error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError && len(backend.added) > 0 {
+				t.Errorf("缺少嵌入向量时不应写入 Chroma，实际写入 %v", backend.added)
+			}
+			if !tt.wantError && len(backend.added) != 3 {
+				t.Errorf("写入 Chroma 的文档 = %v, want 3 条", backend.added)
+			}
+		})
+	}
+}
+
+func TestClipDocumentText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxRunes int
+		want     string
+	}{
+		{"不限制", "退货政策：七天无理由退货", 0, "退货政策：七天无理由退货"},
+		{"负数视为不限制", "退货政策", -1, "退货政策"},
+		{"未超出上限", "退货政策", 4, "退货政策"},
+		{"按字符截断", "退货政策：七天无理由退货", 4, "退货政策…"},
+		{"截断处的空白去掉", "退货 \n政策", 3, "退货…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clipDocumentText(tt.text, tt.maxRunes); got != tt.want {
+				t.Errorf("clipDocumentText(%q, %d) = %q, want %q", tt.text, tt.maxRunes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatContext(t *testing.T) {
+	docs := []Document{
+		{ID: "policy", Text: "退货政策：七天无理由退货", Metadata: map[string]interface{}{"category": "售后", "title": "退货政策"}},
+		{ID: "shipping", Text: "全场包邮"},
+	}
+	tests := []struct {
+		name        string
+		format      func([]Document, int) string
+		maxDocRunes int
+		want        []string
+	}{
+		{"不限制长度", FormatContext, 0, []string{"1. 退货政策：七天无理由退货\n   分类: 售后\n", "2. 全场包邮\n"}},
+		{"截断超长文档", FormatContext, 4, []string{"1. 退货政策…\n", "2. 全场包邮\n"}},
+		{"带引用编号", FormatContextWithCitations, 0, []string{"[1] (退货政策) 退货政策：七天无理由退货\n", "[2] (shipping) 全场包邮\n", citationInstruction}},
+		{"带引用编号时截断", FormatContextWithCitations, 4, []string{"[1] (退货政策) 退货政策…\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.format(docs, tt.maxDocRunes)
+			if !strings.HasPrefix(got, untrustedContextHeader+"\n\n"+referenceOpenTag+"\n") || !strings.Contains(got, referenceCloseTag) {
+				t.Errorf("上下文没有用一对参考资料标签包裹: %q", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("上下文 = %q, want 包含 %q", got, want)
+				}
+			}
+		})
+	}
+
+	if got := FormatContext(nil, 0); got != "" {
+		t.Errorf("FormatContext(nil) = %q, want 空字符串", got)
+	}
+}
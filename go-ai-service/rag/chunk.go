@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChunkDocuments 将长文档按字数切分为多个片段（相邻片段重叠 overlap 个字），
+// 片段 ID 为 "<原ID>#<序号>"，元数据中记录原文档 ID 与片段序号；size <= 0 时不切分
+func ChunkDocuments(docs []Document, size, overlap int) []Document {
+	if size <= 0 {
+		return docs
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []Document
+	for _, doc := range docs {
+		runes := []rune(strings.TrimSpace(doc.Text))
+		if len(runes) <= size {
+			chunks = append(chunks, doc)
+			continue
+		}
+
+		index := 0
+		for start := 0; start < len(runes); start += size - overlap {
+			end := start + size
+			if end > len(runes) {
+				end = len(runes)
+			}
+
+			metadata := make(map[string]interface{}, len(doc.Metadata)+2)
+			for k, v := range doc.Metadata {
+				metadata[k] = v
+			}
+			metadata["source_id"] = doc.ID
+			metadata["chunk"] = index
+
+			chunks = append(chunks, Document{
+				ID:       fmt.Sprintf("%s#%d", doc.ID, index),
+				Text:     string(runes[start:end]),
+				Metadata: metadata,
+			})
+			index++
+
+			if end == len(runes) {
+				break
+			}
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,140 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// 分页获取集合列表的参数
+const (
+	collectionsPageSize = 100 // 每页请求的集合数
+	maxCollectionsPages = 50  // 最多翻页次数，避免服务端忽略分页参数时死循环
+)
+
+// collectionInfo 集合列表中的一项
+type collectionInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// collectionsPage 一页集合列表，next 为下一页的 offset（-1 表示服务端未给出）
+type collectionsPage struct {
+	Collections []collectionInfo
+	Next        int
+	HasMore     bool
+}
+
+// parseCollectionsPage 解析集合列表响应，兼容不同 Chroma 版本的返回格式：
+//   - 顶层数组：[{"id": ..., "name": ...}]
+//   - 包装对象：{"collections": [...]} 或 {"data": [...]}，可附带 next_offset / has_more 分页信息
+func parseCollectionsPage(body []byte) (collectionsPage, error) {
+	page := collectionsPage{Next: -1}
+
+	if err := json.Unmarshal(body, &page.Collections); err == nil {
+		return page, nil
+	}
+
+	var wrapped struct {
+		Collections *[]collectionInfo `json:"collections"`
+		Data        *[]collectionInfo `json:"data"`
+		NextOffset  *int              `json:"next_offset"`
+		HasMore     bool              `json:"has_more"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return page, fmt.Errorf("解析集合列表失败: %w", err)
+	}
+
+	switch {
+	case wrapped.Collections != nil:
+		page.Collections = *wrapped.Collections
+	case wrapped.Data != nil:
+		page.Collections = *wrapped.Data
+	default:
+		return page, fmt.Errorf("解析集合列表失败: 未知的响应格式: %s", truncateBody(body))
+	}
+	if wrapped.NextOffset != nil {
+		page.Next = *wrapped.NextOffset
+	}
+	page.HasMore = wrapped.HasMore
+	return page, nil
+}
+
+// findCollection 按名称查找集合 ID，集合列表分页时逐页查找
+func (c *ChromaClient) findCollection(name string) (string, bool, error) {
+	offset := 0
+	seen := make(map[string]bool)
+	for pages := 0; pages < maxCollectionsPages; pages++ {
+		var page collectionsPage
+		err := c.withChromaRetry("获取集合列表", func() error {
+			var err error
+			page, err = c.listCollectionsPage(offset, collectionsPageSize)
+			return err
+		})
+		if err != nil {
+			return "", false, err
+		}
+
+		fresh := 0
+		for _, col := range page.Collections {
+			if col.Name == name && col.ID != "" {
+				return col.ID, true, nil
+			}
+			if !seen[col.ID] {
+				seen[col.ID] = true
+				fresh++
+			}
+		}
+
+		// 服务端明确给出下一页时继续；否则本页未取满、忽略了分页参数（返回超过一页）或全是重复项时视为最后一页
+		switch {
+		case page.Next > offset:
+			offset = page.Next
+		case (page.HasMore || len(page.Collections) == collectionsPageSize) && fresh > 0:
+			offset += len(page.Collections)
+		default:
+			return "", false, nil
+		}
+	}
+	return "", false, nil
+}
+
+// listCollectionsPage 获取一页集合列表
+func (c *ChromaClient) listCollectionsPage(offset, limit int) (collectionsPage, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("offset", strconv.Itoa(offset))
+
+	req, err := http.NewRequest("GET", c.collectionsURL()+"?"+query.Encode(), nil)
+	if err != nil {
+		return collectionsPage{}, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return collectionsPage{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return collectionsPage{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return collectionsPage{}, fmt.Errorf("获取集合列表失败 (状态码 %d): %s", resp.StatusCode, string(body))
+	}
+	return parseCollectionsPage(body)
+}
+
+// truncateBody 截断响应体用于错误信息
+func truncateBody(body []byte) string {
+	const maxLen = 200
+	if len(body) > maxLen {
+		return string(body[:maxLen]) + "..."
+	}
+	return string(body)
+}
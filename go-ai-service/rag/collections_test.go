@@ -0,0 +1,143 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseCollectionsPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      collectionsPage
+		wantError bool
+	}{
+		{
+			name: "顶层数组",
+			body: `[{"id":"c1","name":"shop_knowledge"},{"id":"c2","name":"faq"}]`,
+			want: collectionsPage{Collections: []collectionInfo{{ID: "c1", Name: "shop_knowledge"}, {ID: "c2", Name: "faq"}}, Next: -1},
+		},
+		{
+			name: "collections 包装对象带分页信息",
+			body: `{"collections":[{"id":"c1","name":"faq"}],"next_offset":100,"has_more":true}`,
+			want: collectionsPage{Collections: []collectionInfo{{ID: "c1", Name: "faq"}}, Next: 100, HasMore: true},
+		},
+		{
+			name: "data 包装对象",
+			body: `{"data":[{"id":"c1","name":"faq"}]}`,
+			want: collectionsPage{Collections: []collectionInfo{{ID: "c1", Name: "faq"}}, Next: -1},
+		},
+		{
+			name: "空列表",
+			body: `{"collections":[]}`,
+			want: collectionsPage{Collections: []collectionInfo{}, Next: -1},
+		},
+		{name: "未知的对象格式", body: `{"items":[]}`, wantError: true},
+		{name: "不是 JSON", body: `<html>502</html>`, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCollectionsPage([]byte(tt.body))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("parseCollectionsPage error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCollectionsPage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// collectionList n 个集合，第 target 个（从 0 开始，-1 表示没有）名为 shop_knowledge
+func collectionList(n, target int) []collectionInfo {
+	list := make([]collectionInfo, n)
+	for i := range list {
+		list[i] = collectionInfo{ID: fmt.Sprintf("id-%d", i), Name: fmt.Sprintf("col-%d", i)}
+	}
+	if target >= 0 {
+		list[target].Name = "shop_knowledge"
+	}
+	return list
+}
+
+func TestFindCollection(t *testing.T) {
+	tests := []struct {
+		name         string
+		collections  []collectionInfo
+		format       string // array：顶层数组按 offset/limit 分页；wrapped：包装对象带 next_offset；ignore：忽略分页参数
+		wantID       string
+		wantFound    bool
+		wantRequests int32
+	}{
+		{"第一页找到", collectionList(3, 1), "array", "id-1", true, 1},
+		{"翻页后找到", collectionList(250, 220), "array", "id-220", true, 3},
+		{"按 next_offset 翻页", collectionList(150, 140), "wrapped", "id-140", true, 2},
+		{"不存在", collectionList(120, -1), "array", "", false, 2},
+		{"服务端忽略分页参数时只请求一次", collectionList(250, -1), "ignore", "", false, 1},
+		{"整页重复时停止翻页", collectionList(collectionsPageSize, -1), "ignore", "", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				page := tt.collections
+				if tt.format != "ignore" {
+					end := offset + limit
+					if end > len(page) {
+						end = len(page)
+					}
+					page = page[offset:end]
+				}
+				if tt.format == "wrapped" {
+					body := map[string]interface{}{"collections": page}
+					if offset+limit < len(tt.collections) {
+						body["next_offset"] = offset + limit
+					}
+					json.NewEncoder(w).Encode(body)
+					return
+				}
+				json.NewEncoder(w).Encode(page)
+			}))
+			t.Cleanup(server.Close)
+
+			client := NewChromaClient("127.0.0.1", "1", "test-key", server.Client())
+			client.baseURL = server.URL
+			client.SetChromaRetry(0, 0)
+
+			id, found, err := client.findCollection("shop_knowledge")
+			if err != nil {
+				t.Fatalf("findCollection 失败: %v", err)
+			}
+			if id != tt.wantID || found != tt.wantFound {
+				t.Errorf("findCollection() = %q, %v, want %q, %v", id, found, tt.wantID, tt.wantFound)
+			}
+			if requests.Load() != tt.wantRequests {
+				t.Errorf("请求数 = %d, want %d", requests.Load(), tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestFindCollectionReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewChromaClient("127.0.0.1", "1", "test-key", server.Client())
+	client.baseURL = server.URL
+	client.SetChromaRetry(0, 0)
+
+	if _, _, err := client.findCollection("shop_knowledge"); err == nil {
+		t.Error("获取集合列表失败时应返回错误")
+	}
+}
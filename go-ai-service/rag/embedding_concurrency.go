@@ -0,0 +1,87 @@
+package rag
+
+import (
+	"log"
+	"sync"
+)
+
+// 批量嵌入的默认参数
+const (
+	EmbeddingBatchSize          = 10 // 每次嵌入请求的文本数（DashScope text-embedding-v2 单次最多 25 条，/embed 接口使用相同的批次大小）
+	defaultEmbeddingConcurrency = 2  // 同时进行的批量嵌入请求数上限
+)
+
+// embeddingSemaphore 限制同时进行的批量嵌入请求数（WithTenant 派生的客户端共享同一个限制）
+type embeddingSemaphore chan struct{}
+
+// acquire 占用一个并发名额，名额用完时等待
+func (s embeddingSemaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+// release 释放并发名额
+func (s embeddingSemaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// SetEmbeddingConcurrency 设置导入知识库时同时进行的批量嵌入请求数上限（小于 1 时按 1 处理）
+func (c *ChromaClient) SetEmbeddingConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	c.embeddingSlots = make(embeddingSemaphore, concurrency)
+}
+
+// embedDocuments 为文档生成嵌入向量：按 EmbeddingBatchSize 拆分为多个批次，在并发上限内并行请求，
+// 返回成功嵌入的文档及对应向量（保持输入顺序）；任一批次失败时返回错误
+func (c *ChromaClient) embedDocuments(docs []Document) ([]Document, [][]float64, AddReport, error) {
+	if len(docs) <= EmbeddingBatchSize {
+		return c.embedDocumentBatch(docs)
+	}
+
+	type batchResult struct {
+		docs    []Document
+		vectors [][]float64
+		report  AddReport
+		err     error
+	}
+
+	batches := (len(docs) + EmbeddingBatchSize - 1) / EmbeddingBatchSize
+	results := make([]batchResult, batches)
+	log.Printf("🧮 批量嵌入 %d 条文档，拆分为 %d 批（并发上限 %d）", len(docs), batches, cap(c.embeddingSlots))
+
+	var wg sync.WaitGroup
+	for i := 0; i < batches; i++ {
+		start := i * EmbeddingBatchSize
+		end := start + EmbeddingBatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+
+		wg.Add(1)
+		go func(i int, batch []Document) {
+			defer wg.Done()
+			var result batchResult
+			result.docs, result.vectors, result.report, result.err = c.embedDocumentBatch(batch)
+			results[i] = result
+		}(i, docs[start:end])
+	}
+	wg.Wait()
+
+	var embedded []Document
+	var vectors [][]float64
+	var report AddReport
+	for _, result := range results {
+		report.Failed = append(report.Failed, result.report.Failed...)
+		if result.err != nil {
+			return nil, nil, report, result.err
+		}
+		embedded = append(embedded, result.docs...)
+		vectors = append(vectors, result.vectors...)
+	}
+	return embedded, vectors, report, nil
+}
@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyProbe 记录同时进行的嵌入请求数的峰值
+type concurrencyProbe struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+// embed 模拟耗时的嵌入请求，text 为 fail 开头时返回 400
+func (p *concurrencyProbe) embed(texts []string) (int, string) {
+	p.mu.Lock()
+	p.inFlight++
+	if p.inFlight > p.peak {
+		p.peak = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+
+	for _, text := range texts {
+		if text == "fail" {
+			return http.StatusBadRequest, `{"code":"InvalidParameter","message":"bad input"}`
+		}
+	}
+	return allEmbeddings(texts)
+}
+
+// numberedIDs 生成 n 个文档 ID
+func numberedIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc-%02d", i)
+	}
+	return ids
+}
+
+func TestAddDocumentsEmbeddingConcurrency(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		docs        int
+		wantPeak    int
+	}{
+		{"单个批次", 4, EmbeddingBatchSize, 1},
+		{"并发上限为 1 时逐批请求", 1, 5 * EmbeddingBatchSize, 1},
+		{"并发上限为 2", 2, 5 * EmbeddingBatchSize, 2},
+		{"批次数少于并发上限", 8, 3*EmbeddingBatchSize - 1, 3},
+		{"小于 1 时按 1 处理", 0, 3 * EmbeddingBatchSize, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probe := &concurrencyProbe{}
+			client, backend := newTestChroma(t, probe.embed)
+			client.SetEmbeddingConcurrency(tt.concurrency)
+
+			ids := numberedIDs(tt.docs)
+			report, err := client.AddDocuments(testDocs(ids...))
+			if err != nil {
+				t.Fatalf("AddDocuments 失败: %v", err)
+			}
+			if probe.peak != tt.wantPeak {
+				t.Errorf("同时进行的嵌入请求峰值 = %d, want %d", probe.peak, tt.wantPeak)
+			}
+			// 并行嵌入后仍按输入顺序写入
+			if !reflect.DeepEqual(backend.added, ids) || report.Added != tt.docs {
+				t.Errorf("写入 Chroma 的文档 = %v (report %+v), want %v", backend.added, report, ids)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsFailsWhenAnyBatchFails(t *testing.T) {
+	probe := &concurrencyProbe{}
+	client, backend := newTestChroma(t, probe.embed)
+	client.SetEmbeddingConcurrency(2)
+
+	ids := numberedIDs(3 * EmbeddingBatchSize)
+	ids[2*EmbeddingBatchSize+1] = "fail" // 第 3 批失败
+	if _, err := client.AddDocuments(testDocs(ids...)); err == nil {
+		t.Fatal("任一批次失败时 AddDocuments 应返回错误")
+	}
+	if len(backend.added) != 0 {
+		t.Errorf("批次失败时不应写入任何文档，实际写入 %d 条", len(backend.added))
+	}
+}
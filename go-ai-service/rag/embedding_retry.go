@@ -0,0 +1,152 @@
+package rag
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// EmbeddingFailure 无法生成嵌入向量而被跳过的文档
+type EmbeddingFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// AddReport 一次写入知识库的结果
+type AddReport struct {
+	Added  int                `json:"added"`
+	Failed []EmbeddingFailure `json:"failed,omitempty"`
+}
+
+// SetEmbeddingRetry 设置批量嵌入失败后的重试次数与间隔，skipFailed 为 true 时重试后仍失败的批次会被拆分，仅跳过出错的文档
+func (c *ChromaClient) SetEmbeddingRetry(retries int, delay time.Duration, skipFailed bool) {
+	if retries >= 0 {
+		c.embeddingRetries = retries
+	}
+	if delay >= 0 {
+		c.embeddingRetryDelay = delay
+	}
+	c.embeddingSkipFailed = skipFailed
+}
+
+// embedDocumentBatch 为一批文档生成嵌入向量，返回成功嵌入的文档及对应向量
+// 整批重试后仍失败时：未开启跳过则返回错误；开启则二分拆分批次定位出错的文档，其余文档照常写入
+func (c *ChromaClient) embedDocumentBatch(docs []Document) ([]Document, [][]float64, AddReport, error) {
+	var report AddReport
+
+	embeddings, err := c.embedBatchWithRetry(docs)
+	if err == nil {
+		return docs, embeddings, report, nil
+	}
+	if !c.embeddingSkipFailed || len(docs) == 0 || isBatchWideError(err) {
+		return nil, nil, report, err
+	}
+
+	log.Printf("⚠️  批量嵌入 %d 条文档失败，拆分批次定位出错的文档: %v", len(docs), err)
+	embedded, vectors, err := c.embedSplit(docs, err, &report)
+	if err != nil {
+		return nil, nil, report, err
+	}
+	if len(report.Failed) > 0 {
+		log.Printf("⚠️  %d/%d 条文档无法生成嵌入向量，已跳过", len(report.Failed), len(docs))
+	}
+	return embedded, vectors, report, nil
+}
+
+// maxRateLimitBackoff 被限流时退避等待的上限
+const maxRateLimitBackoff = 30 * time.Second
+
+// embedBatchWithRetry 批量生成嵌入向量，失败后按配置间隔重试；被限流时按指数退避（间隔逐次翻倍，带随机抖动）
+func (c *ChromaClient) embedBatchWithRetry(docs []Document) ([][]float64, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.embeddingRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.embeddingRetryDelay
+			if isRateLimitError(lastErr) {
+				delay = backoffDelay(c.embeddingRetryDelay, maxRateLimitBackoff, attempt)
+				log.Printf("🐢 批量嵌入被限流，%s 后重试（第 %d/%d 次）", delay, attempt, c.embeddingRetries)
+			} else {
+				log.Printf("🔁 重试批量嵌入（第 %d/%d 次）: %v", attempt, c.embeddingRetries, lastErr)
+			}
+			time.Sleep(delay)
+		}
+
+		embeddings, err := c.embedBatch(docs)
+		if err == nil {
+			return embeddings, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// embedBatch 批量生成嵌入向量，并确保每个文档都拿到了向量，避免向 Chroma 写入空向量
+func (c *ChromaClient) embedBatch(docs []Document) ([][]float64, error) {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
+	}
+
+	c.embeddingSlots.acquire()
+	embeddings, err := c.generateBatchEmbeddings(texts)
+	c.embeddingSlots.release()
+	if err != nil {
+		return nil, err
+	}
+	if missing := missingEmbeddings(embeddings, len(docs)); len(missing) > 0 {
+		return nil, fmt.Errorf("%d 条文档缺少嵌入向量 (索引 %v)", len(missing), missing)
+	}
+	return embeddings, nil
+}
+
+// embedSplit 将整体失败的批次二分后分别嵌入，单条文档仍失败时记录到报告中并跳过
+// 出现鉴权、限流等与具体文档无关的错误时停止拆分并返回错误
+func (c *ChromaClient) embedSplit(docs []Document, batchErr error, report *AddReport) ([]Document, [][]float64, error) {
+	if len(docs) == 1 {
+		log.Printf("⚠️  跳过无法生成嵌入向量的文档 %s: %v", docs[0].ID, batchErr)
+		report.Failed = append(report.Failed, EmbeddingFailure{ID: docs[0].ID, Error: batchErr.Error()})
+		return nil, nil, nil
+	}
+
+	var embedded []Document
+	var vectors [][]float64
+	mid := len(docs) / 2
+	for _, part := range [][]Document{docs[:mid], docs[mid:]} {
+		partVectors, err := c.embedBatch(part)
+		if err == nil {
+			embedded = append(embedded, part...)
+			vectors = append(vectors, partVectors...)
+			continue
+		}
+		if isBatchWideError(err) {
+			return nil, nil, err
+		}
+
+		partDocs, partVectors, err := c.embedSplit(part, err, report)
+		if err != nil {
+			return nil, nil, err
+		}
+		embedded = append(embedded, partDocs...)
+		vectors = append(vectors, partVectors...)
+	}
+	return embedded, vectors, nil
+}
+
+// isBatchWideError 判断是否为与具体文档无关的错误（鉴权失败、限流），这类错误拆分批次也无法恢复
+func isBatchWideError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "状态码 401") ||
+		strings.Contains(msg, "状态码 403") ||
+		strings.Contains(msg, "InvalidApiKey") ||
+		isRateLimitError(err)
+}
+
+// isRateLimitError 判断是否为限流错误（HTTP 429 或 DashScope Throttling 错误码）
+func isRateLimitError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "状态码 429") || strings.Contains(msg, "Throttling")
+}
@@ -0,0 +1,178 @@
+package rag
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// allEmbeddings 为全部输入返回嵌入向量
+func allEmbeddings(texts []string) (int, string) {
+	indexes := make([]int, len(texts))
+	for i := range texts {
+		indexes[i] = i
+	}
+	return http.StatusOK, embeddingsBody(indexes...)
+}
+
+// failingFirst 前 n 次调用返回 status，之后全部成功
+func failingFirst(n, status int, body string) embedFunc {
+	calls := 0
+	return func(texts []string) (int, string) {
+		calls++
+		if calls <= n {
+			return status, body
+		}
+		return allEmbeddings(texts)
+	}
+}
+
+// rejectingText 输入包含 bad 开头的文本时整批返回 400
+func rejectingText(texts []string) (int, string) {
+	for _, text := range texts {
+		if strings.HasPrefix(text, "bad") {
+			return http.StatusBadRequest, `{"code":"InvalidParameter","message":"bad input"}`
+		}
+	}
+	return allEmbeddings(texts)
+}
+
+func TestAddDocumentsRetriesEmbeddingBatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		status    int
+		wantError bool
+		wantCalls int
+		wantAdded int
+	}{
+		{"首次成功", 0, http.StatusInternalServerError, false, 1, 2},
+		{"重试一次后成功", 1, http.StatusInternalServerError, false, 2, 2},
+		{"用完重试次数后成功", 2, http.StatusInternalServerError, false, 3, 2},
+		{"重试后仍失败", 3, http.StatusInternalServerError, true, 3, 0},
+		{"被限流后退避重试", 2, http.StatusTooManyRequests, false, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, backend := newTestChroma(t, failingFirst(tt.failures, tt.status, `{"code":"InternalError"}`))
+			client.SetEmbeddingRetry(2, time.Millisecond, false)
+
+			report, err := client.AddDocuments(testDocs("a", "b"))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("AddDocuments error = %v, wantError %v", err, tt.wantError)
+			}
+			if backend.embedCalls != tt.wantCalls {
+				t.Errorf("嵌入接口调用次数 = %d, want %d", backend.embedCalls, tt.wantCalls)
+			}
+			if len(backend.added) != tt.wantAdded || (!tt.wantError && report.Added != tt.wantAdded) {
+				t.Errorf("写入 Chroma 的文档 = %v, report = %+v, want %d 条", backend.added, report, tt.wantAdded)
+			}
+		})
+	}
+}
+
+func TestAddDocumentsSkipsFailedDocuments(t *testing.T) {
+	tests := []struct {
+		name       string
+		docs       []Document
+		skipFailed bool
+		wantError  bool
+		wantAdded  []string
+		wantFailed []string
+	}{
+		{
+			name:       "跳过出错的文档，其余照常写入",
+			docs:       testDocs("a", "bad-1", "c", "d", "bad-2"),
+			skipFailed: true,
+			wantAdded:  []string{"a", "c", "d"},
+			wantFailed: []string{"bad-1", "bad-2"},
+		},
+		{
+			name:       "全部出错",
+			docs:       testDocs("bad-1", "bad-2"),
+			skipFailed: true,
+			wantAdded:  nil,
+			wantFailed: []string{"bad-1", "bad-2"},
+		},
+		{
+			name:      "未开启跳过时整批失败",
+			docs:      testDocs("a", "bad-1", "c"),
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, backend := newTestChroma(t, rejectingText)
+			client.SetEmbeddingRetry(1, time.Millisecond, tt.skipFailed)
+
+			report, err := client.AddDocuments(tt.docs)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("AddDocuments error = %v, wantError %v", err, tt.wantError)
+			}
+			if !reflect.DeepEqual(backend.added, tt.wantAdded) {
+				t.Errorf("写入 Chroma 的文档 = %v, want %v", backend.added, tt.wantAdded)
+			}
+			var failed []string
+			for _, failure := range report.Failed {
+				failed = append(failed, failure.ID)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("跳过的文档 = %v, want %v", failed, tt.wantFailed)
+			}
+			if report.Added != len(tt.wantAdded) {
+				t.Errorf("report.Added = %d, want %d", report.Added, len(tt.wantAdded))
+			}
+		})
+	}
+}
+
+func TestAddDocumentsDoesNotSplitOnBatchWideError(t *testing.T) {
+	client, backend := newTestChroma(t, func([]string) (int, string) {
+		return http.StatusUnauthorized, `{"code":"InvalidApiKey","message":"invalid key"}`
+	})
+	client.SetEmbeddingRetry(1, time.Millisecond, true)
+
+	if _, err := client.AddDocuments(testDocs("a", "b", "c", "d")); err == nil {
+		t.Fatal("鉴权失败时 AddDocuments 应返回错误")
+	}
+	// 首次调用加 1 次重试，之后不拆分批次
+	if backend.embedCalls != 2 {
+		t.Errorf("嵌入接口调用次数 = %d, want 2", backend.embedCalls)
+	}
+	if len(backend.added) != 0 {
+		t.Errorf("不应写入任何文档，实际写入 %v", backend.added)
+	}
+}
+
+func TestIsBatchWideError(t *testing.T) {
+	tests := []struct {
+		err           string
+		wantBatchWide bool
+		wantRateLimit bool
+	}{
+		{"embedding API 错误 (状态码 401): unauthorized", true, false},
+		{"embedding API 错误 (状态码 403): forbidden", true, false},
+		{"embedding API 错误: InvalidApiKey - invalid key", true, false},
+		{"embedding API 错误 (状态码 429): too many requests", true, true},
+		{"embedding API 错误: Throttling.RateQuota - rate limited", true, true},
+		{"embedding API 错误 (状态码 400): bad input", false, false},
+		{"2 条文档缺少嵌入向量 (索引 [0 1])", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err, func(t *testing.T) {
+			err := errors.New(tt.err)
+			if got := isBatchWideError(err); got != tt.wantBatchWide {
+				t.Errorf("isBatchWideError() = %v, want %v", got, tt.wantBatchWide)
+			}
+			if got := isRateLimitError(err); got != tt.wantRateLimit {
+				t.Errorf("isRateLimitError() = %v, want %v", got, tt.wantRateLimit)
+			}
+		})
+	}
+	if isRateLimitError(nil) {
+		t.Error("isRateLimitError(nil) = true")
+	}
+}
@@ -0,0 +1,49 @@
+package rag
+
+import "sort"
+
+// systemMetadataKeys 分块时记录的字段（原文档 ID 与分块序号），不受白名单限制
+var systemMetadataKeys = map[string]bool{
+	"source_id": true,
+	"chunk":     true,
+}
+
+// SetMetadataFields 设置导入时写入 Chroma 的 metadata 字段白名单，为空表示全部保留
+func (c *ChromaClient) SetMetadataFields(fields map[string]bool) {
+	if len(fields) == 0 {
+		c.metadataFields = nil
+		return
+	}
+	c.metadataFields = fields
+}
+
+// filterMetadata 只保留白名单中的 metadata 字段，丢弃的字段名记录到 dropped；
+// 过滤后为空时返回 nil（Chroma 不接受空的 metadata 对象）
+func (c *ChromaClient) filterMetadata(metadata map[string]interface{}, dropped map[string]bool) map[string]interface{} {
+	if c.metadataFields == nil || len(metadata) == 0 {
+		return metadata
+	}
+
+	filtered := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		if c.metadataFields[key] || systemMetadataKeys[key] {
+			filtered[key] = value
+		} else {
+			dropped[key] = true
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+	return filtered
+}
+
+// sortedKeys 返回按字母排序的键
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,109 @@
+package rag
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// defaultQueryConcurrency 多查询检索时并发查询 Chroma 的默认上限
+const defaultQueryConcurrency = 4
+
+// SetQueryConcurrency 设置多查询检索时并发查询 Chroma 的上限
+func (c *ChromaClient) SetQueryConcurrency(concurrency int) {
+	if concurrency > 0 {
+		c.queryConcurrency = concurrency
+	}
+}
+
+// SearchKnowledgeMulti 用多个查询检索知识库：一次批量调用生成全部查询向量，再以有限并发查询 Chroma
+// 结果按文档 ID 去重（保留最小距离），按距离升序返回；部分查询失败时返回其余查询的结果，全部失败才返回错误
+func (c *ChromaClient) SearchKnowledgeMulti(queries []string, topK int) ([]Document, error) {
+	if len(queries) == 0 {
+		return []Document{}, nil
+	}
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+
+	log.Printf("🔍 多查询检索知识库: %d 个查询 (Top %d)", len(queries), topK)
+
+	// 初始化 collection ID（在启动并发查询前完成，避免并发初始化）
+	if c.collectionID == "" {
+		if err := c.initializeCollection(); err != nil {
+			return nil, fmt.Errorf("初始化集合失败: %w", err)
+		}
+	}
+
+	// 1. 一次批量调用生成所有查询向量
+	embeddings, err := c.generateBatchEmbeddings(queries)
+	if err != nil {
+		return nil, fmt.Errorf("生成嵌入向量失败: %w", err)
+	}
+	if missing := missingEmbeddings(embeddings, len(queries)); len(missing) > 0 {
+		return nil, fmt.Errorf("生成嵌入向量失败: %d 个查询缺少嵌入向量 (索引 %v)", len(missing), missing)
+	}
+
+	// 2. 以有限并发查询 Chroma
+	concurrency := c.queryConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultQueryConcurrency
+	}
+
+	results := make([][]Document, len(queries))
+	errs := make([]error, len(queries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range queries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = c.queryChroma(embeddings[i], topK, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	// 3. 合并去重
+	var lastErr error
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			lastErr = err
+			log.Printf("⚠️  查询 %q 检索失败: %v", queries[i], err)
+		}
+	}
+	if failed == len(queries) {
+		return nil, fmt.Errorf("查询 Chroma 失败: %w", lastErr)
+	}
+
+	documents := mergeDocuments(results)
+	log.Printf("✅ 多查询共找到 %d 个相关文档（去重后）", len(documents))
+	return documents, nil
+}
+
+// mergeDocuments 合并多组检索结果，同一文档保留距离最小的一条，按距离升序排列
+func mergeDocuments(groups [][]Document) []Document {
+	index := make(map[string]int)
+	merged := []Document{}
+	for _, docs := range groups {
+		for _, doc := range docs {
+			if i, ok := index[doc.ID]; ok {
+				if doc.Distance < merged[i].Distance {
+					merged[i] = doc
+				}
+				continue
+			}
+			index[doc.ID] = len(merged)
+			merged = append(merged, doc)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Distance < merged[j].Distance
+	})
+	return merged
+}
@@ -0,0 +1,100 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-ai-service/llm"
+	"log"
+	"sort"
+	"strings"
+)
+
+// defaultRerankModel 重排序使用的低成本模型
+const defaultRerankModel = "qwen-turbo"
+
+// SetReranker 设置用于重排序的 LLM 客户端和模型
+func (c *ChromaClient) SetReranker(llmClient *llm.DashScopeClient, model string) {
+	if model == "" {
+		model = defaultRerankModel
+	}
+	c.rerankLLM = llmClient
+	c.rerankModel = model
+}
+
+// RerankDocuments 让 LLM 为每个文档与查询的相关性打分（0-10），保留得分最高的 keep 个文档
+func (c *ChromaClient) RerankDocuments(query string, docs []Document, keep int) ([]Document, error) {
+	if c.rerankLLM == nil {
+		return nil, fmt.Errorf("未配置重排序模型")
+	}
+	if keep <= 0 || keep > len(docs) {
+		keep = len(docs)
+	}
+	if len(docs) <= 1 {
+		return docs, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("用户问题: %s\n\n候选文档:\n", query))
+	for i, doc := range docs {
+		sb.WriteString(fmt.Sprintf("[%d] %s\n", i+1, doc.Text))
+	}
+	sb.WriteString(fmt.Sprintf("\n请为每个候选文档与用户问题的相关性打分(0-10 的整数,10 表示最相关)。"+
+		"只输出一个包含 %d 个分数的 JSON 数组,按文档编号顺序排列,例如 [8, 2, 5],不要输出其他内容。", len(docs)))
+
+	messages := []llm.Message{
+		{Role: "system", Content: "你是一个文档相关性评估助手。"},
+		{Role: "user", Content: sb.String()},
+	}
+
+	resp, err := c.rerankLLM.ChatWithModel(c.rerankModel, messages, nil)
+	if err != nil {
+		return nil, fmt.Errorf("重排序调用失败: %w", err)
+	}
+
+	scores, err := parseRerankScores(c.rerankLLM.GetTextResponse(resp), len(docs))
+	if err != nil {
+		return nil, err
+	}
+
+	type scoredDoc struct {
+		doc   Document
+		score float64
+	}
+	scored := make([]scoredDoc, len(docs))
+	for i, doc := range docs {
+		scored[i] = scoredDoc{doc: doc, score: scores[i]}
+	}
+
+	// 分数相同时保持原有的向量距离顺序
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	reranked := make([]Document, keep)
+	for i := 0; i < keep; i++ {
+		reranked[i] = scored[i].doc
+		log.Printf("   重排序 #%d: %s (得分 %.1f, 距离 %.4f)", i+1, scored[i].doc.ID, scored[i].score, scored[i].doc.Distance)
+	}
+
+	return reranked, nil
+}
+
+// parseRerankScores 从模型回复中解析分数数组
+func parseRerankScores(text string, expected int) ([]float64, error) {
+	start := strings.Index(text, "[")
+	end := strings.LastIndex(text, "]")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("重排序结果格式错误: %s", text)
+	}
+
+	var scores []float64
+	if err := json.Unmarshal([]byte(text[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("解析重排序分数失败: %w", err)
+	}
+
+	if len(scores) != expected {
+		return nil, fmt.Errorf("重排序分数数量不匹配: 期望 %d, 实际 %d", expected, len(scores))
+	}
+
+	return scores, nil
+}
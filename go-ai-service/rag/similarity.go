@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+)
+
+// defaultDistanceMetric 未配置时按 cosine 距离解读 Chroma 返回的距离（与 CHROMA_HNSW_SPACE 默认值一致）
+const defaultDistanceMetric = "cosine"
+
+// SetDistanceMetric 设置知识库集合的距离度量（cosine/l2/ip），用于把检索结果的距离换算为相关度
+func (c *ChromaClient) SetDistanceMetric(metric string) error {
+	switch metric {
+	case "cosine", "l2", "ip":
+		c.distanceMetric = metric
+		return nil
+	}
+	return fmt.Errorf("不支持的距离度量: %s", metric)
+}
+
+// DistanceMetric 返回当前使用的距离度量
+func (c *ChromaClient) DistanceMetric() string {
+	if c.distanceMetric == "" {
+		return defaultDistanceMetric
+	}
+	return c.distanceMetric
+}
+
+// Relevance 文档与查询的相关度（0~1，越大越相关），按检索时的距离度量换算，不同度量下可用同一阈值比较
+func (d Document) Relevance() float64 {
+	return Similarity(d.Distance, d.Metric)
+}
+
+// Similarity 将 Chroma 返回的距离换算为 0~1 的相似度（越大越相关）：
+// cosine/ip 距离为 1 - 相似度，l2 距离（平方欧氏距离）按 1/(1+d) 换算
+func Similarity(distance float64, space string) float64 {
+	var similarity float64
+	switch space {
+	case "cosine", "ip":
+		similarity = 1 - distance
+	default:
+		similarity = 1 / (1 + distance)
+	}
+	similarity = math.Max(0, math.Min(1, similarity))
+	return math.Round(similarity*10000) / 10000
+}
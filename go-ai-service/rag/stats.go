@@ -0,0 +1,158 @@
+package rag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// defaultHNSWSpace 集合未声明距离度量时 Chroma 使用的默认值
+const defaultHNSWSpace = "l2"
+
+// CollectionStats 知识库集合统计信息
+type CollectionStats struct {
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+	Count      int    `json:"count"`
+	Dimension  int    `json:"dimension"` // 嵌入向量维度（集合为空时为 0）
+	Space      string `json:"space"`     // HNSW 距离度量
+}
+
+// CountDocuments 返回知识库集合中的文档数（Chroma v2 count 接口）
+func (c *ChromaClient) CountDocuments() (int, error) {
+	// 初始化 collection ID（首次调用时）
+	if c.collectionID == "" {
+		if err := c.initializeCollection(); err != nil {
+			return 0, fmt.Errorf("初始化集合失败: %w", err)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s/count",
+		c.baseURL, c.tenant, c.database, c.collectionID)
+
+	body, err := c.getJSON(url)
+	if err != nil {
+		return 0, fmt.Errorf("获取文档数失败: %w", err)
+	}
+
+	var count int
+	if err := json.Unmarshal(body, &count); err != nil {
+		return 0, fmt.Errorf("解析文档数失败: %w", err)
+	}
+	return count, nil
+}
+
+// CollectionStats 返回集合的文档数、嵌入向量维度与距离度量
+func (c *ChromaClient) CollectionStats() (CollectionStats, error) {
+	count, err := c.CountDocuments()
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s",
+		c.baseURL, c.tenant, c.database, c.collectionID)
+
+	body, err := c.getJSON(url)
+	if err != nil {
+		return CollectionStats{}, fmt.Errorf("获取集合信息失败: %w", err)
+	}
+
+	var collection struct {
+		Dimension     *int                   `json:"dimension"`
+		Metadata      map[string]interface{} `json:"metadata"`
+		Configuration struct {
+			HNSW *struct {
+				Space string `json:"space"`
+			} `json:"hnsw"`
+		} `json:"configuration_json"`
+	}
+	if err := json.Unmarshal(body, &collection); err != nil {
+		return CollectionStats{}, fmt.Errorf("解析集合信息失败: %w", err)
+	}
+
+	stats := CollectionStats{
+		Collection: c.CollectionName(),
+		ID:         c.collectionID,
+		Count:      count,
+		Space:      defaultHNSWSpace,
+	}
+
+	// 距离度量：优先 metadata 中的 hnsw:space，其次新版本的 configuration_json
+	if space, ok := collection.Metadata["hnsw:space"].(string); ok && space != "" {
+		stats.Space = space
+	} else if collection.Configuration.HNSW != nil && collection.Configuration.HNSW.Space != "" {
+		stats.Space = collection.Configuration.HNSW.Space
+	}
+
+	// 维度：集合未返回时从一条已有文档的嵌入向量推断
+	if collection.Dimension != nil {
+		stats.Dimension = *collection.Dimension
+	} else if count > 0 {
+		dimension, err := c.sampleEmbeddingDimension()
+		if err != nil {
+			return CollectionStats{}, err
+		}
+		stats.Dimension = dimension
+	}
+
+	return stats, nil
+}
+
+// sampleEmbeddingDimension 读取一条文档的嵌入向量，返回其维度
+func (c *ChromaClient) sampleEmbeddingDimension() (int, error) {
+	url := fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections/%s/get",
+		c.baseURL, c.tenant, c.database, c.collectionID)
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"limit":   1,
+		"include": []string{"embeddings"},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, fmt.Errorf("获取嵌入向量失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("获取嵌入向量失败 (状态码 %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("解析嵌入向量失败: %w", err)
+	}
+	if len(result.Embeddings) == 0 {
+		return 0, nil
+	}
+	return len(result.Embeddings[0]), nil
+}
+
+// getJSON 发送 GET 请求并返回响应体（非 200 时返回错误）
+func (c *ChromaClient) getJSON(url string) ([]byte, error) {
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("状态码 %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,118 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 未配置时使用的 Chroma 默认 tenant/database
+const (
+	DefaultTenant   = "default_tenant"
+	DefaultDatabase = "default_database"
+)
+
+// collectionIDCache 按 tenant/database/集合名称 缓存已解析的集合 ID，同一客户端派生的各租户、各集合客户端共享
+type collectionIDCache struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// get 获取已缓存的集合 ID
+func (c *collectionIDCache) get(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ids[key]
+}
+
+// set 缓存集合 ID
+func (c *collectionIDCache) set(key, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids[key] = id
+}
+
+// SetTenant 设置客户端使用的 Chroma tenant/database，为空的参数使用默认值
+func (c *ChromaClient) SetTenant(tenant, database string) {
+	tenant, database = resolveTenant(tenant, database)
+	if tenant == c.tenant && database == c.database {
+		return
+	}
+	c.tenant = tenant
+	c.database = database
+	c.collectionID = c.collectionIDs.get(c.collectionKey())
+}
+
+// Tenant 返回客户端使用的 Chroma tenant 和 database
+func (c *ChromaClient) Tenant() (string, string) {
+	return c.tenant, c.database
+}
+
+// WithTenant 返回访问指定 tenant/database 的客户端（用于按请求切换商户知识库），
+// 与当前客户端相同时直接返回当前客户端；派生的客户端共享 HTTP 客户端、嵌入与重排序配置以及集合 ID 缓存
+func (c *ChromaClient) WithTenant(tenant, database string) *ChromaClient {
+	tenant, database = resolveTenant(tenant, database)
+	if tenant == c.tenant && database == c.database {
+		return c
+	}
+	scoped := *c
+	scoped.tenant = tenant
+	scoped.database = database
+	scoped.collectionID = c.collectionIDs.get(scoped.collectionKey())
+	return &scoped
+}
+
+// resolveTenant 为空的 tenant/database 使用默认值
+func resolveTenant(tenant, database string) (string, string) {
+	if tenant = strings.TrimSpace(tenant); tenant == "" {
+		tenant = DefaultTenant
+	}
+	if database = strings.TrimSpace(database); database == "" {
+		database = DefaultDatabase
+	}
+	return tenant, database
+}
+
+// tenantKey 当前 tenant/database（用于日志）
+func (c *ChromaClient) tenantKey() string {
+	return c.tenant + "/" + c.database
+}
+
+// collectionKey 集合 ID 缓存的键
+func (c *ChromaClient) collectionKey() string {
+	return c.tenantKey() + "/" + c.CollectionName()
+}
+
+// SetCollection 设置客户端默认使用的知识库集合，为空时使用 shop_knowledge
+func (c *ChromaClient) SetCollection(name string) {
+	name = strings.TrimSpace(name)
+	if name == c.CollectionName() {
+		return
+	}
+	c.collection = name
+	c.collectionID = c.collectionIDs.get(c.collectionKey())
+}
+
+// WithCollection 返回访问指定知识库集合的客户端（用于按请求切换集合，如 A/B 测试新旧知识库），
+// 为空或与当前集合相同时直接返回当前客户端；派生的客户端与 WithTenant 一样共享配置和集合 ID 缓存
+func (c *ChromaClient) WithCollection(name string) *ChromaClient {
+	name = strings.TrimSpace(name)
+	if name == "" || name == c.CollectionName() {
+		return c
+	}
+	scoped := *c
+	scoped.collection = name
+	scoped.collectionID = c.collectionIDs.get(scoped.collectionKey())
+	return &scoped
+}
+
+// setCollectionID 记录当前 tenant/database 下当前集合的 ID
+func (c *ChromaClient) setCollectionID(id string) {
+	c.collectionID = id
+	c.collectionIDs.set(c.collectionKey(), id)
+}
+
+// collectionsURL 当前 tenant/database 下的集合接口地址
+func (c *ChromaClient) collectionsURL() string {
+	return fmt.Sprintf("%s/api/v2/tenants/%s/databases/%s/collections", c.baseURL, c.tenant, c.database)
+}
@@ -0,0 +1,67 @@
+package rag
+
+import (
+	"testing"
+)
+
+func TestWithTenant(t *testing.T) {
+	client := NewChromaClient("chroma", "8000", "test-key", nil)
+	client.setCollectionID("default-col")
+
+	tests := []struct {
+		name         string
+		tenant       string
+		database     string
+		wantSame     bool
+		wantTenant   string
+		wantDatabase string
+		wantURL      string
+	}{
+		{"空参数使用默认值", " ", "", true, DefaultTenant, DefaultDatabase, "http://chroma:8000/api/v2/tenants/default_tenant/databases/default_database/collections"},
+		{"与当前相同", DefaultTenant, DefaultDatabase, true, DefaultTenant, DefaultDatabase, ""},
+		{"其他 database", "", "shop_b", false, DefaultTenant, "shop_b", "http://chroma:8000/api/v2/tenants/default_tenant/databases/shop_b/collections"},
+		{"其他 tenant 和 database", "shop_a", "knowledge", false, "shop_a", "knowledge", "http://chroma:8000/api/v2/tenants/shop_a/databases/knowledge/collections"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped := client.WithTenant(tt.tenant, tt.database)
+			if (scoped == client) != tt.wantSame {
+				t.Errorf("WithTenant 返回当前客户端 = %v, want %v", scoped == client, tt.wantSame)
+			}
+			if tenant, database := scoped.Tenant(); tenant != tt.wantTenant || database != tt.wantDatabase {
+				t.Errorf("Tenant() = %s/%s, want %s/%s", tenant, database, tt.wantTenant, tt.wantDatabase)
+			}
+			if tt.wantURL != "" && scoped.collectionsURL() != tt.wantURL {
+				t.Errorf("collectionsURL() = %s, want %s", scoped.collectionsURL(), tt.wantURL)
+			}
+		})
+	}
+
+	if tenant, database := client.Tenant(); tenant != DefaultTenant || database != DefaultDatabase {
+		t.Errorf("WithTenant 修改了原客户端: %s/%s", tenant, database)
+	}
+}
+
+func TestWithTenantSharesCollectionIDCache(t *testing.T) {
+	client := NewChromaClient("chroma", "8000", "test-key", nil)
+	client.setCollectionID("default-col")
+
+	shopA := client.WithTenant("shop_a", "knowledge")
+	if shopA.collectionID != "" {
+		t.Fatalf("其他 tenant 不应沿用默认集合 ID，实际为 %s", shopA.collectionID)
+	}
+	shopA.setCollectionID("shop-a-col")
+
+	// 之后派生的客户端直接使用已解析的集合 ID，切换回默认 tenant 时恢复默认集合 ID
+	if id := client.WithTenant("shop_a", "knowledge").collectionID; id != "shop-a-col" {
+		t.Errorf("再次派生的客户端集合 ID = %q, want shop-a-col", id)
+	}
+	client.SetTenant("shop_a", "knowledge")
+	if client.collectionID != "shop-a-col" {
+		t.Errorf("SetTenant 后集合 ID = %q, want shop-a-col", client.collectionID)
+	}
+	client.SetTenant("", "")
+	if client.collectionID != "default-col" {
+		t.Errorf("切换回默认 tenant 后集合 ID = %q, want default-col", client.collectionID)
+	}
+}
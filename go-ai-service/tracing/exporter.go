@@ -0,0 +1,263 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	exportBatchSize  = 100             // 每批导出的最大 span 数
+	exportInterval   = 5 * time.Second // 定时导出间隔
+	exportQueueSize  = 2048            // 待导出队列长度，满时丢弃新 span
+	exportTimeout    = 10 * time.Second
+	defaultService   = "go-ai-service"
+	otlpTracesSuffix = "/v1/traces"
+)
+
+// globalExporter 全局导出器（为空表示未启用追踪）
+var globalExporter *exporter
+
+// exporter 批量将 span 以 OTLP/HTTP JSON 格式导出
+type exporter struct {
+	endpoint       string
+	headers        map[string]string
+	serviceName    string
+	serviceVersion string
+	httpClient     *http.Client
+
+	queue    chan *Span
+	flushReq chan chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// Init 按 OpenTelemetry 标准环境变量初始化追踪，未配置导出地址时不启用：
+//   - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT / OTEL_EXPORTER_OTLP_ENDPOINT: OTLP/HTTP 地址
+//   - OTEL_EXPORTER_OTLP_HEADERS: 附加请求头（k1=v1,k2=v2）
+//   - OTEL_SERVICE_NAME: 服务名（默认 go-ai-service）
+//   - OTEL_TRACES_EXPORTER=none: 关闭追踪
+func Init(serviceVersion string) {
+	if strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		return
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return
+		}
+		endpoint = strings.TrimRight(base, "/") + otlpTracesSuffix
+	}
+
+	if protocol := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		log.Printf("⚠️  仅支持 OTLP http/json 协议，当前配置 %s，追踪未启用", protocol)
+		return
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = defaultService
+	}
+
+	globalExporter = &exporter{
+		endpoint:       endpoint,
+		headers:        parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		serviceName:    serviceName,
+		serviceVersion: serviceVersion,
+		httpClient:     &http.Client{Timeout: exportTimeout},
+		queue:          make(chan *Span, exportQueueSize),
+		flushReq:       make(chan chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	go globalExporter.run()
+
+	log.Printf("🔭 分布式追踪已启用: %s (服务名 %s)", endpoint, serviceName)
+}
+
+// Shutdown 导出剩余的 span 并停止导出器
+func Shutdown() {
+	if globalExporter == nil {
+		return
+	}
+	globalExporter.stopOnce.Do(func() {
+		done := make(chan struct{})
+		globalExporter.flushReq <- done
+		<-done
+		close(globalExporter.stopped)
+	})
+}
+
+// enqueue 提交待导出的 span，队列已满时丢弃
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		log.Printf("⚠️  追踪队列已满，丢弃 span: %s", span.name)
+	}
+}
+
+// run 导出循环：攒满一批或定时导出
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			log.Printf("⚠️  导出 %d 个 span 失败: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case done := <-e.flushReq:
+			// 取出队列中剩余的 span 后导出
+			for drained := false; !drained; {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					drained = true
+				}
+			}
+			flush()
+			close(done)
+		case <-e.stopped:
+			return
+		}
+	}
+}
+
+// export 以 OTLP/HTTP JSON 格式发送一批 span
+func (e *exporter) export(spans []*Span) error {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, span.toOTLP())
+	}
+
+	resourceAttrs := []map[string]interface{}{otlpAttribute("service.name", e.serviceName)}
+	if e.serviceVersion != "" {
+		resourceAttrs = append(resourceAttrs, otlpAttribute("service.version", e.serviceVersion))
+	}
+
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{"attributes": resourceAttrs},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": defaultService},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("OTLP 导出错误 (状态码 %d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// toOTLP 转换为 OTLP JSON 结构（trace/span ID 使用十六进制）
+func (s *Span) toOTLP() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := make([]map[string]interface{}, 0, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes = append(attributes, otlpAttribute(key, value))
+	}
+
+	status := map[string]interface{}{"code": 0} // STATUS_CODE_UNSET
+	if s.errMessage != "" {
+		status = map[string]interface{}{"code": 2, "message": s.errMessage} // STATUS_CODE_ERROR
+	}
+
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              int(s.kind),
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+	return span
+}
+
+// otlpAttribute 转换为 OTLP KeyValue
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var anyValue map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		anyValue = map[string]interface{}{"stringValue": v}
+	case bool:
+		anyValue = map[string]interface{}{"boolValue": v}
+	case int:
+		anyValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		anyValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		anyValue = map[string]interface{}{"doubleValue": v}
+	default:
+		anyValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return map[string]interface{}{"key": key, "value": anyValue}
+}
+
+// parseHeaders 解析 "k1=v1,k2=v2" 格式的请求头
+func parseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return headers
+}
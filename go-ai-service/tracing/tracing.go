@@ -0,0 +1,156 @@
+// Package tracing 轻量级分布式追踪：生成 W3C traceparent、记录 span 并通过 OTLP/HTTP (JSON) 导出。
+// 未配置导出地址时所有 span 为 nil，方法调用均为空操作。
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind OTLP span 类型
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span 一次操作的追踪记录（nil 表示未启用追踪）
+type Span struct {
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     SpanKind
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	errMessage string
+	ended      bool
+}
+
+// StartRoot 开始一个请求级的根 span；traceparent 为上游传入的 W3C 头，有效时沿用其 trace ID
+func StartRoot(name, traceparent string) *Span {
+	if globalExporter == nil {
+		return nil
+	}
+
+	traceID, parentID, ok := parseTraceparent(traceparent)
+	if !ok {
+		traceID = randomHex(16)
+		parentID = ""
+	}
+	return newSpan(traceID, parentID, name, KindServer)
+}
+
+// Child 开始一个子 span（s 为 nil 时返回 nil）
+func (s *Span) Child(name string, kind SpanKind) *Span {
+	if s == nil {
+		return nil
+	}
+	return newSpan(s.traceID, s.spanID, name, kind)
+}
+
+// SetAttribute 设置属性（支持 string / bool / int / int64 / float64）
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// RecordError 将 span 标记为失败
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.errMessage = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束 span 并提交导出（重复调用只生效一次）
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if globalExporter != nil {
+		globalExporter.enqueue(s)
+	}
+}
+
+// TraceID 返回 trace ID（s 为 nil 时为空）
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID
+}
+
+// Traceparent 返回用于向下游传播的 W3C traceparent 头（s 为 nil 时为空）
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+// newSpan 创建并开始一个 span
+func newSpan(traceID, parentID, name string, kind SpanKind) *Span {
+	return &Span{
+		traceID:    traceID,
+		spanID:     randomHex(8),
+		parentID:   parentID,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+}
+
+// parseTraceparent 解析 W3C traceparent 头: 00-<32位 trace ID>-<16位 span ID>-<flags>
+func parseTraceparent(header string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	if !isHex(parts[1]) || !isHex(parts[2]) ||
+		parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+// isHex 判断字符串是否为十六进制
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// randomHex 生成 n 字节的随机十六进制串
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// 随机数不可用时退化为时间戳，保证 ID 非零
+		return fmt.Sprintf("%0*x", n*2, time.Now().UnixNano())[:n*2]
+	}
+	return hex.EncodeToString(b)
+}
@@ -52,10 +52,18 @@ public class OrderController {
             .orElse(ResponseEntity.notFound().build());
     }
 
+    @GetMapping("/{orderNumber}/tracking")
+    public ResponseEntity<?> getTracking(@PathVariable String orderNumber) {
+        return orderService.getTracking(orderNumber)
+            .map(ResponseEntity::ok)
+            .orElse(ResponseEntity.notFound().build());
+    }
+
     @DeleteMapping("/{orderNumber}")
-    public ResponseEntity<?> cancelOrder(@PathVariable String orderNumber) {
+    public ResponseEntity<?> cancelOrder(@PathVariable String orderNumber,
+                                         @RequestParam(required = false) String reason) {
         try {
-            Order order = orderService.cancelOrder(orderNumber);
+            Order order = orderService.cancelOrder(orderNumber, reason);
             Map<String, Object> response = new HashMap<>();
             response.put("success", true);
             response.put("message", "订单已成功取消");
@@ -52,6 +52,14 @@ public class Order {
 
     private LocalDateTime updatedAt;
 
+    private String cancelReason;
+
+    private String trackingNumber;
+
+    private LocalDateTime shippedAt;
+
+    private LocalDateTime deliveredAt;
+
     @PrePersist
     protected void onCreate() {
         createdAt = LocalDateTime.now();
@@ -66,6 +74,22 @@ public class Order {
         updatedAt = LocalDateTime.now();
     }
 
+    /**
+     * 预计送达时间：已送达返回实际送达时间，已发货按发货后 3 天估算，未发货按下单后 5 天估算，已取消返回 null
+     */
+    public LocalDateTime getEstimatedDelivery() {
+        if (status == OrderStatus.CANCELLED) {
+            return null;
+        }
+        if (deliveredAt != null) {
+            return deliveredAt;
+        }
+        if (shippedAt != null) {
+            return shippedAt.plusDays(3);
+        }
+        return createdAt == null ? null : createdAt.plusDays(5);
+    }
+
     private String generateOrderNumber() {
         return "ORD-" + System.currentTimeMillis();
     }
@@ -9,7 +9,11 @@ import org.springframework.stereotype.Service;
 import org.springframework.transaction.annotation.Transactional;
 
 import java.math.BigDecimal;
+import java.time.LocalDateTime;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
 import java.util.List;
+import java.util.Map;
 import java.util.Optional;
 
 /**
@@ -84,6 +88,16 @@ public class OrderService {
         Order order = orderRepository.findByOrderNumber(orderNumber)
             .orElseThrow(() -> new RuntimeException("订单不存在"));
 
+        // 记录物流节点时间，发货时生成运单号
+        LocalDateTime now = LocalDateTime.now();
+        if (newStatus == Order.OrderStatus.SHIPPED && order.getShippedAt() == null) {
+            order.setShippedAt(now);
+            order.setTrackingNumber("SF" + System.currentTimeMillis());
+        }
+        if (newStatus == Order.OrderStatus.DELIVERED && order.getDeliveredAt() == null) {
+            order.setDeliveredAt(now);
+        }
+
         order.setStatus(newStatus);
         Order updatedOrder = orderRepository.save(order);
 
@@ -95,7 +109,7 @@ public class OrderService {
      * 取消订单
      */
     @Transactional
-    public Order cancelOrder(String orderNumber) {
+    public Order cancelOrder(String orderNumber, String reason) {
         Order order = orderRepository.findByOrderNumber(orderNumber)
             .orElseThrow(() -> new RuntimeException("订单不存在"));
 
@@ -110,9 +124,52 @@ public class OrderService {
 
         // 更新订单状态
         order.setStatus(Order.OrderStatus.CANCELLED);
+        order.setCancelReason(reason);
         Order cancelledOrder = orderRepository.save(order);
 
-        log.info("取消订单成功: {}", orderNumber);
+        log.info("取消订单成功: {}, 原因: {}", orderNumber, reason);
         return cancelledOrder;
     }
+
+    /**
+     * 查询订单物流轨迹（根据订单状态和时间节点生成）
+     */
+    public Optional<Map<String, Object>> getTracking(String orderNumber) {
+        return orderRepository.findByOrderNumber(orderNumber).map(order -> {
+            List<Map<String, Object>> events = new ArrayList<>();
+            events.add(trackingEvent(order.getCreatedAt(), "订单已提交", order.getShippingAddress()));
+
+            Order.OrderStatus status = order.getStatus();
+            if (status == Order.OrderStatus.CANCELLED) {
+                events.add(trackingEvent(order.getUpdatedAt(), "订单已取消", order.getCancelReason()));
+            } else {
+                if (status != Order.OrderStatus.PENDING) {
+                    events.add(trackingEvent(null, "商家已确认，正在备货", null));
+                }
+                if (order.getShippedAt() != null) {
+                    events.add(trackingEvent(order.getShippedAt(), "已发货", "运单号 " + order.getTrackingNumber()));
+                }
+                if (order.getDeliveredAt() != null) {
+                    events.add(trackingEvent(order.getDeliveredAt(), "已送达", order.getShippingAddress()));
+                }
+            }
+
+            Map<String, Object> tracking = new LinkedHashMap<>();
+            tracking.put("orderNumber", order.getOrderNumber());
+            tracking.put("status", status);
+            tracking.put("statusDescription", status.getDescription());
+            tracking.put("trackingNumber", order.getTrackingNumber());
+            tracking.put("shippingAddress", order.getShippingAddress());
+            tracking.put("events", events);
+            return tracking;
+        });
+    }
+
+    private Map<String, Object> trackingEvent(LocalDateTime time, String status, String detail) {
+        Map<String, Object> event = new LinkedHashMap<>();
+        event.put("time", time);
+        event.put("status", status);
+        event.put("detail", detail);
+        return event;
+    }
 }
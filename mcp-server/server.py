@@ -3,8 +3,12 @@ MCP Server - 提供订单管理工具服务
 使用 FastMCP 实现标准 MCP 协议
 """
 import os
+import re
+from datetime import date
+from typing import List, Optional, Union
+
 import requests
-from mcp.server.fastmcp import FastMCP
+from mcp.server.fastmcp import Context, FastMCP
 
 # 创建 MCP 服务器
 mcp = FastMCP("OrderManager")
@@ -12,9 +16,26 @@ mcp = FastMCP("OrderManager")
 # Java Shop API 地址
 JAVA_SHOP_URL = os.getenv("JAVA_SHOP_URL", "http://java-shop:8080")
 
+# list_orders 默认与最大每页订单数（与 Go 服务的工具定义保持一致）
+DEFAULT_ORDER_PAGE_SIZE = 10
+MAX_ORDER_PAGE_SIZE = 50
+
+
+def trace_headers(ctx: Context = None) -> dict:
+    """
+    从 MCP 请求的 _meta.traceparent 中取出追踪上下文，作为 HTTP 头传给 Java Shop
+    """
+    try:
+        meta = ctx.request_context.meta if ctx else None
+    except ValueError:
+        # 不在 MCP 请求上下文中
+        return {}
+    traceparent = getattr(meta, "traceparent", None) if meta else None
+    return {"traceparent": traceparent} if traceparent else {}
+
 
 @mcp.tool()
-def search_product(keyword: str) -> str:
+def search_product(keyword: str, ctx: Context = None) -> str:
     """
     搜索商品
     
@@ -26,7 +47,7 @@ def search_product(keyword: str) -> str:
     """
     try:
         url = f"{JAVA_SHOP_URL}/api/products/search?keyword={keyword}"
-        response = requests.get(url, timeout=10)
+        response = requests.get(url, headers=trace_headers(ctx), timeout=10)
         
         if response.status_code != 200:
             return f"❌ 搜索商品失败：HTTP {response.status_code}"
@@ -60,7 +81,8 @@ def create_order(
     quantity: int,
     customerName: str,
     customerPhone: str,
-    shippingAddress: str
+    shippingAddress: str,
+    ctx: Context = None
 ) -> str:
     """
     创建新订单
@@ -78,7 +100,7 @@ def create_order(
     try:
         # 1. 先搜索商品，获取商品ID
         search_url = f"{JAVA_SHOP_URL}/api/products/search?keyword={productName}"
-        search_response = requests.get(search_url, timeout=10)
+        search_response = requests.get(search_url, headers=trace_headers(ctx), timeout=10)
         
         if search_response.status_code != 200:
             return f"❌ 搜索商品失败：HTTP {search_response.status_code}"
@@ -104,7 +126,7 @@ def create_order(
             "shippingAddress": shippingAddress
         }
         
-        response = requests.post(url, json=payload, timeout=10)
+        response = requests.post(url, json=payload, headers=trace_headers(ctx), timeout=10)
         
         if response.status_code == 200:
             order = response.json()
@@ -132,7 +154,7 @@ def create_order(
 
 
 @mcp.tool()
-def query_order(orderNumber: str = None) -> str:
+def query_order(orderNumber: str = None, ctx: Context = None) -> str:
     """
     查询订单信息
     
@@ -140,11 +162,23 @@ def query_order(orderNumber: str = None) -> str:
         orderNumber: 订单号（可选，如果不提供则返回所有订单）
     
     Returns:
-        订单信息
+        指定订单号时返回订单 JSON（由 Go 服务渲染），否则返回订单列表
     """
     try:
+        # 如果指定了订单号，只返回该订单
+        if orderNumber:
+            url = f"{JAVA_SHOP_URL}/api/orders/{orderNumber}"
+            response = requests.get(url, headers=trace_headers(ctx), timeout=10)
+            
+            if response.status_code == 404:
+                return f"❌ 未找到订单：{orderNumber}"
+            if response.status_code != 200:
+                return f"❌ 查询订单失败：HTTP {response.status_code}"
+            
+            return response.text
+        
         url = f"{JAVA_SHOP_URL}/api/orders"
-        response = requests.get(url, timeout=10)
+        response = requests.get(url, headers=trace_headers(ctx), timeout=10)
         
         if response.status_code != 200:
             return f"❌ 查询订单失败：HTTP {response.status_code}"
@@ -154,27 +188,6 @@ def query_order(orderNumber: str = None) -> str:
         if not orders:
             return "📋 暂无订单记录"
         
-        # 如果指定了订单号，只返回该订单
-        if orderNumber:
-            target_order = None
-            for order in orders:
-                if order.get('orderNumber') == orderNumber:
-                    target_order = order
-                    break
-            
-            if not target_order:
-                return f"❌ 未找到订单：{orderNumber}"
-            
-            return f"""📋 订单详情
-
-订单号：{target_order.get('orderNumber')}
-商品ID：{target_order.get('productId')}
-数量：{target_order.get('quantity')}
-客户姓名：{target_order.get('customerName')}
-联系电话：{target_order.get('customerPhone')}
-收货地址：{target_order.get('shippingAddress')}
-订单状态：{target_order.get('status')}"""
-        
         # 返回所有订单
         result = f"📋 共有 {len(orders)} 个订单：\n\n"
         for order in orders:
@@ -194,19 +207,142 @@ def query_order(orderNumber: str = None) -> str:
 
 
 @mcp.tool()
-def cancel_order(orderNumber: str) -> str:
+def list_orders(
+    customerPhone: str,
+    startDate: str = "",
+    endDate: str = "",
+    status: Optional[Union[List[str], str]] = None,
+    page: int = 1,
+    pageSize: int = DEFAULT_ORDER_PAGE_SIZE,
+    ctx: Context = None
+) -> str:
+    """
+    按客户手机号列出订单（按下单时间倒序），可按下单日期范围和订单状态筛选并分页
+    
+    Args:
+        customerPhone: 客户手机号
+        startDate: 下单日期起始（含），格式 YYYY-MM-DD，可选
+        endDate: 下单日期截止（含），格式 YYYY-MM-DD，可选
+        status: 订单状态筛选（可多选，如 ["PENDING", "SHIPPED"] 或 "PENDING,SHIPPED"），可选
+        page: 页码，从 1 开始
+        pageSize: 每页订单数（最多 50）
+    
+    Returns:
+        订单列表（包含总数与分页信息）
+    """
+    try:
+        for value in (startDate, endDate):
+            if value:
+                try:
+                    date.fromisoformat(value)
+                except ValueError:
+                    return f"❌ 日期格式错误：{value}，应为 YYYY-MM-DD"
+        
+        if isinstance(status, str):
+            status = [s for s in re.split(r"[\s,，、]+", status) if s]
+        statuses = {s.upper() for s in status or []}
+        
+        page = max(page, 1)
+        pageSize = min(max(pageSize, 1), MAX_ORDER_PAGE_SIZE)
+        
+        url = f"{JAVA_SHOP_URL}/api/orders"
+        response = requests.get(url, headers=trace_headers(ctx), timeout=10)
+        
+        if response.status_code != 200:
+            return f"❌ 查询订单失败：HTTP {response.status_code}"
+        
+        orders = []
+        for o in response.json():
+            if o.get('customerPhone') != customerPhone:
+                continue
+            # 下单时间为 ISO 格式（如 2024-01-15T10:30:00），按前 10 位比较日期
+            created_date = (o.get('createdAt') or '')[:10]
+            if startDate and created_date < startDate:
+                continue
+            if endDate and created_date > endDate:
+                continue
+            if statuses and (o.get('status') or '').upper() not in statuses:
+                continue
+            orders.append(o)
+        
+        if not orders:
+            return "📋 暂无订单记录"
+        
+        orders.sort(key=lambda o: o.get('createdAt') or '', reverse=True)
+        
+        total = len(orders)
+        pages = (total + pageSize - 1) // pageSize
+        page_orders = orders[(page - 1) * pageSize:page * pageSize]
+        
+        if not page_orders:
+            return f"📋 共有 {total} 个订单，第 {page}/{pages} 页没有订单"
+        
+        result = f"📋 共有 {total} 个订单，第 {page}/{pages} 页：\n\n"
+        for order in page_orders:
+            product = order.get('product') or {}
+            result += f"订单号：{order.get('orderNumber')}\n"
+            result += f"商品：{product.get('name', '')}\n"
+            result += f"数量：{order.get('quantity')}\n"
+            result += f"状态：{order.get('status')}\n"
+            result += f"下单时间：{order.get('createdAt')}\n"
+            result += "---\n"
+        
+        if page < pages:
+            result += f"还有 {total - page * pageSize} 个订单未显示，可查看第 {page + 1} 页\n"
+        
+        return result
+        
+    except requests.exceptions.RequestException as e:
+        return f"❌ 查询订单失败：{str(e)}"
+    except Exception as e:
+        return f"❌ 系统错误：{str(e)}"
+
+
+@mcp.tool()
+def track_shipment(orderNumber: str, ctx: Context = None) -> str:
+    """
+    查询订单物流轨迹
+    
+    Args:
+        orderNumber: 订单号
+    
+    Returns:
+        物流信息（JSON，包含订单状态、运单号和物流节点）
+    """
+    try:
+        url = f"{JAVA_SHOP_URL}/api/orders/{orderNumber}/tracking"
+        response = requests.get(url, headers=trace_headers(ctx), timeout=10)
+        
+        if response.status_code == 404:
+            return f"❌ 未找到订单：{orderNumber}"
+        if response.status_code != 200:
+            return f"❌ 查询物流失败：HTTP {response.status_code}"
+        
+        # 返回 JSON，由 Go 服务渲染物流时间线
+        return response.text
+        
+    except requests.exceptions.RequestException as e:
+        return f"❌ 查询物流失败：{str(e)}"
+    except Exception as e:
+        return f"❌ 系统错误：{str(e)}"
+
+
+@mcp.tool()
+def cancel_order(orderNumber: str, reason: str = "", ctx: Context = None) -> str:
     """
     取消订单
     
     Args:
         orderNumber: 订单号
+        reason: 取消原因（可选，如"质量问题"、"不想要了"）
     
     Returns:
         取消结果
     """
     try:
         url = f"{JAVA_SHOP_URL}/api/orders/{orderNumber}"
-        response = requests.delete(url, timeout=10)
+        params = {"reason": reason} if reason else None
+        response = requests.delete(url, params=params, headers=trace_headers(ctx), timeout=10)
         
         if response.status_code == 200:
             return f"✅ 订单 {orderNumber} 已成功取消"